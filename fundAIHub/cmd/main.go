@@ -1,16 +1,17 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"database/sql"
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
+	"sync"
+	"syscall"
 	"time"
 
 	"FundAIHub/internal/api"
@@ -18,137 +19,194 @@ import (
 	"FundAIHub/internal/config"
 	"FundAIHub/internal/db"
 	"FundAIHub/internal/firebase_admin"
+	"FundAIHub/internal/metrics"
 	"FundAIHub/internal/middleware"
 	"FundAIHub/internal/storage"
+	"FundAIHub/internal/webhook"
 
 	_ "github.com/joho/godotenv/autoload"
 )
 
-type SupabaseStorage struct {
-	projectURL string
-	apiKey     string
-	bucketName string
-	client     *http.Client
-}
+// replicateToMirror copies every stored content object missing from the
+// mirror, once at startup and then on each tick. Each object is copied from
+// the backend its record names.
+func replicateToMirror(ctx context.Context, store *db.ContentStore, backends *storage.Registry, mirror storage.StorageService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		contents, err := store.ListStored(ctx)
+		if err != nil {
+			log.Printf("[Replicator] Failed to list stored content: %v", err)
+		} else {
+			keys := make(map[string][]string)
+			for _, c := range contents {
+				name := c.StorageBackend
+				if name == "" {
+					name = db.DefaultStorageBackend
+				}
+				keys[name] = append(keys[name], c.StorageKey.String)
+			}
+			for name, backendKeys := range keys {
+				primary, err := backends.Get(name)
+				if err != nil {
+					log.Printf("[Replicator] Skipping %d objects: %v", len(backendKeys), err)
+					continue
+				}
+				if copied := storage.NewReplicator(primary, mirror).Sync(ctx, backendKeys); copied > 0 {
+					log.Printf("[Replicator] Copied %d objects from %s to mirror", copied, name)
+				}
+			}
+		}
 
-func NewSupabaseStorage(projectURL, apiKey, bucketName string) *SupabaseStorage {
-	return &SupabaseStorage{
-		projectURL: projectURL,
-		apiKey:     apiKey,
-		bucketName: bucketName,
-		client:     &http.Client{Timeout: 30 * time.Second},
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 }
 
-func (s *SupabaseStorage) Upload(ctx context.Context, file io.Reader, filename string, contentType string) (*storage.FileInfo, error) {
-	uploadURL := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.projectURL, s.bucketName, filename)
-	req, err := http.NewRequestWithContext(ctx, "POST", uploadURL, file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create upload request: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+s.apiKey)
-	req.Header.Set("Content-Type", contentType)
-	req.Header.Set("x-upsert", "true") // Overwrite if exists
-
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute upload request: %w", err)
-	}
-	defer resp.Body.Close()
+// verifyChecksumsPeriodically re-hashes stored objects against their recorded
+// checksums on each tick
+func verifyChecksumsPeriodically(ctx context.Context, store *db.ContentStore, backends *storage.Registry, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		report, err := api.VerifyChecksums(ctx, store, backends)
+		if err != nil {
+			log.Printf("[ChecksumVerifier] Verification pass failed: %v", err)
+			continue
+		}
+		log.Printf("[ChecksumVerifier] Checked %d objects: %d ok, %d mismatched, %d failed",
+			report.Checked, report.OK, report.Mismatched, report.Failed)
 	}
-
-	log.Printf("[SupabaseStorage] Upload successful for %s. Status: %d", filename, resp.StatusCode)
-
-	return &storage.FileInfo{
-		Key:         filename,
-		ContentType: contentType,
-	}, nil
 }
 
-func (s *SupabaseStorage) Download(ctx context.Context, key string) (io.ReadCloser, *storage.FileInfo, error) {
-	downloadURL := fmt.Sprintf("%s/storage/v1/object/authenticated/%s/%s", s.projectURL, s.bucketName, key)
-	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create download request: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+// purgeDownloadsPeriodically deletes finished downloads older than the
+// retention window on each tick
+func purgeDownloadsPeriodically(ctx context.Context, store *db.ContentStore, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to execute download request: %w", err)
+		purged, err := store.PurgeOldDownloads(ctx, retention, nil)
+		if err != nil {
+			log.Printf("[DownloadPurge] Purge failed: %v", err)
+			continue
+		}
+		log.Printf("[DownloadPurge] Purged %d finished downloads older than %s", purged, retention)
 	}
+}
 
-	if resp.StatusCode == http.StatusNotFound {
-		resp.Body.Close()
-		return nil, nil, fmt.Errorf("file not found in storage: %s", key)
-	}
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return nil, nil, fmt.Errorf("download failed with status %d: %s", resp.StatusCode, string(bodyBytes))
-	}
+// markStaleDownloadsPeriodically marks downloads whose device stopped
+// reporting as stale on each tick
+func markStaleDownloadsPeriodically(ctx context.Context, store *db.ContentStore, olderThan, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 
-	fileInfo := &storage.FileInfo{
-		Key:         key,
-		Size:        resp.ContentLength,
-		ContentType: resp.Header.Get("Content-Type"),
-	}
-	lastModified := resp.Header.Get("Last-Modified")
-	if lastModified != "" {
-		tm, err := time.Parse(http.TimeFormat, lastModified)
-		if err == nil {
-			fileInfo.UpdatedAt = tm
+		marked, err := store.MarkStaleDownloads(ctx, olderThan)
+		if err != nil {
+			log.Printf("[StaleDownloads] Check failed: %v", err)
+			continue
 		}
+		log.Printf("[StaleDownloads] Marked %d downloads not updated for %s as stale", marked, olderThan)
 	}
-
-	return resp.Body, fileInfo, nil
 }
 
-func (s *SupabaseStorage) Delete(ctx context.Context, key string) error {
-	deleteURL := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.projectURL, s.bucketName, key)
-	payload := map[string][]string{"prefixes": {key}}
-	payloadBytes, _ := json.Marshal(payload)
-
-	req, err := http.NewRequestWithContext(ctx, "DELETE", deleteURL, bytes.NewReader(payloadBytes))
-	if err != nil {
-		return fmt.Errorf("failed to create delete request: %w", err)
+// serveMetrics serves /metrics alone on addr until ctx is done, so it can be
+// kept off the public listener and scraped without admin credentials
+func serveMetrics(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	log.Printf("Metrics listening on %s", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("[Metrics] Listener on %s failed: %v", addr, err)
 	}
-	req.Header.Set("Authorization", "Bearer "+s.apiKey)
-	req.Header.Set("Content-Type", "application/json")
+}
 
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to execute delete request: %w", err)
-	}
-	defer resp.Body.Close()
+// expireUploadSessionsPeriodically deletes chunked upload sessions past
+// their TTL, and their chunks, on each tick
+func expireUploadSessionsPeriodically(ctx context.Context, contentHandler *api.ContentHandler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("delete failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		expired, err := contentHandler.ExpireUploadSessions(ctx)
+		if err != nil {
+			log.Printf("[UploadSessions] Cleanup failed: %v", err)
+			continue
+		}
+		if expired > 0 {
+			log.Printf("[UploadSessions] Deleted %d expired upload sessions", expired)
+		}
 	}
-	log.Printf("[SupabaseStorage] Delete successful for key: %s", key)
-	return nil
 }
 
-func (s *SupabaseStorage) GetInfo(ctx context.Context, key string) (*storage.FileInfo, error) {
-	log.Printf("[SupabaseStorage] GetInfo called for %s (using placeholder logic)", key)
-	return nil, fmt.Errorf("GetInfo not fully implemented for SupabaseStorage")
+// connTracker counts connections with a request in progress, so shutdown
+// can report how many it waited on
+type connTracker struct {
+	mu     sync.Mutex
+	active map[net.Conn]struct{}
 }
 
-func (s *SupabaseStorage) ListFiles(ctx context.Context) ([]storage.FileInfo, error) {
-	log.Printf("[SupabaseStorage] ListFiles called (using placeholder logic)")
-	return nil, fmt.Errorf("ListFiles not fully implemented for SupabaseStorage")
+func newConnTracker() *connTracker {
+	return &connTracker{active: make(map[net.Conn]struct{})}
 }
 
-var _ storage.StorageService = (*SupabaseStorage)(nil)
+// track is an http.Server ConnState hook
+func (t *connTracker) track(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state == http.StateActive {
+		t.active[c] = struct{}{}
+	} else {
+		delete(t.active, c)
+	}
+}
+
+// Active returns the number of connections serving a request
+func (t *connTracker) Active() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.active)
+}
 
 func main() {
-	ctx := context.Background()
+	// Background workers stop on SIGTERM/SIGINT; requests in flight do not,
+	// since the server gives them their own contexts
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 	cfg := config.GetConfig()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	log.Printf("Running in %s mode", cfg.Environment)
 	log.Printf("Using FundaVault URL: %s", cfg.FundaVaultURL)
@@ -164,12 +222,21 @@ func main() {
 	log.Println("Successfully connected to database")
 
 	store := db.NewContentStore(database)
+	store.EnableCache(cfg.ContentCacheSize, cfg.ContentCacheTTL)
+	store.SetQueryTimeout(cfg.DBQueryTimeout)
 
-	storageInstance := NewSupabaseStorage(
+	supabaseRetry := storage.RetryPolicy{
+		Attempts:  cfg.SupabaseRetryAttempts,
+		BaseDelay: cfg.SupabaseRetryDelay,
+		Writes:    cfg.SupabaseRetryWrites,
+	}
+	storageInstance := storage.NewSupabaseStorage(
 		os.Getenv("SUPABASE_URL"),
 		os.Getenv("SUPABASE_KEY"),
 		"content",
 	)
+	storageInstance.SetListPageSize(cfg.StorageListPageSize)
+	storageInstance.SetRetryPolicy(supabaseRetry)
 	log.Printf("[Debug] Initialized storage with URL: %s", os.Getenv("SUPABASE_URL"))
 
 	firebaseService, err := firebase_admin.NewFirebaseAdminService(ctx)
@@ -179,66 +246,126 @@ func main() {
 
 	fundaVault := auth.NewFundaVaultClient(cfg)
 	authMiddleware := middleware.NewAuthMiddleware(fundaVault)
+	authMiddleware.SetEmbedTokenSecret(cfg.EmbedTokenSecret)
+	authMiddleware.EnableVerificationCache(cfg.DeviceVerifyCacheSize, cfg.DeviceVerifyCacheTTL)
+	if cfg.RateLimitPerMinute > 0 {
+		limiter := middleware.NewRateLimiter(cfg.RateLimitPerMinute, cfg.RateLimitBurst)
+		authMiddleware.SetRateLimiter(limiter)
+		go limiter.RunCleanup(ctx, time.Minute)
+		log.Printf("Rate limit: %d requests a minute per device, bursts of %d", cfg.RateLimitPerMinute, cfg.RateLimitBurst)
+	}
 	firebaseHandler := api.NewFirebaseHandler(firebaseService)
 
-	downloadHandler := api.NewDownloadHandler(store, storageInstance)
+	// Each content record names the backend holding its object; new uploads
+	// go to the configured one
+	backends := storage.NewRegistry(db.DefaultStorageBackend, storageInstance)
+	if cfg.LocalStorageRoot != "" {
+		backends.Register("local", storage.NewLocalStorage(cfg.LocalStorageRoot))
+		log.Printf("Local storage enabled: %s", cfg.LocalStorageRoot)
+	}
+	if cfg.S3Bucket != "" {
+		backends.Register("s3", storage.NewS3Storage(storage.S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+		}))
+		log.Printf("S3 storage enabled: bucket %s", cfg.S3Bucket)
+	}
+	if err := backends.SetActive(cfg.StorageBackend); err != nil {
+		log.Fatalf("Invalid STORAGE_BACKEND: %v", err)
+	}
+	resilient := func(svc storage.StorageService) storage.StorageService {
+		return storage.NewResilient(svc, cfg.StorageRetryAttempts, cfg.StorageRetryDelay)
+	}
+
+	downloadHandler := api.NewDownloadHandler(store, resilient(storageInstance))
+	downloadHandler.SetBackends(backends.Wrap(resilient))
+	if err := downloadHandler.EnableTransforms(cfg.DownloadTransforms); err != nil {
+		log.Fatalf("Invalid DOWNLOAD_TRANSFORMS: %v", err)
+	}
+	contentHandler := api.NewContentHandler(store, storageInstance)
+	contentHandler.SetBackends(backends)
+	adminHandler := api.NewAdminHandler(store, backends)
+	adminHandler.SetContext(ctx)
+	deviceViewHandler := api.NewDeviceViewHandler(store, downloadHandler, fundaVault)
+	go deviceViewHandler.RunLimiterCleanup(ctx, time.Minute)
+	handoffHandler := api.NewHandoffHandler(store, fundaVault)
+
+	if cfg.MirrorSupabaseURL != "" {
+		mirror := storage.NewSupabaseStorage(cfg.MirrorSupabaseURL, cfg.MirrorSupabaseKey, cfg.MirrorBucket)
+		mirror.SetRetryPolicy(supabaseRetry)
+		downloadHandler.SetMirror(storage.NewResilient(mirror, cfg.StorageRetryAttempts, cfg.StorageRetryDelay))
+		go replicateToMirror(ctx, store, backends, mirror, cfg.MirrorReplicationInterval)
+		log.Printf("Mirror storage enabled: %s (bucket %s)", cfg.MirrorSupabaseURL, cfg.MirrorBucket)
+	}
+	if cfg.ArchiveSupabaseURL != "" {
+		cold := storage.NewSupabaseStorage(cfg.ArchiveSupabaseURL, cfg.ArchiveSupabaseKey, cfg.ArchiveBucket)
+		cold.SetRetryPolicy(supabaseRetry)
+		archiver := api.NewArchiver(ctx, store, backends, cold)
+		downloadHandler.SetArchiver(archiver)
+		adminHandler.SetArchiver(archiver)
+		log.Printf("Archive storage enabled: %s (bucket %s)", cfg.ArchiveSupabaseURL, cfg.ArchiveBucket)
+	}
+	if cfg.ChecksumVerifyInterval > 0 {
+		go verifyChecksumsPeriodically(ctx, store, backends, cfg.ChecksumVerifyInterval)
+	}
+	if cfg.DownloadPurgeInterval > 0 {
+		go purgeDownloadsPeriodically(ctx, store, cfg.DownloadRetention, cfg.DownloadPurgeInterval)
+	}
+	if cfg.StaleDownloadCheckInterval > 0 {
+		go markStaleDownloadsPeriodically(ctx, store, cfg.StaleDownloadAfter, cfg.StaleDownloadCheckInterval)
+	}
+	if cfg.UploadSessionCleanupInterval > 0 {
+		go expireUploadSessionsPeriodically(ctx, contentHandler, cfg.UploadSessionCleanupInterval)
+	}
+	webhooks := webhook.NewDispatcher(store, cfg.WebhookMaxAttempts, cfg.WebhookRetryDelay, cfg.WebhookWorkers)
+	webhooks.SetAllowPrivateTargets(cfg.WebhookAllowPrivateTargets)
+	go webhooks.Run(ctx)
+	contentHandler.SetWebhooks(webhooks)
+	adminHandler.SetWebhooks(webhooks)
+
+	// Probes are registered ahead of, and outside, device authentication
+	http.HandleFunc("/healthz", api.Healthz)
+	readiness := map[string]api.ReadinessCheck{
+		"database":   database.PingContext,
+		"fundavault": fundaVault.Ping,
+	}
+	// Every registered backend, since records in each are still served
+	for _, name := range backends.Names() {
+		svc, _ := backends.Get(name)
+		readiness["storage:"+name] = func(ctx context.Context) error {
+			return storage.Ping(ctx, svc)
+		}
+	}
+	http.HandleFunc("/readyz", api.Readyz(cfg.ReadinessTimeout, readiness))
 
 	http.HandleFunc("/api/downloads/start",
 		authMiddleware.AuthenticateDevice(downloadHandler.StartDownload))
 	http.HandleFunc("/api/downloads/status",
 		authMiddleware.AuthenticateDevice(downloadHandler.UpdateStatus))
+	http.HandleFunc("/api/downloads/cancel",
+		authMiddleware.AuthenticateDevice(downloadHandler.CancelDownload))
 	http.HandleFunc("/api/downloads/history",
 		authMiddleware.AuthenticateDevice(downloadHandler.GetHistory))
+	// Also reachable with an embed token; see AllowEmbedToken before adding
+	// other routes
 	http.HandleFunc("/api/downloads/url",
-		authMiddleware.AuthenticateDevice(downloadHandler.GetDownloadURL))
-
-	http.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("[Debug] Received upload request")
-
-		file, header, err := r.FormFile("file")
-		if err != nil {
-			log.Printf("[Error] Reading form file: %v", err)
-			http.Error(w, "Could not read file", http.StatusBadRequest)
-			return
-		}
-		defer file.Close()
-
-		log.Printf("[Debug] File: %s, Size: %d", header.Filename, header.Size)
-
-		fileInfo, err := storageInstance.Upload(r.Context(), file, header.Filename, header.Header.Get("Content-Type"))
-		if err != nil {
-			log.Printf("[Error] Upload failed: %v", err)
-			http.Error(w, "Upload failed", http.StatusInternalServerError)
-			return
-		}
-
-		log.Printf("[Success] File uploaded: %s", fileInfo.Key)
-
-		contentTypeFromHeader := header.Header.Get("Content-Type")
-		if err := store.Create(r.Context(), &db.Content{
-			Name:        header.Filename,
-			Type:        "linux-app",
-			Version:     r.FormValue("version"),
-			Description: r.FormValue("description"),
-			AppVersion:  r.FormValue("app_version"),
-			AppType:     r.FormValue("app_type"),
-			FilePath:    fileInfo.Key,
-			Size:        int(header.Size),
-			StorageKey:  sql.NullString{String: fileInfo.Key, Valid: true},
-			ContentType: sql.NullString{String: contentTypeFromHeader, Valid: contentTypeFromHeader != ""},
-		}); err != nil {
-			log.Printf("[Error] Database insert failed: %v", err)
-			storageInstance.Delete(r.Context(), fileInfo.Key)
-			http.Error(w, "Failed to create content record", http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"message": "File uploaded successfully",
-			"key":     fileInfo.Key,
-		})
-	})
+		authMiddleware.AllowEmbedToken(downloadHandler.GetDownloadURL))
+	http.HandleFunc("/api/downloads/handoff",
+		authMiddleware.AuthenticateDevice(handoffHandler.Claim))
+	http.HandleFunc("/api/downloads/plan",
+		authMiddleware.AuthenticateDevice(downloadHandler.GetPlan))
+
+	http.HandleFunc("/upload",
+		authMiddleware.AdminOnly(contentHandler.UploadFile))
+	http.HandleFunc("/api/uploads",
+		authMiddleware.AdminOnly(contentHandler.InitiateUpload))
+	http.HandleFunc("/api/uploads/chunk",
+		authMiddleware.AdminOnly(contentHandler.UploadChunk))
+	http.HandleFunc("/api/uploads/finalize",
+		authMiddleware.AdminOnly(contentHandler.FinalizeUpload))
 
 	http.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
 		key := r.URL.Query().Get("key")
@@ -264,22 +391,134 @@ func main() {
 		}
 	})
 
-	http.HandleFunc("/api/content/list", func(w http.ResponseWriter, r *http.Request) {
-		contents, err := store.List(r.Context())
-		if err != nil {
-			log.Printf("[Error] Failed to list content (deprecated route): %v", err)
-			http.Error(w, "Failed to list content", http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(contents)
-	})
+	// Deprecated alias of /api/content, kept for older clients
+	http.HandleFunc("/api/content/list",
+		authMiddleware.AuthenticateDevice(contentHandler.List))
+
+	http.HandleFunc("/api/content",
+		authMiddleware.AuthenticateDevice(contentHandler.List))
+	http.HandleFunc("/api/content/version",
+		authMiddleware.AuthenticateDevice(contentHandler.CatalogVersion))
+	http.HandleFunc("/api/content/download-url",
+		authMiddleware.AuthenticateDevice(downloadHandler.GetDownloadURLByVersion))
+	http.HandleFunc("/api/content/latest",
+		authMiddleware.AuthenticateDevice(contentHandler.LatestVersion))
+	http.HandleFunc("/api/content/delta",
+		authMiddleware.AuthenticateDevice(contentHandler.GetDelta))
+	http.HandleFunc("/api/content/delta/file",
+		authMiddleware.AuthenticateDevice(contentHandler.DownloadDelta))
+	http.HandleFunc("/api/content/checksum",
+		authMiddleware.AuthenticateDevice(contentHandler.GetChecksum))
+	http.HandleFunc("/api/content/verify",
+		authMiddleware.AuthenticateDevice(contentHandler.VerifyChecksum))
+
+	// Sub-resources of a content record, e.g. /api/content/{id}/dependencies
+	// and /api/content/{id}/related
+	http.HandleFunc("/api/content/",
+		authMiddleware.AuthenticateDevice(downloadHandler.ContentSubresource))
+
+	http.HandleFunc("/api/admin/content",
+		authMiddleware.AdminOnly(adminHandler.GetContent))
+	http.HandleFunc("/api/admin/stats",
+		authMiddleware.AdminOnly(adminHandler.Stats))
+	http.HandleFunc("/api/admin/stats/downloads",
+		authMiddleware.AdminOnly(adminHandler.DownloadStats))
+	http.HandleFunc("/api/admin/content/deltas",
+		authMiddleware.AdminOnly(contentHandler.UploadDelta))
+	http.HandleFunc("/api/admin/content/dependencies",
+		authMiddleware.AdminOnly(adminHandler.AddDependency))
+	http.HandleFunc("/api/admin/content/fix-content-types",
+		authMiddleware.AdminOnly(adminHandler.FixContentTypes))
+	http.HandleFunc("/api/admin/content/verify-checksums",
+		authMiddleware.AdminOnly(adminHandler.VerifyChecksums))
+	http.HandleFunc("/api/admin/content/verification-report",
+		authMiddleware.AdminOnly(adminHandler.VerificationReport))
+	http.HandleFunc("/api/admin/content/missing-objects",
+		authMiddleware.AdminOnly(adminHandler.MissingObjects))
+	http.HandleFunc("/api/admin/content/update",
+		authMiddleware.AdminOnly(contentHandler.Update))
+	http.HandleFunc("/api/admin/content/delete",
+		authMiddleware.AdminOnly(contentHandler.Delete))
+	http.HandleFunc("/api/admin/content/enable",
+		authMiddleware.AdminOnly(adminHandler.SetContentEnabled))
+	http.HandleFunc("/api/admin/content/pin",
+		authMiddleware.AdminOnly(adminHandler.SetContentPinned))
+	http.HandleFunc("/api/admin/content/upsert",
+		authMiddleware.AdminOnly(contentHandler.UpsertContent))
+	http.HandleFunc("/api/admin/content/archive",
+		authMiddleware.AdminOnly(adminHandler.ArchiveContent))
+	http.HandleFunc("/api/admin/content/versions",
+		authMiddleware.AdminOnly(adminHandler.ListVersionRange))
+	// Support view of a device's plan, e.g. /api/admin/devices/{hardwareID}/view
+	http.HandleFunc("/api/admin/devices/",
+		authMiddleware.AdminOnly(deviceViewHandler.View))
+	http.HandleFunc("/api/admin/device-cache",
+		authMiddleware.AdminOnly(authMiddleware.EvictDevice))
+	http.HandleFunc("/api/admin/downloads/handoff",
+		authMiddleware.AdminOnly(handoffHandler.Assign))
+	http.HandleFunc("/api/admin/downloads/purge",
+		authMiddleware.AdminOnly(adminHandler.PurgeDownloads))
+	http.HandleFunc("/api/admin/embed-tokens",
+		authMiddleware.AdminOnly(adminHandler.IssueEmbedToken))
+	http.HandleFunc("/api/admin/signing-keys",
+		authMiddleware.AdminOnly(adminHandler.SigningKeys))
+	http.HandleFunc("/api/admin/webhooks",
+		authMiddleware.AdminOnly(adminHandler.Webhooks))
 
 	http.HandleFunc("/api/secure/firestore-write",
 		authMiddleware.AuthenticateDevice(firebaseHandler.HandleSecureFirestoreWrite))
 
 	http.HandleFunc("/download/", downloadHandler.HandleSignedDownload)
 
+	http.HandleFunc("/api/time", api.ServerTime(cfg.SignedURLClockSkew))
+
+	var handler http.Handler = http.DefaultServeMux
+	if cfg.MetricsEnabled {
+		if cfg.MetricsAddr != "" {
+			go serveMetrics(ctx, cfg.MetricsAddr)
+		} else {
+			http.HandleFunc("/metrics", authMiddleware.AdminOnly(metrics.Handler().ServeHTTP))
+		}
+		handler = metrics.InstrumentMux(http.DefaultServeMux)
+	}
+	// Outermost, so preflights are answered before device authentication
+	handler = middleware.CORS(middleware.CORSConfig{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedMethods:   cfg.CORSAllowedMethods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	}, handler)
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		log.Printf("CORS enabled for origins: %v", cfg.CORSAllowedOrigins)
+	}
+
+	conns := newConnTracker()
+	server := &http.Server{Addr: ":8080", Handler: handler, ConnState: conns.track}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ListenAndServe() }()
 	log.Printf("Server starting on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+
+	select {
+	case err := <-serveErr:
+		log.Fatalf("Server failed: %v", err)
+	case <-ctx.Done():
+	}
+	// A second signal kills the process without waiting
+	stop()
+
+	draining := conns.Active()
+	log.Printf("[Shutdown] Stopped accepting connections; draining %d active connections (%d downloads streaming), waiting up to %s",
+		draining, api.ActiveDownloads(), cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		remaining := conns.Active()
+		log.Printf("[Shutdown] Timed out with %d of %d connections still active, closing them: %v",
+			remaining, draining, err)
+		server.Close()
+	} else {
+		log.Printf("[Shutdown] Drained %d connections", draining)
+	}
+	log.Printf("[Shutdown] Closing database connection")
 }
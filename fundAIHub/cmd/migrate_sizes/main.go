@@ -0,0 +1,125 @@
+package main
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/storage"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// sizeReport counts outcomes of a size repair run
+type sizeReport struct {
+	checked   int
+	corrected int
+	skipped   int
+	missing   int
+	failed    int
+}
+
+// migrate_sizes widens content.size to BIGINT where that has not happened
+// yet and repairs sizes recorded before it was: rows left negative by the
+// overflow, or zero, are re-read from storage.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report corrections without changing the database")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("Error loading .env file")
+	}
+
+	database, err := db.NewConnection(db.Config{ConnectionURL: os.Getenv("DATABASE_URL")})
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+	store := db.NewContentStore(database)
+
+	svc := storage.NewSupabaseStorage(
+		os.Getenv("SUPABASE_URL"),
+		os.Getenv("SUPABASE_KEY"),
+		"content",
+	)
+
+	ctx := context.Background()
+	if *dryRun {
+		log.Printf("Dry run: the size column and records are left unchanged")
+	} else {
+		widened, err := store.WidenSizeColumn(ctx)
+		if err != nil {
+			log.Fatalf("Failed to widen content.size: %v", err)
+		}
+		if widened {
+			log.Printf("Widened content.size to BIGINT")
+		} else {
+			log.Printf("content.size is already BIGINT")
+		}
+	}
+
+	report, err := repairSizes(ctx, store, svc, *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to list records to repair: %v", err)
+	}
+	log.Printf("Size repair finished (dry run: %t): %d checked, %d corrected, %d skipped, %d missing from storage, %d failed",
+		*dryRun, report.checked, report.corrected, report.skipped, report.missing, report.failed)
+	if report.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// repairSizes sets the size of each suspect record to that of its object.
+// Gzipped content records its uncompressed size, which storage cannot tell
+// us, so it is reported and left alone, as are records in other backends.
+func repairSizes(ctx context.Context, store *db.ContentStore, svc storage.StorageService, dryRun bool) (*sizeReport, error) {
+	contents, err := store.ListSuspectSizes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &sizeReport{}
+	for _, c := range contents {
+		report.checked++
+		key := c.StorageKey.String
+
+		if c.StorageBackend != db.DefaultStorageBackend {
+			log.Printf("Skipping %s (%s): stored in %q", c.ID, key, c.StorageBackend)
+			report.skipped++
+			continue
+		}
+		if c.ContentEncoding != "" {
+			log.Printf("Skipping %s (%s): size %d cannot be recovered from a %s object", c.ID, key, c.Size, c.ContentEncoding)
+			report.skipped++
+			continue
+		}
+
+		info, err := svc.GetInfo(ctx, key)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				log.Printf("Skipping %s (%s): object not found", c.ID, key)
+				report.missing++
+				continue
+			}
+			log.Printf("GetInfo failed for %s (%s): %v", c.ID, key, err)
+			report.failed++
+			continue
+		}
+		if info.Size == c.Size {
+			continue
+		}
+
+		if !dryRun {
+			if err := store.UpdateSize(ctx, c.ID, info.Size); err != nil {
+				log.Printf("Failed to update %s: %v", c.ID, err)
+				report.failed++
+				continue
+			}
+		}
+		log.Printf("%s (%s): size %d -> %d (dry run: %t)", c.ID, key, c.Size, info.Size, dryRun)
+		report.corrected++
+	}
+	return report, nil
+}
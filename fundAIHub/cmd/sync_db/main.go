@@ -4,14 +4,39 @@ import (
 	"FundAIHub/internal/db"
 	"FundAIHub/internal/storage"
 	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// syncStats counts outcomes across workers
+type syncStats struct {
+	created atomic.Int64
+	skipped atomic.Int64
+	failed  atomic.Int64
+}
+
 func main() {
+	workers := flag.Int("workers", 8, "number of files processed concurrently")
+	batchSize := flag.Int("batch", 100, "storage keys checked per existence query")
+	backend := flag.String("backend", "", "storage backend to sync: supabase, local or s3 (default $STORAGE_BACKEND, else supabase)")
+	flag.Parse()
+	if *workers < 1 {
+		*workers = 1
+	}
+	if *batchSize < 1 {
+		*batchSize = 1
+	}
+
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("Error loading .env file")
 	}
@@ -25,55 +50,141 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer database.Close()
+	// Leave room for the existence queries alongside the workers' inserts
+	database.SetMaxOpenConns(*workers + 1)
 
 	store := db.NewContentStore(database)
 
-	// Initialize Supabase storage
-	storage := storage.NewSupabaseStorage(
-		os.Getenv("SUPABASE_URL"),
-		os.Getenv("SUPABASE_KEY"),
-		"content",
-	)
+	if *backend == "" {
+		*backend = os.Getenv("STORAGE_BACKEND")
+	}
+	if *backend == "" {
+		*backend = db.DefaultStorageBackend
+	}
+	svc, err := openBackend(*backend)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+
+	ctx := context.Background()
+	start := time.Now()
 
 	// List all files in storage
-	files, err := storage.ListFiles(context.Background())
+	files, err := svc.ListFiles(ctx, "")
 	if err != nil {
 		log.Fatalf("Failed to list files: %v", err)
 	}
+	log.Printf("Syncing %d files from %s with %d workers, batch size %d", len(files), *backend, *workers, *batchSize)
 
-	// For each file, create a database record if it doesn't exist
-	for _, file := range files {
-		info, err := storage.GetInfo(context.Background(), file.Key)
-		if err != nil {
-			log.Printf("Failed to get info for %s: %v", file.Key, err)
-			continue
+	var stats syncStats
+	keys := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				syncFile(ctx, store, svc, *backend, key, &stats)
+			}
+		}()
+	}
+
+	// Check existence a batch at a time and only hand missing keys to workers
+	for i := 0; i < len(files); i += *batchSize {
+		end := i + *batchSize
+		if end > len(files) {
+			end = len(files)
+		}
+		batch := make([]string, 0, end-i)
+		for _, file := range files[i:end] {
+			batch = append(batch, file.Key)
 		}
 
-		// Check if record already exists
-		exists, err := store.Exists(context.Background(), file.Key)
+		existing, err := store.ExistingStorageKeys(ctx, batch)
 		if err != nil {
-			log.Printf("Failed to check existence for %s: %v", file.Key, err)
+			log.Printf("Failed to check existence for batch at %d: %v", i, err)
+			stats.failed.Add(int64(len(batch)))
 			continue
 		}
 
-		if exists {
-			log.Printf("Record already exists for %s, skipping", file.Key)
-			continue
+		for _, key := range batch {
+			if existing[key] {
+				stats.skipped.Add(1)
+				continue
+			}
+			keys <- key
 		}
+	}
+	close(keys)
+	wg.Wait()
 
-		content := &db.Content{
-			Name:        path.Base(file.Key),
-			FilePath:    file.Key,
-			Size:        int(info.Size),
-			StorageKey:  file.Key,
-			ContentType: info.ContentType,
-		}
+	elapsed := time.Since(start)
+	log.Printf("Sync finished in %s: %d created, %d skipped, %d failed (%.1f files/s)",
+		elapsed.Round(time.Millisecond), stats.created.Load(), stats.skipped.Load(), stats.failed.Load(),
+		float64(len(files))/elapsed.Seconds())
+}
 
-		if err := store.Create(context.Background(), content); err != nil {
-			log.Printf("Failed to create record for %s: %v", file.Key, err)
-			continue
+// openBackend returns the named storage backend, configured from the same
+// environment variables as the hub
+func openBackend(name string) (storage.StorageService, error) {
+	switch name {
+	case db.DefaultStorageBackend:
+		return storage.NewSupabaseStorage(os.Getenv("SUPABASE_URL"), os.Getenv("SUPABASE_KEY"), "content"), nil
+	case "local":
+		root := os.Getenv("LOCAL_STORAGE_ROOT")
+		if root == "" {
+			return nil, fmt.Errorf("LOCAL_STORAGE_ROOT is not set")
+		}
+		return storage.NewLocalStorage(root), nil
+	case "s3":
+		bucket := os.Getenv("S3_BUCKET")
+		if bucket == "" {
+			return nil, fmt.Errorf("S3_BUCKET is not set")
 		}
+		return storage.NewS3Storage(storage.S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          bucket,
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		}), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", storage.ErrUnknownBackend, name)
+	}
+}
 
-		log.Printf("Created record for %s", file.Key)
+// syncFile creates a content record for a storage object that has none. The
+// unique index on storage_key makes concurrent inserts of the same key safe;
+// the loser is counted as skipped.
+func syncFile(ctx context.Context, store *db.ContentStore, svc storage.StorageService, backend, key string, stats *syncStats) {
+	info, err := svc.GetInfo(ctx, key)
+	if err != nil {
+		log.Printf("Failed to get info for %s: %v", key, err)
+		stats.failed.Add(1)
+		return
+	}
+
+	content := &db.Content{
+		Name:        path.Base(key),
+		FilePath:    key,
+		Size:        info.Size,
+		StorageKey:  sql.NullString{String: key, Valid: true},
+		ContentType: sql.NullString{String: info.ContentType, Valid: info.ContentType != ""},
+		// Downloads read the object from the backend it was found in
+		StorageBackend: backend,
 	}
+
+	if err := store.Create(ctx, content); err != nil {
+		if errors.Is(err, db.ErrDuplicateStorageKey) {
+			log.Printf("Record already exists for %s, skipping", key)
+			stats.skipped.Add(1)
+			return
+		}
+		log.Printf("Failed to create record for %s: %v", key, err)
+		stats.failed.Add(1)
+		return
+	}
+
+	log.Printf("Created record for %s", key)
+	stats.created.Add(1)
 }
@@ -0,0 +1,512 @@
+package api
+
+import (
+	"FundAIHub/internal/config"
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/middleware"
+	"FundAIHub/internal/storage"
+	"FundAIHub/internal/webhook"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AdminHandler serves maintenance endpoints. Routes must be wrapped in
+// AuthMiddleware.AdminOnly.
+type AdminHandler struct {
+	store        *db.ContentStore
+	backends     *storage.Registry
+	urlGenerator *URLGenerator
+	embedSecret  []byte
+	embedMaxTTL  time.Duration
+	// downloadRetention is the default age past which PurgeDownloads
+	// deletes finished downloads
+	downloadRetention time.Duration
+	archiver          *Archiver
+	// ctx bounds background jobs started by requests; see SetContext
+	ctx         context.Context
+	checksumMu  sync.Mutex
+	checksumJob ChecksumJob
+	// webhookAllowPrivate skips the public address check on new webhooks
+	webhookAllowPrivate bool
+	// webhooks is told of content changed through admin endpoints; nil
+	// publishes nothing
+	webhooks *webhook.Dispatcher
+}
+
+// NewAdminHandler reads each record's object from the backend in backends
+// named on the record
+func NewAdminHandler(store *db.ContentStore, backends *storage.Registry) *AdminHandler {
+	cfg := config.GetConfig()
+	h := &AdminHandler{
+		store:        store,
+		backends:     backends,
+		urlGenerator: NewURLGenerator(store),
+		embedMaxTTL:  cfg.EmbedTokenMaxTTL,
+
+		downloadRetention: cfg.DownloadRetention,
+		ctx:               context.Background(),
+		checksumJob:       ChecksumJob{Status: jobIdle},
+
+		webhookAllowPrivate: cfg.WebhookAllowPrivateTargets,
+	}
+	if cfg.EmbedTokenSecret != "" {
+		h.embedSecret = []byte(cfg.EmbedTokenSecret)
+	}
+	return h
+}
+
+// SetWebhooks enables notifications for content enabled, disabled or
+// archived through this handler
+func (h *AdminHandler) SetWebhooks(d *webhook.Dispatcher) {
+	h.webhooks = d
+}
+
+// SetContext runs background jobs started by admin requests, such as
+// checksum verification, under ctx, so they stop when it is done
+func (h *AdminHandler) SetContext(ctx context.Context) {
+	h.ctx = ctx
+}
+
+// ContentTypeChange describes a single content_type correction
+type ContentTypeChange struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	From string    `json:"from"`
+	To   string    `json:"to"`
+}
+
+// ContentTypeReport summarises a content_type correction run
+type ContentTypeReport struct {
+	DryRun    bool                `json:"dry_run"`
+	Checked   int                 `json:"checked"`
+	Corrected int                 `json:"corrected"`
+	Failed    int                 `json:"failed"`
+	Changes   []ContentTypeChange `json:"changes"`
+}
+
+// CorrectContentTypes compares the content_type recorded for each stored
+// object with what storage reports and fixes records that disagree. With
+// dryRun set the report lists the changes without writing them.
+func CorrectContentTypes(ctx context.Context, store *db.ContentStore, backends *storage.Registry, dryRun bool) (*ContentTypeReport, error) {
+	contents, err := store.ListStored(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ContentTypeReport{DryRun: dryRun, Changes: []ContentTypeChange{}}
+	for _, c := range contents {
+		report.Checked++
+
+		svc, err := backendOf(backends, &c)
+		if err != nil {
+			log.Printf("[CorrectContentTypes] No backend for %s (%s): %v", c.ID, c.StorageBackend, err)
+			report.Failed++
+			continue
+		}
+		info, err := svc.GetInfo(ctx, c.StorageKey.String)
+		if err != nil {
+			log.Printf("[CorrectContentTypes] GetInfo failed for %s (%s): %v", c.ID, c.StorageKey.String, err)
+			report.Failed++
+			continue
+		}
+
+		actual := info.ContentType
+		// A generic type from storage tells us nothing new; keep whatever we have
+		if actual == "" || (actual == "application/octet-stream" && c.ContentType.Valid) {
+			continue
+		}
+		if c.ContentType.Valid && c.ContentType.String == actual {
+			continue
+		}
+
+		change := ContentTypeChange{ID: c.ID, Name: c.Name, From: c.ContentType.String, To: actual}
+		if !dryRun {
+			if err := store.UpdateContentType(ctx, c.ID, actual); err != nil {
+				log.Printf("[CorrectContentTypes] Failed to update %s: %v", c.ID, err)
+				report.Failed++
+				continue
+			}
+		}
+		log.Printf("[CorrectContentTypes] %s: %q -> %q (dry run: %t)", c.ID, change.From, change.To, dryRun)
+		report.Changes = append(report.Changes, change)
+		report.Corrected++
+	}
+	return report, nil
+}
+
+// FixContentTypes runs CorrectContentTypes. Pass ?dry_run=true to preview.
+func (h *AdminHandler) FixContentTypes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "dry_run must be a boolean", http.StatusBadRequest)
+			return
+		}
+		dryRun = parsed
+	}
+
+	report, err := CorrectContentTypes(r.Context(), h.store, h.backends, dryRun)
+	if err != nil {
+		log.Printf("[FixContentTypes] [Error] %v", err)
+		http.Error(w, "Failed to correct content types", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// ListVersionRange returns the content of an app_type between two versions,
+// e.g. GET ?app_type=linux-app&min=1.2.0&max=2.0.0. Either bound may be
+// omitted.
+func (h *AdminHandler) ListVersionRange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	q := r.URL.Query()
+	appType := q.Get("app_type")
+	if appType == "" {
+		respondWithError(w, http.StatusBadRequest, "app_type is required")
+		return
+	}
+
+	contents, err := h.store.ListByVersionRange(r.Context(), appType, q.Get("min"), q.Get("max"))
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidVersion) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("[ListVersionRange] [Error] %v", err)
+		http.Error(w, "Failed to list content", http.StatusInternalServerError)
+		return
+	}
+	if contents == nil {
+		contents = []db.Content{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contents)
+}
+
+// SigningKeys reports fingerprints of the URL signing keys and which one
+// signs new URLs, so a rotation can be confirmed without exposing the keys.
+func (h *AdminHandler) SigningKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]KeyFingerprint{
+		"keys": h.urlGenerator.KeyFingerprints(),
+	})
+}
+
+// contentDetail is the admin view of a single content record
+type contentDetail struct {
+	*db.Content
+	UniqueDevices int `json:"unique_devices"`
+}
+
+// GetContent returns a content record with its reach, GET ?id=<uuid>
+func (h *AdminHandler) GetContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	idStr := r.URL.Query().Get("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid ID", "id", idStr, err)
+		return
+	}
+
+	content, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	devices, err := h.store.CountUniqueDevicesByContent(r.Context(), id)
+	if err != nil {
+		log.Printf("[AdminGetContent] [Error] Failed to count devices for %s: %v", id, err)
+		http.Error(w, "Failed to load content stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contentDetail{Content: content, UniqueDevices: devices})
+}
+
+// Stats lists completed downloads and unique devices for every content record
+func (h *AdminHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	stats, err := h.store.ListContentStats(r.Context())
+	if err != nil {
+		log.Printf("[AdminStats] [Error] %v", err)
+		http.Error(w, "Failed to load stats", http.StatusInternalServerError)
+		return
+	}
+	if stats == nil {
+		stats = []db.ContentStats{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]db.ContentStats{"content": stats})
+}
+
+// DownloadStats counts completed, failed and in-progress downloads and the
+// bytes transferred for every content record, GET ?from=&to=. Both bounds
+// are optional and take a date or an RFC 3339 time; a date in to counts
+// that whole day.
+func (h *AdminHandler) DownloadStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	var bounds [2]time.Time
+	for i, field := range []string{"from", "to"} {
+		v := r.URL.Query().Get(field)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", v); err == nil && field == "to" {
+				t = t.AddDate(0, 0, 1)
+			}
+		}
+		if err != nil {
+			writeErrorResponse(w, ErrorResponse{
+				Error:  "Invalid " + field + " time",
+				Code:   http.StatusBadRequest,
+				Field:  field,
+				Value:  truncateValue(v),
+				Reason: "must be a date (2006-01-02) or an RFC 3339 time",
+			})
+			return
+		}
+		bounds[i] = t
+	}
+	from, to := bounds[0], bounds[1]
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		respondWithError(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	stats, err := h.store.DownloadStats(r.Context(), from, to)
+	if err != nil {
+		log.Printf("[AdminDownloadStats] [Error] %v", err)
+		http.Error(w, "Failed to load download stats", http.StatusInternalServerError)
+		return
+	}
+	if stats == nil {
+		stats = []db.ContentDownloadStat{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]db.ContentDownloadStat{"content": stats})
+}
+
+// MissingObjects lists content whose storage object was found missing when
+// a download was attempted
+func (h *AdminHandler) MissingObjects(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	contents, err := h.store.ListMissingObjects(r.Context())
+	if err != nil {
+		log.Printf("[MissingObjects] [Error] %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list missing objects")
+		return
+	}
+	if contents == nil {
+		contents = []db.Content{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contents)
+}
+
+// SetContentEnabled pulls content from download, or restores it, without
+// touching the record or its object. POST ?id=<uuid>&enabled=false
+func (h *AdminHandler) SetContentEnabled(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	q := r.URL.Query()
+	idStr := q.Get("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid ID", "id", idStr, err)
+		return
+	}
+	enabled, err := strconv.ParseBool(q.Get("enabled"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "enabled must be a boolean")
+		return
+	}
+
+	if err := h.store.SetEnabled(r.Context(), id, enabled); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[SetContentEnabled] [Error] %s: %v", id, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update content")
+		return
+	}
+	adminID, _ := middleware.UserIDFromContext(r.Context())
+	log.Printf("[SetContentEnabled] Admin %s set enabled=%t on %s", adminID, enabled, id)
+
+	content, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		log.Printf("[SetContentEnabled] [Error] Failed to reload %s: %v", id, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to load content")
+		return
+	}
+	h.webhooks.Publish(webhook.EventContentUpdated, content)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(content)
+}
+
+// SetContentPinned serves POST /api/admin/content/pin?id=&pinned=, putting
+// content at the front of every device's download plan or taking it off
+func (h *AdminHandler) SetContentPinned(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	q := r.URL.Query()
+	idStr := q.Get("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid ID", "id", idStr, err)
+		return
+	}
+	pinned, err := strconv.ParseBool(q.Get("pinned"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "pinned must be a boolean")
+		return
+	}
+
+	if err := h.store.SetPinned(r.Context(), id, pinned); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[SetContentPinned] [Error] %s: %v", id, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update content")
+		return
+	}
+	adminID, _ := middleware.UserIDFromContext(r.Context())
+	log.Printf("[SetContentPinned] Admin %s set pinned=%t on %s", adminID, pinned, id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"content_id": id, "pinned": pinned})
+}
+
+// embedDownloadPath is the route that accepts embed tokens; tokens are bound
+// to it and to one content_id
+const embedDownloadPath = "/api/downloads/url"
+
+// EmbedLink is an embeddable download link and when it stops working
+type EmbedLink struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IssueEmbedToken returns a time-limited link to the download URL endpoint
+// for one content record that works without a Device-ID, for embedding in
+// pages such as an LMS. POST ?content_id=<uuid>&ttl=1h
+func (h *AdminHandler) IssueEmbedToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if h.embedSecret == nil {
+		respondWithError(w, http.StatusServiceUnavailable, "Embed tokens are disabled; set EMBED_TOKEN_SECRET")
+		return
+	}
+
+	q := r.URL.Query()
+	idStr := q.Get("content_id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid content ID", "content_id", idStr, err)
+		return
+	}
+	ttl := h.embedMaxTTL
+	if v := q.Get("ttl"); v != "" {
+		ttl, err = time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			respondWithError(w, http.StatusBadRequest, "ttl must be a positive duration, e.g. 1h")
+			return
+		}
+		if ttl > h.embedMaxTTL {
+			respondWithError(w, http.StatusBadRequest, "ttl exceeds EMBED_TOKEN_MAX_TTL ("+h.embedMaxTTL.String()+")")
+			return
+		}
+	}
+
+	content, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[IssueEmbedToken] [Error] %s: %v", id, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to load content")
+		return
+	}
+	if !content.Enabled {
+		respondContentDisabled(w)
+		return
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	token := middleware.SignEmbedToken(h.embedSecret, embedDownloadPath, id.String(), expiresAt)
+	adminID, _ := middleware.UserIDFromContext(r.Context())
+	log.Printf("[IssueEmbedToken] Admin %s issued an embed token for %s expiring %s", adminID, id, expiresAt.UTC().Format(time.RFC3339))
+
+	params := url.Values{"content_id": {id.String()}, middleware.EmbedTokenParam: {token}}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EmbedLink{
+		URL:       embedDownloadPath + "?" + params.Encode(),
+		ExpiresAt: expiresAt.UTC(),
+	})
+}
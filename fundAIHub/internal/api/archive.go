@@ -0,0 +1,209 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/middleware"
+	"FundAIHub/internal/storage"
+	"FundAIHub/internal/webhook"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// rehydrationTimeout bounds a single restore from cold storage
+const rehydrationTimeout = 30 * time.Minute
+
+// ErrAlreadyArchived is returned when archiving content that is already in
+// cold storage or being restored from it
+var ErrAlreadyArchived = errors.New("content is already archived")
+
+// Archiver moves content objects between hot storage, which serves
+// downloads, and a cheaper cold backend. Each object's hot copy lives in the
+// backend in hot named on its record.
+type Archiver struct {
+	ctx   context.Context
+	store *db.ContentStore
+	hot   *storage.Registry
+	cold  storage.StorageService
+}
+
+// NewArchiver runs restores under ctx, so they stop when it is cancelled;
+// pass the server's context
+func NewArchiver(ctx context.Context, store *db.ContentStore, hot *storage.Registry, cold storage.StorageService) *Archiver {
+	return &Archiver{ctx: ctx, store: store, hot: hot, cold: cold}
+}
+
+// Archive copies a content's object to cold storage, marks the record
+// archived and removes the hot copy. The record is marked before the hot copy
+// is deleted so downloads in between rehydrate rather than report it missing.
+func (a *Archiver) Archive(ctx context.Context, content *db.Content) error {
+	switch content.StorageState.String {
+	case db.StorageStateArchived, db.StorageStateRehydrating:
+		return ErrAlreadyArchived
+	}
+	if !content.StorageKey.Valid {
+		return fmt.Errorf("content %s has no storage object", content.ID)
+	}
+	key := content.StorageKey.String
+	hot, err := backendOf(a.hot, content)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.Copy(ctx, hot, a.cold, key); err != nil {
+		return fmt.Errorf("copying %s to cold storage: %w", key, err)
+	}
+	if err := a.store.SetStorageState(ctx, content.ID, db.StorageStateArchived); err != nil {
+		return err
+	}
+	if err := hot.Delete(ctx, key); err != nil {
+		// The record already points at cold storage; the stray hot copy
+		// only costs space
+		log.Printf("[Archiver] Archived %s but failed to delete hot copy %s: %v", content.ID, key, err)
+	}
+	log.Printf("[Archiver] Archived %s (%s)", content.ID, key)
+	return nil
+}
+
+// Rehydrate starts restoring archived content in the background unless a
+// restore is already running, and reports whether it started one. A restore
+// that has run past rehydrationTimeout, e.g. one lost to a restart, is
+// replaced.
+func (a *Archiver) Rehydrate(ctx context.Context, content *db.Content) (bool, error) {
+	hot, err := backendOf(a.hot, content)
+	if err != nil {
+		return false, err
+	}
+	startedAt, started, err := a.store.BeginRehydration(ctx, content.ID, rehydrationTimeout)
+	if err != nil || !started {
+		return false, err
+	}
+
+	key := content.StorageKey.String
+	go func() {
+		// The download request that triggered the restore will not wait
+		// for it, so the restore runs under the server's context
+		ctx, cancel := context.WithTimeout(a.ctx, rehydrationTimeout)
+		defer cancel()
+
+		log.Printf("[Archiver] Rehydrating %s (%s)", content.ID, key)
+		restoreErr := storage.Copy(ctx, a.cold, hot, key)
+		if restoreErr != nil {
+			log.Printf("[Archiver] [Error] Rehydration of %s failed: %v", content.ID, restoreErr)
+		} else {
+			log.Printf("[Archiver] Rehydrated %s", content.ID)
+		}
+		// Recorded even when shutdown cut the restore short, so the
+		// next download retries it rather than waiting out the timeout
+		if err := a.store.FinishRehydration(context.WithoutCancel(ctx), content.ID, startedAt, restoreErr); err != nil {
+			log.Printf("[Archiver] [Error] Failed to record rehydration of %s: %v", content.ID, err)
+		}
+	}()
+	return true, nil
+}
+
+// SetArchiver enables archival; without one, archive requests are refused
+func (h *AdminHandler) SetArchiver(archiver *Archiver) {
+	h.archiver = archiver
+}
+
+// SetArchiver lets downloads of archived content trigger a restore
+func (h *DownloadHandler) SetArchiver(archiver *Archiver) {
+	h.archiver = archiver
+}
+
+// ArchiveContent moves a content's object to cold storage, POST ?id=<uuid>.
+// Downloads of archived content are answered with 202 while it is restored.
+func (h *AdminHandler) ArchiveContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if h.archiver == nil {
+		respondWithError(w, http.StatusServiceUnavailable, "Archive storage is not configured")
+		return
+	}
+
+	idStr := r.URL.Query().Get("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid ID", "id", idStr, err)
+		return
+	}
+	content, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to load content")
+		return
+	}
+
+	if err := h.archiver.Archive(r.Context(), content); err != nil {
+		if errors.Is(err, ErrAlreadyArchived) {
+			respondWithError(w, http.StatusConflict, "Content is already archived")
+			return
+		}
+		log.Printf("[ArchiveContent] [Error] %s: %v", id, err)
+		respondWithError(w, http.StatusBadGateway, "Failed to archive content")
+		return
+	}
+	adminID, _ := middleware.UserIDFromContext(r.Context())
+	log.Printf("[ArchiveContent] Admin %s archived %s", adminID, id)
+
+	if content, err = h.store.Get(r.Context(), id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load content")
+		return
+	}
+	h.webhooks.Publish(webhook.EventContentUpdated, content)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(content)
+}
+
+// rehydratingResponse answers a download of archived content
+type rehydratingResponse struct {
+	Status            string    `json:"status"`
+	ContentID         uuid.UUID `json:"content_id"`
+	RetryAfterSeconds int       `json:"retry_after_seconds"`
+}
+
+// handleArchivedObject starts restoring archived content if needed and tells
+// the client to retry once it is back in hot storage
+func (h *DownloadHandler) handleArchivedObject(w http.ResponseWriter, r *http.Request, content *db.Content) {
+	if h.archiver == nil {
+		log.Printf("[HandleSignedDownload] [Error] Content %s is archived but no archive storage is configured", content.ID)
+		respondContentUnavailable(w, http.StatusServiceUnavailable, "Content is archived and cannot be restored", 0)
+		return
+	}
+	// Also called while rehydrating, to take over a restore that has been
+	// running too long
+	started, err := h.archiver.Rehydrate(r.Context(), content)
+	if err != nil {
+		log.Printf("[HandleSignedDownload] [Error] Failed to start rehydration of %s: %v", content.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to restore archived content")
+		return
+	}
+	if started {
+		log.Printf("[HandleSignedDownload] Download of archived content %s started a rehydration", content.ID)
+	}
+
+	retryAfter := int(math.Ceil(h.rehydrationRetryAfter.Seconds()))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(rehydratingResponse{
+		Status:            db.StorageStateRehydrating,
+		ContentID:         content.ID,
+		RetryAfterSeconds: retryAfter,
+	})
+}
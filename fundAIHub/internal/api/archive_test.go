@@ -0,0 +1,129 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/storage"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestArchiveAndRehydrate(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	key := "test/" + uuid.New().String() + ".bin"
+	content := &db.Content{
+		Name:       "Archived Content",
+		Type:       "test",
+		Version:    "1.0",
+		FilePath:   key,
+		Size:       4,
+		StorageKey: sql.NullString{String: key, Valid: true},
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("Failed to create content: %v", err)
+	}
+	hot, cold := newFakeStorage(), newFakeStorage()
+	hot.objects[key] = []byte("data")
+
+	backends := storage.NewRegistry(db.DefaultStorageBackend, hot)
+	archiver := NewArchiver(context.Background(), store, backends, cold)
+	handler := NewDownloadHandler(store, hot)
+	handler.SetArchiver(archiver)
+	admin := NewAdminHandler(store, backends)
+	admin.SetArchiver(archiver)
+
+	rr := httptest.NewRecorder()
+	admin.ArchiveContent(rr, httptest.NewRequest(http.MethodPost, "/api/admin/content/archive?id="+content.ID.String(), nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d archiving, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if _, ok := hot.objects[key]; ok {
+		t.Error("Expected hot copy to be removed")
+	}
+	if string(cold.objects[key]) != "data" {
+		t.Error("Expected object in cold storage")
+	}
+
+	rr = httptest.NewRecorder()
+	admin.ArchiveContent(rr, httptest.NewRequest(http.MethodPost, "/api/admin/content/archive?id="+content.ID.String(), nil))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %d archiving twice, got %d", http.StatusConflict, rr.Code)
+	}
+
+	signed, err := handler.urlGenerator.GenerateURL(content.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign URL: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	handler.HandleSignedDownload(rr, httptest.NewRequest(http.MethodGet, signed, nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d for archived content, got %d", http.StatusAccepted, rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := store.Get(context.Background(), content.ID)
+		if err != nil {
+			t.Fatalf("Failed to reload content: %v", err)
+		}
+		if !got.StorageState.Valid {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Rehydration did not finish, storage_state %q", got.StorageState.String)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.HandleSignedDownload(rr, httptest.NewRequest(http.MethodGet, signed, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d after rehydration, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Body.String() != "data" {
+		t.Errorf("Expected restored body %q, got %q", "data", rr.Body.String())
+	}
+}
+
+func TestArchiveUsesRecordBackend(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	key := "test/" + uuid.New().String() + ".bin"
+	content := &db.Content{
+		Name:           "Local Content",
+		Type:           "test",
+		Version:        "1.0",
+		FilePath:       key,
+		Size:           4,
+		StorageKey:     sql.NullString{String: key, Valid: true},
+		StorageBackend: "local",
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("Failed to create content: %v", err)
+	}
+	supabase, local, cold := newFakeStorage(), newFakeStorage(), newFakeStorage()
+	local.objects[key] = []byte("data")
+	backends := storage.NewRegistry(db.DefaultStorageBackend, supabase)
+	backends.Register("local", local)
+
+	if err := NewArchiver(context.Background(), store, backends, cold).Archive(context.Background(), content); err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+	if _, ok := local.objects[key]; ok {
+		t.Error("Expected the local copy to be removed")
+	}
+	if string(cold.objects[key]) != "data" {
+		t.Error("Expected the local object in cold storage")
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/storage"
+	"context"
+	"errors"
+)
+
+// errNoStorage is returned when a handler built without storage is asked to
+// read an object
+var errNoStorage = errors.New("no storage configured")
+
+// SetBackends sends new uploads to the registry's active backend and records
+// its name on the content, so each record can later be read from the backend
+// that holds it
+func (h *ContentHandler) SetBackends(backends *storage.Registry) {
+	h.backends = backends
+	h.backend, h.storage = backends.Active()
+}
+
+// SetBackends lets downloads be served from the backend named on each
+// content record. Without it every record is read from the handler's storage.
+func (h *DownloadHandler) SetBackends(backends *storage.Registry) {
+	h.backends = backends
+}
+
+// backendFor returns the backend holding content's object
+func (h *DownloadHandler) backendFor(content *db.Content) (storage.StorageService, error) {
+	if h.backends == nil {
+		if h.storage == nil {
+			return nil, errNoStorage
+		}
+		return h.storage, nil
+	}
+	return backendOf(h.backends, content)
+}
+
+// backendOf returns the backend in backends holding content's object
+func backendOf(backends *storage.Registry, content *db.Content) (storage.StorageService, error) {
+	if backends == nil {
+		return nil, errNoStorage
+	}
+	return backends.Get(storageBackendName(content.StorageBackend))
+}
+
+// backendNamed returns the backend registered under name, which for content
+// stored through this handler is its own storage
+func (h *ContentHandler) backendNamed(name string) (storage.StorageService, error) {
+	name = storageBackendName(name)
+	if h.backends == nil || name == h.backend {
+		return h.storage, nil
+	}
+	return h.backends.Get(name)
+}
+
+// storageBackendName treats records without a backend as predating the
+// column
+func storageBackendName(name string) string {
+	if name == "" {
+		return db.DefaultStorageBackend
+	}
+	return name
+}
+
+// deleteObject removes an object from whichever backend holds it
+func (h *ContentHandler) deleteObject(ctx context.Context, obj db.StoredObject) error {
+	backend, err := h.backendNamed(obj.Backend)
+	if err != nil {
+		return err
+	}
+	return backend.Delete(ctx, obj.Key)
+}
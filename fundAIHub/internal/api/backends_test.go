@@ -0,0 +1,64 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/storage"
+	"errors"
+	"testing"
+)
+
+func TestDownloadBackendFor(t *testing.T) {
+	supabase, local := newFakeStorage(), newFakeStorage()
+	backends := storage.NewRegistry(db.DefaultStorageBackend, supabase)
+	backends.Register("local", local)
+	h := &DownloadHandler{storage: supabase, backends: backends}
+
+	tests := []struct {
+		name    string
+		backend string
+		want    storage.StorageService
+		wantErr error
+	}{
+		{"Named backend", "local", local, nil},
+		{"Record predating the column", "", supabase, nil},
+		{"Unregistered backend", "s3", nil, storage.ErrUnknownBackend},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.backendFor(&db.Content{StorageBackend: tt.backend})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("backendFor(%q) returned the wrong backend", tt.backend)
+			}
+		})
+	}
+}
+
+func TestDownloadBackendForWithoutStorage(t *testing.T) {
+	h := NewDownloadHandler(nil, nil)
+	if _, err := h.backendFor(&db.Content{}); !errors.Is(err, errNoStorage) {
+		t.Errorf("error = %v, want errNoStorage", err)
+	}
+}
+
+func TestContentHandlerSetBackends(t *testing.T) {
+	supabase, local := newFakeStorage(), newFakeStorage()
+	backends := storage.NewRegistry(db.DefaultStorageBackend, supabase)
+	backends.Register("local", local)
+	if err := backends.SetActive("local"); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &ContentHandler{storage: supabase, backend: db.DefaultStorageBackend}
+	h.SetBackends(backends)
+	if h.backend != "local" || h.storage != local {
+		t.Errorf("Uploads go to %q, want the active backend", h.backend)
+	}
+
+	// Objects stored before the switch are still reached in their backend
+	if got, err := h.backendNamed(db.DefaultStorageBackend); err != nil || got != supabase {
+		t.Errorf("backendNamed(supabase) = %v, %v", got, err)
+	}
+}
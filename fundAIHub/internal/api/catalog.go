@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// catalogVersionResponse is the body of GET /api/content/version
+type catalogVersionResponse struct {
+	CatalogVersion int64 `json:"catalog_version"`
+}
+
+// catalogNotModified sets X-Catalog-Version and, when the request's
+// If-Catalog-Version names the same version, answers 304 and reports true.
+// A header that is not a number never matches.
+func catalogNotModified(w http.ResponseWriter, r *http.Request, version int64) bool {
+	w.Header().Set("X-Catalog-Version", strconv.FormatInt(version, 10))
+	if v := strings.TrimSpace(r.Header.Get("If-Catalog-Version")); v != "" {
+		if known, err := strconv.ParseInt(v, 10, 64); err == nil && known == version {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// CatalogVersion returns a number that increases whenever content is
+// created, updated or deleted, so clients can poll it cheaply and re-read
+// the catalog only when it moves. Honours If-Catalog-Version like List.
+func (h *ContentHandler) CatalogVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	version, err := h.store.CatalogVersion(r.Context())
+	if err != nil {
+		log.Printf("[CatalogVersion] [Error] %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to read catalog version")
+		return
+	}
+	if catalogNotModified(w, r, version) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(catalogVersionResponse{CatalogVersion: version})
+}
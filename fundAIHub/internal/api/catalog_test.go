@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCatalogNotModified(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"41", false},
+		{"42", true},
+		{" 42 ", true},
+		{"forty-two", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/content", nil)
+			if tt.header != "" {
+				req.Header.Set("If-Catalog-Version", tt.header)
+			}
+			rr := httptest.NewRecorder()
+
+			if got := catalogNotModified(rr, req, 42); got != tt.want {
+				t.Fatalf("catalogNotModified = %v, want %v", got, tt.want)
+			}
+			if v := rr.Header().Get("X-Catalog-Version"); v != "42" {
+				t.Errorf("X-Catalog-Version = %q, want 42", v)
+			}
+			if tt.want && rr.Code != http.StatusNotModified {
+				t.Errorf("Expected status %d, got %d", http.StatusNotModified, rr.Code)
+			}
+		})
+	}
+}
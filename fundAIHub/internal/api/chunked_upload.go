@@ -0,0 +1,396 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/webhook"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxChunkSize bounds a single chunk request body
+	maxChunkSize = 64 << 20
+	// maxChunkCount bounds how many chunks a session may declare
+	maxChunkCount = 10000
+)
+
+type initiateUploadRequest struct {
+	Filename    string `json:"filename"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	AppVersion  string `json:"app_version"`
+	AppType     string `json:"app_type"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	ChunkCount  int    `json:"chunk_count"`
+}
+
+// chunkObjectKey is where a chunk is kept until the upload is finalized
+func chunkObjectKey(sessionID uuid.UUID, index int) string {
+	return fmt.Sprintf("uploads/%s/%06d", sessionID, index)
+}
+
+// InitiateUpload starts a chunked upload, declaring the final file's size,
+// SHA-256 and number of chunks.
+func (h *ContentHandler) InitiateUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req initiateUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	checksum, err := hex.DecodeString(strings.ToLower(req.SHA256))
+	switch {
+	case req.Filename == "":
+		respondWithError(w, http.StatusBadRequest, "filename is required")
+		return
+	case req.Size <= 0:
+		respondWithError(w, http.StatusBadRequest, "size must be positive")
+		return
+	case req.ChunkCount < 1 || req.ChunkCount > maxChunkCount:
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("chunk_count must be between 1 and %d", maxChunkCount))
+		return
+	case err != nil || len(checksum) != sha256.Size:
+		respondWithError(w, http.StatusBadRequest, "sha256 must be a 64 character hex digest")
+		return
+	}
+	if h.maxUploadBytes > 0 && req.Size > h.maxUploadBytes {
+		log.Printf("[InitiateUpload] Refused %d byte upload, limit is %d", req.Size, h.maxUploadBytes)
+		respondUploadTooLarge(w, h.maxUploadBytes)
+		return
+	}
+
+	session := &db.UploadSession{
+		Filename:       req.Filename,
+		Version:        req.Version,
+		Description:    req.Description,
+		AppVersion:     req.AppVersion,
+		AppType:        req.AppType,
+		ContentType:    resolveContentType(req.ContentType, req.AppType, h.defaultContentTypes),
+		ExpectedSize:   req.Size,
+		ExpectedSHA256: hex.EncodeToString(checksum),
+		ChunkCount:     req.ChunkCount,
+	}
+	if err := h.store.CreateUploadSession(r.Context(), session); err != nil {
+		log.Printf("[InitiateUpload] [Error] Failed to create session: %v", err)
+		http.Error(w, "Failed to start upload", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// UploadChunk stores one chunk. PUT ?session=<id>&index=<n> with the raw
+// bytes as the body. Re-sending an index replaces the earlier chunk.
+func (h *ContentHandler) UploadChunk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		respondMethodNotAllowed(w, http.MethodPut)
+		return
+	}
+
+	session, ok := h.loadUploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	indexStr := r.URL.Query().Get("index")
+	index, err := strconv.Atoi(indexStr)
+	if err != nil || index < 0 || index >= session.ChunkCount {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("index must be between 0 and %d", session.ChunkCount-1))
+		return
+	}
+
+	// A chunk may not take the upload past its declared size
+	chunks, err := h.store.ListUploadChunks(r.Context(), session.ID)
+	if err != nil {
+		log.Printf("[UploadChunk] [Error] Failed to list chunks of %s: %v", session.ID, err)
+		http.Error(w, "Failed to store chunk", http.StatusInternalServerError)
+		return
+	}
+	limit := session.ExpectedSize
+	for _, c := range chunks {
+		if c.Index != index {
+			limit -= c.Size
+		}
+	}
+	if limit > maxChunkSize {
+		limit = maxChunkSize
+	}
+	if limit <= 0 || r.ContentLength > limit {
+		log.Printf("[UploadChunk] Refused chunk %d of %s: %d bytes left of %d declared",
+			index, session.ID, limit, session.ExpectedSize)
+		respondUploadTooLarge(w, limit)
+		return
+	}
+
+	body := &countingReader{r: http.MaxBytesReader(w, r.Body, limit)}
+	key := chunkObjectKey(session.ID, index)
+	if _, err := h.storage.Upload(r.Context(), body, key, "application/octet-stream"); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			log.Printf("[UploadChunk] Refused chunk %d of %s: over %d bytes", index, session.ID, limit)
+			respondUploadTooLarge(w, tooLarge.Limit)
+			return
+		}
+		log.Printf("[UploadChunk] [Error] Failed to store chunk %d of %s: %v", index, session.ID, err)
+		http.Error(w, "Failed to store chunk", http.StatusInternalServerError)
+		return
+	}
+
+	chunk := db.UploadChunk{Index: index, StorageKey: key, Size: body.n}
+	if err := h.store.RecordUploadChunk(r.Context(), session.ID, chunk); err != nil {
+		log.Printf("[UploadChunk] [Error] Failed to record chunk %d of %s: %v", index, session.ID, err)
+		http.Error(w, "Failed to record chunk", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chunk)
+}
+
+// FinalizeUpload assembles the chunks of ?session=<id>, verifies the result
+// against the declared size and SHA-256 and only then creates the content
+// record. Missing chunks return 400 and leave the session intact so the
+// client can upload them and retry; a size or checksum mismatch returns 422
+// and discards the session and its objects. Sessions older than the upload
+// session TTL are refused with 410.
+func (h *ContentHandler) FinalizeUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	session, ok := h.loadUploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	chunks, err := h.store.ListUploadChunks(r.Context(), session.ID)
+	if err != nil {
+		log.Printf("[FinalizeUpload] [Error] Failed to list chunks of %s: %v", session.ID, err)
+		http.Error(w, "Failed to finalize upload", http.StatusInternalServerError)
+		return
+	}
+
+	if missing := missingChunks(session.ChunkCount, chunks); len(missing) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":          "Upload is missing chunks",
+			"code":           http.StatusBadRequest,
+			"missing_chunks": missing,
+		})
+		return
+	}
+	if total := totalChunkSize(chunks); total != session.ExpectedSize {
+		h.discardUpload(r.Context(), session.ID, chunks, "")
+		respondWithError(w, http.StatusUnprocessableEntity,
+			fmt.Sprintf("Chunks total %d bytes but %d were declared", total, session.ExpectedSize))
+		return
+	}
+
+	// A fresh key, so assembling can never overwrite another record's object
+	objectKey := h.keyLayout.ObjectKey(session.AppType, session.Filename, time.Now())
+
+	checksum, err := h.assembleChunks(r.Context(), chunks, objectKey, session.ContentType)
+	if err != nil {
+		log.Printf("[FinalizeUpload] [Error] Failed to assemble %s: %v", session.ID, err)
+		h.storage.Delete(r.Context(), objectKey)
+		http.Error(w, "Failed to assemble upload", http.StatusInternalServerError)
+		return
+	}
+	if checksum != session.ExpectedSHA256 {
+		h.discardUpload(r.Context(), session.ID, chunks, objectKey)
+		respondWithError(w, http.StatusUnprocessableEntity,
+			fmt.Sprintf("Assembled file has sha256 %s but %s was declared", checksum, session.ExpectedSHA256))
+		return
+	}
+
+	content := &db.Content{
+		Name:        session.Filename,
+		Type:        "linux-app",
+		Version:     session.Version,
+		Description: session.Description,
+		AppVersion:  session.AppVersion,
+		AppType:     session.AppType,
+		FilePath:    objectKey,
+		Size:        session.ExpectedSize,
+		StorageKey:  sql.NullString{String: objectKey, Valid: true},
+		ContentType: sql.NullString{String: session.ContentType, Valid: session.ContentType != ""},
+		Checksum:    sql.NullString{String: checksum, Valid: true},
+
+		StorageBackend: h.backend,
+	}
+	if err := h.store.Create(r.Context(), content); err != nil {
+		h.storage.Delete(r.Context(), objectKey)
+		if errors.Is(err, db.ErrDuplicateVersion) || errors.Is(err, db.ErrDuplicateStorageKey) {
+			respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		http.Error(w, "Failed to create content record", http.StatusInternalServerError)
+		return
+	}
+
+	// The chunks are no longer needed once the content exists
+	h.discardUpload(r.Context(), session.ID, chunks, "")
+	h.webhooks.Publish(webhook.EventContentCreated, content)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(content)
+}
+
+func (h *ContentHandler) loadUploadSession(w http.ResponseWriter, r *http.Request) (*db.UploadSession, bool) {
+	idStr := r.URL.Query().Get("session")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid upload session ID", "session", idStr, err)
+		return nil, false
+	}
+
+	session, err := h.store.GetUploadSession(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Upload session not found", http.StatusNotFound)
+			return nil, false
+		}
+		log.Printf("[Upload] [Error] Failed to load session %s: %v", id, err)
+		http.Error(w, "Failed to load upload session", http.StatusInternalServerError)
+		return nil, false
+	}
+	if h.uploadSessionExpired(session) {
+		respondWithError(w, http.StatusGone, "Upload session expired; start a new upload")
+		return nil, false
+	}
+	return session, true
+}
+
+// uploadSessionExpired reports whether session has outlived the upload
+// session TTL
+func (h *ContentHandler) uploadSessionExpired(session *db.UploadSession) bool {
+	return h.uploadSessionTTL > 0 && time.Since(session.CreatedAt) > h.uploadSessionTTL
+}
+
+// ExpireUploadSessions deletes chunked upload sessions older than the
+// upload session TTL together with their stored chunks, and returns how
+// many it deleted
+func (h *ContentHandler) ExpireUploadSessions(ctx context.Context) (int, error) {
+	if h.uploadSessionTTL <= 0 {
+		return 0, nil
+	}
+	ids, err := h.store.ListUploadSessionsBefore(ctx, time.Now().Add(-h.uploadSessionTTL))
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		chunks, err := h.store.ListUploadChunks(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+		h.discardUpload(ctx, id, chunks, "")
+	}
+	return len(ids), nil
+}
+
+// assembleChunks streams the chunks in order into objectKey and returns the
+// hex SHA-256 of the assembled bytes
+func (h *ContentHandler) assembleChunks(ctx context.Context, chunks []db.UploadChunk, objectKey, contentType string) (string, error) {
+	pr, pw := io.Pipe()
+	hash := sha256.New()
+
+	go func() {
+		for _, c := range chunks {
+			reader, _, err := h.storage.Download(ctx, c.StorageKey)
+			if err != nil {
+				pw.CloseWithError(fmt.Errorf("reading chunk %d: %w", c.Index, err))
+				return
+			}
+			_, err = io.Copy(io.MultiWriter(pw, hash), reader)
+			reader.Close()
+			if err != nil {
+				pw.CloseWithError(fmt.Errorf("copying chunk %d: %w", c.Index, err))
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	if _, err := h.storage.Upload(ctx, pr, objectKey, contentType); err != nil {
+		pr.CloseWithError(err)
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// discardUpload deletes the chunk objects, the optional assembled object and
+// the session. Errors are logged; leftovers are harmless but take space.
+func (h *ContentHandler) discardUpload(ctx context.Context, sessionID uuid.UUID, chunks []db.UploadChunk, assembledKey string) {
+	for _, c := range chunks {
+		if err := h.storage.Delete(ctx, c.StorageKey); err != nil {
+			log.Printf("[Upload] Failed to delete chunk %s: %v", c.StorageKey, err)
+		}
+	}
+	if assembledKey != "" {
+		if err := h.storage.Delete(ctx, assembledKey); err != nil {
+			log.Printf("[Upload] Failed to delete assembled object %s: %v", assembledKey, err)
+		}
+	}
+	if err := h.store.DeleteUploadSession(ctx, sessionID); err != nil {
+		log.Printf("[Upload] Failed to delete session %s: %v", sessionID, err)
+	}
+}
+
+// missingChunks lists the indexes in [0, count) that have no chunk
+func missingChunks(count int, chunks []db.UploadChunk) []int {
+	have := make(map[int]bool, len(chunks))
+	for _, c := range chunks {
+		have[c.Index] = true
+	}
+	missing := []int{}
+	for i := 0; i < count; i++ {
+		if !have[i] {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+func totalChunkSize(chunks []db.UploadChunk) int64 {
+	var total int64
+	for _, c := range chunks {
+		total += c.Size
+	}
+	return total
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMissingChunks(t *testing.T) {
+	chunks := []db.UploadChunk{{Index: 0, Size: 10}, {Index: 2, Size: 10}, {Index: 4, Size: 5}}
+
+	if got, want := missingChunks(5, chunks), []int{1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("missingChunks = %v, want %v", got, want)
+	}
+	if got := missingChunks(1, chunks[:1]); len(got) != 0 {
+		t.Errorf("missingChunks = %v, want none", got)
+	}
+	if got := totalChunkSize(chunks); got != 25 {
+		t.Errorf("totalChunkSize = %d, want 25", got)
+	}
+}
+
+// startUpload creates an upload session of size bytes in chunks parts,
+// declaring the SHA-256 of declared
+func startUpload(t *testing.T, h *ContentHandler, version, declared string, size int64, chunks int) uuid.UUID {
+	t.Helper()
+	sum := sha256.Sum256([]byte(declared))
+	reqBody, _ := json.Marshal(initiateUploadRequest{
+		Filename:   "chunked-" + uuid.New().String() + ".zip",
+		Version:    version,
+		AppType:    "chunked-app",
+		Size:       size,
+		SHA256:     hex.EncodeToString(sum[:]),
+		ChunkCount: chunks,
+	})
+	rr := httptest.NewRecorder()
+	h.InitiateUpload(rr, httptest.NewRequest(http.MethodPost, "/api/uploads", bytes.NewReader(reqBody)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("InitiateUpload: status %d: %s", rr.Code, rr.Body.String())
+	}
+	var session db.UploadSession
+	if err := json.NewDecoder(rr.Body).Decode(&session); err != nil {
+		t.Fatalf("Decoding session: %v", err)
+	}
+	return session.ID
+}
+
+func putChunk(h *ContentHandler, id uuid.UUID, index int, body string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut,
+		fmt.Sprintf("/api/uploads/chunk?session=%s&index=%d", id, index), strings.NewReader(body))
+	h.UploadChunk(rr, req)
+	return rr
+}
+
+func finalize(h *ContentHandler, id uuid.UUID) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	h.FinalizeUpload(rr, httptest.NewRequest(http.MethodPost, "/api/uploads/finalize?session="+id.String(), nil))
+	return rr
+}
+
+// objectsUnder lists the fake storage keys with prefix
+func objectsUnder(svc *fakeStorage, prefix string) []string {
+	var keys []string
+	for key := range svc.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestChunkedUploadFailures(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	svc := newFakeStorage()
+	h := NewContentHandler(store, svc)
+	ctx := context.Background()
+
+	t.Run("Chunk past the declared size is 413", func(t *testing.T) {
+		id := startUpload(t, h, "", "abcdef", 6, 2)
+		if rr := putChunk(h, id, 0, "abcd"); rr.Code != http.StatusOK {
+			t.Fatalf("First chunk: status %d", rr.Code)
+		}
+		rr := putChunk(h, id, 1, "efgh")
+		var resp ErrorResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if rr.Code != http.StatusRequestEntityTooLarge || resp.ErrorCode != errCodeUploadTooLarge {
+			t.Errorf("Expected 413 %s, got %d %q", errCodeUploadTooLarge, rr.Code, resp.ErrorCode)
+		}
+		// Re-sending a chunk counts only its own new size
+		if rr := putChunk(h, id, 0, "ab"); rr.Code != http.StatusOK {
+			t.Errorf("Replacing a chunk: status %d", rr.Code)
+		}
+	})
+
+	t.Run("Missing chunks keep the session", func(t *testing.T) {
+		id := startUpload(t, h, "", "abcdef", 6, 2)
+		putChunk(h, id, 0, "abc")
+		if rr := finalize(h, id); rr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if _, err := store.GetUploadSession(ctx, id); err != nil {
+			t.Errorf("Expected the session to be kept, got %v", err)
+		}
+	})
+
+	t.Run("Size mismatch discards the session", func(t *testing.T) {
+		id := startUpload(t, h, "", "abcdef", 6, 2)
+		putChunk(h, id, 0, "abc")
+		putChunk(h, id, 1, "de")
+		if rr := finalize(h, id); rr.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+		}
+		if _, err := store.GetUploadSession(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Expected the session to be deleted, got %v", err)
+		}
+		if left := objectsUnder(svc, "uploads/"+id.String()); len(left) != 0 {
+			t.Errorf("Chunks left behind: %v", left)
+		}
+	})
+
+	t.Run("Checksum mismatch removes the assembled object", func(t *testing.T) {
+		before := len(svc.objects)
+		id := startUpload(t, h, "", "abcdef", 6, 2)
+		putChunk(h, id, 0, "abc")
+		putChunk(h, id, 1, "xyz")
+		if rr := finalize(h, id); rr.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+		}
+		if len(svc.objects) != before {
+			t.Errorf("Expected no objects left behind, have %d more", len(svc.objects)-before)
+		}
+	})
+
+	t.Run("Unreadable chunk fails assembly", func(t *testing.T) {
+		before := len(svc.objects)
+		id := startUpload(t, h, "", "abcdef", 6, 2)
+		putChunk(h, id, 0, "abc")
+		putChunk(h, id, 1, "def")
+		delete(svc.objects, chunkObjectKey(id, 1))
+		if rr := finalize(h, id); rr.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+		// Only chunk 0 remains; the partial assembly is gone
+		if len(svc.objects) != before+1 {
+			t.Errorf("Expected only the surviving chunk left, have %d objects more", len(svc.objects)-before)
+		}
+	})
+
+	t.Run("Published version is 409", func(t *testing.T) {
+		for i, want := range []int{http.StatusCreated, http.StatusConflict} {
+			before := len(svc.objects)
+			id := startUpload(t, h, "9.9.9", "abcdef", 6, 1)
+			putChunk(h, id, 0, "abcdef")
+			rr := finalize(h, id)
+			if rr.Code != want {
+				t.Fatalf("Finalize %d: expected status %d, got %d", i, want, rr.Code)
+			}
+			if want == http.StatusConflict && len(svc.objects) != before+1 {
+				t.Errorf("Expected the assembled object removed, have %d objects more", len(svc.objects)-before)
+			}
+		}
+	})
+
+	t.Run("Expired sessions are refused and cleaned up", func(t *testing.T) {
+		id := startUpload(t, h, "", "abcdef", 6, 2)
+		putChunk(h, id, 0, "abc")
+
+		h.uploadSessionTTL = time.Nanosecond
+		defer func() { h.uploadSessionTTL = 24 * time.Hour }()
+		time.Sleep(time.Millisecond)
+
+		if rr := putChunk(h, id, 1, "def"); rr.Code != http.StatusGone {
+			t.Errorf("Chunk: expected status %d, got %d", http.StatusGone, rr.Code)
+		}
+		if rr := finalize(h, id); rr.Code != http.StatusGone {
+			t.Errorf("Finalize: expected status %d, got %d", http.StatusGone, rr.Code)
+		}
+		if _, err := h.ExpireUploadSessions(ctx); err != nil {
+			t.Fatalf("ExpireUploadSessions: %v", err)
+		}
+		if _, err := store.GetUploadSession(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Expected the session to be deleted, got %v", err)
+		}
+		if left := objectsUnder(svc, "uploads/"+id.String()); len(left) != 0 {
+			t.Errorf("Chunks left behind: %v", left)
+		}
+	})
+}
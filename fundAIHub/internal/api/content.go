@@ -1,35 +1,188 @@
 package api
 
 import (
+	"FundAIHub/internal/config"
 	"FundAIHub/internal/db"
+	"FundAIHub/internal/semver"
 	"FundAIHub/internal/storage"
+	"FundAIHub/internal/webhook"
+	"context"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type ContentHandler struct {
-	store   *db.ContentStore
-	storage storage.StorageService
+	store               *db.ContentStore
+	storage             storage.StorageService
+	backend             string // Name recorded on content uploaded to storage
+	backends            *storage.Registry
+	defaultContentTypes map[string]string
+	keyLayout           storage.KeyLayout
+	webhooks            *webhook.Dispatcher
+	maxFormParts        int
+	maxFormFieldBytes   int64
+	maxUploadBytes      int64
+	uploadSessionTTL    time.Duration
 }
 
-func NewContentHandler(store *db.ContentStore, storage storage.StorageService) *ContentHandler {
-	return &ContentHandler{store: store, storage: storage}
+func NewContentHandler(store *db.ContentStore, svc storage.StorageService) *ContentHandler {
+	cfg := config.GetConfig()
+	layout, err := storage.ParseKeyLayout(cfg.StorageKeyLayout)
+	if err != nil {
+		log.Printf("[ContentHandler] %v, falling back to flat layout", err)
+		layout = storage.LayoutFlat
+	}
+	return &ContentHandler{
+		store:               store,
+		storage:             svc,
+		backend:             db.DefaultStorageBackend,
+		defaultContentTypes: cfg.DefaultContentTypes,
+		keyLayout:           layout,
+		maxFormParts:        cfg.UploadMaxFormParts,
+		maxFormFieldBytes:   cfg.UploadMaxFormFieldBytes,
+		maxUploadBytes:      cfg.UploadMaxBytes,
+		uploadSessionTTL:    cfg.UploadSessionTTL,
+	}
+}
+
+// SetWebhooks enables catalog change notifications for this handler
+func (h *ContentHandler) SetWebhooks(d *webhook.Dispatcher) {
+	h.webhooks = d
+}
+
+// genericContentTypes are Content-Type values that say nothing about the file
+var genericContentTypes = map[string]bool{
+	"":                         true,
+	"application/octet-stream": true,
+	"binary/octet-stream":      true,
+	"application/unknown":      true,
+}
+
+// resolveContentType returns the uploaded Content-Type unless it is missing or
+// generic, in which case the configured default for the app type is used.
+func resolveContentType(headerType, appType string, defaults map[string]string) string {
+	if !genericContentTypes[strings.ToLower(strings.TrimSpace(headerType))] {
+		return headerType
+	}
+	if def, ok := defaults[appType]; ok {
+		return def
+	}
+	return headerType
 }
 
+// validateLicenseURL accepts an empty value or an absolute http(s) URL
+func validateLicenseURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("license_url is not a valid URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("license_url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// Content list page sizes; see List
+const (
+	defaultContentPageSize = 50
+	maxContentPageSize     = 200
+)
+
+// List returns a page of content, filtered by ?type=, ?app_type= and
+// ?license= and paged with ?limit= and ?offset=. The number of records
+// matching the filters across all pages is sent in X-Total-Count, and the
+// catalog version in X-Catalog-Version; see CatalogVersion.
 func (h *ContentHandler) List(w http.ResponseWriter, r *http.Request) {
-	contents, err := h.store.List(r.Context())
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := db.ListOptions{
+		Limit:   defaultContentPageSize,
+		Type:    query.Get("type"),
+		AppType: query.Get("app_type"),
+		License: query.Get("license"),
+		Sort:    query.Get("sort"),
+	}
+	if opts.Sort != "" && !db.ValidContentSort(opts.Sort) {
+		writeErrorResponse(w, ErrorResponse{
+			Error:  "Invalid sort order",
+			Code:   http.StatusBadRequest,
+			Field:  "sort",
+			Value:  truncateValue(opts.Sort),
+			Reason: "expected one of name, created_at, size, popularity",
+		})
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxContentPageSize {
+			writeErrorResponse(w, ErrorResponse{
+				Error:  "Invalid limit",
+				Code:   http.StatusBadRequest,
+				Field:  "limit",
+				Value:  truncateValue(v),
+				Reason: fmt.Sprintf("expected an integer between 1 and %d", maxContentPageSize),
+			})
+			return
+		}
+		opts.Limit = limit
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			writeErrorResponse(w, ErrorResponse{
+				Error:  "Invalid offset",
+				Code:   http.StatusBadRequest,
+				Field:  "offset",
+				Value:  truncateValue(v),
+				Reason: "expected a non-negative integer",
+			})
+			return
+		}
+		opts.Offset = offset
+	}
+
+	// Read the version before the content so a change in between is
+	// picked up by the next poll rather than hidden behind this version
+	version, err := h.store.CatalogVersion(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if catalogNotModified(w, r, version) {
+		return
+	}
+
+	contents, total, err := h.store.List(r.Context(), opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if contents == nil {
+		contents = []db.Content{}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 	json.NewEncoder(w).Encode(contents)
 }
 
@@ -39,18 +192,34 @@ func (h *ContentHandler) Create(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := validateLicenseURL(content.LicenseURL); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	if err := h.store.Create(r.Context(), &content); err != nil {
+		if errors.Is(err, db.ErrDuplicateStorageKey) || errors.Is(err, db.ErrDuplicateVersion) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.webhooks.Publish(webhook.EventContentCreated, &content)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(content)
 }
 
+// Update replaces a record's name, type, version, file path and size. PUT
+// /api/admin/content/update with the record as the body.
 func (h *ContentHandler) Update(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		respondMethodNotAllowed(w, http.MethodPut)
+		return
+	}
+
 	var content db.Content
 	if err := json.NewDecoder(r.Body).Decode(&content); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -65,21 +234,59 @@ func (h *ContentHandler) Update(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// Answer and notify with the whole record, not just the fields sent
+	if updated, err := h.store.Get(r.Context(), content.ID); err == nil {
+		content = *updated
+	}
+	h.webhooks.Publish(webhook.EventContentUpdated, &content)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(content)
 }
 
+// Delete removes a record, DELETE /api/admin/content/delete?id=<uuid>.
+// The record is soft-deleted unless hard=true.
 func (h *ContentHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondMethodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
 	// Extract ID from URL
 	idStr := r.URL.Query().Get("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		respondWithInvalidUUID(w, "Invalid ID", "id", idStr, err)
 		return
 	}
 
-	if err := h.store.Delete(r.Context(), id); err != nil {
+	// Content is soft-deleted unless hard=true asks for the row to go
+	hard := false
+	if v := r.URL.Query().Get("hard"); v != "" {
+		hard, err = strconv.ParseBool(v)
+		if err != nil {
+			writeErrorResponse(w, ErrorResponse{
+				Error:  "Invalid hard parameter",
+				Code:   http.StatusBadRequest,
+				Field:  "hard",
+				Value:  truncateValue(v),
+				Reason: "expected true or false",
+			})
+			return
+		}
+	}
+
+	// Keep the record around so subscribers learn what was removed
+	deleted, err := h.store.GetIncludingDeleted(r.Context(), id)
+	if err != nil {
+		deleted = &db.Content{ID: id}
+	}
+
+	remove := h.store.SoftDelete
+	if hard {
+		remove = h.store.Delete
+	}
+	if err := remove(r.Context(), id); err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Content not found", http.StatusNotFound)
 			return
@@ -87,67 +294,142 @@ func (h *ContentHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.webhooks.Publish(webhook.EventContentDeleted, deleted)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (h *ContentHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[Debug] Starting file upload handler")
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
 
-	// Parse form data
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		http.Error(w, "Could not parse form", http.StatusBadRequest)
+	if !h.checkUploadSize(w, r) {
 		return
 	}
 
-	// Get file
-	file, header, err := r.FormFile("file")
+	// Parse form data part by part so abusive forms are cut off early; the
+	// file itself is streamed to storage
+	form, err := openUploadForm(r, "file", h.maxFormParts, h.maxFormFieldBytes, "app_type", "version")
 	if err != nil {
-		http.Error(w, "Could not read file", http.StatusBadRequest)
+		respondWithFormError(w, err)
 		return
 	}
-	defer file.Close()
 
-	// Upload to storage
-	fileInfo, err := h.storage.Upload(r.Context(), file, header.Filename, header.Header.Get("Content-Type"))
+	licenseURL := form.value("license_url")
+	if err := validateLicenseURL(licenseURL); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	encoding := form.value("content_encoding")
+	if encoding != "" && encoding != db.ContentEncodingGzip {
+		respondWithError(w, http.StatusBadRequest, "content_encoding must be empty or gzip")
+		return
+	}
+
+	appType := form.value("app_type")
+	objectKey := h.keyLayout.ObjectKey(appType, form.filename, time.Now())
+
+	// Fall back to the app type's default when the client sent nothing useful
+	contentTypeFromHeader := resolveContentType(form.header.Get("Content-Type"), appType, h.defaultContentTypes)
+
+	// Upload to storage, compressing on the way if asked to
+	var body io.Reader = form
+	if encoding == db.ContentEncodingGzip {
+		gz := gzipStream(form)
+		defer gz.Close()
+		body = gz
+	}
+	fileInfo, err := h.storage.Upload(r.Context(), body, objectKey, contentTypeFromHeader)
 	if err != nil {
-		http.Error(w, "Upload failed", http.StatusInternalServerError)
+		respondStorageUploadFailed(w, form)
+		return
+	}
+	if !h.finishUpload(w, r, form, fileInfo.Key) {
 		return
 	}
 
 	// Create content record with metadata
-	contentTypeFromHeader := header.Header.Get("Content-Type") // Get content type
 	content := &db.Content{
-		Name:        header.Filename,
+		Name:        form.filename,
 		Type:        "linux-app",
-		Version:     r.FormValue("version"),
-		Description: r.FormValue("description"),
-		AppVersion:  r.FormValue("app_version"),
-		AppType:     r.FormValue("app_type"),
+		Version:     form.value("version"),
+		Description: form.value("description"),
+		AppVersion:  form.value("app_version"),
+		AppType:     appType,
+		License:     form.value("license"),
+		LicenseURL:  licenseURL,
 		FilePath:    fileInfo.Key,
-		Size:        int(header.Size),
+		Size:        form.size,
 		StorageKey:  sql.NullString{String: fileInfo.Key, Valid: true},
 		ContentType: sql.NullString{String: contentTypeFromHeader, Valid: contentTypeFromHeader != ""},
+		Checksum:    sql.NullString{String: form.checksum, Valid: true},
+
+		StorageBackend:  h.backend,
+		ContentEncoding: encoding,
 	}
 
 	// Automatically create/update database record
 	if err := h.store.Create(r.Context(), content); err != nil {
-		// If database insert fails, clean up the uploaded file
-		h.storage.Delete(r.Context(), fileInfo.Key)
+		// If database insert fails, clean up the uploaded file. The key is
+		// new to this upload, so the object is ours whatever the error.
+		log.Printf("[UploadFile] Failed to create record for %s: %v", fileInfo.Key, err)
+		if delErr := compensateUpload(r.Context(), h.storage, fileInfo.Key); delErr != nil {
+			log.Printf("[UploadFile] [Orphan] Object %s left in storage without a record: %v", fileInfo.Key, delErr)
+			respondWithError(w, http.StatusInternalServerError,
+				fmt.Sprintf("Failed to create content record; uploaded object %s could not be removed", fileInfo.Key))
+			return
+		}
+		if errors.Is(err, db.ErrDuplicateVersion) || errors.Is(err, db.ErrDuplicateStorageKey) {
+			respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
 		http.Error(w, "Failed to create content record", http.StatusInternalServerError)
 		return
 	}
+	h.webhooks.Publish(webhook.EventContentCreated, content)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(content)
 }
 
+// Compensating deletes are retried so a transient storage error does not
+// orphan an object whose record was never created
+var (
+	compensateAttempts   = 3
+	compensateRetryDelay = 500 * time.Millisecond
+)
+
+// compensateUpload removes an uploaded object after its record failed to
+// insert. It keeps going if the request is cancelled, since the client
+// hanging up is no reason to leave the object behind.
+func compensateUpload(ctx context.Context, svc storage.StorageService, key string) error {
+	ctx = context.WithoutCancel(ctx)
+	delay := compensateRetryDelay
+
+	var err error
+	for attempt := 1; attempt <= compensateAttempts; attempt++ {
+		if err = svc.Delete(ctx, key); err == nil {
+			return nil
+		}
+		log.Printf("[UploadFile] Compensating delete of %s failed (attempt %d/%d): %v", key, attempt, compensateAttempts, err)
+		if attempt < compensateAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
+
 func (h *ContentHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 	// Extract content ID from URL
 	idStr := r.URL.Query().Get("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		respondWithInvalidUUID(w, "Invalid ID", "id", idStr, err)
 		return
 	}
 
@@ -162,6 +444,11 @@ func (h *ContentHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !content.Enabled {
+		respondContentDisabled(w)
+		return
+	}
+
 	// Check if StorageKey is valid before using it
 	if !content.StorageKey.Valid {
 		log.Printf("Error: Content ID %s has NULL storage key in DownloadFile handler", idStr)
@@ -169,9 +456,15 @@ func (h *ContentHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	storageKey := content.StorageKey.String // Get the string value
+	backend, err := h.backendNamed(content.StorageBackend)
+	if err != nil {
+		log.Printf("Error: Content ID %s is stored in an unavailable backend: %v", idStr, err)
+		http.Error(w, "Internal Server Error: Storage backend unavailable", http.StatusInternalServerError)
+		return
+	}
 
 	// Get file from storage using the valid string key
-	reader, info, err := h.storage.Download(r.Context(), storageKey)
+	reader, info, err := backend.Download(r.Context(), storageKey)
 	if err != nil {
 		// Log the key being used
 		log.Printf("Error downloading from storage with key '%s': %v", storageKey, err)
@@ -203,7 +496,7 @@ func (h *ContentHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 
 // List all content
 func (h *ContentHandler) ListContent(w http.ResponseWriter, r *http.Request) {
-	contents, err := h.store.List(r.Context())
+	contents, _, err := h.store.List(r.Context(), db.ListOptions{})
 	if err != nil {
 		log.Printf("[Error] Failed to list content: %v", err)
 		http.Error(w, "Failed to list content", http.StatusInternalServerError)
@@ -219,7 +512,7 @@ func (h *ContentHandler) GetContent(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		respondWithInvalidUUID(w, "Invalid ID", "id", idStr, err)
 		return
 	}
 
@@ -236,3 +529,145 @@ func (h *ContentHandler) GetContent(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(content)
 }
+
+// GetChecksum returns the SHA-256 recorded for the content, so a client can
+// check a download itself. Returns 404 when none has been recorded.
+func (h *ContentHandler) GetChecksum(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	idStr := r.URL.Query().Get("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid ID", "id", idStr, err)
+		return
+	}
+
+	content, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !content.Checksum.Valid {
+		http.Error(w, "No checksum recorded for this content", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"id":        id.String(),
+		"algorithm": "sha256",
+		"checksum":  strings.ToLower(content.Checksum.String),
+	})
+}
+
+// LatestVersion reports the newest release of an app type, GET
+// ?app_type=&current_version=. With current_version the response also says
+// whether that release is newer than the client's.
+func (h *ContentHandler) LatestVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	appType := r.URL.Query().Get("app_type")
+	if appType == "" {
+		respondWithError(w, http.StatusBadRequest, "app_type is required")
+		return
+	}
+	var current *semver.Version
+	if v := r.URL.Query().Get("current_version"); v != "" {
+		parsed, err := semver.Parse(v)
+		if err != nil {
+			writeErrorResponse(w, ErrorResponse{
+				Error:  "Invalid current_version",
+				Code:   http.StatusBadRequest,
+				Field:  "current_version",
+				Value:  truncateValue(v),
+				Reason: err.Error(),
+			})
+			return
+		}
+		current = &parsed
+	}
+
+	latest, err := h.store.GetLatestVersion(r.Context(), appType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "No release found for this app_type")
+			return
+		}
+		log.Printf("[LatestVersion] [Error] Lookup failed for %s: %v", appType, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to look up latest version")
+		return
+	}
+
+	resp := map[string]interface{}{
+		"app_type":   appType,
+		"version":    latest.ReleaseVersion(),
+		"content_id": latest.ID,
+		"size":       latest.Size,
+	}
+	if current != nil {
+		// GetLatestVersion only returns versions that parse
+		v, _ := semver.Parse(latest.ReleaseVersion())
+		resp["current_version"] = r.URL.Query().Get("current_version")
+		resp["update_available"] = semver.Compare(v, *current) > 0
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// VerifyChecksum compares a client-computed SHA-256 against the checksum
+// recorded for the content, e.g. to settle whether a download was corrupted.
+func (h *ContentHandler) VerifyChecksum(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	idStr := r.URL.Query().Get("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid ID", "id", idStr, err)
+		return
+	}
+
+	supplied, err := hex.DecodeString(strings.ToLower(r.URL.Query().Get("sha256")))
+	if err != nil || len(supplied) != 32 {
+		http.Error(w, "sha256 must be a 64 character hex digest", http.StatusBadRequest)
+		return
+	}
+
+	content, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !content.Checksum.Valid {
+		http.Error(w, "No checksum recorded for this content", http.StatusNotFound)
+		return
+	}
+	stored, err := hex.DecodeString(content.Checksum.String)
+	if err != nil {
+		log.Printf("[Error] Content %s has malformed stored checksum: %v", id, err)
+		http.Error(w, "Stored checksum is invalid", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{
+		"match": subtle.ConstantTimeCompare(supplied, stored) == 1,
+	})
+}
@@ -0,0 +1,487 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/storage"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestResolveContentType(t *testing.T) {
+	defaults := map[string]string{
+		"linux-app": "application/x-executable",
+		"document":  "application/pdf",
+	}
+
+	tests := []struct {
+		name       string
+		headerType string
+		appType    string
+		want       string
+	}{
+		{"Mapped type with empty header", "", "linux-app", "application/x-executable"},
+		{"Mapped type with generic header", "application/octet-stream", "document", "application/pdf"},
+		{"Specific header wins over mapping", "application/zip", "linux-app", "application/zip"},
+		{"Unmapped type keeps header", "application/octet-stream", "unknown-app", "application/octet-stream"},
+		{"Unmapped type with empty header", "", "unknown-app", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveContentType(tt.headerType, tt.appType, defaults)
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateLicenseURL(t *testing.T) {
+	tests := []struct {
+		raw     string
+		wantErr bool
+	}{
+		{"", false},
+		{"https://opensource.org/licenses/MIT", false},
+		{"http://example.com/license.txt", false},
+		{"opensource.org/licenses/MIT", true},
+		{"ftp://example.com/license", true},
+		{"https://", true},
+		{"://bad", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			err := validateLicenseURL(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateLicenseURL(%q) error = %v, wantErr %t", tt.raw, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateDuplicateStorageKey(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	key := "test/" + uuid.New().String() + ".bin"
+	newContent := func() *db.Content {
+		return &db.Content{
+			Name:       "Duplicate Key Content",
+			Type:       "test",
+			Version:    "1.0",
+			FilePath:   key,
+			Size:       1024,
+			StorageKey: sql.NullString{String: key, Valid: true},
+		}
+	}
+
+	if err := store.Create(context.Background(), newContent()); err != nil {
+		t.Fatalf("Failed to create first content: %v", err)
+	}
+
+	t.Run("Store returns typed error", func(t *testing.T) {
+		err := store.Create(context.Background(), newContent())
+		if !errors.Is(err, db.ErrDuplicateStorageKey) {
+			t.Errorf("Expected ErrDuplicateStorageKey, got %v", err)
+		}
+	})
+
+	t.Run("Handler responds 409", func(t *testing.T) {
+		body, _ := json.Marshal(newContent())
+		req := httptest.NewRequest("POST", "/api/content", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+
+		NewContentHandler(store, nil).Create(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("Expected status %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+}
+
+func TestExistingStorageKeys(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	key := "test/" + uuid.New().String() + ".bin"
+	content := &db.Content{
+		Name:       "Bulk Exists Content",
+		Type:       "test",
+		Version:    "1.0",
+		FilePath:   key,
+		Size:       1,
+		StorageKey: sql.NullString{String: key, Valid: true},
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("Failed to create content: %v", err)
+	}
+
+	missing := "test/" + uuid.New().String() + ".bin"
+	existing, err := store.ExistingStorageKeys(context.Background(), []string{key, missing})
+	if err != nil {
+		t.Fatalf("ExistingStorageKeys: %v", err)
+	}
+	if !existing[key] || existing[missing] || len(existing) != 1 {
+		t.Errorf("Unexpected result: %v", existing)
+	}
+}
+
+// fakeStorage is an in-memory StorageService whose deletes can be made to fail
+type fakeStorage struct {
+	objects        map[string][]byte
+	deleteFailures int // deletes that fail before one succeeds; -1 fails forever
+	deleteCalls    int
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{objects: make(map[string][]byte)}
+}
+
+func (f *fakeStorage) Upload(ctx context.Context, file io.Reader, key string, contentType string) (*storage.FileInfo, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[key] = data
+	return &storage.FileInfo{Key: key, Size: int64(len(data)), ContentType: contentType}, nil
+}
+
+func (f *fakeStorage) Download(ctx context.Context, key string) (io.ReadCloser, *storage.FileInfo, error) {
+	data, ok := f.objects[key]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+	}
+	return io.NopCloser(bytes.NewReader(data)), &storage.FileInfo{Key: key, Size: int64(len(data))}, nil
+}
+
+func (f *fakeStorage) Delete(ctx context.Context, key string) error {
+	f.deleteCalls++
+	if f.deleteFailures != 0 {
+		if f.deleteFailures > 0 {
+			f.deleteFailures--
+		}
+		return fmt.Errorf("%w: delete %s", storage.ErrUpstream, key)
+	}
+	delete(f.objects, key)
+	return nil
+}
+
+func (f *fakeStorage) GetInfo(ctx context.Context, key string) (*storage.FileInfo, error) {
+	data, ok := f.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+	}
+	return &storage.FileInfo{Key: key, Size: int64(len(data))}, nil
+}
+
+func (f *fakeStorage) ListFiles(ctx context.Context, prefix string) ([]storage.FileInfo, error) {
+	var files []storage.FileInfo
+	for key, data := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			files = append(files, storage.FileInfo{Key: key, Size: int64(len(data))})
+		}
+	}
+	return files, nil
+}
+
+func TestCompensateUpload(t *testing.T) {
+	defer func(d time.Duration) { compensateRetryDelay = d }(compensateRetryDelay)
+	compensateRetryDelay = time.Millisecond
+
+	t.Run("Transient failure is retried", func(t *testing.T) {
+		svc := newFakeStorage()
+		svc.objects["a.zip"] = []byte("a")
+		svc.deleteFailures = compensateAttempts - 1
+
+		if err := compensateUpload(context.Background(), svc, "a.zip"); err != nil {
+			t.Fatalf("Expected delete to succeed on the last attempt, got %v", err)
+		}
+		if _, ok := svc.objects["a.zip"]; ok {
+			t.Error("Expected object to be removed")
+		}
+	})
+
+	t.Run("Persistent failure is returned", func(t *testing.T) {
+		svc := newFakeStorage()
+		svc.objects["a.zip"] = []byte("a")
+		svc.deleteFailures = -1
+
+		err := compensateUpload(context.Background(), svc, "a.zip")
+		if !errors.Is(err, storage.ErrUpstream) {
+			t.Fatalf("Expected upstream error, got %v", err)
+		}
+		if svc.deleteCalls != compensateAttempts {
+			t.Errorf("Expected %d delete attempts, got %d", compensateAttempts, svc.deleteCalls)
+		}
+	})
+
+	t.Run("Cancelled request still cleans up", func(t *testing.T) {
+		svc := newFakeStorage()
+		svc.objects["a.zip"] = []byte("a")
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := compensateUpload(ctx, svc, "a.zip"); err != nil {
+			t.Fatalf("Expected delete to succeed, got %v", err)
+		}
+	})
+}
+
+func newUploadRequest(t *testing.T, filename, version string) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("app_type", "test-app-"+uuid.New().String())
+	mw.WriteField("version", version)
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	part.Write([]byte("payload"))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestUploadFileCompensation(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	defer func(d time.Duration) { compensateRetryDelay = d }(compensateRetryDelay)
+	compensateRetryDelay = time.Millisecond
+
+	t.Run("Success keeps object and record", func(t *testing.T) {
+		svc := newFakeStorage()
+		filename := uuid.New().String() + ".zip"
+		rr := httptest.NewRecorder()
+		NewContentHandler(store, svc).UploadFile(rr, newUploadRequest(t, filename, "1.0"))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var content db.Content
+		if err := json.NewDecoder(rr.Body).Decode(&content); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		key := content.StorageKey.String
+		if !strings.HasSuffix(key, "-"+filename) {
+			t.Errorf("Expected a fresh key ending in %s, got %q", filename, key)
+		}
+		if _, ok := svc.objects[key]; !ok {
+			t.Error("Expected object in storage")
+		}
+		exists, err := store.Exists(context.Background(), key)
+		if err != nil || !exists {
+			t.Errorf("Expected record for %s, exists=%t err=%v", key, exists, err)
+		}
+	})
+
+	// Postgres rejects NUL bytes in text, so this version makes the insert fail
+	badVersion := "1.0\x00"
+
+	t.Run("DB failure deletes object", func(t *testing.T) {
+		svc := newFakeStorage()
+		filename := uuid.New().String() + ".zip"
+		rr := httptest.NewRecorder()
+		NewContentHandler(store, svc).UploadFile(rr, newUploadRequest(t, filename, badVersion))
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+		if len(svc.objects) != 0 {
+			t.Error("Expected compensating delete to remove the object")
+		}
+		if strings.Contains(rr.Body.String(), "could not be removed") {
+			t.Errorf("Unexpected orphan report: %s", rr.Body.String())
+		}
+	})
+
+	t.Run("Failed compensation is surfaced", func(t *testing.T) {
+		svc := newFakeStorage()
+		svc.deleteFailures = -1
+		filename := uuid.New().String() + ".zip"
+		rr := httptest.NewRecorder()
+		NewContentHandler(store, svc).UploadFile(rr, newUploadRequest(t, filename, badVersion))
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+		var resp ErrorResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Expected JSON error body: %v", err)
+		}
+		if !strings.Contains(resp.Error, filename) || !strings.Contains(resp.Error, "could not be removed") {
+			t.Errorf("Expected orphaned key in error, got %q", resp.Error)
+		}
+		if svc.deleteCalls != compensateAttempts {
+			t.Errorf("Expected %d delete attempts, got %d", compensateAttempts, svc.deleteCalls)
+		}
+	})
+}
+
+func TestListRejectsUnknownSort(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/content?sort=downloads", nil)
+	rr := httptest.NewRecorder()
+	NewContentHandler(nil, nil).List(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Field != "sort" || resp.Value != "downloads" {
+		t.Errorf("Unexpected error response: %+v", resp)
+	}
+}
+
+func TestListRejectsInvalidPaging(t *testing.T) {
+	tests := []struct {
+		query string
+		field string
+	}{
+		{"limit=0", "limit"},
+		{"limit=201", "limit"},
+		{"limit=ten", "limit"},
+		{"offset=-1", "offset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/content?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			NewContentHandler(nil, nil).List(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+			var resp ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Field != tt.field {
+				t.Errorf("Expected field %q, got %+v", tt.field, resp)
+			}
+		})
+	}
+}
+
+func TestContentChecksum(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	payload := "lesson notes"
+	checksum := "9e8a1d4e5d9a1e33e8c36e1e0a4f1b5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c"
+	svc := newFakeStorage()
+	key := "test/" + uuid.New().String() + ".txt"
+	svc.objects[key] = []byte(payload)
+	content := &db.Content{
+		Name:        "notes.txt",
+		Type:        "test",
+		Version:     "1.0",
+		FilePath:    key,
+		Size:        int64(len(payload)),
+		StorageKey:  sql.NullString{String: key, Valid: true},
+		ContentType: sql.NullString{String: "text/plain", Valid: true},
+		Checksum:    sql.NullString{String: checksum, Valid: true},
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("Failed to create content: %v", err)
+	}
+	unsummed := createTestContent(t, store)
+
+	handler := NewContentHandler(store, svc)
+
+	t.Run("Recorded checksum is returned", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.GetChecksum(rr, httptest.NewRequest(http.MethodGet, "/api/content/checksum?id="+content.ID.String(), nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var got map[string]string
+		json.NewDecoder(rr.Body).Decode(&got)
+		if got["checksum"] != checksum || got["algorithm"] != "sha256" {
+			t.Errorf("Unexpected response: %v", got)
+		}
+	})
+
+	t.Run("Missing checksum is 404", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.GetChecksum(rr, httptest.NewRequest(http.MethodGet, "/api/content/checksum?id="+unsummed.ID.String(), nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Signed downloads carry the checksum", func(t *testing.T) {
+		downloads := NewDownloadHandler(store, svc)
+		signed, err := downloads.urlGenerator.GenerateURL(content.ID, time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to sign URL: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		downloads.HandleSignedDownload(rr, httptest.NewRequest(http.MethodGet, signed, nil))
+		if got := rr.Header().Get(checksumHeader); got != checksum {
+			t.Errorf("Expected %s %q, got %q", checksumHeader, checksum, got)
+		}
+	})
+}
+
+func TestLatestVersion(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	handler := NewContentHandler(store, newFakeStorage())
+
+	appType := "test-app-" + uuid.New().String()
+	var newest *db.Content
+	for _, version := range []string{"1.9.0", "1.10.0", "1.10.0-beta.1", "not-a-version"} {
+		c := &db.Content{Name: "app.zip", Type: "test", Version: version, AppType: appType, FilePath: "test/app.zip", Size: 1024}
+		if err := store.Create(context.Background(), c); err != nil {
+			t.Fatalf("Failed to create content: %v", err)
+		}
+		if version == "1.10.0" {
+			newest = c
+		}
+	}
+
+	get := func(query string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		rr := httptest.NewRecorder()
+		handler.LatestVersion(rr, httptest.NewRequest(http.MethodGet, "/api/content/latest?"+query, nil))
+		var resp map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr, resp
+	}
+
+	rr, resp := get("app_type=" + appType + "&current_version=1.9.0")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rr.Code)
+	}
+	if resp["version"] != "1.10.0" || resp["content_id"] != newest.ID.String() || resp["update_available"] != true {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+
+	if _, resp := get("app_type=" + appType + "&current_version=v1.10.0"); resp["update_available"] != false {
+		t.Errorf("Expected no update for the current release, got %v", resp)
+	}
+	if rr, _ := get("app_type=" + appType + "&current_version=latest"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid current_version, got %d", rr.Code)
+	}
+	if rr, _ := get("app_type=unknown-" + uuid.New().String()); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown app_type, got %d", rr.Code)
+	}
+}
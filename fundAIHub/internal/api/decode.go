@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// errTrailingData reports bytes after the first JSON value in a body
+var errTrailingData = errors.New("request body must contain a single JSON object")
+
+// decodeJSON decodes exactly one JSON value from body into dst, rejecting
+// fields dst does not declare and anything after the value
+func decodeJSON(body io.Reader, dst interface{}) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+// respondWithDecodeError turns a decodeJSON error into a 400 that names the
+// offending field and what was expected, where the decoder says so
+func respondWithDecodeError(w http.ResponseWriter, err error) {
+	resp := ErrorResponse{Error: "Invalid request body", Code: http.StatusBadRequest}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		resp.Error = "Malformed JSON"
+		resp.Reason = fmt.Sprintf("%s at offset %d", syntaxErr.Error(), syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		resp.Error = "Invalid value for field"
+		resp.Field = typeErr.Field
+		resp.Reason = fmt.Sprintf("expected %s, got %s", jsonTypeName(typeErr.Type), typeErr.Value)
+	case errors.Is(err, io.EOF):
+		resp.Reason = "body is empty"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		resp.Error = "Malformed JSON"
+		resp.Reason = "unexpected end of input"
+	case errors.Is(err, errTrailingData):
+		resp.Reason = errTrailingData.Error()
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for this one
+		resp.Error = "Unknown field"
+		resp.Field = strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+	default:
+		resp.Reason = err.Error()
+	}
+	writeErrorResponse(w, resp)
+}
+
+// jsonTypeName describes a Go type the way a JSON client thinks of it
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return t.String()
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRespondWithDecodeError(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantError  string
+		wantField  string
+		wantReason string
+	}{
+		{"Type mismatch", `{"contentId": 42}`, "Invalid value for field", "contentId", "expected string, got number"},
+		{"Trailing garbage", `{"contentId": "x"} garbage`, "Invalid request body", "", errTrailingData.Error()},
+		{"Second object", `{"contentId": "x"}{"contentId": "y"}`, "Invalid request body", "", errTrailingData.Error()},
+		{"Unknown field", `{"content_id": "x"}`, "Unknown field", "content_id", ""},
+		{"Malformed", `{"contentId": }`, "Malformed JSON", "", ""},
+		{"Truncated", `{"contentId": "x"`, "Malformed JSON", "", "unexpected end of input"},
+		{"Empty", ``, "Invalid request body", "", "body is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req struct {
+				ContentID string `json:"contentId"`
+				Resume    bool   `json:"resume,omitempty"`
+			}
+			err := decodeJSON(strings.NewReader(tt.body), &req)
+			if err == nil {
+				t.Fatal("Expected a decode error")
+			}
+
+			rr := httptest.NewRecorder()
+			respondWithDecodeError(rr, err)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+
+			var resp ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Error != tt.wantError {
+				t.Errorf("Expected error %q, got %q", tt.wantError, resp.Error)
+			}
+			if resp.Field != tt.wantField {
+				t.Errorf("Expected field %q, got %q", tt.wantField, resp.Field)
+			}
+			if tt.wantReason != "" && resp.Reason != tt.wantReason {
+				t.Errorf("Expected reason %q, got %q", tt.wantReason, resp.Reason)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONAcceptsTrailingWhitespace(t *testing.T) {
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := decodeJSON(strings.NewReader("{\"id\": \"abc\"}\n  "), &req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if req.ID != "abc" {
+		t.Errorf("Expected id %q, got %q", "abc", req.ID)
+	}
+}
+
+func TestDownloadHandlersRejectBadJSON(t *testing.T) {
+	handler := &DownloadHandler{}
+	tests := []struct {
+		name      string
+		method    string
+		body      string
+		serve     http.HandlerFunc
+		wantField string
+	}{
+		{"StartDownload type mismatch", http.MethodPost, `{"contentId": true}`, handler.StartDownload, "contentId"},
+		{"StartDownload trailing garbage", http.MethodPost, `{"contentId": "x"}]`, handler.StartDownload, ""},
+		{"UpdateStatus type mismatch", http.MethodPut, `{"id": "x", "bytes_downloaded": "many"}`, handler.UpdateStatus, "bytes_downloaded"},
+		{"UpdateStatus trailing garbage", http.MethodPut, `{"id": "x"} trailing`, handler.UpdateStatus, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/downloads", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			tt.serve(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+			var resp ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Field != tt.wantField {
+				t.Errorf("Expected field %q, got %q", tt.wantField, resp.Field)
+			}
+		})
+	}
+}
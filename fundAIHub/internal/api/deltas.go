@@ -0,0 +1,260 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/semver"
+	"FundAIHub/internal/storage"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// DeltaPatch is one patch a client downloads and applies in turn
+type DeltaPatch struct {
+	ID          uuid.UUID `json:"id"`
+	FromVersion string    `json:"from_version"`
+	ToVersion   string    `json:"to_version"`
+	Size        int64     `json:"size"`
+	Checksum    string    `json:"checksum"`
+	DownloadURL string    `json:"download_url"`
+}
+
+// DeltaResponse tells a client how to update to a content record from the
+// version it has: by applying Patches in order or, when
+// FullDownloadRequired is set, by downloading the whole file
+type DeltaResponse struct {
+	ContentID            uuid.UUID    `json:"content_id"`
+	FromVersion          string       `json:"from_version"`
+	ToVersion            string       `json:"to_version"`
+	FullDownloadRequired bool         `json:"full_download_required"`
+	Reason               string       `json:"reason,omitempty"`
+	FullSize             int64        `json:"full_size"`
+	PatchSize            int64        `json:"patch_size"`
+	Patches              []DeltaPatch `json:"patches"`
+}
+
+// deltaObjectKey is where an uploaded patch is stored
+func deltaObjectKey() string {
+	return "deltas/" + uuid.New().String()
+}
+
+// UploadDelta stores a patch between two releases of an app type, POST
+// multipart with file, app_type, from_version and to_version
+func (h *ContentHandler) UploadDelta(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !h.checkUploadSize(w, r) {
+		return
+	}
+
+	form, err := openUploadForm(r, "file", h.maxFormParts, h.maxFormFieldBytes, "app_type", "from_version", "to_version")
+	if err != nil {
+		respondWithFormError(w, err)
+		return
+	}
+
+	delta := &db.ContentDelta{
+		AppType:     form.value("app_type"),
+		FromVersion: form.value("from_version"),
+		ToVersion:   form.value("to_version"),
+	}
+	// Refuse bad versions before anything is stored
+	var versions [2]semver.Version
+	for i, field := range []string{"from_version", "to_version"} {
+		if versions[i], err = semver.Parse(form.value(field)); err != nil {
+			writeErrorResponse(w, ErrorResponse{
+				Error:  "Invalid " + field,
+				Code:   http.StatusBadRequest,
+				Field:  field,
+				Value:  truncateValue(form.value(field)),
+				Reason: err.Error(),
+			})
+			return
+		}
+	}
+	if semver.Compare(versions[0], versions[1]) >= 0 {
+		respondWithError(w, http.StatusBadRequest, "from_version must be lower than to_version")
+		return
+	}
+
+	fileInfo, err := h.storage.Upload(r.Context(), form, deltaObjectKey(), "application/octet-stream")
+	if err != nil {
+		log.Printf("[UploadDelta] [Error] Storage upload failed: %v", err)
+		respondStorageUploadFailed(w, form)
+		return
+	}
+	if !h.finishUpload(w, r, form, fileInfo.Key) {
+		return
+	}
+	delta.StorageKey = fileInfo.Key
+	delta.Size = form.size
+	delta.Checksum = form.checksum
+
+	if err := h.store.CreateDelta(r.Context(), delta); err != nil {
+		if delErr := compensateUpload(r.Context(), h.storage, fileInfo.Key); delErr != nil {
+			log.Printf("[UploadDelta] [Orphan] Object %s left in storage without a record: %v", fileInfo.Key, delErr)
+		}
+		if errors.Is(err, db.ErrDuplicateDelta) {
+			respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		log.Printf("[UploadDelta] [Error] Failed to record delta %s: %v", fileInfo.Key, err)
+		http.Error(w, "Failed to record delta", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[UploadDelta] Stored %s delta %s -> %s (%d bytes)", delta.AppType, delta.FromVersion, delta.ToVersion, delta.Size)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(delta)
+}
+
+// GetDelta serves GET /api/content/delta?id=&from= with the smallest chain
+// of patches from the client's version to the content's, or says a full
+// download is needed: when there is no chain, when it would be no smaller
+// than the file itself, or when the content has no semantic version.
+func (h *ContentHandler) GetDelta(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	idStr := r.URL.Query().Get("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid ID", "id", idStr, err)
+		return
+	}
+	fromStr := r.URL.Query().Get("from")
+	from, err := db.CanonicalVersion(fromStr)
+	if err != nil {
+		writeErrorResponse(w, ErrorResponse{
+			Error:  "Invalid from version",
+			Code:   http.StatusBadRequest,
+			Field:  "from",
+			Value:  truncateValue(fromStr),
+			Reason: err.Error(),
+		})
+		return
+	}
+
+	content, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !content.Enabled {
+		respondContentDisabled(w)
+		return
+	}
+
+	resp := DeltaResponse{
+		ContentID:   content.ID,
+		FromVersion: from,
+		ToVersion:   content.ReleaseVersion(),
+		FullSize:    content.Size,
+		Patches:     []DeltaPatch{},
+	}
+	to, err := db.CanonicalVersion(content.ReleaseVersion())
+	if err != nil {
+		resp.FullDownloadRequired, resp.Reason = true, "content has no semantic version"
+		respondDelta(w, resp)
+		return
+	}
+	resp.ToVersion = to
+
+	chain, err := h.store.FindDeltaChain(r.Context(), content.AppType, from, to)
+	if errors.Is(err, db.ErrNoDeltaChain) {
+		resp.FullDownloadRequired, resp.Reason = true, "no patches lead from this version"
+		respondDelta(w, resp)
+		return
+	}
+	if err != nil {
+		log.Printf("[GetDelta] [Error] Failed to find deltas for %s from %s: %v", id, from, err)
+		http.Error(w, "Failed to look up deltas", http.StatusInternalServerError)
+		return
+	}
+
+	for _, d := range chain {
+		resp.PatchSize += d.Size
+		resp.Patches = append(resp.Patches, DeltaPatch{
+			ID:          d.ID,
+			FromVersion: d.FromVersion,
+			ToVersion:   d.ToVersion,
+			Size:        d.Size,
+			Checksum:    d.Checksum,
+			DownloadURL: "/api/content/delta/file?id=" + d.ID.String(),
+		})
+	}
+	if len(chain) > 0 && content.Size > 0 && resp.PatchSize >= content.Size {
+		resp.FullDownloadRequired, resp.Reason = true, "patches are no smaller than the full download"
+		resp.Patches, resp.PatchSize = []DeltaPatch{}, 0
+	}
+	respondDelta(w, resp)
+}
+
+func respondDelta(w http.ResponseWriter, resp DeltaResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// DownloadDelta streams a stored patch, GET ?id=<delta id>, with its
+// checksum in the X-Content-SHA256 header
+func (h *ContentHandler) DownloadDelta(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	idStr := r.URL.Query().Get("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid ID", "id", idStr, err)
+		return
+	}
+
+	delta, err := h.store.GetDelta(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Delta not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[DownloadDelta] [Error] Failed to look up delta %s: %v", id, err)
+		http.Error(w, "Failed to look up delta", http.StatusInternalServerError)
+		return
+	}
+
+	reader, _, err := h.storage.Download(r.Context(), delta.StorageKey)
+	if err != nil {
+		log.Printf("[DownloadDelta] [Error] Failed to open %s: %v", delta.StorageKey, err)
+		if errors.Is(err, storage.ErrNotFound) {
+			respondContentUnavailable(w, http.StatusGone, "Delta file is missing from storage", 0)
+			return
+		}
+		http.Error(w, "Failed to access storage", http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		fmt.Sprintf("%s-%s-to-%s.patch", delta.AppType, delta.FromVersion, delta.ToVersion)))
+	w.Header().Set("Content-Length", strconv.FormatInt(delta.Size, 10))
+	w.Header().Set(checksumHeader, delta.Checksum)
+	if n, err := io.Copy(w, reader); err != nil {
+		log.Printf("[DownloadDelta] Stream of delta %s aborted after %d bytes: %v", id, n, err)
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestContentDeltas(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	svc := newFakeStorage()
+	handler := NewContentHandler(store, svc)
+
+	appType := "delta-app-" + uuid.New().String()
+	target := &db.Content{Name: "app.zip", Type: "test", Version: "1.2.0", AppType: appType, FilePath: "test/app.zip", Size: 100}
+	if err := store.Create(context.Background(), target); err != nil {
+		t.Fatalf("Failed to create content: %v", err)
+	}
+
+	upload := func(from, to, body string) *httptest.ResponseRecorder {
+		req := multipartRequest(t, [][2]string{{"app_type", appType}, {"from_version", from}, {"to_version", to}}, body)
+		rr := httptest.NewRecorder()
+		handler.UploadDelta(rr, req)
+		return rr
+	}
+	for _, d := range [][2]string{{"1.0.0", "1.1.0"}, {"1.1.0", "1.2.0"}} {
+		if rr := upload(d[0], d[1], "patch "+d[0]); rr.Code != http.StatusCreated {
+			t.Fatalf("Expected 201 uploading %s -> %s, got %d: %s", d[0], d[1], rr.Code, rr.Body.String())
+		}
+	}
+	if rr := upload("1.0.0", "1.1.0", "again"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate delta, got %d", rr.Code)
+	}
+	if rr := upload("1.2.0", "1.1.0", "backwards"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a backwards delta, got %d", rr.Code)
+	}
+
+	get := func(from string) DeltaResponse {
+		rr := httptest.NewRecorder()
+		handler.GetDelta(rr, httptest.NewRequest(http.MethodGet, "/api/content/delta?id="+target.ID.String()+"&from="+from, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp DeltaResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return resp
+	}
+
+	resp := get("v1.0")
+	if resp.FullDownloadRequired || len(resp.Patches) != 2 || resp.PatchSize != int64(len("patch 1.0.0")+len("patch 1.1.0")) {
+		t.Fatalf("Unexpected chain: %+v", resp)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.DownloadDelta(rr, httptest.NewRequest(http.MethodGet, resp.Patches[0].DownloadURL, nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "patch 1.0.0" {
+		t.Errorf("Expected the first patch, got %d: %q", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get(checksumHeader); got != resp.Patches[0].Checksum || len(got) != 64 {
+		t.Errorf("Expected checksum %q, got %q", resp.Patches[0].Checksum, got)
+	}
+
+	if resp := get("0.9.0"); !resp.FullDownloadRequired || len(resp.Patches) != 0 {
+		t.Errorf("Expected a full download without a chain, got %+v", resp)
+	}
+
+	// A chain as large as the file itself is not worth it
+	if rr := upload("0.5.0", "1.2.0", strings.Repeat("x", 100)); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", rr.Code)
+	}
+	if resp := get("0.5.0"); !resp.FullDownloadRequired {
+		t.Errorf("Expected a full download for an oversized patch, got %+v", resp)
+	}
+}
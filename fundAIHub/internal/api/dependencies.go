@@ -0,0 +1,142 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DependencyItem is one piece of content a client must also download
+type DependencyItem struct {
+	ContentID   uuid.UUID `json:"content_id"`
+	Name        string    `json:"name"`
+	Version     string    `json:"version"`
+	AppType     string    `json:"app_type"`
+	Size        int64     `json:"size"`
+	DownloadURL string    `json:"download_url"`
+}
+
+// DependencyResponse lists everything contentID needs, in install order
+type DependencyResponse struct {
+	ContentID    uuid.UUID        `json:"content_id"`
+	Dependencies []DependencyItem `json:"dependencies"`
+}
+
+// GetDependencies serves GET /api/content/{id}/dependencies with the
+// transitive closure of the content's dependencies and a signed URL for each.
+func (h *DownloadHandler) GetDependencies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/api/content/")
+	idStr, suffix, ok := strings.Cut(rest, "/")
+	if !ok || suffix != "dependencies" {
+		http.NotFound(w, r)
+		return
+	}
+	contentID, err := uuid.Parse(idStr)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid content ID", "id", idStr, err)
+		return
+	}
+
+	if _, err := h.store.Get(r.Context(), contentID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	deps, err := h.store.ResolveDependencies(r.Context(), contentID)
+	if err != nil {
+		log.Printf("[GetDependencies] [Error] Failed to resolve dependencies for %s: %v", contentID, err)
+		http.Error(w, "Failed to resolve dependencies", http.StatusInternalServerError)
+		return
+	}
+
+	resp := DependencyResponse{ContentID: contentID, Dependencies: []DependencyItem{}}
+	for _, dep := range deps {
+		// The content cannot be installed without every dependency
+		if dep.DeletedAt != nil {
+			log.Printf("[GetDependencies] Dependency %s of %s is deleted", dep.ID, contentID)
+			respondContentUnavailable(w, http.StatusGone, "A dependency of this content has been deleted", 0)
+			return
+		}
+		url, err := h.urlGenerator.GenerateURL(dep.ID, time.Hour)
+		if errors.Is(err, ErrContentDisabled) {
+			log.Printf("[GetDependencies] Dependency %s of %s is disabled", dep.ID, contentID)
+			respondContentDisabled(w)
+			return
+		}
+		if err != nil {
+			log.Printf("[GetDependencies] [Error] Failed to sign URL for %s: %v", dep.ID, err)
+			http.Error(w, "Failed to generate download URLs", http.StatusInternalServerError)
+			return
+		}
+		resp.Dependencies = append(resp.Dependencies, DependencyItem{
+			ContentID:   dep.ID,
+			Name:        dep.Name,
+			Version:     dep.Version,
+			AppType:     dep.AppType,
+			Size:        dep.Size,
+			DownloadURL: url,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// AddDependency records that one content record requires another.
+// POST {"content_id": "...", "depends_on_id": "..."}
+func (h *AdminHandler) AddDependency(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req struct {
+		ContentID   string `json:"content_id"`
+		DependsOnID string `json:"depends_on_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	contentID, err := uuid.Parse(req.ContentID)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid content ID", "content_id", req.ContentID, err)
+		return
+	}
+	dependsOnID, err := uuid.Parse(req.DependsOnID)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid dependency ID", "depends_on_id", req.DependsOnID, err)
+		return
+	}
+
+	if err := h.store.AddDependency(r.Context(), contentID, dependsOnID); err != nil {
+		switch {
+		case errors.Is(err, db.ErrDependencyCycle):
+			respondWithError(w, http.StatusConflict, err.Error())
+		case err == sql.ErrNoRows:
+			http.Error(w, "Content not found", http.StatusNotFound)
+		default:
+			log.Printf("[AddDependency] [Error] %s -> %s: %v", contentID, dependsOnID, err)
+			http.Error(w, "Failed to add dependency", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
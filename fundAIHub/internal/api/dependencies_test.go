@@ -0,0 +1,102 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDependencies(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// app -> lib -> runtime
+	newContent := func(name string) *db.Content {
+		c := &db.Content{Name: name, Type: "test", Version: "1.0", FilePath: name, Size: 1}
+		if err := store.Create(ctx, c); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		return c
+	}
+	app, lib, runtime := newContent("dep-app"), newContent("dep-lib"), newContent("dep-runtime")
+
+	if err := store.AddDependency(ctx, app.ID, lib.ID); err != nil {
+		t.Fatalf("AddDependency app->lib: %v", err)
+	}
+	if err := store.AddDependency(ctx, lib.ID, runtime.ID); err != nil {
+		t.Fatalf("AddDependency lib->runtime: %v", err)
+	}
+
+	t.Run("Cycle rejected", func(t *testing.T) {
+		if err := store.AddDependency(ctx, runtime.ID, app.ID); !errors.Is(err, db.ErrDependencyCycle) {
+			t.Errorf("Expected ErrDependencyCycle, got %v", err)
+		}
+	})
+
+	t.Run("Closure in install order", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/content/"+app.ID.String()+"/dependencies", nil)
+		rr := httptest.NewRecorder()
+		NewDownloadHandler(store, nil).GetDependencies(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp DependencyResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(resp.Dependencies) != 2 {
+			t.Fatalf("Expected 2 dependencies, got %d", len(resp.Dependencies))
+		}
+		if resp.Dependencies[0].ContentID != runtime.ID || resp.Dependencies[1].ContentID != lib.ID {
+			t.Errorf("Expected runtime then lib, got %+v", resp.Dependencies)
+		}
+		for _, d := range resp.Dependencies {
+			if d.DownloadURL == "" {
+				t.Errorf("Missing download URL for %s", d.ContentID)
+			}
+		}
+	})
+
+	resolve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/content/"+app.ID.String()+"/dependencies", nil)
+		rr := httptest.NewRecorder()
+		NewDownloadHandler(store, nil).GetDependencies(rr, req)
+		return rr
+	}
+
+	t.Run("Disabled dependency", func(t *testing.T) {
+		if err := store.SetEnabled(ctx, lib.ID, false); err != nil {
+			t.Fatalf("SetEnabled: %v", err)
+		}
+		defer store.SetEnabled(ctx, lib.ID, true)
+		if rr := resolve(); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusForbidden, rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Deleted dependency", func(t *testing.T) {
+		if err := store.SoftDelete(ctx, runtime.ID); err != nil {
+			t.Fatalf("SoftDelete: %v", err)
+		}
+		deps, err := store.ResolveDependencies(ctx, app.ID)
+		if err != nil {
+			t.Fatalf("ResolveDependencies: %v", err)
+		}
+		if len(deps) != 2 || deps[0].ID != runtime.ID || deps[0].DeletedAt == nil {
+			t.Errorf("Expected runtime returned as deleted, got %+v", deps)
+		}
+
+		rr := resolve()
+		var resp ErrorResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if rr.Code != http.StatusGone || resp.ErrorCode != errCodeContentUnavailable {
+			t.Errorf("Expected status %d with %s, got %d %+v", http.StatusGone, errCodeContentUnavailable, rr.Code, resp)
+		}
+	})
+}
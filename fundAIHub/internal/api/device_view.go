@@ -0,0 +1,208 @@
+package api
+
+import (
+	"FundAIHub/internal/auth"
+	"FundAIHub/internal/config"
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/middleware"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// deviceVerifier resolves a device's account and subscription
+type deviceVerifier interface {
+	VerifyDevice(ctx context.Context, hardwareID string) (*auth.DeviceVerifyResponse, int, error)
+}
+
+// DeviceViewHandler lets support staff see a device's plan without the
+// device present. Routes must be wrapped in AuthMiddleware.AdminOnly.
+type DeviceViewHandler struct {
+	store     *db.ContentStore
+	downloads *DownloadHandler
+	vault     deviceVerifier
+	limiter   *windowLimiter
+}
+
+func NewDeviceViewHandler(store *db.ContentStore, downloads *DownloadHandler, vault deviceVerifier) *DeviceViewHandler {
+	cfg := config.GetConfig()
+	return &DeviceViewHandler{
+		store:     store,
+		downloads: downloads,
+		vault:     vault,
+		limiter:   newWindowLimiter(cfg.AdminDeviceViewsPerMinute, time.Minute),
+	}
+}
+
+// DeviceSubscription is what FundaVault reports for an impersonated device
+type DeviceSubscription struct {
+	UserID          int64  `json:"user_id"`
+	Email           string `json:"email"`
+	SubscriptionEnd string `json:"subscription_end,omitempty"`
+	DeviceStatus    string `json:"device_status,omitempty"`
+}
+
+// DeviceView is the metadata-only view of what a device would be offered.
+// DeviceID is the hardware hash; DeviceUUID is what FundaVault maps it to.
+type DeviceView struct {
+	DeviceID          string              `json:"device_id"`
+	DeviceUUID        *uuid.UUID          `json:"device_uuid,omitempty"`
+	Subscription      *DeviceSubscription `json:"subscription"`
+	SubscriptionError string              `json:"subscription_error,omitempty"`
+	Plan              DownloadPlan        `json:"plan"`
+}
+
+// View serves GET /api/admin/devices/{hardwareID}/view. Download URLs are
+// never included, so nothing returned here can fetch content.
+func (h *DeviceViewHandler) View(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/api/admin/devices/")
+	idStr, suffix, ok := strings.Cut(rest, "/")
+	if !ok || suffix != "view" {
+		http.NotFound(w, r)
+		return
+	}
+	deviceID, ok := middleware.NormalizeDeviceID(idStr)
+	if !ok {
+		writeErrorResponse(w, ErrorResponse{
+			Error:  "Invalid device ID",
+			Code:   http.StatusBadRequest,
+			Field:  "hardware_id",
+			Value:  truncateValue(idStr),
+			Reason: "expected 64 hex characters",
+		})
+		return
+	}
+
+	adminID, _ := middleware.UserIDFromContext(r.Context())
+	adminEmail, _ := middleware.EmailFromContext(r.Context())
+	if wait := h.limiter.allow(adminID, time.Now()); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		respondWithError(w, http.StatusTooManyRequests, "Too many device views, try again later")
+		return
+	}
+
+	// Record who looked before looking, so a failed view is still audited
+	entry := &db.AuditEntry{AdminUserID: adminID, AdminEmail: adminEmail, Action: "device_view", Target: deviceID}
+	if err := h.store.CreateAuditEntry(r.Context(), entry); err != nil {
+		log.Printf("[DeviceView] [Error] Failed to write audit entry: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to record audit entry")
+		return
+	}
+	log.Printf("[Audit] Admin %s (%s) viewed device %s", adminID, adminEmail, deviceID)
+
+	view := DeviceView{DeviceID: deviceID, Plan: DownloadPlan{Items: []PlanItem{}}}
+	result, status, err := h.vault.VerifyDevice(r.Context(), deviceID)
+	switch {
+	case err != nil:
+		view.SubscriptionError = fmt.Sprintf("FundaVault returned status %d", status)
+	case result != nil:
+		view.Subscription = &DeviceSubscription{
+			UserID:          result.UserID,
+			Email:           result.Email,
+			SubscriptionEnd: result.SubscriptionEnd,
+			DeviceStatus:    result.DeviceStatus,
+		}
+		if id, err := uuid.Parse(result.DeviceUUID); err == nil {
+			view.DeviceUUID = &id
+		}
+	}
+
+	// Download history is keyed by device UUID, so without one from
+	// FundaVault there is no plan to show
+	if view.DeviceUUID != nil {
+		view.Plan, err = h.downloads.planFor(r.Context(), *view.DeviceUUID)
+		if err != nil {
+			log.Printf("[DeviceView] [Error] %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to build download plan")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// windowLimiter allows up to limit calls per key in each fixed window
+type windowLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	windows map[string]*limitWindow
+}
+
+type limitWindow struct {
+	start time.Time
+	count int
+}
+
+func newWindowLimiter(limit int, window time.Duration) *windowLimiter {
+	return &windowLimiter{limit: limit, window: window, windows: make(map[string]*limitWindow)}
+}
+
+// allow counts a call for key and returns zero if it is permitted, or how
+// long until the next window opens. A limit of zero or less disables it.
+func (l *windowLimiter) allow(key string, now time.Time) time.Duration {
+	if l.limit <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	win, ok := l.windows[key]
+	if !ok || now.Sub(win.start) >= l.window {
+		l.windows[key] = &limitWindow{start: now, count: 1}
+		return 0
+	}
+	if win.count >= l.limit {
+		return win.start.Add(l.window).Sub(now)
+	}
+	win.count++
+	return 0
+}
+
+// cleanup drops windows that have ended, since a new window would be the
+// same, and returns how many it dropped
+func (l *windowLimiter) cleanup(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dropped := 0
+	for key, win := range l.windows {
+		if now.Sub(win.start) >= l.window {
+			delete(l.windows, key)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// RunLimiterCleanup drops ended rate limit windows on each tick until ctx is
+// done, so admins who stop viewing devices are not kept in memory
+func (h *DeviceViewHandler) RunLimiterCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if dropped := h.limiter.cleanup(time.Now()); dropped > 0 {
+			log.Printf("[DeviceView] Dropped %d idle rate limit windows", dropped)
+		}
+	}
+}
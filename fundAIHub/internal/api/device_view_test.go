@@ -0,0 +1,92 @@
+package api
+
+import (
+	"FundAIHub/internal/auth"
+	"FundAIHub/internal/middleware"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestWindowLimiter(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newWindowLimiter(2, time.Minute)
+
+	if l.allow("admin", start) != 0 || l.allow("admin", start.Add(time.Second)) != 0 {
+		t.Fatal("Expected the first two calls to be allowed")
+	}
+	if wait := l.allow("admin", start.Add(10*time.Second)); wait != 50*time.Second {
+		t.Errorf("Expected to wait 50s for the next window, got %s", wait)
+	}
+	if l.allow("other", start.Add(10*time.Second)) != 0 {
+		t.Error("Expected a different admin to have their own budget")
+	}
+	if l.allow("admin", start.Add(time.Minute)) != 0 {
+		t.Error("Expected the next window to allow calls again")
+	}
+
+	if dropped := l.cleanup(start.Add(90 * time.Second)); dropped != 1 || len(l.windows) != 1 {
+		t.Errorf("Expected only the ended window to be dropped, dropped %d and kept %d", dropped, len(l.windows))
+	}
+
+	unlimited := newWindowLimiter(0, time.Minute)
+	for i := 0; i < 100; i++ {
+		if unlimited.allow("admin", start) != 0 {
+			t.Fatal("Expected a zero limit to disable limiting")
+		}
+	}
+}
+
+// fakeVerifier answers VerifyDevice with a fixed result
+type fakeVerifier struct {
+	result *auth.DeviceVerifyResponse
+	status int
+	err    error
+}
+
+func (f *fakeVerifier) VerifyDevice(ctx context.Context, hardwareID string) (*auth.DeviceVerifyResponse, int, error) {
+	return f.result, f.status, f.err
+}
+
+func TestDeviceViewMapsHashToDeviceUUID(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	deviceUUID := uuid.New()
+	hash := strings.Repeat("ab", 32)
+	vault := &fakeVerifier{result: &auth.DeviceVerifyResponse{Authenticated: true, DeviceUUID: deviceUUID.String()}, status: http.StatusOK}
+	handler := NewDeviceViewHandler(store, NewDownloadHandler(store, nil), vault)
+
+	view := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/devices/"+id+"/view", nil)
+		req = req.WithContext(middleware.WithUserID(req.Context(), "1"))
+		rr := httptest.NewRecorder()
+		handler.View(rr, req)
+		return rr
+	}
+
+	if rr := view(deviceUUID.String()); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected a UUID path to be rejected with %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	rr := view(strings.ToUpper(hash))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var resp DeviceView
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.DeviceID != hash {
+		t.Errorf("Expected device_id %q, got %q", hash, resp.DeviceID)
+	}
+	if resp.DeviceUUID == nil || *resp.DeviceUUID != deviceUUID {
+		t.Errorf("Expected device_uuid %s, got %v", deviceUUID, resp.DeviceUUID)
+	}
+}
@@ -1,14 +1,20 @@
 package api
 
 import (
+	"FundAIHub/internal/auth"
+	"FundAIHub/internal/config"
 	"FundAIHub/internal/db"
+	"FundAIHub/internal/middleware"
+	"FundAIHub/internal/testdb"
 	"bytes"
 	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -17,7 +23,8 @@ import (
 func setupTestDB(t *testing.T) (*db.ContentStore, func()) {
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
-		t.Skip("Skipping test: DATABASE_URL not set")
+		// Fall back to a throwaway database when one is configured
+		return testdb.New(t), func() {}
 	}
 
 	dbConn, err := db.NewConnection(db.Config{
@@ -44,7 +51,7 @@ func createTestDownload(t *testing.T) *db.Download {
 		DeviceID:  uuid.New(),
 		UserID:    "test-user",
 		ContentID: uuid.New(),
-		Status:    "started",
+		Status:    db.DownloadStatusQueued,
 	}
 
 	err := store.CreateDownload(context.Background(), download)
@@ -55,19 +62,22 @@ func createTestDownload(t *testing.T) *db.Download {
 	return download
 }
 
-func updateDownloadStatus(t *testing.T, handler *DownloadHandler, id uuid.UUID, body map[string]interface{}) map[string]interface{} {
+func updateDownloadStatus(t *testing.T, handler *DownloadHandler, download *db.Download, body map[string]interface{}) map[string]interface{} {
+	if _, ok := body["id"]; !ok {
+		body["id"] = download.ID.String()
+	}
 	bodyBytes, err := json.Marshal(body)
 	if err != nil {
 		t.Fatalf("Failed to marshal body: %v", err)
 	}
 
-	req := httptest.NewRequest("PUT", "/api/downloads/status?id="+id.String(), bytes.NewBuffer(bodyBytes))
+	req := httptest.NewRequest("PUT", "/api/downloads/status?id="+download.ID.String(), bytes.NewBuffer(bodyBytes))
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
 
 	// Add required context values
-	ctx := context.WithValue(req.Context(), "device_id", id.String())
+	ctx := middleware.WithDeviceUUID(req.Context(), download.DeviceID.String())
 	req = req.WithContext(ctx)
 
 	handler.UpdateStatus(rr, req)
@@ -103,7 +113,7 @@ func TestDownloadStatusUpdates(t *testing.T) {
 	}
 
 	// Create a handler that will be used throughout the test
-	handler := NewDownloadHandler(store)
+	handler := NewDownloadHandler(store, nil)
 
 	t.Run("Update to Completed", func(t *testing.T) {
 		// Create download using the same store
@@ -111,7 +121,7 @@ func TestDownloadStatusUpdates(t *testing.T) {
 			DeviceID:  uuid.New(),
 			UserID:    "test-user",
 			ContentID: content.ID,
-			Status:    "started",
+			Status:    db.DownloadStatusQueued,
 		}
 
 		err := store.CreateDownload(context.Background(), download)
@@ -125,7 +135,7 @@ func TestDownloadStatusUpdates(t *testing.T) {
 			"bytes_downloaded": 1024,
 		}
 
-		response := updateDownloadStatus(t, handler, download.ID, body)
+		response := updateDownloadStatus(t, handler, download, body)
 
 		if response["status"] != "completed" {
 			t.Errorf("Expected status 'completed', got %v", response["status"])
@@ -138,7 +148,7 @@ func TestDownloadStatusUpdates(t *testing.T) {
 			DeviceID:  uuid.New(),
 			UserID:    "test-user",
 			ContentID: content.ID, // Use the same content
-			Status:    "started",
+			Status:    db.DownloadStatusQueued,
 		}
 
 		err := store.CreateDownload(context.Background(), download)
@@ -151,12 +161,366 @@ func TestDownloadStatusUpdates(t *testing.T) {
 			"bytes_downloaded": 512,
 		}
 
-		response := updateDownloadStatus(t, handler, download.ID, body)
+		response := updateDownloadStatus(t, handler, download, body)
 
 		if response["status"] != "paused" {
 			t.Errorf("Expected status 'paused', got %v", response["status"])
 		}
 	})
+
+	t.Run("Completed Cannot Restart", func(t *testing.T) {
+		download := &db.Download{
+			DeviceID:  uuid.New(),
+			UserID:    "test-user",
+			ContentID: content.ID,
+			Status:    db.DownloadStatusCompleted,
+		}
+		if err := store.CreateDownload(context.Background(), download); err != nil {
+			t.Fatalf("Failed to create test download: %v", err)
+		}
+
+		body := bytes.NewBufferString(`{"id": "` + download.ID.String() + `", "status": "started", "bytes_downloaded": 10}`)
+		req := httptest.NewRequest("PUT", "/api/downloads/status", body)
+		req = req.WithContext(middleware.WithDeviceUUID(req.Context(), download.DeviceID.String()))
+		rr := httptest.NewRecorder()
+		handler.UpdateStatus(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Fatalf("Expected status %d, got %d", http.StatusConflict, rr.Code)
+		}
+		var resp ErrorResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if resp.ErrorCode != errCodeInvalidTransition {
+			t.Errorf("Expected error_code %q, got %q", errCodeInvalidTransition, resp.ErrorCode)
+		}
+	})
+
+	t.Run("Other Device Cannot Update", func(t *testing.T) {
+		download := &db.Download{
+			DeviceID:  uuid.New(),
+			UserID:    "test-user",
+			ContentID: content.ID,
+			Status:    db.DownloadStatusQueued,
+		}
+		if err := store.CreateDownload(context.Background(), download); err != nil {
+			t.Fatalf("Failed to create test download: %v", err)
+		}
+
+		body := bytes.NewBufferString(`{"id": "` + download.ID.String() + `", "status": "completed"}`)
+		req := httptest.NewRequest("PUT", "/api/downloads/status", body)
+		req = req.WithContext(middleware.WithDeviceUUID(req.Context(), uuid.New().String()))
+		rr := httptest.NewRecorder()
+		handler.UpdateStatus(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+		}
+		stored, err := store.GetDownloadByID(context.Background(), download.ID)
+		if err != nil {
+			t.Fatalf("GetDownloadByID: %v", err)
+		}
+		if stored.Status != db.DownloadStatusQueued {
+			t.Errorf("Expected status to stay %q, got %q", db.DownloadStatusQueued, stored.Status)
+		}
+	})
+
+	t.Run("First Bytes Move Queued To Downloading", func(t *testing.T) {
+		download := &db.Download{
+			DeviceID:  uuid.New(),
+			UserID:    "test-user",
+			ContentID: content.ID,
+			Status:    db.DownloadStatusQueued,
+		}
+
+		err := store.CreateDownload(context.Background(), download)
+		if err != nil {
+			t.Fatalf("Failed to create test download: %v", err)
+		}
+
+		// No bytes yet: still queued even though the client says downloading
+		response := updateDownloadStatus(t, handler, download, map[string]interface{}{
+			"id":               download.ID.String(),
+			"status":           "downloading",
+			"bytes_downloaded": 0,
+		})
+		if response["status"] != db.DownloadStatusQueued {
+			t.Errorf("Expected status 'queued', got %v", response["status"])
+		}
+
+		response = updateDownloadStatus(t, handler, download, map[string]interface{}{
+			"id":               download.ID.String(),
+			"status":           "downloading",
+			"bytes_downloaded": 256,
+		})
+		if response["status"] != db.DownloadStatusDownloading {
+			t.Errorf("Expected status 'downloading', got %v", response["status"])
+		}
+
+		counts, err := store.CountActiveDownloads(context.Background(), download.DeviceID)
+		if err != nil {
+			t.Fatalf("CountActiveDownloads: %v", err)
+		}
+		if counts.Downloading != 1 || counts.Queued != 0 {
+			t.Errorf("Unexpected counts: %+v", counts)
+		}
+	})
+
+	t.Run("Resume Position Is Kept For Resume", func(t *testing.T) {
+		download := &db.Download{
+			DeviceID:   uuid.New(),
+			UserID:     "test-user",
+			ContentID:  content.ID,
+			Status:     db.DownloadStatusQueued,
+			TotalBytes: 1024,
+		}
+		if err := store.CreateDownload(context.Background(), download); err != nil {
+			t.Fatalf("Failed to create test download: %v", err)
+		}
+
+		response := updateDownloadStatus(t, handler, download, map[string]interface{}{
+			"status":           "paused",
+			"bytes_downloaded": 600,
+			"resume_position":  512,
+		})
+		if response["resume_position"] != float64(512) {
+			t.Errorf("Expected resume_position 512, got %v", response["resume_position"])
+		}
+
+		body := bytes.NewBufferString(`{"contentId": "` + content.ID.String() + `", "resume": true}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/downloads/start", body)
+		req = req.WithContext(middleware.WithDeviceUUID(req.Context(), download.DeviceID.String()))
+		rr := httptest.NewRecorder()
+		handler.StartDownload(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var resumed db.Download
+		if err := json.NewDecoder(rr.Body).Decode(&resumed); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if resumed.ID != download.ID || resumed.ResumePosition != 512 {
+			t.Errorf("Expected download %s at position 512, got %s at %d", download.ID, resumed.ID, resumed.ResumePosition)
+		}
+
+		body = bytes.NewBufferString(`{"id": "` + download.ID.String() + `", "status": "paused", "bytes_downloaded": 600, "resume_position": 2048}`)
+		req = httptest.NewRequest("PUT", "/api/downloads/status", body)
+		req = req.WithContext(middleware.WithDeviceUUID(req.Context(), download.DeviceID.String()))
+		rr = httptest.NewRecorder()
+		handler.UpdateStatus(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for a position past the end, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("New Resume Position Bypasses Throttling", func(t *testing.T) {
+		defer func(minBytes int64, interval time.Duration) {
+			handler.progressMinBytes, handler.progressInterval = minBytes, interval
+		}(handler.progressMinBytes, handler.progressInterval)
+		handler.progressMinBytes, handler.progressInterval = 1<<30, time.Hour
+
+		download := &db.Download{
+			DeviceID:        uuid.New(),
+			UserID:          "test-user",
+			ContentID:       content.ID,
+			Status:          db.DownloadStatusDownloading,
+			BytesDownloaded: 100,
+			TotalBytes:      1024,
+		}
+		if err := store.CreateDownload(context.Background(), download); err != nil {
+			t.Fatalf("Failed to create test download: %v", err)
+		}
+
+		updateDownloadStatus(t, handler, download, map[string]interface{}{
+			"status":           "downloading",
+			"bytes_downloaded": 150,
+			"resume_position":  128,
+		})
+		stored, err := store.GetDownloadByID(context.Background(), download.ID)
+		if err != nil {
+			t.Fatalf("GetDownloadByID: %v", err)
+		}
+		if stored.ResumePosition != 128 || stored.BytesDownloaded != 150 {
+			t.Errorf("Expected the new resume position written, got position %d at %d bytes", stored.ResumePosition, stored.BytesDownloaded)
+		}
+	})
+}
+
+func TestCancelDownload(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	handler := NewDownloadHandler(store, nil)
+	contentID := createTestContentForDownload(t, store)
+
+	newDownload := func(status string) *db.Download {
+		download := &db.Download{DeviceID: uuid.New(), UserID: "test-user", ContentID: contentID, Status: status}
+		if err := store.CreateDownload(context.Background(), download); err != nil {
+			t.Fatalf("Failed to create test download: %v", err)
+		}
+		return download
+	}
+	cancel := func(download *db.Download, deviceID uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/downloads/cancel?id="+download.ID.String(), nil)
+		req = req.WithContext(middleware.WithDeviceUUID(req.Context(), deviceID.String()))
+		rr := httptest.NewRecorder()
+		handler.CancelDownload(rr, req)
+		return rr
+	}
+
+	t.Run("Owner cancels", func(t *testing.T) {
+		download := newDownload(db.DownloadStatusDownloading)
+		if rr := cancel(download, download.DeviceID); rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		counts, err := store.CountActiveDownloads(context.Background(), download.DeviceID)
+		if err != nil {
+			t.Fatalf("CountActiveDownloads: %v", err)
+		}
+		if counts.Downloading != 0 || counts.Queued != 0 {
+			t.Errorf("Expected a cancelled download not to count as active, got %+v", counts)
+		}
+
+		// Repeating the cancel is harmless, but the download stays cancelled
+		if rr := cancel(download, download.DeviceID); rr.Code != http.StatusOK {
+			t.Errorf("Expected a repeated cancel to succeed, got %d", rr.Code)
+		}
+		body := bytes.NewBufferString(`{"id": "` + download.ID.String() + `", "status": "paused"}`)
+		req := httptest.NewRequest(http.MethodPut, "/api/downloads/status", body)
+		req = req.WithContext(middleware.WithDeviceUUID(req.Context(), download.DeviceID.String()))
+		rr := httptest.NewRecorder()
+		handler.UpdateStatus(rr, req)
+		if rr.Code != http.StatusConflict {
+			t.Errorf("Expected 409 updating a cancelled download, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Other device cannot cancel", func(t *testing.T) {
+		download := newDownload(db.DownloadStatusQueued)
+		if rr := cancel(download, uuid.New()); rr.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", rr.Code)
+		}
+		stored, _ := store.GetDownloadByID(context.Background(), download.ID)
+		if stored.Status != db.DownloadStatusQueued {
+			t.Errorf("Expected status to stay queued, got %q", stored.Status)
+		}
+	})
+
+	t.Run("Completed download cannot be cancelled", func(t *testing.T) {
+		download := newDownload(db.DownloadStatusCompleted)
+		if rr := cancel(download, download.DeviceID); rr.Code != http.StatusConflict {
+			t.Errorf("Expected 409, got %d", rr.Code)
+		}
+	})
+}
+
+// TestUpdateStatusThroughAuth sends status updates through the real
+// AuthenticateDevice middleware, with FundaVault answering in the shape of
+// its DeviceAuthResponse, so the device UUID UpdateStatus checks comes from
+// the same place it does in production
+func TestUpdateStatusThroughAuth(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	content := &db.Content{
+		Name:     "Test Content",
+		Type:     "test",
+		Version:  "1.0",
+		FilePath: "/test/path",
+		Size:     1024,
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("Failed to create test content: %v", err)
+	}
+
+	owner := strings.Repeat("0123456789abcdef", 4)
+	other := strings.Repeat("fedcba9876543210", 4)
+
+	tests := []struct {
+		name  string
+		vault func(hardwareID string) string
+	}{
+		{"Without Device UUID", func(string) string {
+			return `{"authenticated": true, "user_id": 7, "email": "student@example.com"}`
+		}},
+		{"With Device UUID", func(hardwareID string) string {
+			return `{"authenticated": true, "user_id": 7, "email": "student@example.com", "device_uuid": "` + auth.DeviceUUID(hardwareID) + `"}`
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					HardwareID string `json:"hardware_id"`
+				}
+				json.NewDecoder(r.Body).Decode(&req)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.vault(req.HardwareID)))
+			}))
+			defer vault.Close()
+
+			authMiddleware := middleware.NewAuthMiddleware(auth.NewFundaVaultClient(&config.Config{FundaVaultURL: vault.URL}))
+			handler := authMiddleware.AuthenticateDevice(NewDownloadHandler(store, nil).UpdateStatus)
+
+			download := &db.Download{
+				DeviceID:  uuid.MustParse(auth.DeviceUUID(owner)),
+				UserID:    "7",
+				ContentID: content.ID,
+				Status:    db.DownloadStatusQueued,
+			}
+			if err := store.CreateDownload(context.Background(), download); err != nil {
+				t.Fatalf("Failed to create test download: %v", err)
+			}
+
+			send := func(hardwareID string) *httptest.ResponseRecorder {
+				body := bytes.NewBufferString(`{"id": "` + download.ID.String() + `", "status": "downloading", "bytes_downloaded": 512}`)
+				req := httptest.NewRequest(http.MethodPut, "/api/downloads/status", body)
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Device-ID", hardwareID)
+				rr := httptest.NewRecorder()
+				handler(rr, req)
+				return rr
+			}
+
+			if rr := send(other); rr.Code != http.StatusNotFound {
+				t.Errorf("Another device got %d, want %d: %s", rr.Code, http.StatusNotFound, rr.Body.String())
+			}
+			rr := send(owner)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Owning device got %d, want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+			}
+			var response map[string]interface{}
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response["status"] != "downloading" {
+				t.Errorf("Expected status 'downloading', got %v", response["status"])
+			}
+		})
+	}
+}
+
+func TestProgressStatus(t *testing.T) {
+	tests := []struct {
+		current, requested string
+		bytes              int64
+		want               string
+	}{
+		{db.DownloadStatusQueued, "started", 0, db.DownloadStatusQueued},
+		{db.DownloadStatusQueued, "downloading", 0, db.DownloadStatusQueued},
+		{db.DownloadStatusQueued, "downloading", 1, db.DownloadStatusDownloading},
+		{db.DownloadStatusQueued, "", 10, db.DownloadStatusDownloading},
+		{db.DownloadStatusDownloading, "started", 0, db.DownloadStatusDownloading},
+		{db.DownloadStatusDownloading, "paused", 10, db.DownloadStatusPaused},
+		{db.DownloadStatusPaused, "", 20, db.DownloadStatusPaused},
+		{db.DownloadStatusPaused, "paused", 20, db.DownloadStatusPaused},
+		{db.DownloadStatusDownloading, "completed", 10, db.DownloadStatusCompleted},
+		{db.DownloadStatusQueued, "bogus", 0, "bogus"},
+	}
+
+	for _, tt := range tests {
+		if got := progressStatus(tt.current, tt.requested, tt.bytes); got != tt.want {
+			t.Errorf("progressStatus(%q, %q, %d) = %q, want %q", tt.current, tt.requested, tt.bytes, got, tt.want)
+		}
+	}
 }
 
 func createTestContentForDownload(t *testing.T, store *db.ContentStore) uuid.UUID {
@@ -175,3 +539,35 @@ func createTestContentForDownload(t *testing.T, store *db.ContentStore) uuid.UUI
 
 	return content.ID
 }
+
+func TestShouldPersistProgress(t *testing.T) {
+	now := time.Now()
+	stored := &db.Download{
+		Status:          db.DownloadStatusDownloading,
+		BytesDownloaded: 1000,
+		LastUpdatedAt:   now.Add(-time.Second),
+	}
+	const minBytes, interval = 500, 5 * time.Second
+
+	tests := []struct {
+		name   string
+		status string
+		bytes  int64
+		now    time.Time
+		want   bool
+	}{
+		{"Small advance is coalesced", db.DownloadStatusDownloading, 1200, now, false},
+		{"Byte delta reached", db.DownloadStatusDownloading, 1500, now, true},
+		{"Interval elapsed", db.DownloadStatusDownloading, 1001, now.Add(5 * time.Second), true},
+		{"Status change always written", db.DownloadStatusPaused, 1001, now, true},
+		{"Terminal status always written", db.DownloadStatusCompleted, 1000, now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldPersistProgress(stored, tt.status, tt.bytes, tt.now, minBytes, interval); got != tt.want {
+				t.Errorf("shouldPersistProgress = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/metrics"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// VerifyParam is the signed-download query parameter asking for a small file
+// to be checked against its checksum before any of it is sent. Like
+// disposition it is not part of the signature.
+const VerifyParam = "verify"
+
+// checksumVerifiedHeader is set on downloads the server checked in full
+// before sending
+const checksumVerifiedHeader = "X-Checksum-Verified"
+
+// downloadChecksumMismatches counts signed downloads whose bytes did not
+// match the content's recorded checksum
+var downloadChecksumMismatches = metrics.NewCounterVec("fundaihub_download_checksum_mismatches_total",
+	"Signed downloads whose bytes did not match the recorded checksum, by how they were checked.", "check")
+
+// How a download's bytes were checked against the recorded checksum
+const (
+	checkStream   = "stream"
+	checkBuffered = "buffered"
+)
+
+// readVerified reads a whole body of at most limit bytes and checks it
+// against content's checksum, returning the bytes and their hex digest
+func readVerified(body io.Reader, content *db.Content, limit int64) (data []byte, digest string, ok bool, err error) {
+	data, err = io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, "", false, err
+	}
+	if int64(len(data)) > limit {
+		return nil, "", false, fmt.Errorf("content %s is larger than the %d byte verify limit", content.ID, limit)
+	}
+	sum := sha256.Sum256(data)
+	digest = hex.EncodeToString(sum[:])
+	return data, digest, strings.EqualFold(digest, content.Checksum.String), nil
+}
+
+// recordChecksumMismatch counts and logs a download whose bytes did not
+// match, and marks the content as mismatched so it shows in the
+// verification report
+func (h *DownloadHandler) recordChecksumMismatch(ctx context.Context, content *db.Content, backend, check, actual string) {
+	downloadChecksumMismatches.Inc(check)
+	log.Printf("[HandleSignedDownload] [Warning] Checksum mismatch for %s (%s, %s storage, %s check): expected %s, got %s",
+		content.ID, content.StorageKey.String, backend, check, content.Checksum.String, actual)
+	// The client may be gone by now; the record should still be updated
+	if err := h.store.SetVerificationStatus(context.WithoutCancel(ctx), content.ID, db.VerificationMismatch); err != nil {
+		log.Printf("[HandleSignedDownload] Failed to record checksum mismatch for %s: %v", content.ID, err)
+	}
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestReadVerified(t *testing.T) {
+	payload := "lesson notes"
+	sum := sha256.Sum256([]byte(payload))
+	content := &db.Content{Checksum: sql.NullString{String: strings.ToUpper(hex.EncodeToString(sum[:])), Valid: true}}
+
+	data, _, ok, err := readVerified(strings.NewReader(payload), content, 1024)
+	if err != nil || !ok || string(data) != payload {
+		t.Errorf("intact body: data %q, ok %t, err %v", data, ok, err)
+	}
+	if _, _, ok, err := readVerified(strings.NewReader("lesson notez"), content, 1024); err != nil || ok {
+		t.Errorf("corrupted body: ok %t, err %v; want a mismatch", ok, err)
+	}
+	if _, _, _, err := readVerified(strings.NewReader(payload), content, 4); err == nil {
+		t.Error("Expected an error for a body over the limit")
+	}
+}
+
+func TestSignedDownloadVerify(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	payload := strings.Repeat("lesson notes ", 1000)
+	sum := sha256.Sum256([]byte(payload))
+	svc := newFakeStorage()
+	handler := NewDownloadHandler(store, svc)
+	handler.verifyStreams = true
+	handler.verifyMaxBytes = 1 << 20
+
+	// create stores content whose object holds stored rather than payload
+	create := func(t *testing.T, stored string) (*db.Content, string) {
+		key := "test/" + uuid.New().String() + ".txt"
+		svc.objects[key] = []byte(stored)
+		content := &db.Content{
+			Name:        "notes.txt",
+			Type:        "test",
+			Version:     "1.0",
+			FilePath:    key,
+			Size:        int64(len(payload)),
+			StorageKey:  sql.NullString{String: key, Valid: true},
+			ContentType: sql.NullString{String: "text/plain", Valid: true},
+			Checksum:    sql.NullString{String: hex.EncodeToString(sum[:]), Valid: true},
+		}
+		if err := store.Create(ctx, content); err != nil {
+			t.Fatalf("Failed to create content: %v", err)
+		}
+		signed, err := handler.urlGenerator.GenerateURL(content.ID, time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to sign URL: %v", err)
+		}
+		return content, signed
+	}
+	corrupted := "X" + payload[1:]
+
+	t.Run("Intact Stream", func(t *testing.T) {
+		_, signed := create(t, payload)
+		before := downloadChecksumMismatches.Value(checkStream)
+		rr := httptest.NewRecorder()
+		handler.HandleSignedDownload(rr, httptest.NewRequest(http.MethodGet, signed, nil))
+
+		if rr.Code != http.StatusOK || rr.Body.String() != payload {
+			t.Fatalf("Expected the payload with status 200, got %d", rr.Code)
+		}
+		if got := downloadChecksumMismatches.Value(checkStream); got != before {
+			t.Errorf("Mismatches went from %d to %d for an intact download", before, got)
+		}
+	})
+
+	t.Run("Corrupted Stream Is Recorded", func(t *testing.T) {
+		content, signed := create(t, corrupted)
+		before := downloadChecksumMismatches.Value(checkStream)
+		rr := httptest.NewRecorder()
+		handler.HandleSignedDownload(rr, httptest.NewRequest(http.MethodGet, signed, nil))
+
+		// The bytes go out before they can be checked
+		if rr.Code != http.StatusOK || rr.Body.String() != corrupted {
+			t.Fatalf("Expected the stored bytes with status 200, got %d", rr.Code)
+		}
+		if rr.Header().Get(checksumHeader) != hex.EncodeToString(sum[:]) {
+			t.Errorf("Expected %s to carry the recorded checksum", checksumHeader)
+		}
+		if got := downloadChecksumMismatches.Value(checkStream); got != before+1 {
+			t.Errorf("Mismatches went from %d to %d, want one more", before, got)
+		}
+		updated, err := store.Get(ctx, content.ID)
+		if err != nil {
+			t.Fatalf("Failed to reload content: %v", err)
+		}
+		if updated.VerificationStatus.String != db.VerificationMismatch {
+			t.Errorf("verification_status = %q, want %q", updated.VerificationStatus.String, db.VerificationMismatch)
+		}
+	})
+
+	t.Run("Verify Intact", func(t *testing.T) {
+		_, signed := create(t, payload)
+		rr := httptest.NewRecorder()
+		handler.HandleSignedDownload(rr, httptest.NewRequest(http.MethodGet, signed+"&verify=true", nil))
+
+		if rr.Code != http.StatusOK || rr.Body.String() != payload {
+			t.Fatalf("Expected the payload with status 200, got %d", rr.Code)
+		}
+		if rr.Header().Get(checksumVerifiedHeader) != "true" {
+			t.Errorf("Expected %s: true", checksumVerifiedHeader)
+		}
+	})
+
+	t.Run("Verify Corrupted Is Refused", func(t *testing.T) {
+		_, signed := create(t, corrupted)
+		rr := httptest.NewRecorder()
+		handler.HandleSignedDownload(rr, httptest.NewRequest(http.MethodGet, signed+"&verify=true", nil))
+
+		if rr.Code != http.StatusBadGateway {
+			t.Fatalf("Expected status %d, got %d", http.StatusBadGateway, rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), errCodeChecksumMismatch) {
+			t.Errorf("Expected error_code %s, got %s", errCodeChecksumMismatch, rr.Body.String())
+		}
+		if strings.Contains(rr.Body.String(), "lesson notes") {
+			t.Error("Expected none of the corrupted bytes to be sent")
+		}
+	})
+
+	t.Run("Verify Over Limit Streams", func(t *testing.T) {
+		_, signed := create(t, payload)
+		small := NewDownloadHandler(store, svc)
+		small.verifyMaxBytes = 16
+		rr := httptest.NewRecorder()
+		small.HandleSignedDownload(rr, httptest.NewRequest(http.MethodGet, signed+"&verify=true", nil))
+
+		if rr.Code != http.StatusOK || rr.Body.String() != payload {
+			t.Fatalf("Expected the payload with status 200, got %d", rr.Code)
+		}
+		if rr.Header().Get(checksumVerifiedHeader) != "" {
+			t.Errorf("Expected no %s on a file over the verify limit", checksumVerifiedHeader)
+		}
+	})
+}
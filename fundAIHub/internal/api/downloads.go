@@ -1,45 +1,249 @@
 package api
 
 import (
+	"FundAIHub/internal/config"
 	"FundAIHub/internal/db"
+	"FundAIHub/internal/metrics"
+	"FundAIHub/internal/middleware"
 	"FundAIHub/internal/storage"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// checksumHeader carries the content's hex SHA-256 on signed downloads, so
+// a client can verify what it received
+const checksumHeader = "X-Content-SHA256"
+
+const (
+	defaultHistoryPageSize = 50
+	maxHistoryPageSize     = 200
+)
+
+// nextCursorHeader carries the cursor for the next page of a paged history
+// request; it is absent on the last page
+const nextCursorHeader = "X-Next-Cursor"
+
 type DownloadHandler struct {
-	store        *db.ContentStore
-	urlGenerator *URLGenerator
-	storage      storage.StorageService
+	store              *db.ContentStore
+	urlGenerator       *URLGenerator
+	storage            storage.StorageService
+	backends           *storage.Registry // Resolves StorageBackend; nil serves everything from storage
+	mirror             storage.StorageService
+	reads              *readLimiter
+	maxActivePerDevice int
+	maxActivePerUser   int
+	exemptAdmins       bool // Admin devices skip the active download limits
+	progressMinBytes   int64
+	progressInterval   time.Duration
+	typeOverridesByExt map[string]string
+	typeOverridesByApp map[string]string
+	missingStatus      int
+	flagMissing        bool
+	notReadyRetryAfter time.Duration
+	// archiver restores archived content when it is downloaded; nil when
+	// no cold storage is configured
+	archiver              *Archiver
+	rehydrationRetryAfter time.Duration
+	// transforms are the transformers downloads may select by name
+	transforms map[string]Transformer
+	// verifyStreams hashes whole downloads as they stream and reports any
+	// that do not match the recorded checksum. verifyMaxBytes is the
+	// largest file a client may have checked before sending with verify=true.
+	verifyStreams  bool
+	verifyMaxBytes int64
+}
+
+var (
+	// downloadsServed counts signed downloads by the backend that served them
+	downloadsServed = metrics.NewCounterVec("fundaihub_downloads_served_total",
+		"Signed downloads served, by storage backend.", "backend")
+	// activeDownloads is the number of signed downloads currently being handled
+	activeDownloads = metrics.NewGauge("fundaihub_active_downloads",
+		"Signed downloads currently in progress.")
+	// downloadBytes counts bytes sent to clients by signed downloads
+	downloadBytes = metrics.NewCounter("fundaihub_download_bytes_total",
+		"Bytes streamed to clients by signed downloads.")
+	// missingObjects counts signed downloads whose record had no storage object
+	missingObjects = metrics.NewCounter("fundaihub_missing_storage_objects_total",
+		"Signed downloads refused because the content record's storage object is missing.")
+)
+
+// missingObjectStatus returns the configured status for a record whose
+// storage object is gone, defaulting to 410 for anything but 410 or 502
+func missingObjectStatus(configured int) int {
+	if configured == http.StatusBadGateway {
+		return http.StatusBadGateway
+	}
+	return http.StatusGone
 }
 
+// ActiveDownloads returns the number of signed downloads streaming a body
+func ActiveDownloads() int64 {
+	return activeDownloads.Value()
+}
+
+// trackActiveDownload counts a download as in progress until the returned
+// func is called. Callers defer it, so the count also drops when the client
+// disconnects mid-stream or the handler panics.
+func trackActiveDownload() (done func()) {
+	activeDownloads.Inc()
+	return activeDownloads.Dec
+}
+
+// NewDownloadHandler returns a handler serving downloads of the store's
+// content. storage is only read by HandleSignedDownload, and only for
+// content whose backend is not set with SetBackends; it may be nil for
+// handlers that just start, track and list downloads, in which case signed
+// downloads fail with 500.
 func NewDownloadHandler(store *db.ContentStore, storage storage.StorageService) *DownloadHandler {
+	cfg := config.GetConfig()
 	return &DownloadHandler{
-		store:        store,
-		urlGenerator: NewURLGenerator(store),
-		storage:      storage,
+		store:              store,
+		urlGenerator:       NewURLGenerator(store),
+		storage:            storage,
+		reads:              newReadLimiter(cfg.StorageMaxConcurrentReads),
+		maxActivePerDevice: cfg.MaxActiveDownloadsPerDevice,
+		maxActivePerUser:   cfg.MaxActiveDownloadsPerUser,
+		exemptAdmins:       cfg.DownloadLimitsExemptAdmins,
+		progressMinBytes:   cfg.ProgressPersistMinBytes,
+		progressInterval:   cfg.ProgressPersistInterval,
+		typeOverridesByExt: cfg.ContentTypeOverridesByExt,
+		typeOverridesByApp: cfg.ContentTypeOverridesByAppType,
+		missingStatus:      missingObjectStatus(cfg.MissingObjectStatus),
+		flagMissing:        cfg.FlagMissingObjects,
+		notReadyRetryAfter: cfg.ContentNotReadyRetryAfter,
+
+		rehydrationRetryAfter: cfg.RehydrationRetryAfter,
+
+		verifyStreams:  cfg.DownloadVerifyChecksums,
+		verifyMaxBytes: cfg.DownloadVerifyMaxBytes,
+	}
+}
+
+// SetMirror configures a secondary backend used when the primary cannot
+// serve an object
+func (h *DownloadHandler) SetMirror(mirror storage.StorageService) {
+	h.mirror = mirror
+}
+
+// openObject downloads key from the primary backend, falling back to the
+// mirror when the primary is missing the object or unavailable. It returns
+// the name of the backend that served it.
+func (h *DownloadHandler) openObject(ctx context.Context, primary storage.StorageService, key string) (io.ReadCloser, *storage.FileInfo, string, error) {
+	reader, info, err := primary.Download(ctx, key)
+	if err == nil {
+		return reader, info, "primary", nil
+	}
+	if h.mirror == nil || !(errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrUpstream)) {
+		return nil, nil, "", err
+	}
+
+	log.Printf("[Storage] Primary failed for %s, trying mirror: %v", key, err)
+	reader, info, mirrorErr := h.mirror.Download(ctx, key)
+	if mirrorErr != nil {
+		return nil, nil, "", fmt.Errorf("primary: %v; mirror: %w", err, mirrorErr)
+	}
+	return reader, info, "mirror", nil
+}
+
+// servedContentType picks the Content-Type for a download: a configured
+// override for the file extension, then one for the app_type, then the
+// stored type. overridden is true when the result differs from what is
+// stored.
+func servedContentType(content *db.Content, byExt, byAppType map[string]string) (contentType string, overridden bool) {
+	stored := "application/octet-stream" // Default if NULL
+	if content.ContentType.Valid {
+		stored = content.ContentType.String
+	}
+
+	if ct, ok := byExt[strings.ToLower(path.Ext(content.Name))]; ok {
+		return ct, ct != stored
+	}
+	if ct, ok := byAppType[content.AppType]; ok {
+		return ct, ct != stored
+	}
+	return stored, false
+}
+
+// inlineContentTypes can be previewed by a browser without running anything.
+// HTML, SVG and other scriptable types are deliberately absent so stored
+// content can never execute in our origin.
+var inlineContentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"text/plain":      true,
+	"audio/mpeg":      true,
+	"video/mp4":       true,
+}
+
+// contentDisposition returns "inline" when the client asked for it and the
+// served type is safe to preview, and "attachment" otherwise.
+func contentDisposition(requested, contentType string) string {
+	if !strings.EqualFold(requested, "inline") {
+		return "attachment"
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !inlineContentTypes[mediaType] {
+		return "attachment"
 	}
+	return "inline"
+}
+
+// requestDeviceUUID returns the FundaVault device UUID the middleware put
+// in context, which the downloads table keys on. The Device-ID header is a
+// hardware hash and is only used for logging here.
+func requestDeviceUUID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	deviceUUIDStr, _ := middleware.DeviceUUIDFromContext(r.Context())
+	deviceUUID, err := uuid.Parse(deviceUUIDStr)
+	if err != nil {
+		hardwareID, _ := middleware.DeviceIDFromContext(r.Context())
+		log.Printf("[API] Device %s has no usable device UUID (%q): %v", hardwareID, truncateValue(deviceUUIDStr), err)
+		writeErrorResponse(w, ErrorResponse{
+			Error:  "Device is not provisioned for downloads",
+			Code:   http.StatusForbidden,
+			Field:  "device_uuid",
+			Reason: "FundaVault returned a malformed device UUID",
+		})
+		return uuid.Nil, false
+	}
+	return deviceUUID, true
 }
 
 // StartDownload initiates a new download
 func (h *DownloadHandler) StartDownload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondMethodNotAllowed(w, http.MethodPost)
 		return
 	}
 
 	var req struct {
 		ContentID string `json:"contentId"`
 		Resume    bool   `json:"resume,omitempty"`
+		// ForceNew records a fresh download even when resume is set and
+		// the device already has one for this content, e.g. a reinstall
+		ForceNew bool `json:"force_new,omitempty"`
 	}
 
 	// It might also be useful to log the raw body first
@@ -47,9 +251,9 @@ func (h *DownloadHandler) StartDownload(w http.ResponseWriter, r *http.Request)
 	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))                      // Restore the body for Decode
 	log.Printf("[StartDownload] Received Raw Body: %s", string(bodyBytes)) // Optional raw body logging
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeJSON(r.Body, &req); err != nil {
 		log.Printf("[StartDownload] Error decoding request body: %v", err) // Log decoding errors
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		respondWithDecodeError(w, err)
 		return
 	}
 
@@ -61,35 +265,76 @@ func (h *DownloadHandler) StartDownload(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		// Log the error from uuid.Parse
 		log.Printf("[StartDownload] Error parsing ContentID '%s': %v", req.ContentID, err)
-		http.Error(w, "Invalid content ID", http.StatusBadRequest)
+		respondWithInvalidUUID(w, "Invalid content ID", "contentId", req.ContentID, err)
 		return
 	}
 
 	// Get hardware_id and user_id from middleware context
 	log.Printf("[StartDownload] Getting context values for device and user") // Added log
-	deviceID := r.Context().Value("device_id").(string)
-	userID := r.Context().Value("user_id").(string)
-	log.Printf("[StartDownload] Context values - DeviceID: %s, UserID: %s", deviceID, userID) // Added log
+	userID, _ := middleware.UserIDFromContext(r.Context())
+	hardwareID, _ := middleware.DeviceIDFromContext(r.Context())
+	deviceUUID, ok := requestDeviceUUID(w, r)
+	if !ok {
+		return
+	}
+	log.Printf("[StartDownload] Context values - Device: %s (hardware %s), UserID: %s", deviceUUID, hardwareID, userID) // Added log
 
-	// Convert deviceID string to UUID
-	log.Printf("[StartDownload] Parsing DeviceID string to UUID: [%s]", deviceID) // Added log
-	deviceUUID, err := uuid.Parse(deviceID)
+	// The content's size is the download's target, for progress and resume
+	content, err := h.store.Get(r.Context(), contentID)
 	if err != nil {
-		log.Printf("[StartDownload] Error parsing DeviceID '%s': %v", deviceID, err) // Log device ID parse error
-		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[StartDownload] [Error] Failed to look up content %s: %v", contentID, err)
+		http.Error(w, "Failed to start download", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("[StartDownload] DeviceID parsed successfully: %s", deviceUUID.String()) // Added log
+
+	if r.URL.Query().Get("force_new") == "true" {
+		req.ForceNew = true
+	}
+	if req.Resume && !req.ForceNew {
+		// A failed or cancelled download cannot be picked up again, so a
+		// fresh one is started instead
+		existing, err := h.store.GetLatestDownload(r.Context(), deviceUUID, contentID)
+		if err == nil && (existing.Status == db.DownloadStatusFailed || existing.Status == db.DownloadStatusCancelled) {
+			err = sql.ErrNoRows
+		}
+		if err == nil {
+			log.Printf("[StartDownload] Resuming existing download %s (status %s)", existing.ID, existing.Status)
+			existing.EstimateTransfer(existing.LastUpdatedAt)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(existing)
+			return
+		}
+		if err != sql.ErrNoRows {
+			log.Printf("[StartDownload] [Error] Failed to look up existing download: %v", err)
+			http.Error(w, "Failed to start download", http.StatusInternalServerError)
+			return
+		}
+	}
 
 	download := &db.Download{
-		DeviceID:  deviceUUID,
-		UserID:    userID,
-		ContentID: contentID, // Uses the parsed UUID
-		Status:    "started",
+		DeviceID:   deviceUUID,
+		UserID:     userID,
+		ContentID:  contentID, // Uses the parsed UUID
+		Status:     db.DownloadStatusQueued,
+		TotalBytes: content.Size,
 	}
 	log.Printf("[StartDownload] Creating download record: %+v", download) // Added log
 
-	if err := h.store.CreateDownload(r.Context(), download); err != nil {
+	limits := db.DownloadLimits{PerDevice: h.maxActivePerDevice, PerUser: h.maxActivePerUser}
+	if isAdmin, _ := middleware.IsAdminFromContext(r.Context()); isAdmin && h.exemptAdmins {
+		limits = db.DownloadLimits{}
+	}
+	if err := h.store.CreateDownloadWithinLimits(r.Context(), download, limits); err != nil {
+		var limitErr *db.DownloadLimitError
+		if errors.As(err, &limitErr) {
+			log.Printf("[StartDownload] Refusing download for device %s (user %s): %v", deviceUUID, userID, limitErr)
+			respondDownloadLimit(w, limitErr)
+			return
+		}
 		log.Printf("[StartDownload] [Error] Failed to create download in DB: %v", err) // Clarified log source
 		http.Error(w, "Failed to start download", http.StatusInternalServerError)
 		return
@@ -100,11 +345,56 @@ func (h *DownloadHandler) StartDownload(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(download)
 }
 
+// progressStatus maps a reported status onto queued or downloading for
+// in-flight updates: a download only counts as downloading once bytes have
+// arrived, and never drops back to queued. A progress-only update leaves a
+// paused download paused, and other statuses are returned unchanged.
+func progressStatus(current, requested string, bytesDownloaded int64) string {
+	if requested == "" && current == db.DownloadStatusPaused {
+		return current
+	}
+	switch requested {
+	case "", db.DownloadStatusQueued, db.DownloadStatusStarted, db.DownloadStatusDownloading:
+		if bytesDownloaded > 0 || current == db.DownloadStatusDownloading {
+			return db.DownloadStatusDownloading
+		}
+		return db.DownloadStatusQueued
+	}
+	return requested
+}
+
+// respondDownloadLimit refuses a download that would take a device or user
+// past its limit. It clears once another download finishes.
+func respondDownloadLimit(w http.ResponseWriter, limitErr *db.DownloadLimitError) {
+	transient := true
+	writeErrorResponse(w, ErrorResponse{
+		Error:     limitErr.Error(),
+		Code:      http.StatusTooManyRequests,
+		ErrorCode: errCodeTooManyDownloads,
+		Transient: &transient,
+	})
+}
+
+// shouldPersistProgress reports whether an update must be written. Status
+// changes are always written; a progress-only update is written once bytes
+// have advanced by minBytes or interval has passed since the last write.
+// Skipped updates are coalesced into the next write, which carries the
+// latest byte count.
+func shouldPersistProgress(stored *db.Download, status string, bytesDownloaded int64, now time.Time, minBytes int64, interval time.Duration) bool {
+	if status != stored.Status {
+		return true
+	}
+	if bytesDownloaded-stored.BytesDownloaded >= minBytes {
+		return true
+	}
+	return now.Sub(stored.LastUpdatedAt) >= interval
+}
+
 // UpdateStatus updates the status of an existing download
 func (h *DownloadHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
 	// 1. Check Method
 	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondMethodNotAllowed(w, http.MethodPut)
 		return
 	}
 
@@ -114,12 +404,18 @@ func (h *DownloadHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
 		Status          string  `json:"status"`
 		BytesDownloaded int64   `json:"bytes_downloaded"`        // Keep optional fields if frontend might send them
 		ErrorMessage    *string `json:"error_message,omitempty"` // Use pointer for optional field
+		// ResumePosition, when sent, is the byte offset the client will
+		// resume from; it is kept until the next update that sends one
+		ResumePosition *int64 `json:"resume_position,omitempty"`
+		// Version, when sent, is the version the client last saw; the
+		// update is refused if the download has moved on since
+		Version *int `json:"version,omitempty"`
 	}
 
 	// 3. Decode JSON body into the struct
-	if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+	if err := decodeJSON(r.Body, &updateReq); err != nil {
 		log.Printf("[UpdateStatus] Error decoding request body: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		respondWithDecodeError(w, err)
 		return
 	}
 	log.Printf("[UpdateStatus] Received update request body: %+v", updateReq)
@@ -134,11 +430,16 @@ func (h *DownloadHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
 	downloadUUID, err := uuid.Parse(updateReq.ID)
 	if err != nil {
 		log.Printf("[UpdateStatus] Error parsing download ID '%s' from body: %v", updateReq.ID, err)
-		http.Error(w, "Invalid download ID format", http.StatusBadRequest)
+		respondWithInvalidUUID(w, "Invalid download ID format", "id", updateReq.ID, err)
 		return
 	}
 	log.Printf("[UpdateStatus] Parsed Download UUID from body: %s", downloadUUID)
 
+	deviceUUID, ok := requestDeviceUUID(w, r)
+	if !ok {
+		return
+	}
+
 	// 5. Fetch the existing download record from DB using the parsed UUID
 	download, err := h.store.GetDownloadByID(r.Context(), downloadUUID) // Use the UUID parsed from the body
 	if err != nil {
@@ -152,50 +453,282 @@ func (h *DownloadHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if download.DeviceID != deviceUUID {
+		// Answer as if it did not exist so other devices' IDs are not confirmed
+		hardwareID, _ := middleware.DeviceIDFromContext(r.Context())
+		log.Printf("[UpdateStatus] Device %s (%s) tried to update download %s owned by %s", deviceUUID, hardwareID, downloadUUID, download.DeviceID)
+		http.Error(w, "Download not found", http.StatusNotFound)
+		return
+	}
 	log.Printf("[UpdateStatus] Found download record to update: %+v", download)
+	if updateReq.Version != nil && *updateReq.Version != download.Version {
+		respondVersionConflict(w, download)
+		return
+	}
 
 	// 6. Update the download record fields
-	download.Status = updateReq.Status
+	status := progressStatus(download.Status, updateReq.Status, updateReq.BytesDownloaded)
+	if !db.ValidDownloadStatus(status) {
+		log.Printf("[UpdateStatus] Error: Invalid status '%s'", updateReq.Status)
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid status %q", updateReq.Status))
+		return
+	}
+	if pos := updateReq.ResumePosition; pos != nil && (*pos < 0 || (download.TotalBytes > 0 && *pos > download.TotalBytes)) {
+		writeErrorResponse(w, ErrorResponse{
+			Error:  "Invalid resume position",
+			Code:   http.StatusBadRequest,
+			Field:  "resume_position",
+			Value:  strconv.FormatInt(*pos, 10),
+			Reason: fmt.Sprintf("must be between 0 and the download's total of %d bytes", download.TotalBytes),
+		})
+		return
+	}
+	// Checked here as well as by the store, since throttled progress
+	// updates are acknowledged without reaching it
+	if err := db.CheckDownloadTransition(download, status, updateReq.BytesDownloaded); err != nil {
+		respondInvalidTransition(w, downloadUUID, status, err)
+		return
+	}
+	previousStatus := download.Status
+	// A new resume position is what a paused client resumes from, so it is
+	// never held back with throttled progress
+	persist := updateReq.ErrorMessage != nil ||
+		(updateReq.ResumePosition != nil && *updateReq.ResumePosition != download.ResumePosition) ||
+		shouldPersistProgress(download, status, updateReq.BytesDownloaded, time.Now(), h.progressMinBytes, h.progressInterval)
+	download.Status = status
 	download.BytesDownloaded = updateReq.BytesDownloaded // Assuming frontend sends this
 	download.ErrorMessage = updateReq.ErrorMessage       // Update optional error message
+	if updateReq.ResumePosition != nil {
+		download.ResumePosition = *updateReq.ResumePosition
+	}
+
+	if !persist {
+		// Acknowledge without a DB write; the next persisted update carries
+		// the latest byte count
+		download.EstimateTransfer(time.Now())
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Progress-Persisted", "false")
+		json.NewEncoder(w).Encode(download)
+		return
+	}
 
 	// 7. Save the updated record to the database
 	if err := h.store.UpdateDownload(r.Context(), download); err != nil {
+		if errors.Is(err, db.ErrInvalidTransition) {
+			respondInvalidTransition(w, downloadUUID, status, err)
+			return
+		}
+		if errors.Is(err, db.ErrVersionConflict) {
+			log.Printf("[UpdateStatus] Concurrent update of download %s; refusing stale write", downloadUUID)
+			if current, err := h.store.GetDownloadByID(r.Context(), downloadUUID); err == nil {
+				download = current
+			}
+			respondVersionConflict(w, download)
+			return
+		}
 		log.Printf("[UpdateStatus] [Error] Failed to update download record in DB: %v", err)
 		http.Error(w, "Failed to update download status", http.StatusInternalServerError)
 		return
 	}
 	log.Printf("[UpdateStatus] Successfully updated download record ID: %s", downloadUUID)
+	if download.Status == db.DownloadStatusCompleted && previousStatus != db.DownloadStatusCompleted {
+		hardwareID, _ := middleware.DeviceIDFromContext(r.Context())
+		logTransferCompleted(transferSummary{
+			Source:     transferSourceStatus,
+			ContentID:  download.ContentID,
+			DownloadID: download.ID,
+			Device:     hardwareID,
+			Bytes:      download.BytesDownloaded,
+			Duration:   download.LastUpdatedAt.Sub(download.StartedAt),
+		})
+	}
 
 	// 8. Send success response (return the updated record)
+	download.EstimateTransfer(download.LastUpdatedAt)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(download)
 }
 
+// respondInvalidTransition answers an update the download's current status
+// does not allow with 409 and the reason
+func respondInvalidTransition(w http.ResponseWriter, id uuid.UUID, status string, err error) {
+	log.Printf("[UpdateStatus] Refusing status %s for download %s: %v", status, id, err)
+	writeErrorResponse(w, ErrorResponse{
+		Error:     "Invalid status transition",
+		Code:      http.StatusConflict,
+		ErrorCode: errCodeInvalidTransition,
+		Field:     "status",
+		Value:     truncateValue(status),
+		Reason:    err.Error(),
+	})
+}
+
+// CancelDownload marks one of the device's downloads as cancelled so it no
+// longer counts as active. Cancelling a cancelled download succeeds; one
+// that has completed or failed gets 409.
+func (h *DownloadHandler) CancelDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	idStr := r.URL.Query().Get("id")
+	downloadUUID, err := uuid.Parse(idStr)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid download ID format", "id", idStr, err)
+		return
+	}
+	deviceUUID, ok := requestDeviceUUID(w, r)
+	if !ok {
+		return
+	}
+
+	download, err := h.store.GetDownloadByID(r.Context(), downloadUUID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Download not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[CancelDownload] [Error] Failed to find download record: %v", err)
+		http.Error(w, "Failed to retrieve download record", http.StatusInternalServerError)
+		return
+	}
+	if download.DeviceID != deviceUUID {
+		// Answer as if it did not exist so other devices' IDs are not confirmed
+		log.Printf("[CancelDownload] Device %s tried to cancel download %s owned by %s", deviceUUID, downloadUUID, download.DeviceID)
+		http.Error(w, "Download not found", http.StatusNotFound)
+		return
+	}
+
+	if download.Status != db.DownloadStatusCancelled {
+		if !db.ValidDownloadTransition(download.Status, db.DownloadStatusCancelled) {
+			respondWithError(w, http.StatusConflict, fmt.Sprintf("Download is %s and cannot be cancelled", download.Status))
+			return
+		}
+		download.Status = db.DownloadStatusCancelled
+		if err := h.store.UpdateDownload(r.Context(), download); err != nil {
+			if errors.Is(err, db.ErrInvalidTransition) {
+				respondInvalidTransition(w, downloadUUID, download.Status, err)
+				return
+			}
+			if errors.Is(err, db.ErrVersionConflict) {
+				if current, err := h.store.GetDownloadByID(r.Context(), downloadUUID); err == nil {
+					download = current
+				}
+				respondVersionConflict(w, download)
+				return
+			}
+			log.Printf("[CancelDownload] [Error] Failed to cancel download %s: %v", downloadUUID, err)
+			http.Error(w, "Failed to cancel download", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("[CancelDownload] Device %s cancelled download %s", deviceUUID, downloadUUID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(download)
+}
+
+// respondVersionConflict answers an update based on a stale read with 409
+// and the download as it now stands, so the client can re-apply its change
+func respondVersionConflict(w http.ResponseWriter, current *db.Download) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":      "Download was updated concurrently; refetch and retry",
+		"code":       http.StatusConflict,
+		"error_code": "version_conflict",
+		"download":   current,
+	})
+}
+
 // GetHistory returns download history for the current device
 func (h *DownloadHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondMethodNotAllowed(w, http.MethodGet)
 		return
 	}
 
-	deviceID := r.Context().Value("device_id").(string)
-	deviceUUID, err := uuid.Parse(deviceID)
+	deviceUUID, ok := requestDeviceUUID(w, r)
+	if !ok {
+		return
+	}
 
-	if err != nil {
-		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+	var err error
+	var cursor *db.DownloadCursor
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		cursor, err = db.DecodeDownloadCursor(token)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Without limit or cursor the whole history is returned, as it was
+	// before paging; paging is opted into
+	limit := 0
+	if cursor != nil {
+		limit = defaultHistoryPageSize
+	}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxHistoryPageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxHistoryPageSize), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if include := r.URL.Query().Get("include"); include == "content" {
+		h.getHistoryWithContent(w, r, deviceUUID, cursor, limit)
+		return
+	} else if include != "" {
+		http.Error(w, "include must be content", http.StatusBadRequest)
 		return
 	}
 
-	downloads, err := h.store.ListDownloadsByDeviceID(r.Context(), deviceUUID)
+	downloads, next, err := h.store.ListDownloadsByDeviceID(r.Context(), deviceUUID, cursor, limit)
 	if err != nil {
 		log.Printf("[Error] Failed to get download history: %v", err)
 		http.Error(w, "Failed to get download history", http.StatusInternalServerError)
 		return
 	}
 
+	for _, d := range downloads {
+		d.EstimateTransfer(d.LastUpdatedAt)
+	}
+	if downloads == nil {
+		downloads = []*db.Download{}
+	}
+	writeHistoryPage(w, downloads, next)
+}
+
+// writeHistoryPage writes a history page as a JSON array, with the cursor
+// for the page after it in X-Next-Cursor
+func writeHistoryPage(w http.ResponseWriter, page interface{}, next *db.DownloadCursor) {
+	if next != nil {
+		w.Header().Set(nextCursorHeader, next.Encode())
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(downloads)
+	json.NewEncoder(w).Encode(page)
+}
+
+// getHistoryWithContent serves a history page with content metadata joined
+// in, sparing clients a lookup per download
+func (h *DownloadHandler) getHistoryWithContent(w http.ResponseWriter, r *http.Request, deviceID uuid.UUID, cursor *db.DownloadCursor, limit int) {
+	downloads, next, err := h.store.ListDownloadsWithContentByDeviceID(r.Context(), deviceID, cursor, limit)
+	if err != nil {
+		log.Printf("[Error] Failed to get download history with content: %v", err)
+		http.Error(w, "Failed to get download history", http.StatusInternalServerError)
+		return
+	}
+
+	for _, d := range downloads {
+		d.EstimateTransfer(d.LastUpdatedAt)
+	}
+	if downloads == nil {
+		downloads = []*db.DownloadWithContent{}
+	}
+	writeHistoryPage(w, downloads, next)
 }
 
 func (h *DownloadHandler) GetDownloadURL(w http.ResponseWriter, r *http.Request) {
@@ -203,7 +736,7 @@ func (h *DownloadHandler) GetDownloadURL(w http.ResponseWriter, r *http.Request)
 
 	if r.Method != http.MethodGet {
 		log.Printf("[GetDownloadURL] Error: Method not allowed (%s)", r.Method) // Added log
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondMethodNotAllowed(w, http.MethodGet)
 		return
 	}
 
@@ -219,7 +752,7 @@ func (h *DownloadHandler) GetDownloadURL(w http.ResponseWriter, r *http.Request)
 	id, err := uuid.Parse(contentID)
 	if err != nil {
 		log.Printf("[GetDownloadURL] Error parsing contentID '%s': %v", contentID, err) // Added log
-		http.Error(w, "Invalid content ID", http.StatusBadRequest)
+		respondWithInvalidUUID(w, "Invalid content ID", "content_id", contentID, err)
 		return
 	}
 	log.Printf("[GetDownloadURL] ContentID parsed successfully: %s", id.String()) // Added log
@@ -227,6 +760,11 @@ func (h *DownloadHandler) GetDownloadURL(w http.ResponseWriter, r *http.Request)
 	// Generate URL with 1-hour expiration
 	log.Printf("[GetDownloadURL] Calling urlGenerator.GenerateURL for ID: %s", id.String()) // Added log
 	url, err := h.urlGenerator.GenerateURL(id, time.Hour)
+	if errors.Is(err, ErrContentDisabled) {
+		log.Printf("[GetDownloadURL] Refusing URL for disabled content %s", id)
+		respondContentDisabled(w)
+		return
+	}
 	if err != nil {
 		// This log already exists, but added context
 		log.Printf("[GetDownloadURL] [Error] urlGenerator.GenerateURL failed: %v", err)
@@ -245,12 +783,110 @@ func (h *DownloadHandler) GetDownloadURL(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleMissingObject answers a signed download whose record is valid but
+// whose bytes are gone, and flags the record so admin views can surface it
+func (h *DownloadHandler) handleMissingObject(w http.ResponseWriter, r *http.Request, content *db.Content) {
+	missingObjects.Inc()
+	log.Printf("[HandleSignedDownload] [Alert] Storage object missing for content %s (key %s)",
+		content.ID, content.StorageKey.String)
+
+	if h.flagMissing && content.StorageState.String != db.StorageStateMissing {
+		if err := h.store.SetStorageState(r.Context(), content.ID, db.StorageStateMissing); err != nil {
+			log.Printf("[HandleSignedDownload] Failed to flag %s as missing: %v", content.ID, err)
+		}
+	}
+	// A 502 says the bytes may come back, e.g. once the mirror catches up; a
+	// 410 says they are gone for good
+	retryAfter := time.Duration(0)
+	if h.missingStatus == http.StatusBadGateway {
+		retryAfter = h.notReadyRetryAfter
+	}
+	respondContentUnavailable(w, h.missingStatus, "Content file is missing from storage", retryAfter)
+}
+
+// GetDownloadURLByVersion signs a download URL for the content identified by
+// app_type and version, for clients that track releases rather than IDs
+func (h *DownloadHandler) GetDownloadURLByVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	appType := r.URL.Query().Get("app_type")
+	version := r.URL.Query().Get("version")
+	if appType == "" || version == "" {
+		respondWithError(w, http.StatusBadRequest, "app_type and version are required")
+		return
+	}
+
+	matches, err := h.store.FindByVersion(r.Context(), appType, version)
+	if err != nil {
+		log.Printf("[GetDownloadURLByVersion] [Error] Lookup failed for %s %s: %v", appType, version, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to look up content")
+		return
+	}
+
+	switch len(matches) {
+	case 0:
+		respondWithError(w, http.StatusNotFound, "No content found for this app_type and version")
+		return
+	case 1:
+	default:
+		ids := make([]uuid.UUID, len(matches))
+		for i, c := range matches {
+			ids[i] = c.ID
+		}
+		log.Printf("[GetDownloadURLByVersion] %s %s matches %d records", appType, version, len(matches))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":       "Multiple content records match this app_type and version",
+			"content_ids": ids,
+		})
+		return
+	}
+
+	content := matches[0]
+	url, err := h.urlGenerator.GenerateURL(content.ID, time.Hour)
+	if errors.Is(err, ErrContentDisabled) {
+		respondContentDisabled(w)
+		return
+	}
+	if err != nil {
+		log.Printf("[GetDownloadURLByVersion] [Error] urlGenerator.GenerateURL failed for %s: %v", content.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate download URL")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"content_id":   content.ID.String(),
+		"download_url": url,
+		"expires_in":   "1h",
+	})
+}
+
 func (h *DownloadHandler) HandleSignedDownload(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[HandleSignedDownload] Received request for: %s", r.URL.RequestURI())
 
 	// 1. Validate the signed URL
-	isValid := h.urlGenerator.ValidateURL(r.URL.RequestURI())
-	if !isValid {
+	if err := h.urlGenerator.VerifyURL(r.URL.RequestURI()); err != nil {
+		if errors.Is(err, ErrContentChanged) {
+			log.Printf("[HandleSignedDownload] Content changed since URL was issued: %s", r.URL.RequestURI())
+			contentID := strings.TrimPrefix(r.URL.Path, "/download/")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":       "Content has been updated since this download link was issued",
+				"reissue_url": "/api/downloads/url?content_id=" + url.QueryEscape(contentID),
+			})
+			return
+		}
+		if errors.Is(err, ErrUnsupportedURLVersion) {
+			log.Printf("[HandleSignedDownload] %v: %s", err, r.URL.RequestURI())
+			respondWithError(w, http.StatusBadRequest, "Unsupported download link version; request a new link")
+			return
+		}
 		log.Printf("[HandleSignedDownload] Invalid or expired signature for: %s", r.URL.RequestURI())
 		http.Error(w, "Forbidden: Invalid or expired download link", http.StatusForbidden)
 		return
@@ -273,6 +909,23 @@ func (h *DownloadHandler) HandleSignedDownload(w http.ResponseWriter, r *http.Re
 	}
 	log.Printf("[HandleSignedDownload] Extracted ContentID: %s", contentID.String())
 
+	// An enabled transformer may rewrite the content as it streams
+	var transform *Transformer
+	if name := r.URL.Query().Get(TransformParam); name != "" {
+		t, ok := h.transforms[name]
+		if !ok {
+			writeErrorResponse(w, ErrorResponse{
+				Error:  "Unsupported transform",
+				Code:   http.StatusBadRequest,
+				Field:  TransformParam,
+				Value:  truncateValue(name),
+				Reason: "transform is not enabled on this server",
+			})
+			return
+		}
+		transform = &t
+	}
+
 	// 3. Get content metadata from the database
 	content, err := h.store.Get(r.Context(), contentID)
 	if err != nil {
@@ -287,6 +940,17 @@ func (h *DownloadHandler) HandleSignedDownload(w http.ResponseWriter, r *http.Re
 		return
 	}
 	log.Printf("[HandleSignedDownload] Found content metadata: %+v", content)
+	if !content.Enabled {
+		log.Printf("[HandleSignedDownload] Refusing download of disabled content %s", contentID)
+		respondContentDisabled(w)
+		return
+	}
+
+	switch content.StorageState.String {
+	case db.StorageStateArchived, db.StorageStateRehydrating:
+		h.handleArchivedObject(w, r, content)
+		return
+	}
 
 	// 4. Check if StorageKey is valid and not NULL, then get the actual file stream
 	if !content.StorageKey.Valid {
@@ -295,37 +959,257 @@ func (h *DownloadHandler) HandleSignedDownload(w http.ResponseWriter, r *http.Re
 		return
 	}
 	storageKey := content.StorageKey.String // Get the actual string value
+	backendSvc, err := h.backendFor(content)
+	if err != nil {
+		log.Printf("[HandleSignedDownload] Error: Content %s is stored in an unavailable backend: %v", contentID, err)
+		http.Error(w, "Internal Server Error: Storage backend unavailable", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		h.handleSignedHead(w, r, content, backendSvc, transform)
+		return
+	}
+
+	// Ranges address the stored bytes, so they are only honoured for content
+	// stored and served as is; anything else gets the whole file
+	start, end, ranged := int64(0), int64(0), false
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && content.ContentEncoding == "" && transform == nil && content.Size > 0 {
+		start, end, err = parseByteRange(rangeHeader, content.Size)
+		switch {
+		case err == nil:
+			ranged = true
+		case errors.Is(err, errRangeNotSatisfiable):
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", content.Size))
+			respondWithError(w, http.StatusRequestedRangeNotSatisfiable, "Requested range not satisfiable")
+			return
+		default:
+			log.Printf("[HandleSignedDownload] Ignoring Range %q for %s", rangeHeader, contentID)
+		}
+	}
+
+	// Wait for a storage read slot; a popular content queues behind its own
+	// downloads rather than everyone else's
+	releaseRead, err := h.reads.acquire(r.Context(), contentID.String())
+	if err != nil {
+		log.Printf("[HandleSignedDownload] Client went away while %s was queued for storage: %v", contentID, err)
+		return
+	}
+	defer releaseRead()
+
 	log.Printf("[HandleSignedDownload] Attempting to download from storage with key: %s", storageKey)
-	reader, info, err := h.storage.Download(r.Context(), storageKey)
+	var reader io.ReadCloser
+	var info *storage.FileInfo
+	var backend string
+	if ranged {
+		log.Printf("[HandleSignedDownload] Serving bytes %d-%d of %s", start, end, contentID)
+		reader, backend, err = h.openObjectRange(r.Context(), backendSvc, storageKey, start, end)
+	} else {
+		reader, info, backend, err = h.openObject(r.Context(), backendSvc, storageKey)
+	}
 	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.handleMissingObject(w, r, content)
+			return
+		}
 		log.Printf("[HandleSignedDownload] Error downloading file from storage key '%s': %v", storageKey, err)
 		http.Error(w, "Failed to access storage", http.StatusInternalServerError)
 		return
 	}
 	defer reader.Close()
-	log.Printf("[HandleSignedDownload] Successfully opened stream from storage. Info: %+v", info)
+	if content.StorageState.String == db.StorageStateMissing {
+		// The object is back, e.g. restored by reconcile tooling
+		if err := h.store.SetStorageState(r.Context(), contentID, ""); err != nil {
+			log.Printf("[HandleSignedDownload] Failed to clear storage state for %s: %v", contentID, err)
+		}
+	}
+	downloadsServed.Inc(backend)
+	log.Printf("[HandleSignedDownload] Successfully opened stream from %s storage. Info: %+v", backend, info)
 
 	// 5. Set response headers
-	responseContentType := "application/octet-stream" // Default if NULL
-	if content.ContentType.Valid {
-		responseContentType = content.ContentType.String
+	h.setEntityHeaders(w, r, content, transform)
+
+	// Gzipped objects go out as stored to clients that accept gzip and are
+	// decompressed for everyone else, and before any transform;
+	// content.Size is the uncompressed size
+	var body io.Reader = reader
+	storedSize := int64(0)
+	if info != nil {
+		storedSize = info.Size
 	}
-	w.Header().Set("Content-Type", responseContentType)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", content.Name))
-	if info != nil && info.Size > 0 {
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size))
-	} else if content.Size > 0 {
+	if content.ContentEncoding == db.ContentEncodingGzip {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r.Header.Get("Accept-Encoding")) && transform == nil {
+			w.Header().Set("Content-Encoding", "gzip")
+		} else {
+			gz, err := gzip.NewReader(reader)
+			if err != nil {
+				log.Printf("[HandleSignedDownload] Stored object for %s is not valid gzip: %v", contentID, err)
+				http.Error(w, "Failed to decode stored content", http.StatusInternalServerError)
+				return
+			}
+			defer gz.Close()
+			body = gz
+			storedSize = 0
+		}
+	}
+	if transform != nil {
+		transformed, err := transform.Apply(body)
+		if err != nil {
+			log.Printf("[HandleSignedDownload] Transform of %s failed: %v", contentID, err)
+			http.Error(w, "Failed to transform content", http.StatusInternalServerError)
+			return
+		}
+		if c, ok := transformed.(io.Closer); ok {
+			defer c.Close()
+		}
+		body = transformed
+		storedSize = 0
+	}
+
+	// The checksum covers the whole original file, so only a body that is
+	// exactly that can be checked against it
+	var streamHash hash.Hash
+	if !ranged && transform == nil && w.Header().Get("Content-Encoding") == "" && content.Checksum.Valid {
+		if r.URL.Query().Get(VerifyParam) == "true" && content.Size > 0 && content.Size <= h.verifyMaxBytes {
+			data, actual, ok, err := readVerified(body, content, h.verifyMaxBytes)
+			if err != nil {
+				log.Printf("[HandleSignedDownload] Failed to read %s for verification: %v", contentID, err)
+				http.Error(w, "Failed to access storage", http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				h.recordChecksumMismatch(r.Context(), content, backend, checkBuffered, actual)
+				for _, header := range []string{checksumHeader, "Content-Disposition", "Accept-Ranges", "X-Content-Type-Options"} {
+					w.Header().Del(header)
+				}
+				transient := false
+				writeErrorResponse(w, ErrorResponse{
+					Error:     "Stored content failed checksum verification",
+					Code:      http.StatusBadGateway,
+					ErrorCode: errCodeChecksumMismatch,
+					Transient: &transient,
+				})
+				return
+			}
+			w.Header().Set(checksumVerifiedHeader, "true")
+			body = bytes.NewReader(data)
+			storedSize = int64(len(data))
+		} else if h.verifyStreams {
+			streamHash = sha256.New()
+			body = io.TeeReader(body, streamHash)
+		}
+	}
+	switch {
+	case ranged:
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, content.Size))
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", end-start+1))
+	case storedSize > 0:
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", storedSize))
+	case content.Size > 0 && w.Header().Get("Content-Encoding") == "" && transform == nil:
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", content.Size))
 	}
-	log.Printf("[HandleSignedDownload] Set download headers.")
 	log.Printf("[HandleSignedDownload] Headers set: %v", w.Header())
+	if ranged {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+
+	// 6. Stream the file content. Only a GET that gets this far counts as an
+	// active download; refused links, HEADs and failed opens do not.
+	defer trackActiveDownload()()
+	started := time.Now()
+	bytesCopied, err := io.Copy(w, body)
+	downloadBytes.Add(bytesCopied)
+	summary := transferSummary{
+		Source:    transferSourceStream,
+		ContentID: contentID,
+		Bytes:     bytesCopied,
+		Duration:  time.Since(started),
+	}
+	expected, _ := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64)
+	if err != nil || (expected > 0 && bytesCopied < expected) {
+		logTransferAborted(summary, expected, err)
+		return
+	}
+	// The bytes are already sent; the client checks them against the
+	// X-Content-SHA256 header, and the mismatch is recorded here
+	if streamHash != nil {
+		if actual := hex.EncodeToString(streamHash.Sum(nil)); !strings.EqualFold(actual, content.Checksum.String) {
+			h.recordChecksumMismatch(r.Context(), content, backend, checkStream, actual)
+		}
+	}
+	logTransferCompleted(summary)
+}
+
+// setEntityHeaders sets the headers describing the file a signed download
+// serves, shared by GET and HEAD: its type, filename, checksum and whether
+// ranges are accepted
+func (h *DownloadHandler) setEntityHeaders(w http.ResponseWriter, r *http.Request, content *db.Content, transform *Transformer) {
+	responseContentType, overridden := servedContentType(content, h.typeOverridesByExt, h.typeOverridesByApp)
+	if overridden {
+		log.Printf("[HandleSignedDownload] Overriding content type for %s: stored %q, serving %q",
+			content.ID, content.ContentType.String, responseContentType)
+	}
+	filename := content.Name
+	if transform != nil {
+		if transform.ContentType != "" {
+			responseContentType = transform.ContentType
+		}
+		filename += transform.Extension
+	}
+	w.Header().Set("Content-Type", responseContentType)
+	disposition := contentDisposition(r.URL.Query().Get("disposition"), responseContentType)
+	if disposition == "inline" {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"", disposition, filename))
+
+	if content.ContentEncoding == "" && transform == nil {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
+	// The checksum covers the whole original file, which a transform changes
+	if content.Checksum.Valid && transform == nil {
+		w.Header().Set(checksumHeader, strings.ToLower(content.Checksum.String))
+	}
+}
 
-	// 6. Stream the file content
-	log.Printf("[HandleSignedDownload] Starting file stream to client...")
-	bytesCopied, err := io.Copy(w, reader)
+// handleSignedHead answers a HEAD on a signed link with the headers a GET
+// would send, taken from the record and the object's metadata, so a client
+// can learn the size and type of a file without streaming it. No read slot
+// is taken and the download is not counted.
+func (h *DownloadHandler) handleSignedHead(w http.ResponseWriter, r *http.Request, content *db.Content, svc storage.StorageService, transform *Transformer) {
+	info, err := svc.GetInfo(r.Context(), content.StorageKey.String)
 	if err != nil {
-		log.Printf("[HandleSignedDownload] Error streaming file to client: %v", err)
+		if errors.Is(err, storage.ErrNotFound) {
+			h.handleMissingObject(w, r, content)
+			return
+		}
+		log.Printf("[HandleSignedDownload] Error getting info for storage key '%s': %v", content.StorageKey.String, err)
+		http.Error(w, "Failed to access storage", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("[HandleSignedDownload] Finished streaming %d bytes.", bytesCopied)
+
+	h.setEntityHeaders(w, r, content, transform)
+	lastModified := content.UpdatedAt
+	if !info.UpdatedAt.IsZero() {
+		lastModified = info.UpdatedAt
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	// Mirror the lengths a GET would send; a transformed body's is unknown
+	size := content.Size
+	if content.ContentEncoding == db.ContentEncodingGzip {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r.Header.Get("Accept-Encoding")) && transform == nil {
+			w.Header().Set("Content-Encoding", "gzip")
+			size = info.Size
+		}
+	} else if size <= 0 {
+		size = info.Size
+	}
+	if size > 0 && transform == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
 }
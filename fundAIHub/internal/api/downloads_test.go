@@ -2,14 +2,24 @@ package api
 
 import (
 	"FundAIHub/internal/db"
+	"FundAIHub/internal/middleware"
+	"FundAIHub/internal/storage"
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // mockEduVaultMiddleware simulates the EduVault middleware for testing
@@ -20,8 +30,8 @@ func mockEduVaultMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		userID := "test-user-" + time.Now().Format("20060102")
 
 		// Add to context like EduVault would
-		ctx := context.WithValue(r.Context(), "hardware_id", deviceID)
-		ctx = context.WithValue(ctx, "user_id", userID)
+		ctx := middleware.WithDeviceID(r.Context(), deviceID)
+		ctx = middleware.WithUserID(ctx, userID)
 
 		// Call the next handler with our test context
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -45,7 +55,7 @@ func TestDownloadFlow(t *testing.T) {
 
 	// Create store using the correct function
 	store := db.NewContentStore(dbConn) // This is the correct function call
-	handler := NewDownloadHandler(store)
+	handler := NewDownloadHandler(store, nil)
 
 	// Create test content first
 	content := createTestContent(t, store)
@@ -103,3 +113,818 @@ func createTestContent(t *testing.T, store *db.ContentStore) *db.Content {
 
 	return content
 }
+
+func TestServedContentType(t *testing.T) {
+	byExt := map[string]string{".appimage": "application/vnd.appimage"}
+	byApp := map[string]string{"document": "application/pdf"}
+
+	tests := []struct {
+		name           string
+		content        db.Content
+		want           string
+		wantOverridden bool
+	}{
+		{
+			"Extension override, case-insensitive",
+			db.Content{Name: "Tutor.AppImage", ContentType: sql.NullString{String: "text/plain", Valid: true}},
+			"application/vnd.appimage", true,
+		},
+		{
+			"App type override",
+			db.Content{Name: "notes", AppType: "document", ContentType: sql.NullString{String: "text/plain", Valid: true}},
+			"application/pdf", true,
+		},
+		{
+			"Override matching stored type is not reported",
+			db.Content{Name: "x.appimage", ContentType: sql.NullString{String: "application/vnd.appimage", Valid: true}},
+			"application/vnd.appimage", false,
+		},
+		{
+			"Stored type used without override",
+			db.Content{Name: "x.zip", ContentType: sql.NullString{String: "application/zip", Valid: true}},
+			"application/zip", false,
+		},
+		{
+			"Missing stored type falls back to octet-stream",
+			db.Content{Name: "x.bin"},
+			"application/octet-stream", false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, overridden := servedContentType(&tt.content, byExt, byApp)
+			if got != tt.want || overridden != tt.wantOverridden {
+				t.Errorf("servedContentType = (%q, %v), want (%q, %v)", got, overridden, tt.want, tt.wantOverridden)
+			}
+		})
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name        string
+		requested   string
+		contentType string
+		want        string
+	}{
+		{"PDF inline", "inline", "application/pdf", "inline"},
+		{"Image inline with parameters", "INLINE", "image/png; charset=binary", "inline"},
+		{"Inline not requested", "", "application/pdf", "attachment"},
+		{"HTML forced to attachment", "inline", "text/html; charset=utf-8", "attachment"},
+		{"SVG forced to attachment", "inline", "image/svg+xml", "attachment"},
+		{"Executable stays attachment", "inline", "application/x-executable", "attachment"},
+		{"Unparseable type", "inline", "not a type;;", "attachment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contentDisposition(tt.requested, tt.contentType); got != tt.want {
+				t.Errorf("contentDisposition(%q, %q) = %q, want %q", tt.requested, tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDownloadURLByVersion(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	handler := NewDownloadHandler(store, nil)
+
+	appType := "test-app-" + uuid.New().String()
+	create := func(version string) *db.Content {
+		key := "test/" + uuid.New().String() + ".bin"
+		c := &db.Content{
+			Name:       "Versioned Content",
+			Type:       "test",
+			Version:    version,
+			AppType:    appType,
+			FilePath:   key,
+			Size:       1024,
+			StorageKey: sql.NullString{String: key, Valid: true},
+		}
+		if err := store.Create(context.Background(), c); err != nil {
+			t.Fatalf("Failed to create content: %v", err)
+		}
+		return c
+	}
+	unique := create("1.0.0")
+
+	get := func(version string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet,
+			"/api/content/download-url?app_type="+appType+"&version="+version, nil)
+		rr := httptest.NewRecorder()
+		handler.GetDownloadURLByVersion(rr, req)
+		return rr
+	}
+
+	t.Run("Unique version is signed", func(t *testing.T) {
+		rr := get("1.0.0")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var resp map[string]string
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if resp["content_id"] != unique.ID.String() {
+			t.Errorf("Expected content_id %s, got %s", unique.ID, resp["content_id"])
+		}
+		if !strings.HasPrefix(resp["download_url"], "/download/"+unique.ID.String()) {
+			t.Errorf("Unexpected download_url %q", resp["download_url"])
+		}
+	})
+
+	t.Run("Duplicate version is refused", func(t *testing.T) {
+		dup := &db.Content{Name: "Versioned Content", Type: "test", Version: "1.0.0", AppType: appType, FilePath: "dup", Size: 1024}
+		if err := store.Create(context.Background(), dup); !errors.Is(err, db.ErrDuplicateVersion) {
+			t.Errorf("Expected ErrDuplicateVersion, got %v", err)
+		}
+	})
+
+	t.Run("Unknown version is not found", func(t *testing.T) {
+		if rr := get("3.0.0"); rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func TestStartDownloadForceNew(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	handler := NewDownloadHandler(store, nil)
+
+	contentID := createTestContentForDownload(t, store)
+	deviceID := uuid.New()
+
+	completed := &db.Download{
+		DeviceID:  deviceID,
+		UserID:    "test-user",
+		ContentID: contentID,
+		Status:    db.DownloadStatusCompleted,
+	}
+	if err := store.CreateDownload(context.Background(), completed); err != nil {
+		t.Fatalf("Failed to create download: %v", err)
+	}
+
+	start := func(body string) *db.Download {
+		req := httptest.NewRequest(http.MethodPost, "/api/downloads/start", strings.NewReader(body))
+		ctx := middleware.WithDeviceUUID(req.Context(), deviceID.String())
+		ctx = middleware.WithUserID(ctx, "test-user")
+		rr := httptest.NewRecorder()
+		handler.StartDownload(rr, req.WithContext(ctx))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var download db.Download
+		if err := json.NewDecoder(rr.Body).Decode(&download); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return &download
+	}
+
+	resumed := start(`{"contentId": "` + contentID.String() + `", "resume": true}`)
+	if resumed.ID != completed.ID {
+		t.Errorf("Expected resume to return download %s, got %s", completed.ID, resumed.ID)
+	}
+
+	fresh := start(`{"contentId": "` + contentID.String() + `", "resume": true, "force_new": true}`)
+	if fresh.ID == completed.ID {
+		t.Fatal("Expected force_new to create a new download")
+	}
+	if fresh.Status != db.DownloadStatusQueued {
+		t.Errorf("Expected new download to be %q, got %q", db.DownloadStatusQueued, fresh.Status)
+	}
+
+	history, _, err := store.ListDownloadsByDeviceID(context.Background(), deviceID, nil, 0)
+	if err != nil {
+		t.Fatalf("Failed to list downloads: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 downloads in history, got %d", len(history))
+	}
+	if old, err := store.GetDownloadByID(context.Background(), completed.ID); err != nil || old.Status != db.DownloadStatusCompleted {
+		t.Errorf("Expected original download to stay completed, got %+v (%v)", old, err)
+	}
+}
+
+func TestStartDownloadTotalBytes(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	handler := NewDownloadHandler(store, nil)
+
+	contentID := createTestContentForDownload(t, store)
+	deviceID := uuid.New()
+
+	start := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/downloads/start", strings.NewReader(body))
+		ctx := middleware.WithDeviceUUID(req.Context(), deviceID.String())
+		ctx = middleware.WithUserID(ctx, "test-user")
+		rr := httptest.NewRecorder()
+		handler.StartDownload(rr, req.WithContext(ctx))
+		return rr
+	}
+
+	rr := start(`{"contentId": "` + contentID.String() + `"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var first db.Download
+	if err := json.NewDecoder(rr.Body).Decode(&first); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if first.TotalBytes != 1024 {
+		t.Errorf("Expected total_bytes 1024, got %d", first.TotalBytes)
+	}
+
+	first.Status = db.DownloadStatusCancelled
+	if err := store.UpdateDownload(context.Background(), &first); err != nil {
+		t.Fatalf("Failed to cancel download: %v", err)
+	}
+	rr = start(`{"contentId": "` + contentID.String() + `", "resume": true}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var resumed db.Download
+	if err := json.NewDecoder(rr.Body).Decode(&resumed); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resumed.ID == first.ID {
+		t.Error("Expected resume over a cancelled download to create a new one")
+	}
+
+	rr = start(`{"contentId": "` + uuid.New().String() + `"}`)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown content, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestStartDownloadAdminExemption(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	handler := NewDownloadHandler(store, nil)
+	handler.maxActivePerDevice = 1
+
+	contentID := createTestContentForDownload(t, store)
+	deviceID := uuid.New()
+	active := &db.Download{DeviceID: deviceID, ContentID: contentID, Status: db.DownloadStatusDownloading}
+	if err := store.CreateDownload(context.Background(), active); err != nil {
+		t.Fatalf("Failed to create download: %v", err)
+	}
+
+	start := func(isAdmin bool) int {
+		body := `{"contentId": "` + contentID.String() + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/downloads/start", strings.NewReader(body))
+		ctx := middleware.WithDeviceUUID(req.Context(), deviceID.String())
+		ctx = middleware.WithIsAdmin(ctx, isAdmin)
+		rr := httptest.NewRecorder()
+		handler.StartDownload(rr, req.WithContext(ctx))
+		return rr.Code
+	}
+
+	if code := start(true); code != http.StatusTooManyRequests {
+		t.Errorf("Expected admins to be limited by default, got %d", code)
+	}
+	handler.exemptAdmins = true
+	if code := start(false); code != http.StatusTooManyRequests {
+		t.Errorf("Expected other devices to stay limited, got %d", code)
+	}
+	if code := start(true); code != http.StatusOK {
+		t.Errorf("Expected an exempt admin to start a download, got %d", code)
+	}
+}
+
+func TestStartDownloadUserLimit(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	handler := NewDownloadHandler(store, nil)
+	handler.maxActivePerDevice = 5
+	handler.maxActivePerUser = 2
+
+	contentID := createTestContentForDownload(t, store)
+	userID := "test-user-" + uuid.New().String()
+	laptop, phone := uuid.New(), uuid.New()
+
+	// One transfer on each device fills the user's cap
+	for _, deviceID := range []uuid.UUID{laptop, phone} {
+		active := &db.Download{
+			DeviceID:  deviceID,
+			UserID:    userID,
+			ContentID: contentID,
+			Status:    db.DownloadStatusDownloading,
+		}
+		if err := store.CreateDownload(context.Background(), active); err != nil {
+			t.Fatalf("Failed to create download: %v", err)
+		}
+	}
+
+	start := func(deviceID uuid.UUID, userID string) *httptest.ResponseRecorder {
+		body := `{"contentId": "` + contentID.String() + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/downloads/start", strings.NewReader(body))
+		ctx := middleware.WithDeviceUUID(req.Context(), deviceID.String())
+		ctx = middleware.WithUserID(ctx, userID)
+		rr := httptest.NewRecorder()
+		handler.StartDownload(rr, req.WithContext(ctx))
+		return rr
+	}
+
+	rr := start(phone, userID)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d at the user's cap, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+	var resp ErrorResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.ErrorCode != errCodeTooManyDownloads {
+		t.Errorf("Expected error_code %q, got %q", errCodeTooManyDownloads, resp.ErrorCode)
+	}
+
+	// The same device for another user is under both caps
+	if rr := start(phone, "other-user-"+uuid.New().String()); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d for another user, got %d", http.StatusOK, rr.Code)
+	}
+
+	handler.maxActivePerUser = 0
+	if rr := start(phone, userID); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d with the user cap disabled, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+// TestStartDownloadCountsQueued starts downloads that never report bytes,
+// all at once, and checks the queued ones fill the device's cap
+func TestStartDownloadCountsQueued(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	handler := NewDownloadHandler(store, nil)
+	handler.maxActivePerDevice = 3
+
+	contentID := createTestContentForDownload(t, store)
+	deviceID := uuid.New()
+	start := func() int {
+		body := `{"contentId": "` + contentID.String() + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/downloads/start", strings.NewReader(body))
+		ctx := middleware.WithDeviceUUID(req.Context(), deviceID.String())
+		rr := httptest.NewRecorder()
+		handler.StartDownload(rr, req.WithContext(ctx))
+		return rr.Code
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, 8)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = start()
+		}(i)
+	}
+	wg.Wait()
+
+	started, refused := 0, 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			started++
+		case http.StatusTooManyRequests:
+			refused++
+		default:
+			t.Errorf("Unexpected status %d", code)
+		}
+	}
+	if started != handler.maxActivePerDevice || refused != len(codes)-started {
+		t.Errorf("Started %d and refused %d, want %d started and the rest refused", started, refused, handler.maxActivePerDevice)
+	}
+	if code := start(); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d once queued downloads fill the cap, got %d", http.StatusTooManyRequests, code)
+	}
+}
+
+// TestPlanParallelismMatchesLimit checks a device told it may start n
+// downloads can start exactly n, whatever state its others are in
+func TestPlanParallelismMatchesLimit(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	handler := NewDownloadHandler(store, nil)
+	handler.maxActivePerDevice = 5
+	handler.maxActivePerUser = 0
+
+	contentID := createTestContentForDownload(t, store)
+	deviceID := uuid.New()
+	for _, status := range []string{db.DownloadStatusQueued, db.DownloadStatusPaused} {
+		download := &db.Download{DeviceID: deviceID, ContentID: contentID, Status: status}
+		if err := store.CreateDownload(context.Background(), download); err != nil {
+			t.Fatalf("Failed to create download: %v", err)
+		}
+	}
+
+	plan, err := handler.planFor(context.Background(), deviceID)
+	if err != nil {
+		t.Fatalf("planFor: %v", err)
+	}
+	if plan.Parallelism != 3 {
+		t.Fatalf("Parallelism = %d, want 3", plan.Parallelism)
+	}
+
+	start := func() int {
+		body := `{"contentId": "` + contentID.String() + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/downloads/start", strings.NewReader(body))
+		ctx := middleware.WithDeviceUUID(req.Context(), deviceID.String())
+		rr := httptest.NewRecorder()
+		handler.StartDownload(rr, req.WithContext(ctx))
+		return rr.Code
+	}
+	for i := 0; i < plan.Parallelism; i++ {
+		if code := start(); code != http.StatusOK {
+			t.Fatalf("Start %d of %d: expected status %d, got %d", i+1, plan.Parallelism, http.StatusOK, code)
+		}
+	}
+	if code := start(); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d past the plan's parallelism, got %d", http.StatusTooManyRequests, code)
+	}
+	if plan, err := handler.planFor(context.Background(), deviceID); err != nil || plan.Parallelism != 0 {
+		t.Errorf("Parallelism = %d, %v once the device is full, want 0", plan.Parallelism, err)
+	}
+}
+
+func TestRequestDeviceUUID(t *testing.T) {
+	deviceUUID := uuid.New()
+	hash := strings.Repeat("0f", 32)
+	tests := []struct {
+		name     string
+		value    string
+		set      bool
+		wantCode int
+	}{
+		{"FundaVault device UUID", deviceUUID.String(), true, http.StatusOK},
+		{"Missing device UUID", "", true, http.StatusForbidden},
+		{"Not in context", "", false, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/downloads/history", nil)
+			ctx := middleware.WithDeviceID(req.Context(), hash)
+			if tt.set {
+				ctx = middleware.WithDeviceUUID(ctx, tt.value)
+			}
+			rr := httptest.NewRecorder()
+			got, ok := requestDeviceUUID(rr, req.WithContext(ctx))
+
+			if tt.wantCode == http.StatusOK {
+				if !ok || got != deviceUUID {
+					t.Errorf("Expected %s, got %s (ok=%t)", deviceUUID, got, ok)
+				}
+				return
+			}
+			if ok || rr.Code != tt.wantCode {
+				t.Errorf("Expected status %d, got %d (ok=%t)", tt.wantCode, rr.Code, ok)
+			}
+		})
+	}
+}
+
+func TestTrackActiveDownload(t *testing.T) {
+	before := ActiveDownloads()
+
+	const workers = 64
+	var started, release sync.WaitGroup
+	started.Add(workers)
+	release.Add(1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Half the downloads panic, as a handler would on a bug
+			defer func() { recover() }()
+			defer trackActiveDownload()()
+
+			started.Done()
+			release.Wait()
+			if i%2 == 0 {
+				panic("download failed")
+			}
+		}(i)
+	}
+
+	started.Wait()
+	if got := ActiveDownloads() - before; got != workers {
+		t.Errorf("Expected %d active downloads, got %d", workers, got)
+	}
+
+	release.Done()
+	wg.Wait()
+	if got := ActiveDownloads(); got != before {
+		t.Errorf("Expected count to return to %d, got %d", before, got)
+	}
+}
+
+func TestMissingObjectStatus(t *testing.T) {
+	tests := []struct {
+		configured int
+		want       int
+	}{
+		{http.StatusGone, http.StatusGone},
+		{http.StatusBadGateway, http.StatusBadGateway},
+		{http.StatusInternalServerError, http.StatusGone},
+		{0, http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		if got := missingObjectStatus(tt.configured); got != tt.want {
+			t.Errorf("missingObjectStatus(%d) = %d, want %d", tt.configured, got, tt.want)
+		}
+	}
+}
+
+func TestSignedDownloadMissingObject(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	key := "test/" + uuid.New().String() + ".bin"
+	content := &db.Content{
+		Name:       "Missing Object",
+		Type:       "test",
+		Version:    "1.0",
+		FilePath:   key,
+		Size:       1024,
+		StorageKey: sql.NullString{String: key, Valid: true},
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("Failed to create content: %v", err)
+	}
+	// The fake storage is empty, so the object is missing
+	handler := NewDownloadHandler(store, newFakeStorage())
+	handler.flagMissing = true
+
+	signed, err := handler.urlGenerator.GenerateURL(content.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign URL: %v", err)
+	}
+	before := missingObjects.Value()
+
+	rr := httptest.NewRecorder()
+	handler.HandleSignedDownload(rr, httptest.NewRequest(http.MethodGet, signed, nil))
+
+	if rr.Code != http.StatusGone {
+		t.Fatalf("Expected status %d, got %d", http.StatusGone, rr.Code)
+	}
+	if missingObjects.Value() != before+1 {
+		t.Error("Expected missing object counter to increase")
+	}
+	got, err := store.Get(context.Background(), content.ID)
+	if err != nil {
+		t.Fatalf("Failed to reload content: %v", err)
+	}
+	if got.StorageState.String != db.StorageStateMissing {
+		t.Errorf("Expected storage_state %q, got %q", db.StorageStateMissing, got.StorageState.String)
+	}
+}
+
+func TestDisabledContentBlocksDownload(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	key := "test/" + uuid.New().String() + ".bin"
+	content := &db.Content{
+		Name:       "Pulled Content",
+		Type:       "test",
+		Version:    "1.0",
+		FilePath:   key,
+		Size:       4,
+		StorageKey: sql.NullString{String: key, Valid: true},
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("Failed to create content: %v", err)
+	}
+	if !content.Enabled {
+		t.Fatal("Expected new content to be enabled")
+	}
+	objects := newFakeStorage()
+	objects.objects[key] = []byte("data")
+	handler := NewDownloadHandler(store, objects)
+	admin := NewAdminHandler(store, storage.NewRegistry(db.DefaultStorageBackend, objects))
+
+	signed, err := handler.urlGenerator.GenerateURL(content.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign URL: %v", err)
+	}
+
+	toggle := func(enabled string) {
+		rr := httptest.NewRecorder()
+		admin.SetContentEnabled(rr, httptest.NewRequest(http.MethodPost,
+			"/api/admin/content/enable?id="+content.ID.String()+"&enabled="+enabled, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d toggling enabled=%s, got %d", http.StatusOK, enabled, rr.Code)
+		}
+	}
+	download := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.HandleSignedDownload(rr, httptest.NewRequest(http.MethodGet, signed, nil))
+		return rr
+	}
+
+	toggle("false")
+
+	rr := download()
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("Expected status %d for disabled content, got %d", http.StatusForbidden, rr.Code)
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.ErrorCode != errCodeContentDisabled {
+		t.Errorf("Expected error_code %q, got %q", errCodeContentDisabled, resp.ErrorCode)
+	}
+
+	urlReq := httptest.NewRequest(http.MethodGet, "/api/downloads/url?content_id="+content.ID.String(), nil)
+	urlRR := httptest.NewRecorder()
+	handler.GetDownloadURL(urlRR, urlReq)
+	if urlRR.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d signing disabled content, got %d", http.StatusForbidden, urlRR.Code)
+	}
+
+	if got, err := store.Get(context.Background(), content.ID); err != nil || got.Enabled {
+		t.Errorf("Expected record to remain and be disabled, got %+v (%v)", got, err)
+	}
+
+	toggle("true")
+	if rr := download(); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d once re-enabled, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestSignedDownloadHead(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	payload := "lesson notes"
+	checksum := strings.Repeat("ab", 32)
+	svc := newFakeStorage()
+	key := "test/" + uuid.New().String() + ".txt"
+	svc.objects[key] = []byte(payload)
+	content := &db.Content{
+		Name:        "notes.txt",
+		Type:        "test",
+		Version:     "1.0",
+		FilePath:    key,
+		Size:        int64(len(payload)),
+		StorageKey:  sql.NullString{String: key, Valid: true},
+		ContentType: sql.NullString{String: "text/plain", Valid: true},
+		Checksum:    sql.NullString{String: checksum, Valid: true},
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("Failed to create content: %v", err)
+	}
+
+	handler := NewDownloadHandler(store, svc)
+	signed, err := handler.urlGenerator.GenerateURL(content.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign URL: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.HandleSignedDownload(rr, httptest.NewRequest(http.MethodHead, signed, nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("Expected no body, got %q", rr.Body.String())
+	}
+	for header, want := range map[string]string{
+		"Content-Length": strconv.Itoa(len(payload)),
+		"Content-Type":   "text/plain",
+		"Accept-Ranges":  "bytes",
+		checksumHeader:   checksum,
+	} {
+		if got := rr.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if rr.Header().Get("Last-Modified") == "" {
+		t.Error("Expected Last-Modified")
+	}
+}
+
+// gaugeStorage records the active download count whenever storage is
+// touched, so a test can see which requests were counted
+type gaugeStorage struct {
+	*fakeStorage
+	seen []int64
+}
+
+func (g *gaugeStorage) GetInfo(ctx context.Context, key string) (*storage.FileInfo, error) {
+	g.seen = append(g.seen, ActiveDownloads())
+	return g.fakeStorage.GetInfo(ctx, key)
+}
+
+func (g *gaugeStorage) Download(ctx context.Context, key string) (io.ReadCloser, *storage.FileInfo, error) {
+	reader, info, err := g.fakeStorage.Download(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{readerFunc(func(p []byte) (int, error) {
+		g.seen = append(g.seen, ActiveDownloads())
+		return reader.Read(p)
+	}), reader}, info, nil
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+func TestSignedDownloadActiveCount(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := &gaugeStorage{fakeStorage: newFakeStorage()}
+	key := "test/" + uuid.New().String() + ".txt"
+	svc.objects[key] = []byte("lesson notes")
+	content := &db.Content{
+		Name:       "notes.txt",
+		Type:       "test",
+		Version:    "1.0",
+		FilePath:   key,
+		Size:       int64(len("lesson notes")),
+		StorageKey: sql.NullString{String: key, Valid: true},
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("Failed to create content: %v", err)
+	}
+	handler := NewDownloadHandler(store, svc)
+	signed, err := handler.urlGenerator.GenerateURL(content.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign URL: %v", err)
+	}
+	before := ActiveDownloads()
+
+	handler.HandleSignedDownload(httptest.NewRecorder(), httptest.NewRequest(http.MethodHead, signed, nil))
+	if len(svc.seen) != 1 || svc.seen[0] != before {
+		t.Errorf("Expected a HEAD not to be counted, saw %v from %d", svc.seen, before)
+	}
+
+	svc.seen = nil
+	rr := httptest.NewRecorder()
+	handler.HandleSignedDownload(rr, httptest.NewRequest(http.MethodGet, signed, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(svc.seen) == 0 || svc.seen[0] != before+1 {
+		t.Errorf("Expected the streaming GET to be counted, saw %v from %d", svc.seen, before)
+	}
+	if got := ActiveDownloads(); got != before {
+		t.Errorf("Expected count to return to %d, got %d", before, got)
+	}
+}
+
+func TestGetHistoryPaging(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	handler := NewDownloadHandler(store, nil)
+
+	contentID := createTestContentForDownload(t, store)
+	deviceID := uuid.New()
+	for i := 0; i < 3; i++ {
+		d := &db.Download{DeviceID: deviceID, UserID: "test-user", ContentID: contentID, Status: db.DownloadStatusCompleted}
+		if err := store.CreateDownload(context.Background(), d); err != nil {
+			t.Fatalf("Failed to create download: %v", err)
+		}
+	}
+
+	get := func(query string) (*httptest.ResponseRecorder, []db.Download) {
+		req := httptest.NewRequest(http.MethodGet, "/api/downloads/history"+query, nil)
+		req = req.WithContext(middleware.WithDeviceUUID(req.Context(), deviceID.String()))
+		rr := httptest.NewRecorder()
+		handler.GetHistory(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", query, rr.Code)
+		}
+		var page []db.Download
+		if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+			t.Fatalf("GET %s: response is not an array: %v", query, err)
+		}
+		return rr, page
+	}
+
+	// Unpaged requests get the whole history as before
+	rr, all := get("")
+	if len(all) != 3 || rr.Header().Get(nextCursorHeader) != "" {
+		t.Errorf("Unpaged: got %d downloads and cursor %q, want 3 and none", len(all), rr.Header().Get(nextCursorHeader))
+	}
+
+	rr, first := get("?limit=2")
+	cursor := rr.Header().Get(nextCursorHeader)
+	if len(first) != 2 || cursor == "" {
+		t.Fatalf("First page: got %d downloads and cursor %q", len(first), cursor)
+	}
+	rr, second := get("?limit=2&cursor=" + cursor)
+	if len(second) != 1 || rr.Header().Get(nextCursorHeader) != "" {
+		t.Errorf("Last page: got %d downloads and cursor %q", len(second), rr.Header().Get(nextCursorHeader))
+	}
+	if len(second) == 1 && (second[0].ID == first[0].ID || second[0].ID == first[1].ID) {
+		t.Errorf("Last page repeated download %s", second[0].ID)
+	}
+}
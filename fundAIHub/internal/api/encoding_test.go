@@ -0,0 +1,117 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.5", true},
+		{"GZIP", true},
+		{"gzip;q=0", false},
+		{"identity", false},
+		{"*", true},
+		{"br, x-gzip", true},
+	}
+
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.header); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %t, want %t", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGzipStream(t *testing.T) {
+	payload := strings.Repeat("lesson notes ", 1000)
+
+	compressed, err := io.ReadAll(gzipStream(strings.NewReader(payload)))
+	if err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if len(compressed) >= len(payload) {
+		t.Errorf("Expected compression, got %d bytes from %d", len(compressed), len(payload))
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("Output is not gzip: %v", err)
+	}
+	decoded, _ := io.ReadAll(gz)
+	if string(decoded) != payload {
+		t.Error("Round trip changed the payload")
+	}
+}
+
+func TestSignedDownloadGzip(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	payload := strings.Repeat("lesson notes ", 1000)
+	compressed, _ := io.ReadAll(gzipStream(strings.NewReader(payload)))
+
+	svc := newFakeStorage()
+	key := "test/" + uuid.New().String() + ".txt"
+	svc.objects[key] = compressed
+	content := &db.Content{
+		Name:            "notes.txt",
+		Type:            "test",
+		Version:         "1.0",
+		FilePath:        key,
+		Size:            int64(len(payload)),
+		StorageKey:      sql.NullString{String: key, Valid: true},
+		ContentType:     sql.NullString{String: "text/plain", Valid: true},
+		ContentEncoding: db.ContentEncodingGzip,
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("Failed to create content: %v", err)
+	}
+
+	handler := NewDownloadHandler(store, svc)
+	signed, err := handler.urlGenerator.GenerateURL(content.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign URL: %v", err)
+	}
+
+	t.Run("Client accepting gzip gets stored bytes", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, signed, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+		handler.HandleSignedDownload(rr, req)
+
+		if got := rr.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Errorf("Expected Content-Encoding gzip, got %q", got)
+		}
+		if !bytes.Equal(rr.Body.Bytes(), compressed) {
+			t.Error("Expected the compressed object unchanged")
+		}
+	})
+
+	t.Run("Other clients get decompressed bytes", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.HandleSignedDownload(rr, httptest.NewRequest(http.MethodGet, signed, nil))
+
+		if got := rr.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Expected no Content-Encoding, got %q", got)
+		}
+		if rr.Body.String() != payload {
+			t.Error("Expected the decompressed payload")
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxEchoedValueLen bounds how much of a rejected client value is echoed back
+const maxEchoedValueLen = 64
+
+// ErrorResponse is the JSON error body returned by API handlers. It matches
+// the shape used by the auth middleware, with optional detail fields.
+type ErrorResponse struct {
+	Error  string `json:"error"`
+	Code   int    `json:"code"`
+	Field  string `json:"field,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// ErrorCode is a stable machine-readable cause, and Transient tells the
+	// client whether retrying the same request later can succeed
+	ErrorCode string `json:"error_code,omitempty"`
+	Transient *bool  `json:"transient,omitempty"`
+}
+
+// Error codes for content that exists but cannot be served right now
+const (
+	errCodeContentNotReady    = "content_not_ready"
+	errCodeContentUnavailable = "content_unavailable"
+	errCodeContentDisabled    = "content_disabled"
+)
+
+// errCodeTooManyDownloads marks a download refused until one of the device's
+// or user's active downloads finishes
+const errCodeTooManyDownloads = "too_many_active_downloads"
+
+// errCodeInvalidTransition marks a status update the download's current
+// status does not allow, as opposed to a version conflict
+const errCodeInvalidTransition = "invalid_status_transition"
+
+// errCodeChecksumMismatch marks a download refused because the stored
+// bytes did not match the recorded checksum
+const errCodeChecksumMismatch = "checksum_mismatch"
+
+// errCodeUploadTooLarge marks an upload over UPLOAD_MAX_BYTES
+const errCodeUploadTooLarge = "upload_too_large"
+
+func respondWithError(w http.ResponseWriter, code int, message string) {
+	writeErrorResponse(w, ErrorResponse{Error: message, Code: code})
+}
+
+func writeErrorResponse(w http.ResponseWriter, resp ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.Code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// respondMethodNotAllowed answers a method mismatch with 405 and the Allow
+// header listing the methods the route accepts.
+func respondMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+}
+
+// respondContentUnavailable reports content that cannot be served. With a
+// positive retryAfter the condition is transient: Retry-After is set and the
+// body says content_not_ready. Otherwise it is permanent.
+func respondContentUnavailable(w http.ResponseWriter, code int, message string, retryAfter time.Duration) {
+	transient := retryAfter > 0
+	resp := ErrorResponse{Error: message, Code: code, ErrorCode: errCodeContentUnavailable, Transient: &transient}
+	if transient {
+		resp.ErrorCode = errCodeContentNotReady
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	writeErrorResponse(w, resp)
+}
+
+// respondContentDisabled reports content an admin has pulled. It stays
+// disabled until an admin re-enables it, so it is not transient.
+func respondContentDisabled(w http.ResponseWriter) {
+	transient := false
+	writeErrorResponse(w, ErrorResponse{
+		Error:     "Content has been disabled",
+		Code:      http.StatusForbidden,
+		ErrorCode: errCodeContentDisabled,
+		Transient: &transient,
+	})
+}
+
+// respondWithInvalidUUID reports a uuid.Parse failure, echoing a truncated
+// copy of the offending value and the parse reason so clients can tell an
+// empty, malformed and truncated identifier apart.
+func respondWithInvalidUUID(w http.ResponseWriter, message, field, value string, err error) {
+	reason := "value is empty"
+	if value != "" && err != nil {
+		reason = err.Error()
+	}
+	log.Printf("[API] Invalid UUID for %s %q: %s", field, truncateValue(value), reason)
+	writeErrorResponse(w, ErrorResponse{
+		Error:  message,
+		Code:   http.StatusBadRequest,
+		Field:  field,
+		Value:  truncateValue(value),
+		Reason: reason,
+	})
+}
+
+// truncateValue shortens a client-supplied value and strips control
+// characters before it is echoed back or logged. It cuts on a rune boundary,
+// so the result stays valid UTF-8.
+func truncateValue(v string) string {
+	v = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, v)
+	if len(v) > maxEchoedValueLen {
+		cut := maxEchoedValueLen
+		for cut > 0 && !utf8.RuneStart(v[cut]) {
+			cut--
+		}
+		return fmt.Sprintf("%s...(%d bytes)", v[:cut], len(v))
+	}
+	return v
+}
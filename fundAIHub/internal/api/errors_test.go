@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+func TestRespondWithInvalidUUID(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		wantReason string
+	}{
+		{"Empty value", "", "value is empty"},
+		{"Truncated UUID", "6ba7b810-9dad-11d1-80b4", "invalid UUID length"},
+		{"Not a UUID", "not-a-uuid", "invalid UUID length"},
+		{"Oversized value", strings.Repeat("x", 500), "invalid UUID length"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := uuid.Parse(tt.value)
+			rr := httptest.NewRecorder()
+			respondWithInvalidUUID(rr, "Invalid content ID", "content_id", tt.value, err)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+
+			var resp ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Field != "content_id" {
+				t.Errorf("Expected field content_id, got %q", resp.Field)
+			}
+			if !strings.Contains(resp.Reason, tt.wantReason) {
+				t.Errorf("Expected reason containing %q, got %q", tt.wantReason, resp.Reason)
+			}
+			if len(resp.Value) > maxEchoedValueLen+32 {
+				t.Errorf("Echoed value was not truncated: %d bytes", len(resp.Value))
+			}
+		})
+	}
+}
+
+func TestTruncateValueKeepsRunesWhole(t *testing.T) {
+	// One ASCII byte shifts every three-byte rune across the cut
+	v := "x" + strings.Repeat("€", 40)
+	got := truncateValue(v)
+	if !utf8.ValidString(got) {
+		t.Fatalf("Truncated value is not valid UTF-8: %q", got)
+	}
+	if want := "x" + strings.Repeat("€", 21) + "...(121 bytes)"; got != want {
+		t.Errorf("truncateValue = %q, want %q", got, want)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	downloads := NewDownloadHandler(nil, nil)
+	content := NewContentHandler(nil, nil)
+	admin := NewAdminHandler(nil, nil)
+	deviceView := NewDeviceViewHandler(nil, downloads, nil)
+	handoff := NewHandoffHandler(nil, nil)
+
+	tests := []struct {
+		route     string
+		handler   http.HandlerFunc
+		method    string
+		wantAllow string
+	}{
+		{"/api/downloads/start", downloads.StartDownload, http.MethodGet, "POST"},
+		{"/api/downloads/status", downloads.UpdateStatus, http.MethodPost, "PUT"},
+		{"/api/downloads/history", downloads.GetHistory, http.MethodPost, "GET"},
+		{"/api/downloads/url", downloads.GetDownloadURL, http.MethodPost, "GET"},
+		{"/api/downloads/plan", downloads.GetPlan, http.MethodPost, "GET"},
+		{"/api/content/download-url", downloads.GetDownloadURLByVersion, http.MethodPost, "GET"},
+		{"/upload", content.UploadFile, http.MethodGet, "POST"},
+		{"/api/content", content.List, http.MethodPost, "GET"},
+		{"/api/content/version", content.CatalogVersion, http.MethodPost, "GET"},
+		{"/api/content/verify", content.VerifyChecksum, http.MethodPost, "GET"},
+		{"/api/uploads", content.InitiateUpload, http.MethodGet, "POST"},
+		{"/api/uploads/chunk", content.UploadChunk, http.MethodPost, "PUT"},
+		{"/api/uploads/finalize", content.FinalizeUpload, http.MethodGet, "POST"},
+		{"/api/admin/content/fix-content-types", admin.FixContentTypes, http.MethodGet, "POST"},
+		{"/api/admin/content/versions", admin.ListVersionRange, http.MethodPost, "GET"},
+		{"/api/admin/webhooks", admin.Webhooks, http.MethodPut, "GET, POST, DELETE"},
+		{"/api/admin/content", admin.GetContent, http.MethodPost, "GET"},
+		{"/api/content/latest", content.LatestVersion, http.MethodPost, "GET"},
+		{"/api/content/delta", content.GetDelta, http.MethodPost, "GET"},
+		{"/api/content/delta/file", content.DownloadDelta, http.MethodPost, "GET"},
+		{"/api/admin/content/deltas", content.UploadDelta, http.MethodGet, "POST"},
+		{"/api/admin/stats", admin.Stats, http.MethodPost, "GET"},
+		{"/api/admin/stats/downloads", admin.DownloadStats, http.MethodPost, "GET"},
+		{"/api/admin/signing-keys", admin.SigningKeys, http.MethodPost, "GET"},
+		{"/api/admin/content/missing-objects", admin.MissingObjects, http.MethodPost, "GET"},
+		{"/api/admin/devices/{id}/view", deviceView.View, http.MethodPost, "GET"},
+		{"/healthz", Healthz, http.MethodPost, "GET, HEAD"},
+		{"/api/admin/content/verify-checksums", admin.VerifyChecksums, http.MethodPut, "GET, POST"},
+		{"/api/admin/content/verification-report", admin.VerificationReport, http.MethodPost, "GET"},
+		{"/api/content/{id}/related", downloads.GetRelated, http.MethodPost, "GET"},
+		{"/api/admin/content/enable", admin.SetContentEnabled, http.MethodGet, "POST"},
+		{"/api/admin/content/update", content.Update, http.MethodPost, "PUT"},
+		{"/api/admin/content/delete", content.Delete, http.MethodGet, "DELETE"},
+		{"/api/admin/embed-tokens", admin.IssueEmbedToken, http.MethodGet, "POST"},
+		{"/api/admin/downloads/purge", admin.PurgeDownloads, http.MethodDelete, "POST"},
+		{"/api/time", ServerTime(0), http.MethodPost, "GET, HEAD"},
+		{"/readyz", Readyz(time.Second, nil), http.MethodPost, "GET, HEAD"},
+		{"/api/admin/content/archive", admin.ArchiveContent, http.MethodGet, "POST"},
+		{"/api/admin/content/upsert", content.UpsertContent, http.MethodPut, "POST"},
+		{"/api/downloads/handoff", handoff.Claim, http.MethodGet, "POST"},
+		{"/api/admin/downloads/handoff", handoff.Assign, http.MethodGet, "POST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tt.handler(rr, httptest.NewRequest(tt.method, tt.route, nil))
+
+			if rr.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status = %d, want %d", rr.Code, http.StatusMethodNotAllowed)
+			}
+			if got := rr.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("body is not JSON: %v", err)
+			}
+			if resp.Code != http.StatusMethodNotAllowed {
+				t.Errorf("body code = %d, want %d", resp.Code, http.StatusMethodNotAllowed)
+			}
+		})
+	}
+}
+
+func TestRespondContentUnavailable(t *testing.T) {
+	tests := []struct {
+		name          string
+		retryAfter    time.Duration
+		wantCode      string
+		wantTransient bool
+		wantHeader    string
+	}{
+		{"Transient", 1500 * time.Millisecond, errCodeContentNotReady, true, "2"},
+		{"Permanent", 0, errCodeContentUnavailable, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			respondContentUnavailable(rr, http.StatusGone, "gone", tt.retryAfter)
+
+			if got := rr.Header().Get("Retry-After"); got != tt.wantHeader {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantHeader)
+			}
+			var resp ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode body: %v", err)
+			}
+			if resp.ErrorCode != tt.wantCode || resp.Transient == nil || *resp.Transient != tt.wantTransient {
+				t.Errorf("Unexpected body: %+v", resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"FundAIHub/internal/config"
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/middleware"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// HandoffHandler moves an unfinished download to another device of the same
+// user, e.g. after a school re-images a machine. Downloads stay
+// device-scoped otherwise.
+type HandoffHandler struct {
+	store *db.ContentStore
+	vault deviceVerifier
+	// maxActivePerDevice caps the target device's downloads as
+	// StartDownload does
+	maxActivePerDevice int
+}
+
+func NewHandoffHandler(store *db.ContentStore, vault deviceVerifier) *HandoffHandler {
+	return &HandoffHandler{store: store, vault: vault, maxActivePerDevice: config.GetConfig().MaxActiveDownloadsPerDevice}
+}
+
+// handoffRequest names the download to move. HardwareID names the target
+// device on the admin route; on the device route the caller is the target.
+type handoffRequest struct {
+	DownloadID string `json:"download_id"`
+	HardwareID string `json:"hardware_id,omitempty"`
+}
+
+// Claim serves POST /api/downloads/handoff for a device taking over one of
+// its user's downloads. The route must be wrapped in AuthenticateDevice,
+// which has already resolved the caller's user through FundaVault.
+func (h *HandoffHandler) Claim(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req handoffRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		respondWithDecodeError(w, err)
+		return
+	}
+	downloadID, err := uuid.Parse(req.DownloadID)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid download ID", "download_id", req.DownloadID, err)
+		return
+	}
+	deviceUUID, ok := requestDeviceUUID(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.UserIDFromContext(r.Context())
+	email, _ := middleware.EmailFromContext(r.Context())
+
+	h.handoff(w, r, downloadID, deviceUUID, userID, userID, email)
+}
+
+// Assign serves POST /api/admin/downloads/handoff, moving a download to the
+// device given by hardware_id. FundaVault is asked who owns that device.
+func (h *HandoffHandler) Assign(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req handoffRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		respondWithDecodeError(w, err)
+		return
+	}
+	downloadID, err := uuid.Parse(req.DownloadID)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid download ID", "download_id", req.DownloadID, err)
+		return
+	}
+	if req.HardwareID == "" {
+		writeErrorResponse(w, ErrorResponse{Error: "hardware_id is required", Code: http.StatusBadRequest, Field: "hardware_id"})
+		return
+	}
+
+	result, status, err := h.vault.VerifyDevice(r.Context(), req.HardwareID)
+	if err != nil || result == nil || !result.Authenticated {
+		log.Printf("[Handoff] FundaVault could not verify target device %s (status %d): %v", req.HardwareID, status, err)
+		respondWithError(w, http.StatusBadRequest, "Target device could not be verified")
+		return
+	}
+	target, err := uuid.Parse(result.DeviceUUID)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "FundaVault did not return a device ID for the target device")
+		return
+	}
+	adminID, _ := middleware.UserIDFromContext(r.Context())
+	adminEmail, _ := middleware.EmailFromContext(r.Context())
+
+	h.handoff(w, r, downloadID, target, strconv.FormatInt(result.UserID, 10), adminID, adminEmail)
+}
+
+// handoff moves downloadID to targetDevice, owned by targetUser, once it is
+// sure the download belongs to that user
+func (h *HandoffHandler) handoff(w http.ResponseWriter, r *http.Request, downloadID, targetDevice uuid.UUID, targetUser, actorID, actorEmail string) {
+	download, err := h.store.GetDownloadByID(r.Context(), downloadID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Download not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to load download")
+		return
+	}
+	if targetUser == "" || download.UserID != targetUser {
+		log.Printf("[Handoff] Refused handoff of download %s (user %s) to device %s of user %s",
+			downloadID, download.UserID, targetDevice, targetUser)
+		respondWithError(w, http.StatusForbidden, "Downloads can only be handed off between devices of the same user")
+		return
+	}
+
+	moved, err := h.store.HandoffDownload(r.Context(), downloadID, targetDevice, h.maxActivePerDevice)
+	// Record the handoff with its outcome, refused and failed ones included
+	var limitErr *db.DownloadLimitError
+	outcome := "ok"
+	switch {
+	case errors.Is(err, db.ErrDownloadFinished):
+		outcome = "refused: download already finished"
+	case errors.As(err, &limitErr):
+		outcome = "refused: target device at its download limit"
+	case err != nil:
+		outcome = "failed"
+	}
+	h.audit(r, &db.AuditEntry{
+		AdminUserID: actorID,
+		AdminEmail:  actorEmail,
+		Action:      "download_handoff",
+		Target:      fmt.Sprintf("%s: %s -> %s (%s)", downloadID, download.DeviceID, targetDevice, outcome),
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrDownloadFinished) {
+			respondWithError(w, http.StatusConflict, "Download has already finished")
+			return
+		}
+		if limitErr != nil {
+			respondDownloadLimit(w, limitErr)
+			return
+		}
+		log.Printf("[Handoff] [Error] Failed to move download %s: %v", downloadID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to hand off download")
+		return
+	}
+	log.Printf("[Audit] %s handed off download %s from device %s to %s at byte %d",
+		actorID, downloadID, download.DeviceID, targetDevice, moved.ResumePosition)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(moved)
+}
+
+// audit writes entry once the handoff has been attempted. The handoff cannot
+// be taken back by then, so a failed write is logged with the entry rather
+// than failing the request.
+func (h *HandoffHandler) audit(r *http.Request, entry *db.AuditEntry) {
+	if err := h.store.CreateAuditEntry(context.WithoutCancel(r.Context()), entry); err != nil {
+		log.Printf("[Handoff] [Error] Failed to write audit entry %s by %s for %s: %v",
+			entry.Action, entry.AdminUserID, entry.Target, err)
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"FundAIHub/internal/auth"
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/middleware"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDownloadHandoff(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	contentID := createTestContentForDownload(t, store)
+	oldDevice, newDevice := uuid.New(), uuid.New()
+	download := &db.Download{
+		DeviceID:  oldDevice,
+		UserID:    "42",
+		ContentID: contentID,
+		Status:    db.DownloadStatusDownloading,
+	}
+	if err := store.CreateDownload(context.Background(), download); err != nil {
+		t.Fatalf("Failed to create download: %v", err)
+	}
+	body := `{"download_id": "` + download.ID.String() + `", "hardware_id": "` + strings.Repeat("ab", 32) + `"}`
+
+	t.Run("Another user's device is refused", func(t *testing.T) {
+		vault := &fakeVerifier{result: &auth.DeviceVerifyResponse{Authenticated: true, UserID: 7, DeviceUUID: newDevice.String()}, status: http.StatusOK}
+		handler := NewHandoffHandler(store, vault)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/downloads/handoff", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler.Assign(rr, req.WithContext(middleware.WithUserID(req.Context(), "1")))
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("Expected status %d for an admin handoff across users, got %d", http.StatusForbidden, rr.Code)
+		}
+
+		req = httptest.NewRequest(http.MethodPost, "/api/downloads/handoff", strings.NewReader(body))
+		ctx := middleware.WithDeviceUUID(req.Context(), newDevice.String())
+		ctx = middleware.WithUserID(ctx, "7")
+		rr = httptest.NewRecorder()
+		handler.Claim(rr, req.WithContext(ctx))
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("Expected status %d for a claim by another user, got %d", http.StatusForbidden, rr.Code)
+		}
+
+		unchanged, err := store.GetDownloadByID(context.Background(), download.ID)
+		if err != nil {
+			t.Fatalf("Failed to reload download: %v", err)
+		}
+		if unchanged.DeviceID != oldDevice {
+			t.Errorf("Expected download to stay on %s, got %s", oldDevice, unchanged.DeviceID)
+		}
+	})
+
+	t.Run("The same user's device takes over", func(t *testing.T) {
+		handler := NewHandoffHandler(store, nil)
+		req := httptest.NewRequest(http.MethodPost, "/api/downloads/handoff", strings.NewReader(body))
+		ctx := middleware.WithDeviceUUID(req.Context(), newDevice.String())
+		ctx = middleware.WithUserID(ctx, "42")
+		rr := httptest.NewRecorder()
+		handler.Claim(rr, req.WithContext(ctx))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		var moved db.Download
+		if err := json.NewDecoder(rr.Body).Decode(&moved); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if moved.DeviceID != newDevice {
+			t.Errorf("Expected device %s, got %s", newDevice, moved.DeviceID)
+		}
+		if moved.Status != db.DownloadStatusPaused {
+			t.Errorf("Expected in-flight download to be paused, got %q", moved.Status)
+		}
+	})
+}
+
+func TestDownloadHandoffDeviceLimit(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	contentID := createTestContentForDownload(t, store)
+	oldDevice, newDevice := uuid.New(), uuid.New()
+	newDownload := func(deviceID uuid.UUID) *db.Download {
+		download := &db.Download{DeviceID: deviceID, UserID: "42", ContentID: contentID, Status: db.DownloadStatusQueued}
+		if err := store.CreateDownload(context.Background(), download); err != nil {
+			t.Fatalf("Failed to create download: %v", err)
+		}
+		return download
+	}
+	moving := newDownload(oldDevice)
+	newDownload(newDevice)
+
+	handler := NewHandoffHandler(store, nil)
+	handler.maxActivePerDevice = 1
+	claim := func() *httptest.ResponseRecorder {
+		body := `{"download_id": "` + moving.ID.String() + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/downloads/handoff", strings.NewReader(body))
+		ctx := middleware.WithDeviceUUID(req.Context(), newDevice.String())
+		ctx = middleware.WithUserID(ctx, "42")
+		rr := httptest.NewRecorder()
+		handler.Claim(rr, req.WithContext(ctx))
+		return rr
+	}
+
+	rr := claim()
+	var resp ErrorResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if rr.Code != http.StatusTooManyRequests || resp.ErrorCode != errCodeTooManyDownloads {
+		t.Fatalf("Expected status %d with %s, got %d %+v", http.StatusTooManyRequests, errCodeTooManyDownloads, rr.Code, resp)
+	}
+	unchanged, err := store.GetDownloadByID(context.Background(), moving.ID)
+	if err != nil {
+		t.Fatalf("Failed to reload download: %v", err)
+	}
+	if unchanged.DeviceID != oldDevice {
+		t.Errorf("Expected download to stay on %s, got %s", oldDevice, unchanged.DeviceID)
+	}
+
+	handler.maxActivePerDevice = 2
+	if rr := claim(); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d under the limit, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+}
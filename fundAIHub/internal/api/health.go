@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Healthz reports that the process is serving, with the number of signed
+// downloads in flight
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respondMethodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":           "ok",
+		"active_downloads": ActiveDownloads(),
+	})
+}
+
+// ReadinessCheck reports whether a dependency can serve requests, returning
+// an error when it cannot
+type ReadinessCheck func(ctx context.Context) error
+
+// ReadinessResponse lists each dependency's state and the names of any that
+// failed
+type ReadinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+	Failed []string          `json:"failed,omitempty"`
+}
+
+// Readyz returns a handler that runs every check at once, each given at most
+// timeout, and answers 503 naming the dependencies that failed. Errors are
+// logged rather than returned, since the endpoint is unauthenticated.
+func Readyz(timeout time.Duration, checks map[string]ReadinessCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			respondMethodNotAllowed(w, http.MethodGet, http.MethodHead)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		resp := ReadinessResponse{Status: "ready", Checks: make(map[string]string, len(checks))}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for name, check := range checks {
+			wg.Add(1)
+			go func(name string, check ReadinessCheck) {
+				defer wg.Done()
+				err := check(ctx)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					log.Printf("[Readyz] %s check failed: %v", name, err)
+					resp.Checks[name] = "failed"
+					resp.Failed = append(resp.Failed, name)
+					return
+				}
+				resp.Checks[name] = "ok"
+			}(name, check)
+		}
+		wg.Wait()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if len(resp.Failed) > 0 {
+			sort.Strings(resp.Failed)
+			resp.Status = "not_ready"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// TimeResponse is the server clock as signed URLs see it
+type TimeResponse struct {
+	ServerTime string `json:"server_time"`
+	Unix       int64  `json:"unix"`
+	// ClockSkewToleranceSeconds is how long past its expires a signed URL
+	// is still accepted
+	ClockSkewToleranceSeconds int64 `json:"clock_skew_tolerance_seconds"`
+}
+
+// ServerTime returns a handler reporting the current UTC time and the
+// signed-URL clock-skew tolerance, so clients can detect drift that would
+// make their download links look expired
+func ServerTime(clockSkew time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			respondMethodNotAllowed(w, http.MethodGet, http.MethodHead)
+			return
+		}
+
+		now := time.Now().UTC()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(TimeResponse{
+			ServerTime:                now.Format(time.RFC3339),
+			Unix:                      now.Unix(),
+			ClockSkewToleranceSeconds: int64(clockSkew / time.Second),
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServerTime(t *testing.T) {
+	rr := httptest.NewRecorder()
+	ServerTime(5*time.Second)(rr, httptest.NewRequest(http.MethodGet, "/api/time", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var resp TimeResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	serverTime, err := time.Parse(time.RFC3339, resp.ServerTime)
+	if err != nil {
+		t.Fatalf("server_time %q is not RFC3339: %v", resp.ServerTime, err)
+	}
+	if d := time.Since(serverTime); d < -time.Second || d > 5*time.Second {
+		t.Errorf("server_time %s is not current", resp.ServerTime)
+	}
+	if resp.ClockSkewToleranceSeconds != 5 {
+		t.Errorf("clock_skew_tolerance_seconds = %d, want 5", resp.ClockSkewToleranceSeconds)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+	hang := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name       string
+		checks     map[string]ReadinessCheck
+		wantStatus int
+		wantFailed []string
+	}{
+		{"All Ready", map[string]ReadinessCheck{"database": ok, "storage": ok, "fundavault": ok}, http.StatusOK, nil},
+		{"Dependency Down", map[string]ReadinessCheck{"database": ok, "storage": down, "fundavault": ok}, http.StatusServiceUnavailable, []string{"storage"}},
+		{"Check Times Out", map[string]ReadinessCheck{"database": hang, "storage": ok, "fundavault": down}, http.StatusServiceUnavailable, []string{"database", "fundavault"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			rr := httptest.NewRecorder()
+			Readyz(50*time.Millisecond, tt.checks)(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("readiness took %s, expected the timeout to cut it short", elapsed)
+			}
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+			var resp ReadinessResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(resp.Failed) != len(tt.wantFailed) {
+				t.Fatalf("failed = %v, want %v", resp.Failed, tt.wantFailed)
+			}
+			for i, name := range tt.wantFailed {
+				if resp.Failed[i] != name {
+					t.Errorf("failed = %v, want %v", resp.Failed, tt.wantFailed)
+				}
+				if resp.Checks[name] != "failed" {
+					t.Errorf("checks[%s] = %q, want failed", name, resp.Checks[name])
+				}
+			}
+			if len(resp.Checks) != len(tt.checks) {
+				t.Errorf("checks = %v, want one entry per dependency", resp.Checks)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package api
+
+import (
+	"FundAIHub/internal/testdb"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Run(m))
+}
@@ -0,0 +1,254 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sync"
+)
+
+var (
+	errTooManyParts     = errors.New("too many form parts")
+	errFormFieldsTooBig = errors.New("form fields too large")
+	errMissingFile      = errors.New("missing file part")
+	errDuplicateFile    = errors.New("more than one file part")
+	errEmptyFile        = errors.New("empty file")
+	errPartAfterFile    = errors.New("form fields must be sent before the file")
+	errFileNotRead      = errors.New("file was not read to its end")
+)
+
+// missingFieldError is returned when the file part arrives before a field
+// the upload requires
+type missingFieldError struct {
+	Field string
+}
+
+func (e *missingFieldError) Error() string {
+	return fmt.Sprintf("%s is required and must be sent before the file", e.Field)
+}
+
+// uploadForm is a multipart upload read part by part. Fields must come
+// before the file part, which is not buffered: reading the form reads the
+// file straight from the request, hashing and counting it on the way, so an
+// upload can be streamed to storage whatever its size.
+type uploadForm struct {
+	values   map[string]string
+	filename string
+	header   textproto.MIMEHeader
+	size     int64
+	// checksum is the hex SHA-256 of the file, set by finish
+	checksum string
+
+	mr        *multipart.Reader
+	fileField string
+	file      *bufio.Reader
+	hash      hash.Hash
+	// err is the first error reading the file, such as the body limit. It
+	// is guarded as a gzip upload reads the file from another goroutine.
+	mu  sync.Mutex
+	err error
+}
+
+// value returns a form field, or "" when it was not sent
+func (f *uploadForm) value(key string) string {
+	return f.values[key]
+}
+
+// Read reads the file part
+func (f *uploadForm) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	f.hash.Write(p[:n])
+	f.size += int64(n)
+	if err != nil && err != io.EOF {
+		f.mu.Lock()
+		if f.err == nil {
+			f.err = err
+		}
+		f.mu.Unlock()
+	}
+	return n, err
+}
+
+// readErr is the error the request body gave while the file was read, if
+// any, so a failed storage upload can be blamed on the client
+func (f *uploadForm) readErr() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// finish checks that the file was read to its end and that no part follows
+// it, then sets the file's checksum. It is called once the file has been
+// stored.
+func (f *uploadForm) finish() error {
+	if n, err := io.Copy(io.Discard, f); err != nil {
+		return err
+	} else if n > 0 {
+		return errFileNotRead
+	}
+	part, err := f.mr.NextPart()
+	if err != io.EOF {
+		if err != nil {
+			return err
+		}
+		if part.FileName() != "" && part.FormName() == f.fileField {
+			return errDuplicateFile
+		}
+		return errPartAfterFile
+	}
+	f.checksum = hex.EncodeToString(f.hash.Sum(nil))
+	return nil
+}
+
+// openUploadForm reads the request's multipart fields up to the part named
+// fileField, refusing more than maxParts parts or more than maxFieldBytes
+// across the fields, so a request made of thousands of tiny parts is cut off
+// early. Each of required must have been sent, non-empty, before the file.
+// The returned form reads the file; an empty one is refused here, before
+// anything is stored.
+func openUploadForm(r *http.Request, fileField string, maxParts int, maxFieldBytes int64, required ...string) (*uploadForm, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	form := &uploadForm{values: make(map[string]string), mr: mr, fileField: fileField, hash: sha256.New()}
+	parts := 0
+	fieldBudget := maxFieldBytes
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errMissingFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		parts++
+		if parts > maxParts {
+			return nil, fmt.Errorf("%w: limit is %d", errTooManyParts, maxParts)
+		}
+
+		if part.FileName() == "" {
+			data, err := io.ReadAll(io.LimitReader(part, fieldBudget+1))
+			if err != nil {
+				return nil, err
+			}
+			fieldBudget -= int64(len(data))
+			if fieldBudget < 0 {
+				return nil, fmt.Errorf("%w: limit is %d bytes", errFormFieldsTooBig, maxFieldBytes)
+			}
+			// The first value wins, as with Request.FormValue
+			if _, ok := form.values[part.FormName()]; !ok {
+				form.values[part.FormName()] = string(data)
+			}
+			continue
+		}
+
+		if part.FormName() != fileField {
+			// Unknown file parts are drained and ignored
+			if _, err := io.Copy(io.Discard, part); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		for _, field := range required {
+			if form.values[field] == "" {
+				return nil, &missingFieldError{Field: field}
+			}
+		}
+		form.filename = part.FileName()
+		form.header = part.Header
+		form.file = bufio.NewReader(part)
+		// A zero-byte record would only be refused later, when a URL is signed
+		if _, err := form.file.Peek(1); err == io.EOF {
+			return nil, errEmptyFile
+		} else if err != nil {
+			return nil, err
+		}
+		return form, nil
+	}
+}
+
+// respondStorageUploadFailed answers an upload the storage backend did not
+// take, blaming the client when it was reading the request that failed
+func respondStorageUploadFailed(w http.ResponseWriter, form *uploadForm) {
+	if err := form.readErr(); err != nil {
+		respondWithFormError(w, err)
+		return
+	}
+	http.Error(w, "Upload failed", http.StatusInternalServerError)
+}
+
+// finishUpload finishes form once its file is stored under key and reports
+// whether the upload may be recorded. When the form turns out bad, key is
+// removed unless it is "", and the client is answered.
+func (h *ContentHandler) finishUpload(w http.ResponseWriter, r *http.Request, form *uploadForm, key string) bool {
+	err := form.finish()
+	if err == nil {
+		return true
+	}
+	if key != "" {
+		if delErr := compensateUpload(r.Context(), h.storage, key); delErr != nil {
+			log.Printf("[UploadFile] [Orphan] Object %s left in storage without a record: %v", key, delErr)
+		}
+	}
+	respondWithFormError(w, err)
+	return false
+}
+
+// checkUploadSize refuses an upload larger than maxUploadBytes and caps the
+// body so one sent without Content-Length is cut off at the limit. It runs
+// before the body is read: the server only answers Expect: 100-continue
+// once the handler reads, so a refused client never sends its payload.
+func (h *ContentHandler) checkUploadSize(w http.ResponseWriter, r *http.Request) bool {
+	if h.maxUploadBytes <= 0 {
+		return true
+	}
+	if r.ContentLength > h.maxUploadBytes {
+		log.Printf("[UploadFile] Refused %d byte upload, limit is %d", r.ContentLength, h.maxUploadBytes)
+		respondUploadTooLarge(w, h.maxUploadBytes)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadBytes)
+	return true
+}
+
+// respondWithFormError reports why an upload form was rejected
+func respondWithFormError(w http.ResponseWriter, err error) {
+	log.Printf("[UploadFile] Rejected form: %v", err)
+	var tooLarge *http.MaxBytesError
+	var missing *missingFieldError
+	switch {
+	case errors.As(err, &tooLarge):
+		respondUploadTooLarge(w, tooLarge.Limit)
+	case errors.As(err, &missing):
+		writeErrorResponse(w, ErrorResponse{Error: err.Error(), Code: http.StatusBadRequest, Field: missing.Field})
+	case errors.Is(err, errFileNotRead):
+		respondWithError(w, http.StatusInternalServerError, "Upload failed")
+	case errors.Is(err, errTooManyParts), errors.Is(err, errFormFieldsTooBig),
+		errors.Is(err, errMissingFile), errors.Is(err, errDuplicateFile),
+		errors.Is(err, errEmptyFile), errors.Is(err, errPartAfterFile):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondWithError(w, http.StatusBadRequest, "Could not parse form")
+	}
+}
+
+// respondUploadTooLarge answers an upload over the size limit with 413,
+// naming the limit so clients can tell the user
+func respondUploadTooLarge(w http.ResponseWriter, limit int64) {
+	writeErrorResponse(w, ErrorResponse{
+		Error:     fmt.Sprintf("upload too large: limit is %d bytes", limit),
+		Code:      http.StatusRequestEntityTooLarge,
+		ErrorCode: errCodeUploadTooLarge,
+	})
+}
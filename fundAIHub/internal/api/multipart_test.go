@@ -0,0 +1,289 @@
+package api
+
+import (
+	"FundAIHub/internal/middleware"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// multipartRequest builds an upload request from fields and an optional
+// file part written after them
+func multipartRequest(t *testing.T, fields [][2]string, fileBody string) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, f := range fields {
+		mw.WriteField(f[0], f[1])
+	}
+	if fileBody != "" {
+		part, err := mw.CreateFormFile("file", "app.zip")
+		if err != nil {
+			t.Fatalf("Failed to create form file: %v", err)
+		}
+		part.Write([]byte(fileBody))
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestOpenUploadForm(t *testing.T) {
+	t.Run("Fields and file are read", func(t *testing.T) {
+		req := multipartRequest(t, [][2]string{{"version", "1.0"}, {"app_type", "linux-app"}}, "payload")
+		form, err := openUploadForm(req, "file", 10, 1024, "app_type", "version")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if form.value("version") != "1.0" || form.value("app_type") != "linux-app" {
+			t.Errorf("Unexpected values: %v", form.values)
+		}
+
+		data, _ := io.ReadAll(form)
+		if err := form.finish(); err != nil {
+			t.Fatalf("Unexpected finish error: %v", err)
+		}
+		if string(data) != "payload" || form.size != 7 || form.filename != "app.zip" {
+			t.Errorf("Unexpected file: %q size %d name %q", data, form.size, form.filename)
+		}
+		// sha256 of "payload"
+		if want := "239f59ed55e737c77147cf55ad0c1b030b6d7ee748a7426952f9b852d5a935e5"; form.checksum != want {
+			t.Errorf("Checksum = %s, want %s", form.checksum, want)
+		}
+	})
+
+	t.Run("Excessive parts are rejected", func(t *testing.T) {
+		fields := make([][2]string, 5000)
+		for i := range fields {
+			fields[i] = [2]string{fmt.Sprintf("f%d", i), "x"}
+		}
+		_, err := openUploadForm(multipartRequest(t, fields, "payload"), "file", 10, 1<<20)
+		if !errors.Is(err, errTooManyParts) {
+			t.Errorf("Expected errTooManyParts, got %v", err)
+		}
+	})
+
+	t.Run("Oversized fields are rejected", func(t *testing.T) {
+		fields := [][2]string{{"description", strings.Repeat("a", 600)}, {"notes", strings.Repeat("b", 600)}}
+		_, err := openUploadForm(multipartRequest(t, fields, "payload"), "file", 10, 1024)
+		if !errors.Is(err, errFormFieldsTooBig) {
+			t.Errorf("Expected errFormFieldsTooBig, got %v", err)
+		}
+	})
+
+	t.Run("Required field must precede the file", func(t *testing.T) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("app_type", "linux-app")
+		part, _ := mw.CreateFormFile("file", "app.zip")
+		part.Write([]byte("payload"))
+		mw.WriteField("version", "1.0")
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		_, err := openUploadForm(req, "file", 10, 1024, "app_type", "version")
+		var missing *missingFieldError
+		if !errors.As(err, &missing) || missing.Field != "version" {
+			t.Fatalf("Expected version to be missing, got %v", err)
+		}
+		rr := httptest.NewRecorder()
+		respondWithFormError(rr, err)
+		var resp ErrorResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if rr.Code != http.StatusBadRequest || resp.Field != "version" {
+			t.Errorf("Expected 400 naming version, got %d %+v", rr.Code, resp)
+		}
+	})
+
+	t.Run("Part after the file is rejected", func(t *testing.T) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		part, _ := mw.CreateFormFile("file", "app.zip")
+		part.Write([]byte("payload"))
+		mw.WriteField("description", "late")
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		form, err := openUploadForm(req, "file", 10, 1024)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		io.Copy(io.Discard, form)
+		if err := form.finish(); !errors.Is(err, errPartAfterFile) {
+			t.Errorf("Expected errPartAfterFile, got %v", err)
+		}
+	})
+
+	t.Run("Missing file is rejected", func(t *testing.T) {
+		_, err := openUploadForm(multipartRequest(t, [][2]string{{"version", "1.0"}}, ""), "file", 10, 1024)
+		if !errors.Is(err, errMissingFile) {
+			t.Errorf("Expected errMissingFile, got %v", err)
+		}
+	})
+}
+
+func TestUploadFileEmptyFile(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("app_type", "linux-app")
+	mw.WriteField("version", "1.0")
+	if _, err := mw.CreateFormFile("file", "app.zip"); err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	// No store or storage: an empty file must be refused before either is used
+	h := NewContentHandler(nil, nil)
+	rr := httptest.NewRecorder()
+	h.UploadFile(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "empty file") {
+		t.Errorf("Expected \"empty file\" error, got %s", rr.Body.String())
+	}
+}
+
+// readFlag is a request body that records whether the client sent it
+type readFlag struct {
+	r    io.Reader
+	read bool
+}
+
+func (f *readFlag) Read(p []byte) (int, error) {
+	f.read = true
+	return f.r.Read(p)
+}
+
+func TestUploadFileExpectContinue(t *testing.T) {
+	h := NewContentHandler(nil, nil)
+	h.maxUploadBytes = 1024
+	server := httptest.NewServer(http.HandlerFunc(h.UploadFile))
+	defer server.Close()
+
+	payload := multipartRequest(t, nil, strings.Repeat("x", 4096))
+	body := &readFlag{r: payload.Body}
+	req, err := http.NewRequest(http.MethodPost, server.URL, body)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.ContentLength = payload.ContentLength
+	req.Header.Set("Content-Type", payload.Header.Get("Content-Type"))
+	req.Header.Set("Expect", "100-continue")
+
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, resp.StatusCode)
+	}
+	if body.read {
+		t.Error("Expected the oversized body not to be sent")
+	}
+}
+
+// TestUploadFileRequiresAdmin checks /upload as main.go routes it: an
+// anonymous upload is refused before the client sends the file
+func TestUploadFileRequiresAdmin(t *testing.T) {
+	h := NewContentHandler(nil, nil)
+	authMiddleware := middleware.NewAuthMiddleware(nil)
+	server := httptest.NewServer(authMiddleware.AdminOnly(h.UploadFile))
+	defer server.Close()
+
+	payload := multipartRequest(t, [][2]string{{"app_type", "linux-app"}, {"version", "1.0.0"}}, strings.Repeat("x", 4096))
+	body := &readFlag{r: payload.Body}
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/upload", body)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.ContentLength = payload.ContentLength
+	req.Header.Set("Content-Type", payload.Header.Get("Content-Type"))
+	req.Header.Set("Expect", "100-continue")
+
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+	if body.read {
+		t.Error("Expected the anonymous upload's body not to be sent")
+	}
+}
+
+func TestUploadFileTooLargeWithoutLength(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := newFakeStorage()
+	h := NewContentHandler(store, svc)
+	h.maxUploadBytes = 1024
+	req := multipartRequest(t, [][2]string{{"app_type", "linux-app"}, {"version", uuid.New().String()}}, strings.Repeat("x", 4096))
+	req.ContentLength = -1
+
+	rr := httptest.NewRecorder()
+	h.UploadFile(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), errCodeUploadTooLarge) {
+		t.Errorf("Expected error_code %s, got %s", errCodeUploadTooLarge, rr.Body.String())
+	}
+	if len(svc.objects) != 0 {
+		t.Errorf("Expected nothing stored, got %d objects", len(svc.objects))
+	}
+}
+
+func TestInitiateUploadTooLarge(t *testing.T) {
+	h := NewContentHandler(nil, nil)
+	h.maxUploadBytes = 1024
+	body := fmt.Sprintf(`{"filename":"app.zip","size":4096,"sha256":%q,"chunk_count":1}`, strings.Repeat("a", 64))
+	rr := httptest.NewRecorder()
+	h.InitiateUpload(rr, httptest.NewRequest(http.MethodPost, "/api/uploads", strings.NewReader(body)))
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), errCodeUploadTooLarge) {
+		t.Errorf("Expected error_code %s, got %s", errCodeUploadTooLarge, rr.Body.String())
+	}
+}
+
+func TestUploadFileTooManyParts(t *testing.T) {
+	fields := make([][2]string, 5000)
+	for i := range fields {
+		fields[i] = [2]string{fmt.Sprintf("f%d", i), "x"}
+	}
+
+	h := NewContentHandler(nil, nil)
+	rr := httptest.NewRecorder()
+	h.UploadFile(rr, multipartRequest(t, fields, "payload"))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	planReasonPinned = "pinned"
+	planReasonUpdate = "update"
+	planReasonNew    = "new"
+)
+
+// PlanItem is one entry of a device's download plan
+type PlanItem struct {
+	ContentID   uuid.UUID `json:"content_id"`
+	Name        string    `json:"name"`
+	Version     string    `json:"version"`
+	AppType     string    `json:"app_type"`
+	Size        int64     `json:"size"`
+	Reason      string    `json:"reason"`
+	DownloadURL string    `json:"download_url,omitempty"`
+
+	// StorageState is "archived" or "rehydrating" for content that is
+	// restored from cold storage before it can be downloaded; until then its
+	// URL answers with a retry
+	StorageState string `json:"storage_state,omitempty"`
+
+	updatedAt time.Time
+}
+
+// DownloadPlan is the ordered list of content a device should fetch next and
+// how many downloads it should run in parallel.
+type DownloadPlan struct {
+	Parallelism int        `json:"parallelism"`
+	Items       []PlanItem `json:"items"`
+}
+
+// buildPlan orders candidates so pinned content comes first, then updates to
+// apps the device already has, then new apps. Only one candidate per
+// app_type is kept, a pinned one or else the newest, and older builds of an
+// installed app are only suggested when pinned.
+func buildPlan(candidates []db.PlanCandidate) []PlanItem {
+	var pinned, updates, fresh []PlanItem
+	seen := make(map[string]bool)
+
+	// Candidates arrive pinned first and then newest first, so the first one
+	// per app_type wins
+	for _, c := range candidates {
+		key := c.AppType
+		if key == "" {
+			key = c.ID.String()
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		item := PlanItem{
+			ContentID: c.ID,
+			Name:      c.Name,
+			Version:   c.Version,
+			AppType:   c.AppType,
+			Size:      c.Size,
+			updatedAt: c.UpdatedAt,
+
+			StorageState: c.StorageState,
+		}
+		switch {
+		case c.Pinned:
+			item.Reason = planReasonPinned
+			pinned = append(pinned, item)
+		case c.InstalledAt == nil:
+			item.Reason = planReasonNew
+			fresh = append(fresh, item)
+		case c.CreatedAt.After(*c.InstalledAt):
+			item.Reason = planReasonUpdate
+			updates = append(updates, item)
+		}
+	}
+	return append(append(pinned, updates...), fresh...)
+}
+
+// planFor builds a device's plan without download URLs
+func (h *DownloadHandler) planFor(ctx context.Context, deviceID uuid.UUID) (DownloadPlan, error) {
+	candidates, err := h.store.ListPlanCandidates(ctx, deviceID)
+	if err != nil {
+		return DownloadPlan{}, fmt.Errorf("listing plan candidates: %w", err)
+	}
+
+	active, err := h.store.CountActiveDownloads(ctx, deviceID)
+	if err != nil {
+		return DownloadPlan{}, fmt.Errorf("counting active downloads: %w", err)
+	}
+
+	plan := DownloadPlan{Items: buildPlan(candidates)}
+	if plan.Items == nil {
+		plan.Items = []PlanItem{}
+	}
+	// Counted as StartDownload counts, so the device can start as many
+	// downloads as it is told to
+	if free := h.maxActivePerDevice - active.Holding; free > 0 {
+		plan.Parallelism = free
+	}
+	return plan, nil
+}
+
+// GetPlan returns a server-driven sync plan for the calling device
+func (h *DownloadHandler) GetPlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	deviceUUID, ok := requestDeviceUUID(w, r)
+	if !ok {
+		return
+	}
+
+	unsigned, err := h.planFor(r.Context(), deviceUUID)
+	if err != nil {
+		log.Printf("[GetPlan] [Error] %v", err)
+		http.Error(w, "Failed to build download plan", http.StatusInternalServerError)
+		return
+	}
+
+	// Candidates are enabled, live and non-empty, so they are signed as they
+	// are rather than loaded again one by one
+	plan := DownloadPlan{Parallelism: unsigned.Parallelism, Items: unsigned.Items}
+	for i := range plan.Items {
+		plan.Items[i].DownloadURL = h.urlGenerator.signedURL(plan.Items[i].ContentID, plan.Items[i].updatedAt, time.Hour)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
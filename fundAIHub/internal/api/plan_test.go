@@ -0,0 +1,41 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildPlan(t *testing.T) {
+	now := time.Now()
+	installed := now.Add(-48 * time.Hour)
+
+	editorV2 := db.PlanCandidate{ID: uuid.New(), AppType: "editor", CreatedAt: now}
+	editorV1 := db.PlanCandidate{ID: uuid.New(), AppType: "editor", CreatedAt: now.Add(-time.Hour), InstalledAt: &installed}
+	tutor := db.PlanCandidate{ID: uuid.New(), AppType: "tutor", CreatedAt: now.Add(-2 * time.Hour), StorageState: db.StorageStateArchived}
+	oldReader := db.PlanCandidate{ID: uuid.New(), AppType: "reader", CreatedAt: now.Add(-72 * time.Hour), InstalledAt: &installed}
+	pinnedPlayer := db.PlanCandidate{ID: uuid.New(), AppType: "player", CreatedAt: now.Add(-96 * time.Hour), InstalledAt: &installed, Pinned: true}
+	newPlayer := db.PlanCandidate{ID: uuid.New(), AppType: "player", CreatedAt: now, InstalledAt: &installed}
+	editorV2.InstalledAt = &installed
+
+	// Pinned first, then newest first, as returned by ListPlanCandidates
+	items := buildPlan([]db.PlanCandidate{pinnedPlayer, editorV2, newPlayer, editorV1, tutor, oldReader})
+
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 plan items, got %d: %+v", len(items), items)
+	}
+	if items[0].ContentID != pinnedPlayer.ID || items[0].Reason != planReasonPinned {
+		t.Errorf("Expected the pinned player first, got %+v", items[0])
+	}
+	if items[1].ContentID != editorV2.ID || items[1].Reason != planReasonUpdate {
+		t.Errorf("Expected newest editor update second, got %+v", items[1])
+	}
+	if items[2].ContentID != tutor.ID || items[2].Reason != planReasonNew {
+		t.Errorf("Expected new tutor app third, got %+v", items[2])
+	}
+	if items[2].StorageState != db.StorageStateArchived || items[0].StorageState != "" {
+		t.Errorf("Expected only the archived tutor app flagged, got %+v", items)
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"FundAIHub/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+var (
+	// errRangeIgnored marks a Range header that is answered with the whole
+	// file, as RFC 9110 allows for ranges a server does not support
+	errRangeIgnored = errors.New("range ignored")
+	// errRangeNotSatisfiable marks a range starting past the end of the file
+	errRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// parseByteRange parses a single byte range, "bytes=N-", "bytes=N-M" or
+// "bytes=-N", against a file of size bytes and returns its inclusive bounds.
+// Malformed headers and multiple ranges return errRangeIgnored.
+func parseByteRange(header string, size int64) (start, end int64, err error) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, errRangeIgnored
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, errRangeIgnored
+	}
+
+	if first == "" {
+		// A suffix range: the last N bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, errRangeIgnored
+		}
+		if n == 0 {
+			return 0, 0, errRangeNotSatisfiable
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, errRangeIgnored
+	}
+	if start >= size {
+		return 0, 0, errRangeNotSatisfiable
+	}
+	end = size - 1
+	if last != "" {
+		requested, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || requested < start {
+			return 0, 0, errRangeIgnored
+		}
+		if requested < end {
+			end = requested
+		}
+	}
+	return start, end, nil
+}
+
+// openObjectRange is openObject for bytes start through end of the object
+func (h *DownloadHandler) openObjectRange(ctx context.Context, primary storage.StorageService, key string, start, end int64) (io.ReadCloser, string, error) {
+	reader, err := storage.OpenRange(ctx, primary, key, start, end)
+	if err == nil {
+		return reader, "primary", nil
+	}
+	if h.mirror == nil || !(errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrUpstream)) {
+		return nil, "", err
+	}
+
+	log.Printf("[Storage] Primary failed for range of %s, trying mirror: %v", key, err)
+	reader, mirrorErr := storage.OpenRange(ctx, h.mirror, key, start, end)
+	if mirrorErr != nil {
+		return nil, "", fmt.Errorf("primary: %v; mirror: %w", err, mirrorErr)
+	}
+	return reader, "mirror", nil
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		start, end int64
+		wantErr    error
+	}{
+		{"bytes=0-", 0, 99, nil},
+		{"bytes=40-", 40, 99, nil},
+		{"bytes=10-19", 10, 19, nil},
+		{"bytes=90-200", 90, 99, nil},
+		{"bytes=-10", 90, 99, nil},
+		{"bytes=-500", 0, 99, nil},
+		{"bytes=100-", 0, 0, errRangeNotSatisfiable},
+		{"bytes=-0", 0, 0, errRangeNotSatisfiable},
+		{"bytes=0-1,5-6", 0, 0, errRangeIgnored},
+		{"bytes=20-10", 0, 0, errRangeIgnored},
+		{"items=0-1", 0, 0, errRangeIgnored},
+		{"bytes=abc-", 0, 0, errRangeIgnored},
+	}
+	for _, tt := range tests {
+		start, end, err := parseByteRange(tt.header, 100)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%q: expected error %v, got %v", tt.header, tt.wantErr, err)
+			continue
+		}
+		if err == nil && (start != tt.start || end != tt.end) {
+			t.Errorf("%q: expected %d-%d, got %d-%d", tt.header, tt.start, tt.end, start, end)
+		}
+	}
+}
+
+func TestSignedDownloadRange(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	key := "test/" + uuid.New().String() + ".bin"
+	content := &db.Content{
+		Name:       "Ranged Content",
+		Type:       "test",
+		Version:    "1.0",
+		FilePath:   key,
+		Size:       10,
+		StorageKey: sql.NullString{String: key, Valid: true},
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("Failed to create content: %v", err)
+	}
+	svc := newFakeStorage()
+	svc.objects[key] = []byte("0123456789")
+	handler := NewDownloadHandler(store, svc)
+
+	signed, err := handler.urlGenerator.GenerateURL(content.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign URL: %v", err)
+	}
+	download := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, signed, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rr := httptest.NewRecorder()
+		handler.HandleSignedDownload(rr, req)
+		return rr
+	}
+
+	rr := download("bytes=4-")
+	if rr.Code != http.StatusPartialContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusPartialContent, rr.Code)
+	}
+	if rr.Body.String() != "456789" {
+		t.Errorf("Expected body %q, got %q", "456789", rr.Body.String())
+	}
+	if got := rr.Header().Get("Content-Range"); got != "bytes 4-9/10" {
+		t.Errorf("Expected Content-Range %q, got %q", "bytes 4-9/10", got)
+	}
+
+	rr = download("")
+	if rr.Code != http.StatusOK || rr.Body.String() != "0123456789" {
+		t.Errorf("Expected full body with 200, got %d %q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Accept-Ranges") != "bytes" {
+		t.Error("Expected Accept-Ranges: bytes")
+	}
+
+	if rr = download("bytes=10-"); rr.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestedRangeNotSatisfiable, rr.Code)
+	}
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"FundAIHub/internal/metrics"
+	"context"
+	"sync"
+)
+
+var (
+	// storageReadsInFlight is the number of storage reads being served per
+	// content
+	storageReadsInFlight = metrics.NewGaugeVec("fundaihub_storage_reads_in_flight",
+		"Signed downloads reading from storage, by content.", "content_id")
+	// storageReadsQueued is the number of downloads waiting for a read slot
+	storageReadsQueued = metrics.NewGauge("fundaihub_storage_reads_queued",
+		"Signed downloads waiting for a storage read slot.")
+)
+
+// readLimiter bounds how many storage reads run at once. Waiters are queued
+// per key and slots are handed out round-robin across keys, so a burst of
+// downloads of one content cannot hold back downloads of everything else.
+type readLimiter struct {
+	capacity int // Zero or less admits every read at once
+
+	mu       sync.Mutex
+	inFlight int
+	queues   map[string][]*readWaiter
+	order    []string // Keys with waiters, next to be served first
+}
+
+// readWaiter is a queued acquire; granted is set, under the limiter's lock,
+// when a slot is handed to it
+type readWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+func newReadLimiter(capacity int) *readLimiter {
+	return &readLimiter{capacity: capacity, queues: make(map[string][]*readWaiter)}
+}
+
+// acquire waits for a read slot for key. It fails only if ctx is done first.
+// The returned func gives the slot back. A nil limiter admits everything.
+func (l *readLimiter) acquire(ctx context.Context, key string) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	if l.capacity <= 0 || (l.inFlight < l.capacity && len(l.order) == 0) {
+		l.admit(key)
+		l.mu.Unlock()
+		return l.releaser(key), nil
+	}
+
+	w := &readWaiter{ready: make(chan struct{})}
+	if len(l.queues[key]) == 0 {
+		l.order = append(l.order, key)
+	}
+	l.queues[key] = append(l.queues[key], w)
+	storageReadsQueued.Inc()
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return l.releaser(key), nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w.granted {
+		// The slot arrived as the caller gave up; pass it on
+		l.release(key)
+		return nil, ctx.Err()
+	}
+	l.dequeue(key, w)
+	return nil, ctx.Err()
+}
+
+// admit counts a read for key as running. Called with mu held.
+func (l *readLimiter) admit(key string) {
+	l.inFlight++
+	storageReadsInFlight.Inc(key)
+}
+
+func (l *readLimiter) releaser(key string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.release(key)
+		})
+	}
+}
+
+// release frees key's slot and hands it to the first waiter of the next key
+// in turn, which then goes to the back of the rotation. Called with mu held.
+func (l *readLimiter) release(key string) {
+	l.inFlight--
+	storageReadsInFlight.Dec(key)
+
+	if len(l.order) == 0 || (l.capacity > 0 && l.inFlight >= l.capacity) {
+		return
+	}
+	next := l.order[0]
+	l.order = l.order[1:]
+	queue := l.queues[next]
+	w := queue[0]
+	if len(queue) > 1 {
+		l.queues[next] = queue[1:]
+		l.order = append(l.order, next)
+	} else {
+		delete(l.queues, next)
+	}
+	storageReadsQueued.Dec()
+
+	l.admit(next)
+	w.granted = true
+	close(w.ready)
+}
+
+// dequeue removes a waiter that gave up. Called with mu held.
+func (l *readLimiter) dequeue(key string, w *readWaiter) {
+	queue := l.queues[key]
+	for i, q := range queue {
+		if q == w {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	storageReadsQueued.Dec()
+	if len(queue) > 0 {
+		l.queues[key] = queue
+		return
+	}
+	delete(l.queues, key)
+	for i, k := range l.order {
+		if k == key {
+			l.order = append(l.order[:i], l.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// waiting returns how many acquires are queued
+func (l *readLimiter) waiting() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, q := range l.queues {
+		n += len(q)
+	}
+	return n
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// queueAcquire starts an acquire for key and waits until it is queued, so
+// tests control the arrival order
+func queueAcquire(t *testing.T, l *readLimiter, key string, granted chan<- string, releases chan func()) {
+	t.Helper()
+	before := l.waiting()
+	go func() {
+		release, err := l.acquire(context.Background(), key)
+		if err != nil {
+			t.Errorf("acquire(%s): %v", key, err)
+			return
+		}
+		granted <- key
+		releases <- release
+	}()
+	deadline := time.Now().Add(time.Second)
+	for l.waiting() == before {
+		if time.Now().After(deadline) {
+			t.Fatalf("acquire(%s) was never queued", key)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReadLimiterRoundRobin(t *testing.T) {
+	l := newReadLimiter(1)
+	hold, err := l.acquire(context.Background(), "popular")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	// A burst for one content queues ahead of a single download of another
+	granted := make(chan string, 10)
+	releases := make(chan func(), 10)
+	for i := 0; i < 5; i++ {
+		queueAcquire(t, l, "popular", granted, releases)
+	}
+	queueAcquire(t, l, "rare", granted, releases)
+	queueAcquire(t, l, "other", granted, releases)
+
+	// Serve the queue one slot at a time and record who got each slot
+	hold()
+	var order []string
+	for len(order) < 7 {
+		order = append(order, <-granted)
+		(<-releases)()
+	}
+
+	// rare and other are served within one round of popular, not after
+	// the whole burst
+	want := []string{"popular", "rare", "other", "popular", "popular", "popular", "popular"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Grant order = %v, want %v", order, want)
+		}
+	}
+	if n := storageReadsInFlight.Value("popular"); n != 0 {
+		t.Errorf("In-flight gauge for popular = %d after all releases", n)
+	}
+}
+
+func TestReadLimiterCancelledWaiter(t *testing.T) {
+	l := newReadLimiter(1)
+	hold, err := l.acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := l.acquire(ctx, "b"); err == nil {
+			t.Error("Expected a cancelled acquire to fail")
+		}
+	}()
+	for l.waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+
+	// The abandoned place in the queue does not swallow the slot
+	hold()
+	release, err := l.acquire(context.Background(), "c")
+	if err != nil {
+		t.Fatalf("acquire after cancellation: %v", err)
+	}
+	release()
+	if l.waiting() != 0 || l.inFlight != 0 {
+		t.Errorf("Limiter not idle: %d waiting, %d in flight", l.waiting(), l.inFlight)
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultRelatedLimit = 10
+	maxRelatedLimit     = 50
+)
+
+// RelatedItem is one content record offered alongside another
+type RelatedItem struct {
+	ContentID uuid.UUID `json:"content_id"`
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	AppType   string    `json:"app_type"`
+	Size      int64     `json:"size"`
+}
+
+// ContentSubresource routes /api/content/{id}/{resource} to the handler for
+// that resource
+func (h *DownloadHandler) ContentSubresource(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/content/")
+	_, suffix, _ := strings.Cut(rest, "/")
+	switch suffix {
+	case "dependencies":
+		h.GetDependencies(w, r)
+	case "related":
+		h.GetRelated(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// GetRelated serves GET /api/content/{id}/related?limit=N with other
+// downloadable content of the same app_type, newest first
+func (h *DownloadHandler) GetRelated(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/api/content/")
+	idStr, suffix, ok := strings.Cut(rest, "/")
+	if !ok || suffix != "related" {
+		http.NotFound(w, r)
+		return
+	}
+	contentID, err := uuid.Parse(idStr)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid content ID", "id", idStr, err)
+		return
+	}
+
+	limit := defaultRelatedLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxRelatedLimit {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxRelatedLimit))
+			return
+		}
+	}
+
+	if _, err := h.store.Get(r.Context(), contentID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	related, err := h.store.ListRelated(r.Context(), contentID, limit)
+	if err != nil {
+		log.Printf("[GetRelated] [Error] Failed to list related content for %s: %v", contentID, err)
+		http.Error(w, "Failed to list related content", http.StatusInternalServerError)
+		return
+	}
+
+	items := []RelatedItem{}
+	for _, c := range related {
+		items = append(items, RelatedItem{
+			ContentID: c.ID,
+			Name:      c.Name,
+			Version:   c.Version,
+			AppType:   c.AppType,
+			Size:      c.Size,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"content_id": contentID, "related": items})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGetRelated(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	appType := "related-app-" + uuid.New().String()
+	newContent := func(name, appType string, stored bool) *db.Content {
+		c := &db.Content{Name: name, Type: "test", Version: "1.0-" + name, AppType: appType, FilePath: name, Size: 1}
+		if stored {
+			c.StorageKey = sql.NullString{String: "test/" + uuid.New().String(), Valid: true}
+		}
+		if err := store.Create(ctx, c); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		return c
+	}
+	item := newContent("related-item", appType, true)
+	sibling := newContent("related-sibling", appType, true)
+	newContent("related-unstored", appType, false)
+	newContent("related-other", "other-"+appType, true)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		NewDownloadHandler(store, nil).ContentSubresource(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	rr := get("/api/content/" + item.ID.String() + "/related")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Related []RelatedItem `json:"related"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Related) != 1 || resp.Related[0].ContentID != sibling.ID {
+		t.Errorf("Expected only %s, got %+v", sibling.ID, resp.Related)
+	}
+
+	if rr := get("/api/content/" + item.ID.String() + "/related?limit=0"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for limit=0, got %d", rr.Code)
+	}
+	if rr := get("/api/content/" + uuid.New().String() + "/related"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown content, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/middleware"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PurgeReport is the outcome of a download purge
+type PurgeReport struct {
+	Purged        int64    `json:"purged"`
+	OlderThanDays int      `json:"older_than_days"`
+	Statuses      []string `json:"statuses"`
+}
+
+// PurgeDownloads deletes finished downloads older than the retention window,
+// POST ?older_than_days=90&status=completed,failed. Both parameters are
+// optional; the window defaults to DOWNLOAD_RETENTION and the statuses to
+// every terminal status.
+func (h *AdminHandler) PurgeDownloads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	q := r.URL.Query()
+	olderThan := h.downloadRetention
+	if v := q.Get("older_than_days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 1 {
+			respondWithError(w, http.StatusBadRequest, "older_than_days must be a positive integer")
+			return
+		}
+		olderThan = time.Duration(days) * 24 * time.Hour
+	}
+
+	statuses := db.TerminalDownloadStatuses
+	if v := q.Get("status"); v != "" {
+		statuses = strings.Split(v, ",")
+		for _, status := range statuses {
+			if !db.TerminalDownloadStatus(status) {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("status %q is not terminal; expected completed, failed or cancelled", status))
+				return
+			}
+		}
+	}
+
+	purged, err := h.store.PurgeOldDownloads(r.Context(), olderThan, statuses)
+	if err != nil {
+		log.Printf("[PurgeDownloads] [Error] %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to purge downloads")
+		return
+	}
+	adminID, _ := middleware.UserIDFromContext(r.Context())
+	log.Printf("[PurgeDownloads] Admin %s purged %d %v downloads older than %s", adminID, purged, statuses, olderThan)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PurgeReport{
+		Purged:        purged,
+		OlderThanDays: int(olderThan / (24 * time.Hour)),
+		Statuses:      statuses,
+	})
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Transfer summary sources: a signed download streamed by this server, or a
+// client reporting completion through UpdateStatus
+const (
+	transferSourceStream = "stream"
+	transferSourceStatus = "status"
+)
+
+// transferSummary is the single record logged when a transfer ends, for
+// querying completions and capacity planning
+type transferSummary struct {
+	Source     string
+	ContentID  uuid.UUID
+	DownloadID uuid.UUID // Nil for streams, which have no download record
+	Device     string    // Hardware hash when known
+	Bytes      int64
+	Duration   time.Duration
+}
+
+func (s transferSummary) attrs() []any {
+	attrs := []any{
+		"source", s.Source,
+		"content_id", s.ContentID.String(),
+		"bytes", s.Bytes,
+		"duration_ms", s.Duration.Milliseconds(),
+		"throughput_bps", throughput(s.Bytes, s.Duration),
+	}
+	if s.DownloadID != uuid.Nil {
+		attrs = append(attrs, "download_id", s.DownloadID.String())
+	}
+	if s.Device != "" {
+		attrs = append(attrs, "device", s.Device)
+	}
+	return attrs
+}
+
+// throughput is bytes per second, rounded down; zero for an instant transfer
+func throughput(bytes int64, d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(float64(bytes) / d.Seconds())
+}
+
+// logTransferCompleted records a transfer that delivered every byte
+func logTransferCompleted(s transferSummary) {
+	slog.Info("download completed", s.attrs()...)
+}
+
+// logTransferAborted records a stream that ended early, with how much of the
+// expected size was sent. expected is zero when the size was not known.
+func logTransferAborted(s transferSummary, expected int64, err error) {
+	attrs := append(s.attrs(), "expected_bytes", expected)
+	if err != nil {
+		attrs = append(attrs, "error", err.Error())
+	}
+	slog.Warn("download aborted", attrs...)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func captureSlog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestLogTransferCompleted(t *testing.T) {
+	buf := captureSlog(t)
+	contentID, downloadID := uuid.New(), uuid.New()
+
+	logTransferCompleted(transferSummary{
+		Source:     transferSourceStatus,
+		ContentID:  contentID,
+		DownloadID: downloadID,
+		Device:     "abc123",
+		Bytes:      10 << 20,
+		Duration:   4 * time.Second,
+	})
+
+	line := buf.String()
+	for _, want := range []string{
+		"level=INFO", `msg="download completed"`, "source=status",
+		"content_id=" + contentID.String(), "download_id=" + downloadID.String(),
+		"device=abc123", "bytes=10485760", "duration_ms=4000", "throughput_bps=2621440",
+	} {
+		if !strings.Contains(line, want) {
+			t.Errorf("Log line missing %q: %s", want, line)
+		}
+	}
+}
+
+func TestLogTransferAborted(t *testing.T) {
+	buf := captureSlog(t)
+
+	logTransferAborted(transferSummary{
+		Source:    transferSourceStream,
+		ContentID: uuid.New(),
+		Bytes:     512,
+		Duration:  time.Second,
+	}, 1024, errors.New("broken pipe"))
+
+	line := buf.String()
+	for _, want := range []string{`msg="download aborted"`, "source=stream", "bytes=512", "expected_bytes=1024", `error="broken pipe"`} {
+		if !strings.Contains(line, want) {
+			t.Errorf("Log line missing %q: %s", want, line)
+		}
+	}
+	if strings.Contains(line, "download_id=") || strings.Contains(line, "device=") {
+		t.Errorf("Stream summary should omit download and device: %s", line)
+	}
+}
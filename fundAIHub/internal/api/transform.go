@@ -0,0 +1,70 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// TransformParam is the signed-download query parameter that selects a
+// transformer
+const TransformParam = "transform"
+
+// Transformer rewrites content while it streams to the client. Apply must
+// not read the whole object before returning; if the reader it returns is
+// an io.Closer it is closed once the download ends.
+type Transformer struct {
+	// ContentType replaces the served content type; empty keeps it
+	ContentType string
+	// Extension is appended to the served file name, e.g. ".gz"
+	Extension string
+	Apply     func(io.Reader) (io.Reader, error)
+}
+
+// builtinTransformers are the transformers EnableTransforms can switch on
+var builtinTransformers = map[string]Transformer{
+	"identity": {Apply: identityTransform},
+	"gzip":     {ContentType: "application/gzip", Extension: ".gz", Apply: gzipTransform},
+}
+
+// identityTransform passes content through unchanged
+func identityTransform(r io.Reader) (io.Reader, error) {
+	return r, nil
+}
+
+// gzipTransform compresses content as it streams
+func gzipTransform(r io.Reader) (io.Reader, error) {
+	return gzipStream(r), nil
+}
+
+// RegisterTransformer makes t selectable on signed downloads with
+// ?transform=name
+func (h *DownloadHandler) RegisterTransformer(name string, t Transformer) {
+	if h.transforms == nil {
+		h.transforms = map[string]Transformer{}
+	}
+	h.transforms[name] = t
+}
+
+// EnableTransforms registers the named built-in transformers. Downloads
+// asking for any other transform are refused.
+func (h *DownloadHandler) EnableTransforms(names []string) error {
+	for _, name := range names {
+		t, ok := builtinTransformers[name]
+		if !ok {
+			return fmt.Errorf("unknown transform %q; expected one of %s", name, strings.Join(builtinTransformerNames(), ", "))
+		}
+		h.RegisterTransformer(name, t)
+	}
+	return nil
+}
+
+func builtinTransformerNames() []string {
+	names := make([]string, 0, len(builtinTransformers))
+	for name := range builtinTransformers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBuiltinTransformers(t *testing.T) {
+	payload := strings.Repeat("lesson notes ", 1000)
+
+	out, err := identityTransform(strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("identity: %v", err)
+	}
+	if got, _ := io.ReadAll(out); string(got) != payload {
+		t.Error("identity changed the payload")
+	}
+
+	out, err = gzipTransform(strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	gz, err := gzip.NewReader(out)
+	if err != nil {
+		t.Fatalf("gzip output is not gzip: %v", err)
+	}
+	if got, _ := io.ReadAll(gz); string(got) != payload {
+		t.Error("gzip round trip changed the payload")
+	}
+}
+
+func TestEnableTransformsRejectsUnknown(t *testing.T) {
+	h := &DownloadHandler{}
+	if err := h.EnableTransforms([]string{"gzip", "tar"}); err == nil {
+		t.Error("Expected an error for an unknown transform")
+	}
+}
+
+func TestSignedDownloadTransform(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	payload := strings.Repeat("lesson notes ", 1000)
+	svc := newFakeStorage()
+	key := "test/" + uuid.New().String() + ".txt"
+	svc.objects[key] = []byte(payload)
+	content := &db.Content{
+		Name:        "notes.txt",
+		Type:        "test",
+		Version:     "1.0",
+		FilePath:    key,
+		Size:        int64(len(payload)),
+		StorageKey:  sql.NullString{String: key, Valid: true},
+		ContentType: sql.NullString{String: "text/plain", Valid: true},
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("Failed to create content: %v", err)
+	}
+
+	handler := NewDownloadHandler(store, svc)
+	if err := handler.EnableTransforms([]string{"gzip"}); err != nil {
+		t.Fatalf("EnableTransforms: %v", err)
+	}
+	signed, err := handler.urlGenerator.GenerateURL(content.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign URL: %v", err)
+	}
+
+	t.Run("Enabled transform", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, signed+"&transform=gzip", nil)
+		req.Header.Set("Range", "bytes=0-9")
+		rr := httptest.NewRecorder()
+		handler.HandleSignedDownload(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Type"); got != "application/gzip" {
+			t.Errorf("Expected Content-Type application/gzip, got %q", got)
+		}
+		if got := rr.Header().Get("Content-Length"); got != "" {
+			t.Errorf("Expected no Content-Length, got %q", got)
+		}
+		if !strings.Contains(rr.Header().Get("Content-Disposition"), `filename="notes.txt.gz"`) {
+			t.Errorf("Unexpected Content-Disposition %q", rr.Header().Get("Content-Disposition"))
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(rr.Body.Bytes()))
+		if err != nil {
+			t.Fatalf("Body is not gzip: %v", err)
+		}
+		if got, _ := io.ReadAll(gz); string(got) != payload {
+			t.Error("Expected the whole payload, compressed")
+		}
+	})
+
+	t.Run("Transform not enabled", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.HandleSignedDownload(rr, httptest.NewRequest(http.MethodGet, signed+"&transform=identity", nil))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("No transform", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.HandleSignedDownload(rr, httptest.NewRequest(http.MethodGet, signed, nil))
+
+		if rr.Body.String() != payload {
+			t.Error("Expected the payload unchanged")
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/webhook"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// UpsertResult reports whether an upsert created or updated its record
+type UpsertResult struct {
+	Created bool        `json:"created"`
+	Content *db.Content `json:"content"`
+}
+
+// UpsertContent publishes a build idempotently. It takes the same multipart
+// form as UploadFile, but app_type and version are required and identify the
+// record: the one existing record for them is updated and its object
+// replaced, otherwise a new record is created. Responds 201 when created and
+// 200 when updated, so re-running a publish never adds a duplicate.
+func (h *ContentHandler) UpsertContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	if !h.checkUploadSize(w, r) {
+		return
+	}
+	form, err := openUploadForm(r, "file", h.maxFormParts, h.maxFormFieldBytes, "app_type", "version")
+	if err != nil {
+		respondWithFormError(w, err)
+		return
+	}
+	appType, version := form.value("app_type"), form.value("version")
+
+	licenseURL := form.value("license_url")
+	if err := validateLicenseURL(licenseURL); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	encoding := form.value("content_encoding")
+	if encoding != "" && encoding != db.ContentEncodingGzip {
+		respondWithError(w, http.StatusBadRequest, "content_encoding must be empty or gzip")
+		return
+	}
+
+	// A fresh key, so the replaced object is only removed once the record
+	// points away from it and a racing upload can never overwrite it
+	objectKey := h.keyLayout.ObjectKey(appType, form.filename, time.Now())
+	contentType := resolveContentType(form.header.Get("Content-Type"), appType, h.defaultContentTypes)
+
+	var body io.Reader = form
+	if encoding == db.ContentEncodingGzip {
+		gz := gzipStream(form)
+		defer gz.Close()
+		body = gz
+	}
+	fileInfo, err := h.storage.Upload(r.Context(), body, objectKey, contentType)
+	if err != nil {
+		respondStorageUploadFailed(w, form)
+		return
+	}
+	if !h.finishUpload(w, r, form, fileInfo.Key) {
+		return
+	}
+
+	content := &db.Content{
+		Name:        form.filename,
+		Type:        "linux-app",
+		Version:     version,
+		Description: form.value("description"),
+		AppVersion:  form.value("app_version"),
+		AppType:     appType,
+		License:     form.value("license"),
+		LicenseURL:  licenseURL,
+		FilePath:    fileInfo.Key,
+		Size:        form.size,
+		StorageKey:  sql.NullString{String: fileInfo.Key, Valid: true},
+		ContentType: sql.NullString{String: contentType, Valid: contentType != ""},
+		Checksum:    sql.NullString{String: form.checksum, Valid: true},
+
+		StorageBackend:  h.backend,
+		ContentEncoding: encoding,
+	}
+
+	created, previous, err := h.store.UpsertByVersion(r.Context(), content)
+	if err != nil {
+		log.Printf("[UpsertContent] Failed to upsert %s %s: %v", appType, version, err)
+		if delErr := compensateUpload(r.Context(), h.storage, fileInfo.Key); delErr != nil {
+			log.Printf("[UpsertContent] [Orphan] Object %s left in storage without a record: %v", fileInfo.Key, delErr)
+		}
+		if errors.Is(err, db.ErrDuplicateStorageKey) {
+			respondWithError(w, http.StatusConflict, err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to save content record")
+		}
+		return
+	}
+
+	// The record now points at the new object; the one it replaced is unused
+	if previous.Key != "" && (previous.Key != fileInfo.Key || storageBackendName(previous.Backend) != h.backend) {
+		if err := h.deleteObject(r.Context(), previous); err != nil {
+			log.Printf("[UpsertContent] [Orphan] Replaced object %s in %s could not be removed: %v", previous.Key, previous.Backend, err)
+		}
+	}
+
+	status, event, verb := http.StatusOK, webhook.EventContentUpdated, "Updated"
+	if created {
+		status, event, verb = http.StatusCreated, webhook.EventContentCreated, "Created"
+	}
+	log.Printf("[UpsertContent] %s %s %s (content %s, key %s)", verb, appType, version, content.ID, fileInfo.Key)
+	h.webhooks.Publish(event, content)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(UpsertResult{Created: created, Content: content})
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestUpsertContentRequiresVersion(t *testing.T) {
+	h := NewContentHandler(nil, nil)
+	rr := httptest.NewRecorder()
+	h.UpsertContent(rr, multipartRequest(t, [][2]string{{"app_type", "linux-app"}}, "payload"))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	var resp ErrorResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Field != "version" {
+		t.Errorf("Expected field %q, got %q", "version", resp.Field)
+	}
+}
+
+func TestUpsertContent(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := newFakeStorage()
+	h := NewContentHandler(store, svc)
+	appType := "test-app-" + uuid.New().String()
+
+	publish := func(body string) (*httptest.ResponseRecorder, UpsertResult) {
+		rr := httptest.NewRecorder()
+		h.UpsertContent(rr, multipartRequest(t, [][2]string{{"app_type", appType}, {"version", "1.0.0"}}, body))
+		var result UpsertResult
+		if rr.Code < 300 {
+			if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return rr, result
+	}
+
+	rr, first := publish("build one")
+	if rr.Code != http.StatusCreated || !first.Created {
+		t.Fatalf("Expected first publish to create (201), got %d created=%v", rr.Code, first.Created)
+	}
+
+	rr, second := publish("build two, longer")
+	if rr.Code != http.StatusOK || second.Created {
+		t.Fatalf("Expected second publish to update (200), got %d created=%v", rr.Code, second.Created)
+	}
+	if second.Content.ID != first.Content.ID {
+		t.Errorf("Expected the same record to be updated, got %s and %s", first.Content.ID, second.Content.ID)
+	}
+
+	matches, err := store.FindByVersion(context.Background(), appType, "1.0.0")
+	if err != nil {
+		t.Fatalf("Failed to find content: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("Expected one record after re-publishing, got %d", len(matches))
+	}
+	got, err := store.Get(context.Background(), first.Content.ID)
+	if err != nil {
+		t.Fatalf("Failed to reload content: %v", err)
+	}
+	if got.Size != int64(len("build two, longer")) {
+		t.Errorf("Expected size of the new build, got %d", got.Size)
+	}
+	if string(svc.objects[got.StorageKey.String]) != "build two, longer" {
+		t.Errorf("Expected storage object to be replaced, got %q", svc.objects[got.StorageKey.String])
+	}
+	if _, ok := svc.objects[first.Content.StorageKey.String]; ok || len(svc.objects) != 1 {
+		t.Errorf("Expected the first build's object removed, have %d objects", len(svc.objects))
+	}
+	sum := sha256.Sum256([]byte("build two, longer"))
+	if want := hex.EncodeToString(sum[:]); !got.Checksum.Valid || got.Checksum.String != want {
+		t.Errorf("Expected checksum %s of the new build, got %+v", want, got.Checksum)
+	}
+}
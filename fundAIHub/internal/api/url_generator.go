@@ -1,31 +1,130 @@
 package api
 
 import (
+	"FundAIHub/internal/config"
 	"FundAIHub/internal/db"
 	"context"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrInvalidURL is returned when a signed URL is malformed, expired or
+	// carries a signature that does not match.
+	ErrInvalidURL = errors.New("invalid or expired signed URL")
+	// ErrContentChanged is returned when a correctly signed URL was issued for
+	// a revision of the content that has since been replaced.
+	ErrContentChanged = errors.New("content changed since URL was issued")
+	// ErrUnsupportedURLVersion is returned for a signed URL whose format
+	// version this server does not understand.
+	ErrUnsupportedURLVersion = errors.New("unsupported signed URL version")
+	// ErrContentDisabled is returned when asked to sign a URL for content an
+	// admin has disabled.
+	ErrContentDisabled = errors.New("content is disabled")
+)
+
+// urlFormatVersion is the v parameter of newly generated URLs. URLs without
+// one predate versioning and are verified as version 1.
+const urlFormatVersion = "1"
+
+// devSigningKey signs URLs in development when no URL_SIGNING_KEY is set.
+// It is random per process, so links stop working on restart; other
+// environments refuse to start without a key (see config.Validate).
+var devSigningKey = sync.OnceValue(func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("generating development signing key: %v", err))
+	}
+	log.Printf("[URLGenerator] [Warning] URL_SIGNING_KEY is not set; signing with a random key until restart")
+	return key
+})
+
 type URLGenerator struct {
 	store      *db.ContentStore
-	signingKey []byte // Used for signing URLs
+	activeKID  string            // ID of the key that signs new URLs
+	keys       map[string][]byte // Accepted keys by key ID
+	keyOrder   []string          // Key IDs, active first
+	pinVersion bool              // Embed the content revision in the signature
+	clockSkew  time.Duration
 }
 
 func NewURLGenerator(store *db.ContentStore) *URLGenerator {
-	// In production, this should be loaded from environment/config
-	key := []byte("your-secure-signing-key")
-	return &URLGenerator{
+	cfg := config.GetConfig()
+	g := &URLGenerator{
 		store:      store,
-		signingKey: key,
+		pinVersion: cfg.SignedURLPinVersion,
+		clockSkew:  cfg.SignedURLClockSkew,
+	}
+	g.setSigningKeys(signingKeys(cfg))
+	return g
+}
+
+// signingKeys returns the primary key followed by any previous keys that
+// are still accepted during a rotation
+func signingKeys(cfg *config.Config) [][]byte {
+	primary := []byte(cfg.URLSigningKey)
+	if len(primary) == 0 {
+		primary = devSigningKey()
+	}
+	keys := [][]byte{primary}
+	for _, k := range cfg.URLSigningPreviousKeys {
+		keys = append(keys, []byte(k))
+	}
+	return keys
+}
+
+// setSigningKeys replaces the accepted keys. The first signs new URLs; each
+// is identified in URLs by its fingerprint.
+func (g *URLGenerator) setSigningKeys(keys [][]byte) {
+	g.keys = make(map[string][]byte, len(keys))
+	g.keyOrder = g.keyOrder[:0]
+	for _, key := range keys {
+		kid := fingerprint(key)
+		if _, ok := g.keys[kid]; ok {
+			continue
+		}
+		g.keys[kid] = key
+		g.keyOrder = append(g.keyOrder, kid)
+	}
+	g.activeKID = ""
+	if len(g.keyOrder) > 0 {
+		g.activeKID = g.keyOrder[0]
+	}
+}
+
+// KeyFingerprint identifies a signing key without revealing it. The
+// fingerprint is also the kid parameter of URLs signed with the key.
+type KeyFingerprint struct {
+	Fingerprint string `json:"fingerprint"`
+	Primary     bool   `json:"primary"`
+}
+
+// fingerprint is the first 8 bytes of the key's SHA-256, hex encoded
+func fingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// KeyFingerprints lists the configured signing keys, primary first
+func (g *URLGenerator) KeyFingerprints() []KeyFingerprint {
+	out := make([]KeyFingerprint, len(g.keyOrder))
+	for i, kid := range g.keyOrder {
+		out[i] = KeyFingerprint{Fingerprint: kid, Primary: kid == g.activeKID}
 	}
+	return out
 }
 
 type URLParams struct {
@@ -34,6 +133,26 @@ type URLParams struct {
 	Signature string
 }
 
+// contentRevision identifies the stored bytes a URL was issued for. It changes
+// whenever the content record is updated in place.
+func contentRevision(updatedAt time.Time) string {
+	return strconv.FormatInt(updatedAt.UnixMicro(), 10)
+}
+
+func (g *URLGenerator) sign(contentID uuid.UUID, expiresAt time.Time, revision string) string {
+	return signWithKey(g.keys[g.activeKID], contentID, expiresAt, revision)
+}
+
+func signWithKey(key []byte, contentID uuid.UUID, expiresAt time.Time, revision string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(contentID.String()))
+	mac.Write([]byte(expiresAt.UTC().Format(time.RFC3339)))
+	if revision != "" {
+		mac.Write([]byte(revision))
+	}
+	return base64.URLEncoding.EncodeToString(mac.Sum(nil))
+}
+
 func (g *URLGenerator) GenerateURL(contentID uuid.UUID, duration time.Duration) (string, error) {
 	// Add context
 	ctx := context.Background()
@@ -48,82 +167,150 @@ func (g *URLGenerator) GenerateURL(contentID uuid.UUID, duration time.Duration)
 	if content.Size == 0 {
 		return "", fmt.Errorf("invalid content: size is 0")
 	}
+	if content.DeletedAt != nil {
+		return "", fmt.Errorf("content not found: deleted at %s", content.DeletedAt.Format(time.RFC3339))
+	}
+	if !content.Enabled {
+		return "", ErrContentDisabled
+	}
 
+	return g.signedURL(contentID, content.UpdatedAt, duration), nil
+}
+
+// signedURL signs a link to content already known to be downloadable, last
+// updated at updatedAt, so callers that loaded it can skip GenerateURL's
+// lookup
+func (g *URLGenerator) signedURL(contentID uuid.UUID, updatedAt time.Time, duration time.Duration) string {
 	expiresAt := time.Now().Add(duration)
 
-	// Create signature
-	mac := hmac.New(sha256.New, g.signingKey)
-	mac.Write([]byte(contentID.String()))
-	mac.Write([]byte(expiresAt.UTC().Format(time.RFC3339)))
-	signature := base64.URLEncoding.EncodeToString(mac.Sum(nil))
+	var revision string
+	if g.pinVersion {
+		revision = contentRevision(updatedAt)
+	}
+	signature := g.sign(contentID, expiresAt, revision)
 
 	// Generate URL with params
-	url := fmt.Sprintf("/download/%s?expires=%s&signature=%s",
+	url := fmt.Sprintf("/download/%s?v=%s&kid=%s&expires=%s&signature=%s",
 		contentID,
+		urlFormatVersion,
+		g.activeKID,
 		expiresAt.UTC().Format(time.RFC3339),
 		signature,
 	)
+	if revision != "" {
+		url += "&rev=" + revision
+	}
+
+	return url
+}
 
-	return url, nil
+// expired reports whether a URL expiring at expiresAt is past its expiry,
+// allowing for the configured clock skew
+func (g *URLGenerator) expired(expiresAt, now time.Time) bool {
+	return now.After(expiresAt.Add(g.clockSkew))
 }
 
 func (g *URLGenerator) ValidateURL(urlStr string) bool {
+	return g.VerifyURL(urlStr) == nil
+}
+
+// VerifyURL checks a signed URL and reports why it was rejected. A URL with a
+// valid signature whose pinned revision no longer matches the stored content
+// yields ErrContentChanged so callers can ask the client to fetch a new link.
+func (g *URLGenerator) VerifyURL(urlStr string) error {
 	// Parse URL path and query parameters
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
-		return false
+		return ErrInvalidURL
 	}
 
 	// Extract contentID from path
-	// URL format: /download/{contentID}?expires={timestamp}&signature={sig}
+	// URL format: /download/{contentID}?v={version}&kid={keyID}&expires={timestamp}&signature={sig}[&rev={revision}]
 	pathParts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
 	if len(pathParts) != 2 || pathParts[0] != "download" {
-		return false
+		return ErrInvalidURL
 	}
 
 	contentID, err := uuid.Parse(pathParts[1])
 	if err != nil {
-		return false
+		return ErrInvalidURL
 	}
 
-	// Get query parameters
+	// Dispatch on the format version so a new signing scheme can be
+	// introduced while links in the old format are still outstanding
 	queryParams := parsedURL.Query()
+	switch v := queryParams.Get("v"); v {
+	case "", "1":
+		return g.verifyV1(contentID, queryParams)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedURLVersion, v)
+	}
+}
+
+// verifyV1 checks an HMAC-SHA256 signature over the content ID, expiry and
+// optional revision, made with the key named by kid
+func (g *URLGenerator) verifyV1(contentID uuid.UUID, queryParams url.Values) error {
+	kid := queryParams.Get("kid")
 	expiresStr := queryParams.Get("expires")
 	receivedSignature := queryParams.Get("signature")
+	revision := queryParams.Get("rev")
 
 	if expiresStr == "" || receivedSignature == "" {
-		return false
+		return ErrInvalidURL
 	}
 
 	// Parse expiration time
 	expiresAt, err := time.Parse(time.RFC3339, expiresStr)
 	if err != nil {
-		return false
+		return ErrInvalidURL
 	}
 
 	// Check if URL has expired
-	if time.Now().After(expiresAt) {
-		return false
+	if g.expired(expiresAt, time.Now()) {
+		return ErrInvalidURL
+	}
+
+	// Recreate signature for comparison; URLs signed with a key that has
+	// since been rotated out of primary stay valid while it is configured
+	if !g.signatureMatches(kid, receivedSignature, contentID, expiresAt, revision) {
+		return ErrInvalidURL
 	}
 
 	// Add context
 	ctx := context.Background()
 
 	// Use correct method name and pass context
-	_, err = g.store.GetByID(ctx, contentID)
+	content, err := g.store.GetByID(ctx, contentID)
 	if err != nil {
-		return false
+		return ErrInvalidURL
 	}
 
-	// Recreate signature for comparison
-	mac := hmac.New(sha256.New, g.signingKey)
-	mac.Write([]byte(contentID.String()))
-	mac.Write([]byte(expiresAt.UTC().Format(time.RFC3339)))
-	expectedSignature := base64.URLEncoding.EncodeToString(mac.Sum(nil))
+	// URLs issued before pinning was enabled carry no revision and stay valid
+	// until they expire.
+	if revision != "" && revision != contentRevision(content.UpdatedAt) {
+		return ErrContentChanged
+	}
 
-	// Compare signatures
-	return hmac.Equal(
-		[]byte(receivedSignature),
-		[]byte(expectedSignature),
-	)
+	return nil
+}
+
+// signatureMatches checks a signature against the key named by kid. URLs
+// issued before key IDs were added carry none and are tried against every
+// configured key.
+func (g *URLGenerator) signatureMatches(kid, signature string, contentID uuid.UUID, expiresAt time.Time, revision string) bool {
+	if kid != "" {
+		key, ok := g.keys[kid]
+		if !ok {
+			return false
+		}
+		expected := signWithKey(key, contentID, expiresAt, revision)
+		return hmac.Equal([]byte(signature), []byte(expected))
+	}
+	for _, kid := range g.keyOrder {
+		expected := signWithKey(g.keys[kid], contentID, expiresAt, revision)
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return true
+		}
+	}
+	return false
 }
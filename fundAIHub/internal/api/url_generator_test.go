@@ -3,6 +3,7 @@ package api
 import (
 	"FundAIHub/internal/db"
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -84,4 +85,145 @@ func TestURLGenerator(t *testing.T) {
 			t.Error("Tampered URL should not validate")
 		}
 	})
+
+	t.Run("Content Updated After Issue", func(t *testing.T) {
+		generator.pinVersion = true
+		url, err := generator.GenerateURL(content.ID, time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to generate URL: %v", err)
+		}
+
+		// Replace the content in place; updated_at moves forward
+		time.Sleep(time.Millisecond * 2)
+		content.Version = "1.1"
+		if err := store.Update(ctx, content); err != nil {
+			t.Fatalf("Failed to update test content: %v", err)
+		}
+
+		if err := generator.VerifyURL(url); !errors.Is(err, ErrContentChanged) {
+			t.Errorf("Expected ErrContentChanged, got %v", err)
+		}
+
+		// A freshly issued URL is pinned to the new revision
+		url, err = generator.GenerateURL(content.ID, time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to generate URL: %v", err)
+		}
+		if err := generator.VerifyURL(url); err != nil {
+			t.Errorf("Reissued URL failed validation: %v", err)
+		}
+	})
+
+	t.Run("Key Rotation", func(t *testing.T) {
+		oldKey, newKey := []byte("old-key"), []byte("new-key")
+		generator.setSigningKeys([][]byte{oldKey})
+		url, err := generator.GenerateURL(content.ID, time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to generate URL: %v", err)
+		}
+
+		// Rotate: the new key signs, the old one is still accepted
+		generator.setSigningKeys([][]byte{newKey, oldKey})
+		if err := generator.VerifyURL(url); err != nil {
+			t.Errorf("URL signed with previous key failed validation: %v", err)
+		}
+
+		// Retire the old key
+		generator.setSigningKeys([][]byte{newKey})
+		if err := generator.VerifyURL(url); !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("Expected ErrInvalidURL after retiring key, got %v", err)
+		}
+	})
+}
+
+func TestKeyFingerprints(t *testing.T) {
+	g := &URLGenerator{}
+	g.setSigningKeys([][]byte{[]byte("primary"), []byte("previous")})
+	fps := g.KeyFingerprints()
+
+	if len(fps) != 2 || !fps[0].Primary || fps[1].Primary {
+		t.Fatalf("Unexpected fingerprints: %+v", fps)
+	}
+	if fps[0].Fingerprint == fps[1].Fingerprint {
+		t.Error("Distinct keys should have distinct fingerprints")
+	}
+	if len(fps[0].Fingerprint) != 16 {
+		t.Errorf("Fingerprint %q should be 16 hex characters", fps[0].Fingerprint)
+	}
+}
+
+func TestClockSkewBoundary(t *testing.T) {
+	expiresAt := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		skew time.Duration
+		now  time.Time
+		want bool
+	}{
+		{"No skew, at expiry", 0, expiresAt, false},
+		{"No skew, just after", 0, expiresAt.Add(time.Nanosecond), true},
+		{"Skew, inside window", 5 * time.Second, expiresAt.Add(4 * time.Second), false},
+		{"Skew, at window edge", 5 * time.Second, expiresAt.Add(5 * time.Second), false},
+		{"Skew, past window", 5 * time.Second, expiresAt.Add(5*time.Second + time.Nanosecond), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &URLGenerator{clockSkew: tt.skew}
+			if got := g.expired(expiresAt, tt.now); got != tt.want {
+				t.Errorf("expired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestURLFormatVersion(t *testing.T) {
+	g := &URLGenerator{}
+	g.setSigningKeys([][]byte{[]byte("key")})
+	id := uuid.New()
+	expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	t.Run("Unknown version is rejected before the signature", func(t *testing.T) {
+		err := g.VerifyURL("/download/" + id.String() + "?v=9&expires=" + expires + "&signature=x")
+		if !errors.Is(err, ErrUnsupportedURLVersion) {
+			t.Errorf("Expected ErrUnsupportedURLVersion, got %v", err)
+		}
+	})
+
+	for _, v := range []string{"", "&v=1"} {
+		t.Run("Version 1 dispatch"+v, func(t *testing.T) {
+			err := g.VerifyURL("/download/" + id.String() + "?expires=" + expires + "&signature=bad" + v)
+			if !errors.Is(err, ErrInvalidURL) {
+				t.Errorf("Expected ErrInvalidURL from the v1 verifier, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSignatureKeyID(t *testing.T) {
+	oldKey, newKey := []byte("old-key"), []byte("new-key")
+	g := &URLGenerator{}
+	g.setSigningKeys([][]byte{newKey, oldKey})
+	id := uuid.New()
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	oldSig := signWithKey(oldKey, id, expiresAt, "")
+
+	tests := []struct {
+		name string
+		kid  string
+		want bool
+	}{
+		{"Matching kid", fingerprint(oldKey), true},
+		{"Other configured kid", fingerprint(newKey), false},
+		{"Unknown kid", "0000000000000000", false},
+		{"No kid tries every key", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.signatureMatches(tt.kid, oldSig, id, expiresAt, ""); got != tt.want {
+				t.Errorf("signatureMatches = %v, want %v", got, tt.want)
+			}
+		})
+	}
 }
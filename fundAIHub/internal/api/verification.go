@@ -0,0 +1,217 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/middleware"
+	"FundAIHub/internal/storage"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChecksumMismatch describes a stored object whose bytes no longer hash to
+// the recorded checksum
+type ChecksumMismatch struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Key      string    `json:"storage_key"`
+	Expected string    `json:"expected"`
+	Actual   string    `json:"actual,omitempty"`
+}
+
+// VerificationReport summarises a checksum re-verification run
+type VerificationReport struct {
+	Checked    int                `json:"checked"`
+	OK         int                `json:"ok"`
+	Mismatched int                `json:"mismatched"`
+	Failed     int                `json:"failed"`
+	Mismatches []ChecksumMismatch `json:"mismatches"`
+}
+
+// VerifyChecksums re-hashes every stored object that has a recorded checksum
+// and records ok or mismatch on the content record. Objects that cannot be
+// read are counted as failed and keep their previous status.
+func VerifyChecksums(ctx context.Context, store *db.ContentStore, backends *storage.Registry) (*VerificationReport, error) {
+	contents, err := store.ListChecksummed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerificationReport{Mismatches: []ChecksumMismatch{}}
+	for _, c := range contents {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		report.Checked++
+
+		svc, err := backendOf(backends, &c)
+		if err != nil {
+			log.Printf("[VerifyChecksums] No backend for %s (%s): %v", c.ID, c.StorageBackend, err)
+			report.Failed++
+			continue
+		}
+		actual, err := hashObject(ctx, svc, c.StorageKey.String, c.ContentEncoding)
+		if err != nil {
+			log.Printf("[VerifyChecksums] Failed to hash %s (%s): %v", c.ID, c.StorageKey.String, err)
+			report.Failed++
+			continue
+		}
+
+		status := db.VerificationOK
+		if !strings.EqualFold(actual, c.Checksum.String) {
+			status = db.VerificationMismatch
+		}
+		if err := store.SetVerificationStatus(ctx, c.ID, status); err != nil {
+			log.Printf("[VerifyChecksums] Failed to record status for %s: %v", c.ID, err)
+			report.Failed++
+			continue
+		}
+
+		if status == db.VerificationOK {
+			report.OK++
+			continue
+		}
+		log.Printf("[VerifyChecksums] Checksum mismatch for %s (%s): expected %s, got %s",
+			c.ID, c.StorageKey.String, c.Checksum.String, actual)
+		report.Mismatched++
+		report.Mismatches = append(report.Mismatches, ChecksumMismatch{
+			ID:       c.ID,
+			Name:     c.Name,
+			Key:      c.StorageKey.String,
+			Expected: c.Checksum.String,
+			Actual:   actual,
+		})
+	}
+	return report, nil
+}
+
+// hashObject streams a stored object through SHA-256 and returns the hex
+// digest. Gzipped objects are hashed decompressed, matching how Checksum is
+// recorded.
+func hashObject(ctx context.Context, svc storage.StorageService, key, encoding string) (string, error) {
+	reader, _, err := svc.Download(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	var body io.Reader = reader
+	if encoding == db.ContentEncodingGzip {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return "", err
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Checksum job states
+const (
+	jobIdle    = "idle"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// ChecksumJob is the state of the latest on-demand checksum re-verification
+type ChecksumJob struct {
+	Status     string              `json:"status"`
+	StartedAt  *time.Time          `json:"started_at,omitempty"`
+	FinishedAt *time.Time          `json:"finished_at,omitempty"`
+	Report     *VerificationReport `json:"report,omitempty"`
+	Error      string              `json:"error,omitempty"`
+}
+
+// VerifyChecksums starts a checksum re-verification pass with POST, which
+// runs in the background and is answered 202, and reports the latest pass
+// with GET. A POST while a pass is running starts no other.
+func (h *AdminHandler) VerifyChecksums(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if h.startChecksumJob() {
+			adminID, _ := middleware.UserIDFromContext(r.Context())
+			log.Printf("[VerifyChecksums] Admin %s started a verification pass", adminID)
+		}
+	default:
+		respondMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+
+	h.checksumMu.Lock()
+	job := h.checksumJob
+	h.checksumMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodPost {
+		w.Header().Set("Location", r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	}
+	json.NewEncoder(w).Encode(job)
+}
+
+// startChecksumJob starts a verification pass under the handler's context
+// unless one is running, and reports whether it started one
+func (h *AdminHandler) startChecksumJob() bool {
+	h.checksumMu.Lock()
+	defer h.checksumMu.Unlock()
+	if h.checksumJob.Status == jobRunning {
+		return false
+	}
+	started := time.Now()
+	h.checksumJob = ChecksumJob{Status: jobRunning, StartedAt: &started}
+
+	go func() {
+		report, err := VerifyChecksums(h.ctx, h.store, h.backends)
+		finished := time.Now()
+		job := ChecksumJob{Status: jobDone, StartedAt: &started, FinishedAt: &finished, Report: report}
+		if err != nil {
+			log.Printf("[VerifyChecksums] [Error] %v", err)
+			job.Status, job.Error = jobFailed, err.Error()
+		} else {
+			log.Printf("[VerifyChecksums] Checked %d objects: %d ok, %d mismatched, %d failed",
+				report.Checked, report.OK, report.Mismatched, report.Failed)
+		}
+		h.checksumMu.Lock()
+		h.checksumJob = job
+		h.checksumMu.Unlock()
+	}()
+	return true
+}
+
+// VerificationReport lists content whose last re-verification found a
+// checksum mismatch
+func (h *AdminHandler) VerificationReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	contents, err := h.store.ListVerificationMismatches(r.Context())
+	if err != nil {
+		log.Printf("[VerificationReport] [Error] %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list verification mismatches")
+		return
+	}
+	if contents == nil {
+		contents = []db.Content{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contents)
+}
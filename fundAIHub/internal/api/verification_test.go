@@ -0,0 +1,118 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/storage"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestVerifyChecksumsJob(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	hot, mirror := newFakeStorage(), newFakeStorage()
+	backends := storage.NewRegistry(db.DefaultStorageBackend, hot)
+	backends.Register("mirror", mirror)
+
+	sum := sha256.Sum256([]byte("data"))
+	create := func(backend string, svc *fakeStorage, body string) *db.Content {
+		key := "test/" + uuid.New().String() + ".bin"
+		svc.objects[key] = []byte(body)
+		c := &db.Content{
+			Name:           key,
+			Type:           "test",
+			FilePath:       key,
+			Size:           int64(len(body)),
+			StorageKey:     sql.NullString{String: key, Valid: true},
+			Checksum:       sql.NullString{String: hex.EncodeToString(sum[:]), Valid: true},
+			StorageBackend: backend,
+		}
+		if err := store.Create(context.Background(), c); err != nil {
+			t.Fatalf("Failed to create content: %v", err)
+		}
+		return c
+	}
+	create(db.DefaultStorageBackend, hot, "data")
+	// Only found if the record's own backend is read
+	create("mirror", mirror, "data")
+	corrupt := create(db.DefaultStorageBackend, hot, "corrupted")
+
+	admin := NewAdminHandler(store, backends)
+	serve := func(method string) (*httptest.ResponseRecorder, ChecksumJob) {
+		rr := httptest.NewRecorder()
+		admin.VerifyChecksums(rr, httptest.NewRequest(method, "/api/admin/content/verify-checksums", nil))
+		var job ChecksumJob
+		if err := json.NewDecoder(rr.Body).Decode(&job); err != nil {
+			t.Fatalf("%s: decoding job: %v", method, err)
+		}
+		return rr, job
+	}
+
+	if _, job := serve(http.MethodGet); job.Status != jobIdle {
+		t.Errorf("Expected an idle job before any pass, got %q", job.Status)
+	}
+
+	rr, job := serve(http.MethodPost)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d", http.StatusAccepted, rr.Code)
+	}
+	if job.StartedAt == nil {
+		t.Errorf("Expected the started pass, got %+v", job)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == jobRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		_, job = serve(http.MethodGet)
+	}
+	if job.Status != jobDone || job.Report == nil {
+		t.Fatalf("Expected a finished pass, got %+v", job)
+	}
+	if job.Report.OK != 2 || job.Report.Mismatched != 1 || job.Report.Failed != 0 {
+		t.Errorf("Report = %+v, want 2 ok and 1 mismatched", job.Report)
+	}
+	if len(job.Report.Mismatches) != 1 || job.Report.Mismatches[0].ID != corrupt.ID {
+		t.Errorf("Expected %s to mismatch, got %+v", corrupt.ID, job.Report.Mismatches)
+	}
+}
+
+func TestVerifyChecksumsJobStopsWithContext(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	admin := NewAdminHandler(store, storage.NewRegistry(db.DefaultStorageBackend, newFakeStorage()))
+	admin.SetContext(ctx)
+
+	rr := httptest.NewRecorder()
+	admin.VerifyChecksums(rr, httptest.NewRequest(http.MethodPost, "/api/admin/content/verify-checksums", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d", http.StatusAccepted, rr.Code)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		admin.checksumMu.Lock()
+		job := admin.checksumJob
+		admin.checksumMu.Unlock()
+		if job.Status != jobRunning {
+			if job.Status != jobFailed {
+				t.Errorf("Expected a pass under a cancelled context to fail, got %+v", job)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Pass still running under a cancelled context")
+}
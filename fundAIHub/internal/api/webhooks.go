@@ -0,0 +1,144 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/webhook"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+type createWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// createWebhookResponse is the only place a subscription secret is returned
+type createWebhookResponse struct {
+	db.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// Webhooks manages content-availability webhook subscriptions:
+// GET lists them, POST registers one and DELETE ?id= removes one.
+func (h *AdminHandler) Webhooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.listWebhooks(w, r)
+	case http.MethodPost:
+		h.createWebhook(w, r)
+	case http.MethodDelete:
+		h.deleteWebhook(w, r)
+	default:
+		respondMethodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+func (h *AdminHandler) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.store.ListWebhookSubscriptions(r.Context(), "")
+	if err != nil {
+		log.Printf("[Webhooks] [Error] Failed to list subscriptions: %v", err)
+		http.Error(w, "Failed to list webhooks", http.StatusInternalServerError)
+		return
+	}
+	if subs == nil {
+		subs = []db.WebhookSubscription{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subs)
+}
+
+func (h *AdminHandler) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var req createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		respondWithError(w, http.StatusBadRequest, "url must be an absolute http(s) URL")
+		return
+	}
+	if !h.webhookAllowPrivate {
+		if err := webhook.CheckTarget(r.Context(), target.Hostname()); err != nil {
+			log.Printf("[Webhooks] Refused %s: %v", target, err)
+			writeErrorResponse(w, ErrorResponse{
+				Error:  "url must resolve to a public address",
+				Code:   http.StatusBadRequest,
+				Field:  "url",
+				Reason: err.Error(),
+			})
+			return
+		}
+	}
+
+	if len(req.Events) == 0 {
+		req.Events = webhook.Events
+	}
+	for _, event := range req.Events {
+		if !isWebhookEvent(event) {
+			respondWithError(w, http.StatusBadRequest, "Unknown event: "+event)
+			return
+		}
+	}
+
+	if req.Secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+			return
+		}
+		req.Secret = hex.EncodeToString(buf)
+	}
+
+	sub := db.WebhookSubscription{URL: target.String(), Secret: req.Secret, Events: req.Events}
+	if err := h.store.CreateWebhookSubscription(r.Context(), &sub); err != nil {
+		log.Printf("[Webhooks] [Error] Failed to create subscription: %v", err)
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[Webhooks] Registered %s for %v", sub.URL, sub.Events)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createWebhookResponse{WebhookSubscription: sub, Secret: sub.Secret})
+}
+
+func (h *AdminHandler) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	idStr := r.URL.Query().Get("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondWithInvalidUUID(w, "Invalid ID", "id", idStr, err)
+		return
+	}
+
+	if err := h.store.DeleteWebhookSubscription(r.Context(), id); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[Webhooks] [Error] Failed to delete subscription %s: %v", id, err)
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func isWebhookEvent(event string) bool {
+	for _, e := range webhook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
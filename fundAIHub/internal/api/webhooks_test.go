@@ -0,0 +1,83 @@
+package api
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/webhook"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// webhookSubscribers subscribes one test server to every event
+type webhookSubscribers struct {
+	url string
+}
+
+func (s webhookSubscribers) ListWebhookSubscriptions(ctx context.Context, event string) ([]db.WebhookSubscription, error) {
+	return []db.WebhookSubscription{{ID: uuid.New(), URL: s.url, Secret: "s3cret"}}, nil
+}
+
+func (s webhookSubscribers) CreateWebhookDeadLetter(ctx context.Context, d *db.WebhookDeadLetter) error {
+	return nil
+}
+
+func TestSetContentEnabledPublishesWebhook(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	deliveries := make(chan webhook.Payload, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhook.Payload
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &payload)
+		deliveries <- payload
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dispatcher := webhook.NewDispatcher(webhookSubscribers{url: server.URL}, 1, time.Millisecond, 1)
+	dispatcher.SetAllowPrivateTargets(true)
+	go dispatcher.Run(ctx)
+
+	key := "test/" + uuid.New().String() + ".bin"
+	content := &db.Content{
+		Name:       "Webhook Content",
+		Type:       "test",
+		Version:    "1.0",
+		FilePath:   key,
+		Size:       4,
+		StorageKey: sql.NullString{String: key, Valid: true},
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("Failed to create content: %v", err)
+	}
+
+	admin := NewAdminHandler(store, nil)
+	admin.SetWebhooks(dispatcher)
+	for _, enabled := range []bool{false, true} {
+		rr := httptest.NewRecorder()
+		admin.SetContentEnabled(rr, httptest.NewRequest(http.MethodPost,
+			"/api/admin/content/enable?id="+content.ID.String()+"&enabled="+strconv.FormatBool(enabled), nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		select {
+		case payload := <-deliveries:
+			if payload.Event != webhook.EventContentUpdated || payload.Content.ID != content.ID || payload.Content.Enabled != enabled {
+				t.Errorf("Unexpected delivery for enabled=%t: %+v", enabled, payload)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("No webhook delivered for enabled=%t", enabled)
+		}
+	}
+}
@@ -5,12 +5,25 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
+// DefaultTimeout bounds a FundaVault request when the config sets none
+const DefaultTimeout = 5 * time.Second
+
+// ErrTimeout is returned by VerifyDevice when FundaVault does not answer
+// within the client timeout or before the caller's context is done
+var ErrTimeout = errors.New("fundavault request timed out")
+
 type FundaVaultClient struct {
 	config *config.Config
 	client *http.Client
@@ -22,20 +35,70 @@ type DeviceVerifyResponse struct {
 	Email           string `json:"email"`
 	IsAdmin         bool   `json:"is_admin"`
 	SubscriptionEnd string `json:"subscription_end,omitempty"`
+	// DeviceStatus is "active", "inactive" or "revoked"; older FundaVault
+	// releases omit it
+	DeviceStatus string `json:"device_status,omitempty"`
+	// DeviceUUID is FundaVault's ID for the device. Download records are
+	// keyed on it rather than on the hardware hash. VerifyDevice derives it
+	// with DeviceUUID when FundaVault leaves it out.
+	DeviceUUID string `json:"device_uuid,omitempty"`
+}
+
+// deviceUUIDNamespace is the UUIDv5 namespace FundaVault derives device
+// UUIDs in; see app/core/device_uuid.py
+var deviceUUIDNamespace = uuid.NewSHA1(uuid.NameSpaceDNS, []byte("devices.fundai"))
+
+// DeviceUUID returns the UUID FundaVault reports for a hardware hash, so
+// records stay keyed the same whether or not a release sends it
+func DeviceUUID(hardwareID string) string {
+	return uuid.NewSHA1(deviceUUIDNamespace, []byte(strings.ToLower(strings.TrimSpace(hardwareID)))).String()
+}
+
+// Device statuses reported by FundaVault that must be refused immediately
+const (
+	DeviceStatusInactive = "inactive"
+	DeviceStatusRevoked  = "revoked"
+)
+
+// DeviceDisabled reports whether FundaVault has switched the device off,
+// even though it still authenticated it
+func (r *DeviceVerifyResponse) DeviceDisabled() bool {
+	return r.DeviceStatus == DeviceStatusInactive || r.DeviceStatus == DeviceStatusRevoked
+}
+
+// RateLimitedError is returned by VerifyDevice when FundaVault answers 429.
+// RetryAfter is FundaVault's Retry-After header, empty if it sent none.
+type RateLimitedError struct {
+	RetryAfter string
+}
+
+func (e *RateLimitedError) Error() string {
+	if e.RetryAfter == "" {
+		return "fundavault rate limited the request"
+	}
+	return fmt.Sprintf("fundavault rate limited the request; retry after %s", e.RetryAfter)
 }
 
 type DeviceVerifyRequest struct {
 	HardwareID string `json:"hardware_id"`
 }
 
+// NewFundaVaultClient returns a client whose requests give up after
+// cfg.FundaVaultTimeout, or DefaultTimeout when that is unset
 func NewFundaVaultClient(cfg *config.Config) *FundaVaultClient {
+	timeout := cfg.FundaVaultTimeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
 	return &FundaVaultClient{
 		config: cfg,
-		client: &http.Client{},
+		client: &http.Client{Timeout: timeout},
 	}
 }
 
-func (f *FundaVaultClient) VerifyDevice(hardwareID string) (*DeviceVerifyResponse, int, error) {
+// VerifyDevice asks FundaVault who a device belongs to. The request is
+// abandoned with ErrTimeout once ctx is done or the client timeout passes.
+func (f *FundaVaultClient) VerifyDevice(ctx context.Context, hardwareID string) (*DeviceVerifyResponse, int, error) {
 	endpoint := fmt.Sprintf("%s/api/v1/auth/device", f.config.FundaVaultURL)
 
 	requestPayload := DeviceVerifyRequest{HardwareID: hardwareID}
@@ -44,7 +107,7 @@ func (f *FundaVaultClient) VerifyDevice(hardwareID string) (*DeviceVerifyRespons
 		return nil, 0, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(context.Background(), "POST", endpoint, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to create verify device request: %w", err)
 	}
@@ -57,6 +120,9 @@ func (f *FundaVaultClient) VerifyDevice(hardwareID string) (*DeviceVerifyRespons
 	resp, err := f.client.Do(req)
 	if err != nil {
 		log.Printf("[FundaVaultClient] Error sending request to FundaVault: %v", err)
+		if isTimeout(ctx, err) {
+			return nil, 0, fmt.Errorf("%w: %v", ErrTimeout, err)
+		}
 		return nil, 0, fmt.Errorf("failed to send request to FundaVault: %w", err)
 	}
 	defer resp.Body.Close()
@@ -70,6 +136,9 @@ func (f *FundaVaultClient) VerifyDevice(hardwareID string) (*DeviceVerifyRespons
 		log.Printf("[FundaVaultClient] Received response body: %s", string(responseBodyBytes))
 	}
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, resp.StatusCode, &RateLimitedError{RetryAfter: resp.Header.Get("Retry-After")}
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, resp.StatusCode, fmt.Errorf("fundavault verification failed with status %d", resp.StatusCode)
 	}
@@ -79,6 +148,43 @@ func (f *FundaVaultClient) VerifyDevice(hardwareID string) (*DeviceVerifyRespons
 		log.Printf("[FundaVaultClient] Error decoding successful response body: %v", err)
 		return nil, http.StatusInternalServerError, fmt.Errorf("failed to decode successful fundavault response: %w", err)
 	}
+	// Releases before device_uuid was added leave it out
+	if result.DeviceUUID == "" {
+		result.DeviceUUID = DeviceUUID(hardwareID)
+	}
 
 	return &result, resp.StatusCode, nil
 }
+
+// Ping checks FundaVault is reachable. Any answer below 500 counts, since
+// the service has no dedicated health route.
+func (f *FundaVaultClient) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.config.FundaVaultURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create ping request: %w", err)
+	}
+	req.Header.Set("X-Calling-Service", "FundAIHub")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if isTimeout(ctx, err) {
+			return fmt.Errorf("%w: %v", ErrTimeout, err)
+		}
+		return fmt.Errorf("failed to reach FundaVault: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("fundavault answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// isTimeout reports whether a failed request ran out of time, either on the
+// client's own timeout or because ctx was cancelled or expired
+func isTimeout(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
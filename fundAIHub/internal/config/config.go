@@ -1,8 +1,11 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Environment string
@@ -15,6 +18,187 @@ const (
 type Config struct {
 	Environment   Environment
 	FundaVaultURL string
+	// FundaVaultTimeout bounds each device verification request. Zero uses
+	// the client's default of 5s.
+	FundaVaultTimeout time.Duration
+	// DeviceVerifyCacheSize and DeviceVerifyCacheTTL bound the in-memory
+	// cache of FundaVault verifications. Zero for either disables it.
+	DeviceVerifyCacheSize int
+	DeviceVerifyCacheTTL  time.Duration
+	// SignedURLPinVersion pins signed download URLs to the content revision
+	// they were issued for, so in-place updates invalidate older links.
+	SignedURLPinVersion bool
+	// SignedURLClockSkew extends every signed URL's validity by this much
+	// to absorb clock drift. Zero means URLs expire exactly on time.
+	SignedURLClockSkew time.Duration
+	// URLSigningKey signs new download URLs. URLSigningPreviousKeys are
+	// retired keys whose URLs are still accepted until they are removed.
+	URLSigningKey          string
+	URLSigningPreviousKeys []string
+	// DefaultContentTypes maps an app_type to the MIME type assumed for
+	// uploads that arrive without a specific Content-Type.
+	DefaultContentTypes map[string]string
+	// ContentTypeOverridesByExt and ContentTypeOverridesByAppType force the
+	// Content-Type served for signed downloads, correcting mislabelled
+	// records without changing the database. Extensions are lower case and
+	// include the dot; an extension match wins over an app_type match.
+	ContentTypeOverridesByExt     map[string]string
+	ContentTypeOverridesByAppType map[string]string
+	// MaxActiveDownloadsPerDevice caps how many downloads a device should
+	// have in progress at once.
+	MaxActiveDownloadsPerDevice int
+	// MaxActiveDownloadsPerUser caps transferring downloads across all of
+	// a user's devices. Zero disables the cap.
+	MaxActiveDownloadsPerUser int
+	// DownloadLimitsExemptAdmins lets admin devices start downloads past
+	// both active download limits
+	DownloadLimitsExemptAdmins bool
+	// ProgressPersistMinBytes and ProgressPersistInterval throttle progress
+	// writes: an update that does not change status is only written once
+	// bytes advance by the delta or the interval has passed since the last
+	// write.
+	ProgressPersistMinBytes int64
+	ProgressPersistInterval time.Duration
+	// ContentCacheSize and ContentCacheTTL bound the in-memory cache of
+	// content metadata. A size of zero disables the cache.
+	ContentCacheSize int
+	ContentCacheTTL  time.Duration
+	// StorageKeyLayout is "flat" or "hierarchical"; see storage.KeyLayout
+	StorageKeyLayout string
+	// StorageBackend names the backend new uploads are stored in. Content
+	// records keep the name of the backend they were stored in.
+	StorageBackend string
+	// LocalStorageRoot is the directory of the "local" backend, which is
+	// only available when it is set
+	LocalStorageRoot string
+	// S3Endpoint, S3Region, S3Bucket and the S3 credentials configure the
+	// "s3" backend, which is only available when S3Bucket is set. An empty
+	// endpoint uses AWS S3 in the region.
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	// WebhookMaxAttempts and WebhookRetryDelay control webhook redelivery;
+	// the delay doubles after each failed attempt.
+	WebhookMaxAttempts int
+	WebhookRetryDelay  time.Duration
+
+	// WebhookWorkers is how many webhook deliveries run at once.
+	// WebhookAllowPrivateTargets lets webhooks reach loopback, private and
+	// link-local addresses, which are refused by default.
+	WebhookWorkers             int
+	WebhookAllowPrivateTargets bool
+	// MirrorSupabaseURL, when set, enables a mirror bucket that serves
+	// downloads the primary cannot and is kept populated every
+	// MirrorReplicationInterval.
+	MirrorSupabaseURL         string
+	MirrorSupabaseKey         string
+	MirrorBucket              string
+	MirrorReplicationInterval time.Duration
+	// ArchiveSupabaseURL, when set, enables a cold-storage bucket that
+	// content can be archived to. Downloads of archived content are
+	// answered 202 with RehydrationRetryAfter while it is restored.
+	ArchiveSupabaseURL    string
+	ArchiveSupabaseKey    string
+	ArchiveBucket         string
+	RehydrationRetryAfter time.Duration
+	// ChecksumVerifyInterval is how often stored objects are re-hashed and
+	// compared to their recorded checksum. Zero disables the periodic job.
+	ChecksumVerifyInterval time.Duration
+	// MissingObjectStatus is the status returned for a signed download whose
+	// record exists but whose storage object does not (410 or 502).
+	// FlagMissingObjects also marks such records storage_state=missing.
+	MissingObjectStatus int
+	FlagMissingObjects  bool
+	// AdminDeviceViewsPerMinute caps how often one admin may view a device
+	// as that device would see the catalog
+	AdminDeviceViewsPerMinute int
+	// UploadMaxFormParts and UploadMaxFormFieldBytes bound a multipart
+	// upload: the number of parts, and the bytes across all non-file fields
+	UploadMaxFormParts      int
+	UploadMaxFormFieldBytes int64
+	// UploadMaxBytes caps the size of an upload, whether one /upload
+	// request body or a chunked upload's declared size. Zero leaves it
+	// unlimited.
+	UploadMaxBytes int64
+	// UploadSessionTTL is how long a chunked upload may take from start to
+	// finalize. Expired sessions are refused, and every
+	// UploadSessionCleanupInterval their chunks are deleted; a zero
+	// interval disables the cleanup.
+	UploadSessionTTL             time.Duration
+	UploadSessionCleanupInterval time.Duration
+	// ContentNotReadyRetryAfter is the Retry-After sent when content is
+	// temporarily unavailable
+	ContentNotReadyRetryAfter time.Duration
+	// DBQueryTimeout bounds each database call made through the content
+	// store. Zero leaves calls bounded only by the request.
+	DBQueryTimeout time.Duration
+	// StorageRetryAttempts and StorageRetryDelay govern retries when
+	// opening a download from storage fails transiently, and how many times
+	// a broken stream may be resumed. The delay doubles after each try.
+	StorageRetryAttempts int
+	StorageRetryDelay    time.Duration
+	// SupabaseRetryAttempts and SupabaseRetryDelay govern retries of
+	// individual Supabase requests that fail in transit or with a 5xx; the
+	// delay doubles, with jitter, after each try. Uploads and deletes are
+	// only retried if SupabaseRetryWrites is set.
+	SupabaseRetryAttempts int
+	SupabaseRetryDelay    time.Duration
+	SupabaseRetryWrites   bool
+	// StorageListPageSize is how many objects are requested per call when
+	// listing the bucket
+	StorageListPageSize int
+	// StorageMaxConcurrentReads caps signed downloads reading from storage
+	// at once; others wait their turn, taken round-robin across content.
+	// Zero leaves reads unbounded.
+	StorageMaxConcurrentReads int
+	// DownloadTransforms are the built-in transformers signed downloads may
+	// ask for with ?transform=; none are enabled by default
+	DownloadTransforms []string
+	// DownloadRetention is how long finished downloads are kept before a
+	// purge deletes them. DownloadPurgeInterval is how often the purge runs
+	// on its own; zero leaves it to the admin endpoint.
+	DownloadRetention     time.Duration
+	DownloadPurgeInterval time.Duration
+	// StaleDownloadAfter is how long an unfinished download may go without
+	// an update before it is marked stale. StaleDownloadCheckInterval is how
+	// often that is checked; zero disables the check.
+	StaleDownloadAfter         time.Duration
+	StaleDownloadCheckInterval time.Duration
+	// EmbedTokenSecret signs embed tokens for routes that accept them in
+	// place of a Device-ID; empty disables them. EmbedTokenMaxTTL caps the
+	// lifetime an admin may request for one.
+	EmbedTokenSecret string
+	EmbedTokenMaxTTL time.Duration
+	// MetricsEnabled serves /metrics and counts requests by route. With
+	// MetricsAddr set, /metrics is served alone on that address; otherwise
+	// it is on the API listener and admin only.
+	MetricsEnabled bool
+	MetricsAddr    string
+	// ReadinessTimeout bounds each dependency check made by /readyz
+	ReadinessTimeout time.Duration
+	// ShutdownTimeout is how long in-flight requests may run after
+	// SIGTERM/SIGINT before their connections are closed
+	ShutdownTimeout time.Duration
+	// CORSAllowedOrigins are the browser origins allowed to call the API;
+	// empty keeps the same-origin policy. The methods and headers lists
+	// fall back to the middleware's defaults when empty.
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+	// RateLimitPerMinute is how many requests an authenticated device may
+	// make a minute, in bursts of up to RateLimitBurst; zero disables it
+	RateLimitPerMinute int
+	RateLimitBurst     int
+	// DownloadVerifyChecksums hashes whole signed downloads as they stream
+	// and reports any not matching the recorded checksum.
+	// DownloadVerifyMaxBytes is the largest file verify=true buffers and
+	// checks before sending.
+	DownloadVerifyChecksums bool
+	DownloadVerifyMaxBytes  int64
 }
 
 // GetConfig returns configuration based on the environment
@@ -22,13 +206,115 @@ func GetConfig() *Config {
 	env := getEnvironment()
 
 	config := &Config{
-		Environment:   env,
-		FundaVaultURL: getFundaVaultURL(env),
+		Environment:         env,
+		FundaVaultURL:       getFundaVaultURL(env),
+		FundaVaultTimeout:   getEnvDuration("FUNDAVAULT_TIMEOUT", 5*time.Second),
+		SignedURLPinVersion: getEnvBool("SIGNED_URL_PIN_VERSION", true),
+		SignedURLClockSkew:  getEnvDuration("SIGNED_URL_CLOCK_SKEW", 0),
+		DefaultContentTypes: getDefaultContentTypes(),
+
+		ContentTypeOverridesByExt:     getExtensionOverrides(),
+		ContentTypeOverridesByAppType: ParseKeyValueList(os.Getenv("CONTENT_TYPE_OVERRIDES_BY_APP_TYPE")),
+
+		URLSigningKey:          os.Getenv("URL_SIGNING_KEY"),
+		URLSigningPreviousKeys: getEnvList("URL_SIGNING_PREVIOUS_KEYS"),
+
+		MaxActiveDownloadsPerDevice: getEnvInt("MAX_ACTIVE_DOWNLOADS_PER_DEVICE", 3),
+		MaxActiveDownloadsPerUser:   getEnvInt("MAX_ACTIVE_DOWNLOADS_PER_USER", 10),
+		DownloadLimitsExemptAdmins:  getEnvBool("DOWNLOAD_LIMITS_EXEMPT_ADMINS", false),
+		ProgressPersistMinBytes:     int64(getEnvInt("PROGRESS_PERSIST_MIN_BYTES", 1<<20)),
+		ProgressPersistInterval:     getEnvDuration("PROGRESS_PERSIST_INTERVAL", 5*time.Second),
+		ContentCacheSize:            getEnvInt("CONTENT_CACHE_SIZE", 256),
+		ContentCacheTTL:             getEnvDuration("CONTENT_CACHE_TTL", 30*time.Second),
+		DeviceVerifyCacheSize:       getEnvInt("DEVICE_VERIFY_CACHE_SIZE", 1024),
+		DeviceVerifyCacheTTL:        getEnvDuration("DEVICE_VERIFY_CACHE_TTL", 60*time.Second),
+		StorageKeyLayout:            os.Getenv("STORAGE_KEY_LAYOUT"),
+		StorageBackend:              getEnvString("STORAGE_BACKEND", "supabase"),
+		LocalStorageRoot:            os.Getenv("LOCAL_STORAGE_ROOT"),
+		S3Endpoint:                  os.Getenv("S3_ENDPOINT"),
+		S3Region:                    getEnvString("S3_REGION", "us-east-1"),
+		S3Bucket:                    os.Getenv("S3_BUCKET"),
+		S3AccessKeyID:               os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey:           os.Getenv("S3_SECRET_ACCESS_KEY"),
+		WebhookMaxAttempts:          getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5),
+		WebhookRetryDelay:           getEnvDuration("WEBHOOK_RETRY_DELAY", 2*time.Second),
+
+		WebhookWorkers:             getEnvInt("WEBHOOK_WORKERS", 4),
+		WebhookAllowPrivateTargets: getEnvBool("WEBHOOK_ALLOW_PRIVATE_TARGETS", false),
+
+		MirrorSupabaseURL:         os.Getenv("MIRROR_SUPABASE_URL"),
+		MirrorSupabaseKey:         os.Getenv("MIRROR_SUPABASE_KEY"),
+		MirrorBucket:              getEnvString("MIRROR_BUCKET", "content"),
+		MirrorReplicationInterval: getEnvDuration("MIRROR_REPLICATION_INTERVAL", 15*time.Minute),
+
+		ArchiveSupabaseURL:    os.Getenv("ARCHIVE_SUPABASE_URL"),
+		ArchiveSupabaseKey:    os.Getenv("ARCHIVE_SUPABASE_KEY"),
+		ArchiveBucket:         getEnvString("ARCHIVE_BUCKET", "archive"),
+		RehydrationRetryAfter: getEnvDuration("REHYDRATION_RETRY_AFTER", time.Minute),
+
+		UploadSessionTTL:             getEnvDuration("UPLOAD_SESSION_TTL", 24*time.Hour),
+		UploadSessionCleanupInterval: getEnvDuration("UPLOAD_SESSION_CLEANUP_INTERVAL", time.Hour),
+
+		ChecksumVerifyInterval: getEnvDuration("CHECKSUM_VERIFY_INTERVAL", 0),
+		MissingObjectStatus:    getEnvInt("MISSING_OBJECT_STATUS", 410),
+		FlagMissingObjects:     getEnvBool("FLAG_MISSING_OBJECTS", true),
+
+		AdminDeviceViewsPerMinute: getEnvInt("ADMIN_DEVICE_VIEWS_PER_MINUTE", 30),
+		UploadMaxFormParts:        getEnvInt("UPLOAD_MAX_FORM_PARTS", 32),
+		UploadMaxFormFieldBytes:   int64(getEnvInt("UPLOAD_MAX_FORM_FIELD_BYTES", 64<<10)),
+		UploadMaxBytes:            int64(getEnvInt("UPLOAD_MAX_BYTES", 0)),
+		ContentNotReadyRetryAfter: getEnvDuration("CONTENT_NOT_READY_RETRY_AFTER", 30*time.Second),
+		DBQueryTimeout:            getEnvDuration("DB_QUERY_TIMEOUT", 5*time.Second),
+		StorageRetryAttempts:      getEnvInt("STORAGE_RETRY_ATTEMPTS", 3),
+		StorageRetryDelay:         getEnvDuration("STORAGE_RETRY_DELAY", 200*time.Millisecond),
+		SupabaseRetryAttempts:     getEnvInt("SUPABASE_RETRY_ATTEMPTS", 3),
+		SupabaseRetryDelay:        getEnvDuration("SUPABASE_RETRY_DELAY", 100*time.Millisecond),
+		SupabaseRetryWrites:       getEnvBool("SUPABASE_RETRY_WRITES", false),
+		StorageListPageSize:       getEnvInt("STORAGE_LIST_PAGE_SIZE", 1000),
+		StorageMaxConcurrentReads: getEnvInt("STORAGE_MAX_CONCURRENT_READS", 0),
+		DownloadTransforms:        getEnvList("DOWNLOAD_TRANSFORMS"),
+		DownloadRetention:         getEnvDuration("DOWNLOAD_RETENTION", 90*24*time.Hour),
+		DownloadPurgeInterval:     getEnvDuration("DOWNLOAD_PURGE_INTERVAL", 0),
+
+		StaleDownloadAfter:         getEnvDuration("STALE_DOWNLOAD_AFTER", 7*24*time.Hour),
+		StaleDownloadCheckInterval: getEnvDuration("STALE_DOWNLOAD_CHECK_INTERVAL", time.Hour),
+
+		EmbedTokenSecret: os.Getenv("EMBED_TOKEN_SECRET"),
+		EmbedTokenMaxTTL: getEnvDuration("EMBED_TOKEN_MAX_TTL", 24*time.Hour),
+
+		MetricsEnabled: getEnvBool("METRICS_ENABLED", true),
+		MetricsAddr:    os.Getenv("METRICS_ADDR"),
+
+		ReadinessTimeout: getEnvDuration("READINESS_TIMEOUT", 2*time.Second),
+
+		ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+
+		CORSAllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS"),
+		CORSAllowedMethods:   getEnvList("CORS_ALLOWED_METHODS"),
+		CORSAllowedHeaders:   getEnvList("CORS_ALLOWED_HEADERS"),
+		CORSAllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAge:           getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+
+		RateLimitPerMinute: getEnvInt("RATE_LIMIT_PER_MINUTE", 300),
+		RateLimitBurst:     getEnvInt("RATE_LIMIT_BURST", 60),
+
+		DownloadVerifyChecksums: getEnvBool("DOWNLOAD_VERIFY_CHECKSUMS", false),
+		DownloadVerifyMaxBytes:  int64(getEnvInt("DOWNLOAD_VERIFY_MAX_BYTES", 32<<20)),
 	}
 
 	return config
 }
 
+// Validate reports settings the server must not start without. Outside
+// development a signing key is required, since links signed with a
+// well-known or per-process key are either forgeable or break on restart.
+func (c *Config) Validate() error {
+	if c.Environment != Development && c.URLSigningKey == "" {
+		return errors.New("URL_SIGNING_KEY must be set outside development")
+	}
+	return nil
+}
+
 func getEnvironment() Environment {
 	// Render sets this environment variable
 	if os.Getenv("RENDER") != "" {
@@ -51,3 +337,104 @@ func getFundaVaultURL(env Environment) string {
 		return "http://localhost:8000" // Default local FundaVault port
 	}
 }
+
+// getEnvString reads an environment variable, falling back to def when unset
+func getEnvString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// getEnvList reads a comma-separated environment variable, dropping empty
+// entries
+func getEnvList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// getEnvBool reads a boolean environment variable, falling back to def when
+// the variable is unset or cannot be parsed.
+func getEnvBool(key string, def bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+// getEnvInt reads an integer environment variable, falling back to def when
+// the variable is unset or cannot be parsed.
+func getEnvInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// getEnvDuration reads a duration such as "30s" or "5m" from the
+// environment, falling back to def when unset or invalid.
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
+
+// getDefaultContentTypes returns the built-in app_type to MIME type mapping,
+// extended or overridden by DEFAULT_CONTENT_TYPES. The variable holds a
+// comma-separated list of app_type=mime/type pairs, for example:
+//
+//	DEFAULT_CONTENT_TYPES="linux-app=application/x-executable,ebook=application/epub+zip"
+//
+// Malformed pairs are ignored.
+func getDefaultContentTypes() map[string]string {
+	types := map[string]string{
+		"linux-app": "application/x-executable",
+		"document":  "application/pdf",
+	}
+	for app, mime := range ParseKeyValueList(os.Getenv("DEFAULT_CONTENT_TYPES")) {
+		types[app] = mime
+	}
+	return types
+}
+
+// getExtensionOverrides reads CONTENT_TYPE_OVERRIDES_BY_EXT, e.g.
+// ".appimage=application/vnd.appimage,.deb=application/vnd.debian.binary-package",
+// normalising extensions to lower case with a leading dot.
+func getExtensionOverrides() map[string]string {
+	out := make(map[string]string)
+	for ext, mime := range ParseKeyValueList(os.Getenv("CONTENT_TYPE_OVERRIDES_BY_EXT")) {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		out[ext] = mime
+	}
+	return out
+}
+
+// ParseKeyValueList parses "key=value,key=value" into a map, trimming
+// whitespace and skipping entries without a key or value.
+func ParseKeyValueList(raw string) map[string]string {
+	out := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			continue
+		}
+		out[key] = value
+	}
+	return out
+}
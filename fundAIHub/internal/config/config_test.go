@@ -0,0 +1,41 @@
+package config
+
+import "testing"
+
+func TestDefaultContentTypesFromEnv(t *testing.T) {
+	t.Setenv("DEFAULT_CONTENT_TYPES", "ebook=application/epub+zip, linux-app = application/x-appimage ,broken")
+
+	types := GetConfig().DefaultContentTypes
+
+	if got := types["ebook"]; got != "application/epub+zip" {
+		t.Errorf("Expected ebook mapping from env, got %q", got)
+	}
+	if got := types["linux-app"]; got != "application/x-appimage" {
+		t.Errorf("Expected env to override linux-app default, got %q", got)
+	}
+	if got := types["document"]; got != "application/pdf" {
+		t.Errorf("Expected built-in document default to remain, got %q", got)
+	}
+	if _, ok := types["broken"]; ok {
+		t.Error("Malformed pair should be ignored")
+	}
+}
+
+func TestValidateRequiresSigningKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"Production without key", Config{Environment: Production}, true},
+		{"Production with key", Config{Environment: Production, URLSigningKey: "secret"}, false},
+		{"Development without key", Config{Environment: Development}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BeginRehydration moves archived content to rehydrating and reports whether
+// this call did so, along with the start time that identifies the restore.
+// Only the caller that gets true should start a restore, so concurrent
+// downloads of archived content trigger exactly one. A restore begun more
+// than staleAfter ago is presumed lost, e.g. to a restart, and is taken over.
+func (s *ContentStore) BeginRehydration(ctx context.Context, id uuid.UUID, staleAfter time.Duration) (_ time.Time, _ bool, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	if staleAfter <= 0 {
+		return time.Time{}, false, fmt.Errorf("stale threshold must be positive, got %s", staleAfter)
+	}
+
+	var startedAt time.Time
+	err = s.db.QueryRowContext(ctx, `
+		UPDATE content
+		SET storage_state = 'rehydrating', rehydration_requested_at = NOW(), rehydration_error = NULL
+		WHERE id = $1
+		  AND (storage_state = 'archived'
+		       OR (storage_state = 'rehydrating' AND rehydration_requested_at < $2))
+		RETURNING rehydration_requested_at`,
+		id, time.Now().Add(-staleAfter)).Scan(&startedAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	s.invalidate(id)
+	return startedAt, true, nil
+}
+
+// FinishRehydration records the outcome of the restore begun at startedAt.
+// On success the record is back in hot storage; on failure it returns to
+// archived with the error, so the next download tries again. A restore that
+// was taken over as stale finds no row and gets sql.ErrNoRows.
+func (s *ContentStore) FinishRehydration(ctx context.Context, id uuid.UUID, startedAt time.Time, restoreErr error) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	var result sql.Result
+	if restoreErr == nil {
+		result, err = s.db.ExecContext(ctx, `
+			UPDATE content SET storage_state = NULL, rehydration_error = NULL
+			WHERE id = $1 AND storage_state = 'rehydrating' AND rehydration_requested_at = $2`, id, startedAt)
+	} else {
+		result, err = s.db.ExecContext(ctx, `
+			UPDATE content SET storage_state = 'archived', rehydration_error = $3
+			WHERE id = $1 AND storage_state = 'rehydrating' AND rehydration_requested_at = $2`, id, startedAt, restoreErr.Error())
+	}
+	if err != nil {
+		return err
+	}
+	s.invalidate(id)
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package db
+
+import "context"
+
+// CreateAuditEntry records an admin action
+func (s *ContentStore) CreateAuditEntry(ctx context.Context, entry *AuditEntry) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		INSERT INTO admin_audit_log (admin_user_id, admin_email, action, target)
+		VALUES ($1, NULLIF($2, ''), $3, $4)
+		RETURNING id, created_at`
+
+	return s.db.QueryRowContext(ctx, query, entry.AdminUserID, entry.AdminEmail, entry.Action, entry.Target).
+		Scan(&entry.ID, &entry.CreatedAt)
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"FundAIHub/internal/metrics"
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	contentCacheHits   = metrics.NewCounter("fundaihub_content_cache_hits_total", "Content lookups served from the cache.")
+	contentCacheMisses = metrics.NewCounter("fundaihub_content_cache_misses_total", "Content lookups that went to the database.")
+	_                  = metrics.NewGaugeFunc("fundaihub_content_cache_hit_ratio", "Fraction of content lookups served from the cache.", func() float64 {
+		hits, misses := float64(contentCacheHits.Value()), float64(contentCacheMisses.Value())
+		if hits+misses == 0 {
+			return 0
+		}
+		return hits / (hits + misses)
+	})
+)
+
+type cacheEntry struct {
+	id        uuid.UUID
+	content   Content
+	expiresAt time.Time
+}
+
+// contentCache is a size-bounded LRU of content records whose entries also
+// expire after a fixed TTL.
+type contentCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // front is most recently used
+	entries map[uuid.UUID]*list.Element
+	now     func() time.Time
+	// gen counts invalidations, so a fill read before one is not stored
+	gen uint64
+}
+
+func newContentCache(size int, ttl time.Duration) *contentCache {
+	return &contentCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[uuid.UUID]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// get returns a copy of the cached record so callers cannot mutate the cache
+func (c *contentCache) get(id uuid.UUID) (*Content, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[id]
+	if !ok {
+		contentCacheMisses.Inc()
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if c.now().After(entry.expiresAt) {
+		c.order.Remove(el)
+		delete(c.entries, id)
+		contentCacheMisses.Inc()
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	contentCacheHits.Inc()
+	content := entry.content
+	return &content, true
+}
+
+// generation is taken before a record is read from the database for fill
+func (c *contentCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// fill stores a record read from the database, unless a write was
+// invalidated since gen was taken: the record may predate that write, and
+// caching it would serve stale data until the TTL
+func (c *contentCache) fill(content *Content, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return
+	}
+	c.store(content)
+}
+
+// store adds or refreshes content; c.mu must be held
+func (c *contentCache) store(content *Content) {
+	if el, ok := c.entries[content.ID]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.content = *content
+		entry.expiresAt = c.now().Add(c.ttl)
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[content.ID] = c.order.PushFront(&cacheEntry{
+		id:        content.ID,
+		content:   *content,
+		expiresAt: c.now().Add(c.ttl),
+	})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).id)
+	}
+}
+
+func (c *contentCache) invalidate(id uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if el, ok := c.entries[id]; ok {
+		c.order.Remove(el)
+		delete(c.entries, id)
+	}
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestContentCache(t *testing.T) {
+	now := time.Now()
+	cache := newContentCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	a := &Content{ID: uuid.New(), Name: "a"}
+	b := &Content{ID: uuid.New(), Name: "b"}
+	c := &Content{ID: uuid.New(), Name: "c"}
+
+	t.Run("Returns copies", func(t *testing.T) {
+		cache.fill(a, cache.generation())
+		got, ok := cache.get(a.ID)
+		if !ok {
+			t.Fatal("Expected cache hit")
+		}
+		got.Name = "mutated"
+		if again, _ := cache.get(a.ID); again.Name != "a" {
+			t.Errorf("Cached record was mutated through returned pointer: %q", again.Name)
+		}
+	})
+
+	t.Run("Evicts least recently used", func(t *testing.T) {
+		cache.fill(b, cache.generation())
+		cache.get(a.ID) // a is now more recent than b
+		cache.fill(c, cache.generation())
+
+		if _, ok := cache.get(b.ID); ok {
+			t.Error("Expected b to be evicted")
+		}
+		if _, ok := cache.get(a.ID); !ok {
+			t.Error("Expected a to remain cached")
+		}
+	})
+
+	t.Run("Invalidate removes entry", func(t *testing.T) {
+		cache.invalidate(a.ID)
+		if _, ok := cache.get(a.ID); ok {
+			t.Error("Expected a to be gone after invalidate")
+		}
+	})
+
+	t.Run("Fill read before an invalidate is dropped", func(t *testing.T) {
+		gen := cache.generation()
+		cache.invalidate(b.ID) // a write lands while b is read
+		cache.fill(b, gen)
+		if _, ok := cache.get(b.ID); ok {
+			t.Error("Expected the possibly stale fill not to be cached")
+		}
+	})
+
+	t.Run("Entries expire after TTL", func(t *testing.T) {
+		cache.fill(a, cache.generation())
+		now = now.Add(2 * time.Minute)
+		if _, ok := cache.get(a.ID); ok {
+			t.Error("Expected expired entry to miss")
+		}
+	})
+}
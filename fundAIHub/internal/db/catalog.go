@@ -0,0 +1,16 @@
+package db
+
+import "context"
+
+// CatalogVersion returns a number that grows with every change to content
+// that clients see in the catalog, maintained by triggers. Download counts,
+// storage state and verification do not move it. Two equal values mean the
+// catalog is unchanged in between.
+func (s *ContentStore) CatalogVersion(ctx context.Context) (_ int64, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	var version int64
+	err = s.db.QueryRowContext(ctx, `SELECT version FROM catalog_version`).Scan(&version)
+	return version, err
+}
@@ -1,14 +1,18 @@
 package db
 
 import (
+	"FundAIHub/internal/semver"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // Config simplified to just use connection string
@@ -43,7 +47,9 @@ func NewConnection(cfg Config) (*sql.DB, error) {
 
 // ContentStore handles database operations for content
 type ContentStore struct {
-	db *sql.DB
+	db           *sql.DB
+	cache        *contentCache
+	queryTimeout time.Duration
 }
 
 // NewContentStore creates a new ContentStore
@@ -51,11 +57,129 @@ func NewContentStore(db *sql.DB) *ContentStore {
 	return &ContentStore{db: db}
 }
 
-// List returns all content from the database
-func (s *ContentStore) List(ctx context.Context) ([]Content, error) {
-	query := `SELECT id, name, type, version, file_path, size, created_at, updated_at FROM content`
+// EnableCache turns on a read-through cache for Get holding up to size
+// records for at most ttl. Writes through this store evict the affected
+// record immediately. A size or ttl of zero leaves caching disabled.
+func (s *ContentStore) EnableCache(size int, ttl time.Duration) {
+	if size <= 0 || ttl <= 0 {
+		s.cache = nil
+		return
+	}
+	s.cache = newContentCache(size, ttl)
+}
 
-	rows, err := s.db.QueryContext(ctx, query)
+func (s *ContentStore) invalidate(id uuid.UUID) {
+	if s.cache != nil {
+		s.cache.invalidate(id)
+	}
+}
+
+// Content list orderings accepted by List
+const (
+	SortName       = "name"       // A to Z
+	SortCreatedAt  = "created_at" // Newest first
+	SortSize       = "size"       // Smallest first
+	SortPopularity = "popularity" // Most completed downloads first
+)
+
+// contentSortClauses maps each ordering to its ORDER BY clause. Only these
+// strings are ever interpolated into a query.
+var contentSortClauses = map[string]string{
+	SortName:       "name, id",
+	SortCreatedAt:  "created_at DESC, id",
+	SortSize:       "size, id",
+	SortPopularity: "download_count DESC, name, id",
+}
+
+// ValidContentSort reports whether sort is an ordering List accepts
+func ValidContentSort(sort string) bool {
+	_, ok := contentSortClauses[sort]
+	return ok
+}
+
+// ErrInvalidSort is returned by List for an unknown ordering
+var ErrInvalidSort = errors.New("invalid sort order")
+
+// listColumns are the columns List returns: everything Get does, plus the
+// description and download count
+const listColumns = `id, name, type, version, COALESCE(description, ''), COALESCE(app_version, ''), COALESCE(app_type, ''),
+	                 file_path, size, storage_key, content_type, COALESCE(content_encoding, ''), checksum,
+	                 COALESCE(license, ''), COALESCE(license_url, ''), created_at, updated_at,
+	                 last_verified_at, verification_status, storage_state, storage_backend,
+	                 rehydration_requested_at, COALESCE(rehydration_error, ''), enabled, download_count, deleted_at`
+
+// ListOptions selects a page of content for List. Empty filters match
+// everything and a zero Limit returns every match.
+type ListOptions struct {
+	Limit   int
+	Offset  int
+	Type    string
+	AppType string
+	License string
+	// Sort is one of the Sort constants; newest first when empty, so pages
+	// are stable
+	Sort string
+	// IncludeDeleted lists soft-deleted content alongside the rest
+	IncludeDeleted bool
+}
+
+// List returns the page of content selected by opts and the number of
+// records matching its filters across all pages
+func (s *ContentStore) List(ctx context.Context, opts ListOptions) (_ []Content, total int, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	order := opts.Sort
+	if order == "" {
+		order = SortCreatedAt
+	}
+	orderBy, ok := contentSortClauses[order]
+	if !ok {
+		return nil, 0, ErrInvalidSort
+	}
+
+	var where []string
+	var args []interface{}
+	if !opts.IncludeDeleted {
+		where = append(where, "deleted_at IS NULL")
+	}
+	for _, f := range []struct{ column, value string }{
+		{"type", opts.Type},
+		{"app_type", opts.AppType},
+		{"license", opts.License},
+	} {
+		if f.value != "" {
+			args = append(args, f.value)
+			where = append(where, fmt.Sprintf("%s = $%d", f.column, len(args)))
+		}
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM content`+filter, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + listColumns + ` FROM content` + filter + ` ORDER BY ` + orderBy
+	if opts.Limit > 0 {
+		args = append(args, opts.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if opts.Offset > 0 {
+		args = append(args, opts.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+	contents, err := s.queryList(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return contents, total, nil
+}
+
+func (s *ContentStore) queryList(ctx context.Context, query string, args ...interface{}) ([]Content, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -64,35 +188,101 @@ func (s *ContentStore) List(ctx context.Context) ([]Content, error) {
 	var contents []Content
 	for rows.Next() {
 		var c Content
-		err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.Version, &c.FilePath, &c.Size, &c.CreatedAt, &c.UpdatedAt)
+		err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.Version, &c.Description, &c.AppVersion, &c.AppType,
+			&c.FilePath, &c.Size, &c.StorageKey, &c.ContentType, &c.ContentEncoding, &c.Checksum,
+			&c.License, &c.LicenseURL, &c.CreatedAt, &c.UpdatedAt,
+			&c.LastVerifiedAt, &c.VerificationStatus, &c.StorageState, &c.StorageBackend,
+			&c.RehydrationRequestedAt, &c.RehydrationError, &c.Enabled, &c.DownloadCount, &c.DeletedAt)
 		if err != nil {
 			return nil, err
 		}
 		contents = append(contents, c)
 	}
-	return contents, nil
+	return contents, rows.Err()
 }
 
-// Create adds a new content record
-func (s *ContentStore) Create(ctx context.Context, content *Content) error {
-	query := `
-		INSERT INTO content (name, type, version, file_path, size, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
-        RETURNING id, created_at, updated_at`
+// ErrDuplicateStorageKey is returned by Create when another content record
+// already references the same storage object.
+var ErrDuplicateStorageKey = errors.New("content with this storage key already exists")
 
-	return s.db.QueryRowContext(
-		ctx,
-		query,
+// ErrDuplicateVersion is returned by Create when a live content record
+// already publishes the same app_type and version
+var ErrDuplicateVersion = errors.New("content with this app_type and version already exists")
+
+// contentUniqueError maps a unique violation on one of content's indexes to
+// its sentinel error, and returns any other error unchanged
+func contentUniqueError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != uniqueViolation {
+		return err
+	}
+	switch pqErr.Constraint {
+	case "idx_content_storage_key":
+		return ErrDuplicateStorageKey
+	case "idx_content_app_type_version":
+		return ErrDuplicateVersion
+	}
+	return err
+}
+
+// uniqueViolation is the Postgres SQLSTATE for a unique constraint failure
+const uniqueViolation = "23505"
+
+// insertContentQuery inserts a content record from insertContentArgs
+const insertContentQuery = insertContentStatement + insertContentReturning
+
+const insertContentStatement = `
+	INSERT INTO content (name, type, version, description, app_version, app_type,
+	                     file_path, size, storage_key, content_type, checksum, license, license_url,
+	                     content_encoding, storage_backend, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), NULLIF($13, ''),
+	        NULLIF($14, ''), $15, NOW(), NOW())`
+
+const insertContentReturning = `
+	RETURNING id, created_at, updated_at, enabled, storage_backend`
+
+func insertContentArgs(content *Content) []interface{} {
+	return []interface{}{
 		content.Name,
 		content.Type,
 		content.Version,
+		content.Description,
+		content.AppVersion,
+		content.AppType,
 		content.FilePath,
 		content.Size,
-	).Scan(&content.ID, &content.CreatedAt, &content.UpdatedAt)
+		content.StorageKey,
+		content.ContentType,
+		content.Checksum,
+		content.License,
+		content.LicenseURL,
+		content.ContentEncoding,
+		storageBackendOrDefault(content.StorageBackend),
+	}
+}
+
+func storageBackendOrDefault(backend string) string {
+	if backend == "" {
+		return DefaultStorageBackend
+	}
+	return backend
+}
+
+// Create adds a new content record
+func (s *ContentStore) Create(ctx context.Context, content *Content) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	err = s.db.QueryRowContext(ctx, insertContentQuery, insertContentArgs(content)...).
+		Scan(&content.ID, &content.CreatedAt, &content.UpdatedAt, &content.Enabled, &content.StorageBackend)
+	return contentUniqueError(err)
 }
 
 // Update modifies an existing content record
-func (s *ContentStore) Update(ctx context.Context, content *Content) error {
+func (s *ContentStore) Update(ctx context.Context, content *Content) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
 	query := `
 		UPDATE content 
 		SET name = $1, type = $2, version = $3, file_path = $4, size = $5, updated_at = NOW()
@@ -111,7 +301,50 @@ func (s *ContentStore) Update(ctx context.Context, content *Content) error {
 	if err != nil {
 		return err
 	}
+	s.invalidate(content.ID)
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetEnabled enables or disables downloads of a content record. Returns
+// sql.ErrNoRows when the record does not exist.
+func (s *ContentStore) SetEnabled(ctx context.Context, id uuid.UUID, enabled bool) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	result, err := s.db.ExecContext(ctx, `UPDATE content SET enabled = $1 WHERE id = $2`, enabled, id)
+	if err != nil {
+		return err
+	}
+	s.invalidate(id)
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetPinned pins content to the front of every device's download plan, or
+// unpins it
+func (s *ContentStore) SetPinned(ctx context.Context, id uuid.UUID, pinned bool) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
 
+	result, err := s.db.ExecContext(ctx, `UPDATE content SET pinned = $1 WHERE id = $2`, pinned, id)
+	if err != nil {
+		return err
+	}
 	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
@@ -122,14 +355,19 @@ func (s *ContentStore) Update(ctx context.Context, content *Content) error {
 	return nil
 }
 
-// Delete removes a content record
-func (s *ContentStore) Delete(ctx context.Context, id uuid.UUID) error {
+// Delete removes a content record outright. Content is normally retired
+// with SoftDelete; this is for cleanup of records that must not be kept.
+func (s *ContentStore) Delete(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
 	query := `DELETE FROM content WHERE id = $1`
 
 	result, err := s.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
+	s.invalidate(id)
 
 	rows, err := result.RowsAffected()
 	if err != nil {
@@ -141,53 +379,425 @@ func (s *ContentStore) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-// Get retrieves a content record by ID
+// SoftDelete marks a content record deleted, hiding it from Get, List and
+// downloads while keeping the row and its object. It returns sql.ErrNoRows
+// if the record does not exist or is already deleted.
+func (s *ContentStore) SoftDelete(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `UPDATE content SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+
+	result, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	s.invalidate(id)
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Get retrieves a content record by ID, consulting the cache first when
+// one is enabled. Soft-deleted content is reported as sql.ErrNoRows.
 func (s *ContentStore) Get(ctx context.Context, id uuid.UUID) (*Content, error) {
+	return s.get(ctx, id, false)
+}
+
+// GetIncludingDeleted is Get, but also returns soft-deleted content
+func (s *ContentStore) GetIncludingDeleted(ctx context.Context, id uuid.UUID) (*Content, error) {
+	return s.get(ctx, id, true)
+}
+
+func (s *ContentStore) get(ctx context.Context, id uuid.UUID, includeDeleted bool) (_ *Content, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	var gen uint64
+	if s.cache != nil {
+		if content, ok := s.cache.get(id); ok {
+			if content.DeletedAt != nil && !includeDeleted {
+				return nil, sql.ErrNoRows
+			}
+			return content, nil
+		}
+		gen = s.cache.generation()
+	}
+
 	query := `
-		SELECT id, name, type, version, file_path, size, storage_key, content_type, created_at, updated_at 
+		SELECT id, name, type, version, COALESCE(app_type, ''), file_path, size, storage_key, content_type,
+		       COALESCE(content_encoding, ''), checksum, COALESCE(license, ''), COALESCE(license_url, ''), created_at, updated_at, last_verified_at, verification_status,
+		       storage_state, rehydration_requested_at, COALESCE(rehydration_error, ''), enabled, storage_backend, deleted_at
 		FROM content 
 		WHERE id = $1`
 
 	var content Content
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
+	err = s.db.QueryRowContext(ctx, query, id).Scan(
 		&content.ID,
 		&content.Name,
 		&content.Type,
 		&content.Version,
+		&content.AppType,
 		&content.FilePath,
 		&content.Size,
 		&content.StorageKey,
 		&content.ContentType,
+		&content.ContentEncoding,
+		&content.Checksum,
+		&content.License,
+		&content.LicenseURL,
 		&content.CreatedAt,
 		&content.UpdatedAt,
+		&content.LastVerifiedAt,
+		&content.VerificationStatus,
+		&content.StorageState,
+		&content.RehydrationRequestedAt,
+		&content.RehydrationError,
+		&content.Enabled,
+		&content.StorageBackend,
+		&content.DeletedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
+	if s.cache != nil {
+		s.cache.fill(&content, gen)
+	}
+	if content.DeletedAt != nil && !includeDeleted {
+		return nil, sql.ErrNoRows
+	}
 	return &content, nil
 }
 
+// FindByVersion returns the content of an app_type whose version string is
+// exactly version. Live records are unique by app_type and version, so there
+// is at most one unless app_type or version is empty.
+func (s *ContentStore) FindByVersion(ctx context.Context, appType, version string) (_ []Content, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT id, name, version, COALESCE(app_type, ''), created_at, updated_at
+		FROM content
+		WHERE app_type = $1 AND version = $2 AND deleted_at IS NULL
+		ORDER BY created_at`
+
+	rows, err := s.db.QueryContext(ctx, query, appType, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contents []Content
+	for rows.Next() {
+		var c Content
+		if err := rows.Scan(&c.ID, &c.Name, &c.Version, &c.AppType, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		contents = append(contents, c)
+	}
+	return contents, rows.Err()
+}
+
 // Exists checks if a record exists for the given storage key
-func (s *ContentStore) Exists(ctx context.Context, storageKey string) (bool, error) {
+func (s *ContentStore) Exists(ctx context.Context, storageKey string) (_ bool, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM content WHERE storage_key = $1)`
-	err := s.db.QueryRowContext(ctx, query, storageKey).Scan(&exists)
+	err = s.db.QueryRowContext(ctx, query, storageKey).Scan(&exists)
 	return exists, err
 }
 
+// ExistingStorageKeys reports which of keys are already referenced by a
+// content record, using a single query for the whole batch.
+func (s *ContentStore) ExistingStorageKeys(ctx context.Context, keys []string) (_ map[string]bool, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	existing := make(map[string]bool)
+	if len(keys) == 0 {
+		return existing, nil
+	}
+
+	query := `SELECT DISTINCT storage_key FROM content WHERE storage_key = ANY($1)`
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		existing[key] = true
+	}
+	return existing, rows.Err()
+}
+
+// ErrInvalidVersion is returned when a version range bound is not a valid
+// semantic version
+var ErrInvalidVersion = errors.New("invalid version")
+
+// ListByVersionRange returns the content of appType whose ReleaseVersion
+// lies between minVer and maxVer inclusive, ordered by it as GetLatestVersion
+// orders releases; uploads of the same version stay in upload order. An
+// empty bound leaves that end open. Versions are compared in Go since SQL
+// cannot order semver strings; records whose version does not parse are
+// skipped.
+func (s *ContentStore) ListByVersionRange(ctx context.Context, appType, minVer, maxVer string) (_ []Content, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	var lower, upper *semver.Version
+	if minVer != "" {
+		v, err := semver.Parse(minVer)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidVersion, err)
+		}
+		lower = &v
+	}
+	if maxVer != "" {
+		v, err := semver.Parse(maxVer)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidVersion, err)
+		}
+		upper = &v
+	}
+
+	query := `
+		SELECT id, name, type, version, COALESCE(description, ''), COALESCE(app_version, ''),
+			COALESCE(app_type, ''), file_path, size, storage_key, content_type, checksum, created_at, updated_at
+		FROM content
+		WHERE app_type = $1 AND deleted_at IS NULL
+		ORDER BY created_at, id`
+
+	rows, err := s.db.QueryContext(ctx, query, appType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type versioned struct {
+		content Content
+		version semver.Version
+	}
+	var matched []versioned
+	for rows.Next() {
+		var c Content
+		if err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.Version, &c.Description, &c.AppVersion,
+			&c.AppType, &c.FilePath, &c.Size, &c.StorageKey, &c.ContentType, &c.Checksum,
+			&c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		v, err := semver.Parse(c.ReleaseVersion())
+		if err != nil {
+			log.Printf("[ListByVersionRange] Skipping %s: %v", c.ID, err)
+			continue
+		}
+		if lower != nil && semver.Compare(v, *lower) < 0 {
+			continue
+		}
+		if upper != nil && semver.Compare(v, *upper) > 0 {
+			continue
+		}
+		matched = append(matched, versioned{content: c, version: v})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return semver.Compare(matched[i].version, matched[j].version) < 0
+	})
+	contents := make([]Content, len(matched))
+	for i, m := range matched {
+		contents[i] = m.content
+	}
+	return contents, nil
+}
+
+// GetLatestVersion returns the newest downloadable release of appType,
+// ordered by the semantic version of each record's ReleaseVersion; the
+// most recent upload wins a tie. Records whose version does not parse are
+// skipped. Returns sql.ErrNoRows when appType has no such release.
+func (s *ContentStore) GetLatestVersion(ctx context.Context, appType string) (_ *Content, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	contents, err := s.queryList(ctx, `SELECT `+listColumns+` FROM content
+		WHERE app_type = $1 AND deleted_at IS NULL AND enabled
+		ORDER BY created_at DESC, id DESC`, appType)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *Content
+	var latestVersion semver.Version
+	for i := range contents {
+		v, err := semver.Parse(contents[i].ReleaseVersion())
+		if err != nil {
+			log.Printf("[GetLatestVersion] Skipping %s: %v", contents[i].ID, err)
+			continue
+		}
+		// Rows are newest first, so only a strictly higher version replaces
+		if latest == nil || semver.Compare(v, latestVersion) > 0 {
+			latest, latestVersion = &contents[i], v
+		}
+	}
+	if latest == nil {
+		return nil, sql.ErrNoRows
+	}
+	return latest, nil
+}
+
+// ListStored returns the ID, name, storage key and content type of every
+// content record that references an object in hot storage. Archived records
+// are left out.
+func (s *ContentStore) ListStored(ctx context.Context) (_ []Content, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT id, name, storage_key, content_type, storage_backend
+		FROM content
+		WHERE storage_key IS NOT NULL
+		  AND COALESCE(storage_state, '') NOT IN ('archived', 'rehydrating')
+		ORDER BY created_at`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contents []Content
+	for rows.Next() {
+		var c Content
+		if err := rows.Scan(&c.ID, &c.Name, &c.StorageKey, &c.ContentType, &c.StorageBackend); err != nil {
+			return nil, err
+		}
+		contents = append(contents, c)
+	}
+	return contents, rows.Err()
+}
+
+// UpdateContentType overwrites the MIME type recorded for a content record.
+// updated_at is left alone: the stored bytes are unchanged, so signed URLs
+// pinned to the current revision stay valid.
+func (s *ContentStore) UpdateContentType(ctx context.Context, id uuid.UUID, contentType string) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `UPDATE content SET content_type = $1 WHERE id = $2`
+
+	result, err := s.db.ExecContext(ctx, query, contentType, id)
+	if err != nil {
+		return err
+	}
+	s.invalidate(id)
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ContentEncodingGzip marks a content record whose stored object is gzipped
+const ContentEncodingGzip = "gzip"
+
+// Storage states. StorageStateMissing marks a record whose storage object
+// could not be found. StorageStateArchived marks one whose object was moved
+// to cold storage, and StorageStateRehydrating one being restored from it.
+const (
+	StorageStateMissing     = "missing"
+	StorageStateArchived    = "archived"
+	StorageStateRehydrating = "rehydrating"
+)
+
+// SetStorageState records what was found behind a record's storage key. An
+// empty state clears it. Like UpdateContentType this leaves updated_at alone.
+func (s *ContentStore) SetStorageState(ctx context.Context, id uuid.UUID, state string) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `UPDATE content SET storage_state = NULLIF($1, '') WHERE id = $2`
+
+	result, err := s.db.ExecContext(ctx, query, state, id)
+	if err != nil {
+		return err
+	}
+	s.invalidate(id)
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListMissingObjects returns records flagged as having no storage object
+func (s *ContentStore) ListMissingObjects(ctx context.Context) (_ []Content, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT id, name, version, COALESCE(app_type, ''), storage_key, storage_state, created_at, updated_at
+		FROM content
+		WHERE storage_state = 'missing'
+		ORDER BY name`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contents []Content
+	for rows.Next() {
+		var c Content
+		if err := rows.Scan(&c.ID, &c.Name, &c.Version, &c.AppType, &c.StorageKey, &c.StorageState,
+			&c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		contents = append(contents, c)
+	}
+	return contents, rows.Err()
+}
+
 type DownloadStore interface {
 	Create(ctx context.Context, download *Download) error
 	Update(ctx context.Context, download *Download) error
 	GetByID(ctx context.Context, id uuid.UUID) (*Download, error)
-	ListDownloadsByDeviceID(ctx context.Context, deviceID uuid.UUID) ([]*Download, error)
+	ListDownloadsByDeviceID(ctx context.Context, deviceID uuid.UUID, cursor *DownloadCursor, limit int) ([]*Download, *DownloadCursor, error)
 }
 
 // Add these methods to your ContentStore struct
-func (s *ContentStore) CreateDownload(ctx context.Context, download *Download) error {
+func (s *ContentStore) CreateDownload(ctx context.Context, download *Download) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
 	query := `
         INSERT INTO downloads (device_id, user_id, content_id, status, bytes_downloaded, total_bytes)
         VALUES ($1, $2, $3, $4, $5, $6)
-        RETURNING id, created_at`
+        RETURNING id, created_at, version`
 
 	return s.db.QueryRowContext(
 		ctx,
@@ -198,21 +808,24 @@ func (s *ContentStore) CreateDownload(ctx context.Context, download *Download) e
 		download.Status,
 		download.BytesDownloaded,
 		download.TotalBytes,
-	).Scan(&download.ID, &download.StartedAt)
+	).Scan(&download.ID, &download.StartedAt, &download.Version)
 }
 
-func (s *ContentStore) GetDownloadByID(ctx context.Context, id uuid.UUID) (*Download, error) {
+func (s *ContentStore) GetDownloadByID(ctx context.Context, id uuid.UUID) (_ *Download, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
 	log.Printf("[Debug] Looking for download with ID: %s", id)
 
 	query := `
         SELECT id, device_id, user_id, content_id, status, bytes_downloaded, 
                total_bytes, created_at, last_updated_at, completed_at, error_message, 
-               resume_position
+               resume_position, version
         FROM downloads 
         WHERE id = $1`
 
 	download := &Download{}
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
+	err = s.db.QueryRowContext(ctx, query, id).Scan(
 		&download.ID,
 		&download.DeviceID,
 		&download.UserID,
@@ -225,6 +838,7 @@ func (s *ContentStore) GetDownloadByID(ctx context.Context, id uuid.UUID) (*Down
 		&download.CompletedAt,
 		&download.ErrorMessage,
 		&download.ResumePosition,
+		&download.Version,
 	)
 	if err != nil {
 		log.Printf("[Error] Database error: %v", err)
@@ -234,19 +848,87 @@ func (s *ContentStore) GetDownloadByID(ctx context.Context, id uuid.UUID) (*Down
 	return download, nil
 }
 
-func (s *ContentStore) UpdateDownload(ctx context.Context, download *Download) error {
+// GetLatestDownload returns the device's most recent download of a content
+// record, whatever its status, or sql.ErrNoRows when there is none.
+func (s *ContentStore) GetLatestDownload(ctx context.Context, deviceID, contentID uuid.UUID) (_ *Download, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+        SELECT id, device_id, user_id, content_id, status, bytes_downloaded,
+               total_bytes, created_at, last_updated_at, completed_at, error_message,
+               resume_position, version
+        FROM downloads
+        WHERE device_id = $1 AND content_id = $2
+        ORDER BY created_at DESC, id DESC
+        LIMIT 1`
+
+	download := &Download{}
+	err = s.db.QueryRowContext(ctx, query, deviceID, contentID).Scan(
+		&download.ID,
+		&download.DeviceID,
+		&download.UserID,
+		&download.ContentID,
+		&download.Status,
+		&download.BytesDownloaded,
+		&download.TotalBytes,
+		&download.StartedAt,
+		&download.LastUpdatedAt,
+		&download.CompletedAt,
+		&download.ErrorMessage,
+		&download.ResumePosition,
+		&download.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return download, nil
+}
+
+// ErrVersionConflict is returned by UpdateDownload when the download was
+// updated since it was read. The caller should re-read it and retry.
+var ErrVersionConflict = errors.New("download was modified concurrently")
+
+// UpdateDownload writes download's status, progress, resume position and
+// error message if the stored version still equals download.Version, then
+// advances download.Version. Returns sql.ErrNoRows when the download does
+// not exist, ErrVersionConflict when another update got there first, and an
+// error wrapping ErrInvalidTransition when the stored download cannot move
+// to the new status; see CheckDownloadTransition. completed_at is set by the
+// first update to completed.
+func (s *ContentStore) UpdateDownload(ctx context.Context, download *Download) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	current := &Download{}
+	err = s.db.QueryRowContext(ctx, `SELECT status, total_bytes, version FROM downloads WHERE id = $1`, download.ID).
+		Scan(&current.Status, &current.TotalBytes, &current.Version)
+	if err != nil {
+		return err
+	}
+	// A stale read is a conflict whatever it tried to change
+	if current.Version != download.Version {
+		return ErrVersionConflict
+	}
+	if err := CheckDownloadTransition(current, download.Status, download.BytesDownloaded); err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE downloads 
 		SET status = $1, 
 			bytes_downloaded = $2, 
         	error_message = COALESCE($3::text, error_message),
+			resume_position = $6,
 			last_updated_at = NOW(),
 			completed_at = CASE 
-				WHEN status = 'completed' 
-				THEN NOW() 
+				WHEN $1 = 'completed' 
+				THEN COALESCE(completed_at, NOW()) 
 				ELSE completed_at 
-			END
-		WHERE id = $4`
+			END,
+			version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING version, last_updated_at, completed_at`
 
 	var errorMsg interface{}
 	if download.ErrorMessage != nil {
@@ -255,40 +937,48 @@ func (s *ContentStore) UpdateDownload(ctx context.Context, download *Download) e
 		errorMsg = nil
 	}
 
-	result, err := s.db.ExecContext(
+	err = s.db.QueryRowContext(
 		ctx,
 		query,
 		download.Status,
 		download.BytesDownloaded,
 		errorMsg,
 		download.ID,
-	)
-	if err != nil {
+		download.Version,
+		download.ResumePosition,
+	).Scan(&download.Version, &download.LastUpdatedAt, &download.CompletedAt)
+	if err != sql.ErrNoRows {
 		return err
 	}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM downloads WHERE id = $1)`, download.ID).Scan(&exists); err != nil {
 		return err
 	}
-	if rows == 0 {
-		return fmt.Errorf("download not found")
+	if !exists {
+		return sql.ErrNoRows
 	}
-	return nil
+	return ErrVersionConflict
 }
 
-func (s *ContentStore) ListDownloadsByDeviceID(ctx context.Context, deviceID uuid.UUID) ([]*Download, error) {
-	query := `
+// ListDownloadsByDeviceID returns a page of a device's downloads, newest
+// first. Pages are keyed on (created_at, id) so rows inserted while a client
+// is paging never cause skips or duplicates. Pass a nil cursor for the first
+// page; the returned cursor is nil once there are no more rows.
+func (s *ContentStore) ListDownloadsByDeviceID(ctx context.Context, deviceID uuid.UUID, cursor *DownloadCursor, limit int) (_ []*Download, _ *DownloadCursor, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query, args := downloadPageQuery(`
         SELECT id, device_id, user_id, content_id, status, bytes_downloaded, 
                total_bytes, created_at, last_updated_at, completed_at, error_message, 
-               resume_position
+               resume_position, version
         FROM downloads 
-        WHERE device_id = $1
-        ORDER BY created_at DESC`
+        WHERE device_id = $1`, "", deviceID, cursor, limit)
 
-	rows, err := s.db.QueryContext(ctx, query, deviceID)
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
@@ -308,29 +998,192 @@ func (s *ContentStore) ListDownloadsByDeviceID(ctx context.Context, deviceID uui
 			&download.CompletedAt,
 			&download.ErrorMessage,
 			&download.ResumePosition,
+			&download.Version,
 		)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		downloads = append(downloads, download)
 	}
-	return downloads, nil
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *DownloadCursor
+	if limit > 0 && len(downloads) > limit {
+		downloads = downloads[:limit]
+		last := downloads[limit-1]
+		next = &DownloadCursor{CreatedAt: last.StartedAt, ID: last.ID}
+	}
+	return downloads, next, nil
+}
+
+// downloadPageQuery appends the cursor condition, ordering and limit shared
+// by the download history queries. prefix qualifies the downloads columns
+// when the query joins other tables.
+func downloadPageQuery(base, prefix string, deviceID uuid.UUID, cursor *DownloadCursor, limit int) (string, []interface{}) {
+	query := base
+	args := []interface{}{deviceID}
+	if cursor != nil {
+		query += fmt.Sprintf(` AND (%[1]screated_at, %[1]sid) < ($2, $3)`, prefix)
+		args = append(args, cursor.CreatedAt, cursor.ID)
+	}
+	query += fmt.Sprintf(`
+        ORDER BY %[1]screated_at DESC, %[1]sid DESC`, prefix)
+	if limit > 0 {
+		// Fetch one extra row to learn whether another page exists
+		args = append(args, limit+1)
+		query += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+	return query, args
 }
 
-func (s *ContentStore) GetByID(ctx context.Context, id uuid.UUID) (*Content, error) {
+// ListDownloadsWithContentByDeviceID is ListDownloadsByDeviceID with each
+// download's content name, version and size joined in
+func (s *ContentStore) ListDownloadsWithContentByDeviceID(ctx context.Context, deviceID uuid.UUID, cursor *DownloadCursor, limit int) (_ []*DownloadWithContent, _ *DownloadCursor, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query, args := downloadPageQuery(`
+        SELECT d.id, d.device_id, d.user_id, d.content_id, d.status, d.bytes_downloaded,
+               d.total_bytes, d.created_at, d.last_updated_at, d.completed_at, d.error_message,
+               d.resume_position, d.version, c.name, c.version, c.size
+        FROM downloads d
+        LEFT JOIN content c ON c.id = d.content_id
+        WHERE d.device_id = $1`, "d.", deviceID, cursor, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var downloads []*DownloadWithContent
+	for rows.Next() {
+		d := &DownloadWithContent{}
+		var name, version sql.NullString
+		var size sql.NullInt64
+		err := rows.Scan(
+			&d.ID,
+			&d.DeviceID,
+			&d.UserID,
+			&d.ContentID,
+			&d.Status,
+			&d.BytesDownloaded,
+			&d.TotalBytes,
+			&d.StartedAt,
+			&d.LastUpdatedAt,
+			&d.CompletedAt,
+			&d.ErrorMessage,
+			&d.ResumePosition,
+			&d.Version,
+			&name,
+			&version,
+			&size,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		if name.Valid {
+			d.Content = &DownloadContent{Name: name.String, Version: version.String, Size: size.Int64}
+		}
+		downloads = append(downloads, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *DownloadCursor
+	if limit > 0 && len(downloads) > limit {
+		downloads = downloads[:limit]
+		last := downloads[limit-1]
+		next = &DownloadCursor{CreatedAt: last.StartedAt, ID: last.ID}
+	}
+	return downloads, next, nil
+}
+
+// CountActiveDownloads returns how many of a device's downloads are queued,
+// how many are transferring and how many hold a slot.
+func (s *ContentStore) CountActiveDownloads(ctx context.Context, deviceID uuid.UUID) (_ ActiveDownloadCounts, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
 	query := `
-		SELECT id, name, type, version, file_path, size
+        SELECT COUNT(*) FILTER (WHERE status = 'queued'),
+               COUNT(*) FILTER (WHERE status IN ('downloading', 'started', 'resuming')),
+               COUNT(*) FILTER (WHERE status = ANY($2))
+        FROM downloads
+        WHERE device_id = $1`
+
+	var counts ActiveDownloadCounts
+	err = s.db.QueryRowContext(ctx, query, deviceID, pq.Array(SlotDownloadStatuses)).
+		Scan(&counts.Queued, &counts.Downloading, &counts.Holding)
+	return counts, err
+}
+
+// ListPlanCandidates returns every enabled, non-empty content record the
+// device has not yet completed, pinned records first and otherwise newest
+// first. Records whose object is missing are left out; archived ones are
+// returned with their StorageState. InstalledAt carries the creation time of
+// the most recent content of the same app_type the device has completed, if
+// any.
+func (s *ContentStore) ListPlanCandidates(ctx context.Context, deviceID uuid.UUID) (_ []PlanCandidate, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+        SELECT c.id, c.name, c.version, COALESCE(c.app_type, ''), c.size, c.created_at,
+               c.updated_at, c.pinned, COALESCE(c.storage_state, ''),
+               (SELECT MAX(ic.created_at)
+                FROM downloads d
+                JOIN content ic ON ic.id = d.content_id
+                WHERE d.device_id = $1 AND d.status = 'completed'
+                  AND ic.app_type = c.app_type AND c.app_type <> '')
+        FROM content c
+        WHERE c.enabled AND c.deleted_at IS NULL AND c.size > 0
+          AND COALESCE(c.storage_state, '') <> 'missing' AND NOT EXISTS (
+            SELECT 1 FROM downloads d
+            WHERE d.device_id = $1 AND d.content_id = c.id AND d.status = 'completed')
+        ORDER BY c.pinned DESC, c.created_at DESC`
+
+	rows, err := s.db.QueryContext(ctx, query, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []PlanCandidate
+	for rows.Next() {
+		var c PlanCandidate
+		if err := rows.Scan(&c.ID, &c.Name, &c.Version, &c.AppType, &c.Size, &c.CreatedAt,
+			&c.UpdatedAt, &c.Pinned, &c.StorageState, &c.InstalledAt); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+func (s *ContentStore) GetByID(ctx context.Context, id uuid.UUID) (_ *Content, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT id, name, type, version, file_path, size, updated_at, enabled, deleted_at
 		FROM content
 		WHERE id = $1`
 
 	content := &Content{}
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
+	err = s.db.QueryRowContext(ctx, query, id).Scan(
 		&content.ID,
 		&content.Name,
 		&content.Type,
 		&content.Version,
 		&content.FilePath,
 		&content.Size,
+		&content.UpdatedAt,
+		&content.Enabled,
+		&content.DeletedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -338,3 +1191,90 @@ func (s *ContentStore) GetByID(ctx context.Context, id uuid.UUID) (*Content, err
 
 	return content, nil
 }
+
+// CountUniqueDevicesByContent returns how many distinct devices have
+// completed a download of the content, ignoring re-downloads.
+func (s *ContentStore) CountUniqueDevicesByContent(ctx context.Context, contentID uuid.UUID) (_ int, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT COUNT(DISTINCT device_id)
+		FROM downloads
+		WHERE content_id = $1 AND status = 'completed'`
+
+	var count int
+	err = s.db.QueryRowContext(ctx, query, contentID).Scan(&count)
+	return count, err
+}
+
+// ListContentStats returns completed download and unique device counts for
+// every content record, most reached first.
+func (s *ContentStore) ListContentStats(ctx context.Context) (_ []ContentStats, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT c.id, c.name, c.version,
+		       COUNT(d.id),
+		       COUNT(DISTINCT d.device_id)
+		FROM content c
+		LEFT JOIN downloads d ON d.content_id = c.id AND d.status = 'completed'
+		GROUP BY c.id, c.name, c.version
+		ORDER BY COUNT(DISTINCT d.device_id) DESC, c.name`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []ContentStats
+	for rows.Next() {
+		var st ContentStats
+		if err := rows.Scan(&st.ContentID, &st.Name, &st.Version, &st.CompletedDownloads, &st.UniqueDevices); err != nil {
+			return nil, err
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
+
+// DownloadStats counts every content record's downloads by outcome in one
+// grouped query, most completed first. Only downloads created at or after
+// from and before to are counted; a zero time leaves that end open.
+func (s *ContentStore) DownloadStats(ctx context.Context, from, to time.Time) (_ []ContentDownloadStat, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT c.id, c.name, c.version,
+		       COUNT(d.id) FILTER (WHERE d.status = 'completed'),
+		       COUNT(d.id) FILTER (WHERE d.status = 'failed'),
+		       COUNT(d.id) FILTER (WHERE d.status IN ('queued', 'downloading', 'started', 'paused', 'resuming')),
+		       COALESCE(SUM(d.bytes_downloaded), 0)
+		FROM content c
+		LEFT JOIN downloads d ON d.content_id = c.id
+		     AND ($1::timestamptz IS NULL OR d.created_at >= $1)
+		     AND ($2::timestamptz IS NULL OR d.created_at < $2)
+		GROUP BY c.id, c.name, c.version
+		ORDER BY 4 DESC, c.name`
+
+	rows, err := s.db.QueryContext(ctx, query,
+		sql.NullTime{Time: from, Valid: !from.IsZero()},
+		sql.NullTime{Time: to, Valid: !to.IsZero()})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []ContentDownloadStat
+	for rows.Next() {
+		var st ContentDownloadStat
+		if err := rows.Scan(&st.ContentID, &st.Name, &st.Version, &st.Completed, &st.Failed, &st.InProgress, &st.BytesTransferred); err != nil {
+			return nil, err
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
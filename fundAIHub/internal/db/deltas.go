@@ -0,0 +1,183 @@
+package db
+
+import (
+	"FundAIHub/internal/semver"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrDuplicateDelta is returned by CreateDelta when the app type already
+	// has a patch between the same two versions
+	ErrDuplicateDelta = errors.New("a delta between these versions already exists")
+	// ErrNoDeltaChain is returned by FindDeltaChain when no sequence of
+	// patches leads from one version to the other
+	ErrNoDeltaChain = errors.New("no delta chain between these versions")
+)
+
+// CanonicalVersion parses a semantic version and formats it without build
+// metadata, which never affects ordering, so equal versions always match
+func CanonicalVersion(s string) (string, error) {
+	v, err := semver.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidVersion, err)
+	}
+	v.Build = ""
+	return v.String(), nil
+}
+
+// CreateDelta records a stored patch, canonicalising its versions. Patches
+// only lead forward, so FromVersion must be lower than ToVersion.
+func (s *ContentStore) CreateDelta(ctx context.Context, d *ContentDelta) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	from, err := semver.Parse(d.FromVersion)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidVersion, err)
+	}
+	to, err := semver.Parse(d.ToVersion)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidVersion, err)
+	}
+	if semver.Compare(from, to) >= 0 {
+		return fmt.Errorf("%w: from_version must be lower than to_version", ErrInvalidVersion)
+	}
+	from.Build, to.Build = "", ""
+	d.FromVersion, d.ToVersion = from.String(), to.String()
+
+	query := `
+		INSERT INTO content_deltas (app_type, from_version, to_version, storage_key, size, checksum)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	err = s.db.QueryRowContext(ctx, query,
+		d.AppType, d.FromVersion, d.ToVersion, d.StorageKey, d.Size, d.Checksum,
+	).Scan(&d.ID, &d.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return ErrDuplicateDelta
+	}
+	return err
+}
+
+// GetDelta returns sql.ErrNoRows when the delta does not exist
+func (s *ContentStore) GetDelta(ctx context.Context, id uuid.UUID) (_ *ContentDelta, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT id, app_type, from_version, to_version, storage_key, size, checksum, created_at
+		FROM content_deltas
+		WHERE id = $1`
+
+	var d ContentDelta
+	err = s.db.QueryRowContext(ctx, query, id).Scan(
+		&d.ID, &d.AppType, &d.FromVersion, &d.ToVersion, &d.StorageKey, &d.Size, &d.Checksum, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListDeltas returns every patch recorded for appType
+func (s *ContentStore) ListDeltas(ctx context.Context, appType string) (_ []ContentDelta, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT id, app_type, from_version, to_version, storage_key, size, checksum, created_at
+		FROM content_deltas
+		WHERE app_type = $1
+		ORDER BY from_version, to_version`
+
+	rows, err := s.db.QueryContext(ctx, query, appType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deltas []ContentDelta
+	for rows.Next() {
+		var d ContentDelta
+		if err := rows.Scan(&d.ID, &d.AppType, &d.FromVersion, &d.ToVersion,
+			&d.StorageKey, &d.Size, &d.Checksum, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deltas = append(deltas, d)
+	}
+	return deltas, rows.Err()
+}
+
+// FindDeltaChain returns the patches, in the order they are applied, that
+// take appType from one canonical version to another with the fewest bytes
+// to download. The chain is empty when the versions are equal; it returns
+// ErrNoDeltaChain when no chain exists.
+func (s *ContentStore) FindDeltaChain(ctx context.Context, appType, from, to string) ([]ContentDelta, error) {
+	if from == to {
+		return []ContentDelta{}, nil
+	}
+	deltas, err := s.ListDeltas(ctx, appType)
+	if err != nil {
+		return nil, err
+	}
+	chain := shortestDeltaChain(deltas, from, to)
+	if chain == nil {
+		return nil, ErrNoDeltaChain
+	}
+	return chain, nil
+}
+
+// shortestDeltaChain runs Dijkstra's algorithm over the versions linked by
+// deltas, weighing each patch by its size; between chains of equal size the
+// one with fewer patches wins. Returns nil when to cannot be reached. An app
+// type has few enough patches that scanning them all at each step is fine.
+func shortestDeltaChain(deltas []ContentDelta, from, to string) []ContentDelta {
+	type route struct {
+		size    int64
+		patches int
+		via     int // Index of the delta arriving here, -1 at the start
+	}
+	shorter := func(a, b route) bool {
+		return a.size < b.size || (a.size == b.size && a.patches < b.patches)
+	}
+
+	best := map[string]route{from: {via: -1}}
+	settled := map[string]bool{}
+	for {
+		current, found := "", false
+		for v, r := range best {
+			if !settled[v] && (!found || shorter(r, best[current]) || (!shorter(best[current], r) && v < current)) {
+				current, found = v, true
+			}
+		}
+		if !found {
+			return nil
+		}
+		if current == to {
+			break
+		}
+		settled[current] = true
+		for i, d := range deltas {
+			if d.FromVersion != current || settled[d.ToVersion] {
+				continue
+			}
+			next := route{best[current].size + d.Size, best[current].patches + 1, i}
+			if r, ok := best[d.ToVersion]; !ok || shorter(next, r) {
+				best[d.ToVersion] = next
+			}
+		}
+	}
+
+	chain := make([]ContentDelta, best[to].patches)
+	for v, i := to, len(chain)-1; i >= 0; i-- {
+		d := deltas[best[v].via]
+		chain[i] = d
+		v = d.FromVersion
+	}
+	return chain
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShortestDeltaChain(t *testing.T) {
+	deltas := []ContentDelta{
+		{FromVersion: "1.0.0", ToVersion: "1.1.0", Size: 10},
+		{FromVersion: "1.1.0", ToVersion: "1.2.0", Size: 10},
+		{FromVersion: "1.0.0", ToVersion: "1.2.0", Size: 50},
+		{FromVersion: "1.2.0", ToVersion: "2.0.0", Size: 30},
+		{FromVersion: "1.0.0", ToVersion: "2.0.0", Size: 50},
+		{FromVersion: "3.0.0", ToVersion: "4.0.0", Size: 1},
+	}
+	path := func(chain []ContentDelta) string {
+		var hops []string
+		for _, d := range chain {
+			hops = append(hops, d.FromVersion+">"+d.ToVersion)
+		}
+		return strings.Join(hops, ",")
+	}
+
+	tests := []struct {
+		from, to string
+		want     string
+	}{
+		{"1.0.0", "1.2.0", "1.0.0>1.1.0,1.1.0>1.2.0"},
+		{"1.1.0", "2.0.0", "1.1.0>1.2.0,1.2.0>2.0.0"},
+		// 10+10+30 ties the direct patch, which needs fewer downloads
+		{"1.0.0", "2.0.0", "1.0.0>2.0.0"},
+	}
+	for _, tt := range tests {
+		chain := shortestDeltaChain(deltas, tt.from, tt.to)
+		if got := path(chain); got != tt.want {
+			t.Errorf("shortestDeltaChain(%s, %s) = %q, want %q", tt.from, tt.to, got, tt.want)
+		}
+	}
+
+	for _, unreachable := range [][2]string{{"1.0.0", "4.0.0"}, {"2.0.0", "1.0.0"}} {
+		if chain := shortestDeltaChain(deltas, unreachable[0], unreachable[1]); chain != nil {
+			t.Errorf("shortestDeltaChain(%s, %s) = %q, want nil", unreachable[0], unreachable[1], path(chain))
+		}
+	}
+}
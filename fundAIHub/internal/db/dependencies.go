@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrDependencyCycle is returned when adding a dependency would make a
+// content record depend on itself, directly or transitively.
+var ErrDependencyCycle = errors.New("dependency would create a cycle")
+
+// foreignKeyViolation is the Postgres SQLSTATE for a missing referenced row
+const foreignKeyViolation = "23503"
+
+// dependencyLockKey names the advisory lock that serialises dependency
+// inserts, so two concurrent inserts cannot each pass the cycle check and
+// together form a cycle. Like the download limit locks it is a descriptive
+// string hashed with hashtext, rather than a number other code might reuse.
+const dependencyLockKey = "fundaihub.content_dependencies"
+
+// maxDependencyDepth bounds closure queries as a guard against bad data
+const maxDependencyDepth = 32
+
+// AddDependency records that contentID requires dependsOnID. Adding an
+// existing dependency is a no-op. Returns sql.ErrNoRows when either record
+// does not exist.
+func (s *ContentStore) AddDependency(ctx context.Context, contentID, dependsOnID uuid.UUID) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	if contentID == dependsOnID {
+		return ErrDependencyCycle
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, dependencyLockKey); err != nil {
+		return err
+	}
+
+	// A cycle forms if contentID is already reachable from dependsOnID
+	var cycle bool
+	query := `
+		WITH RECURSIVE reach(id) AS (
+			SELECT $1::uuid
+			UNION
+			SELECT d.depends_on_id
+			FROM content_dependencies d
+			JOIN reach ON d.content_id = reach.id
+		)
+		SELECT EXISTS(SELECT 1 FROM reach WHERE id = $2)`
+	if err := tx.QueryRowContext(ctx, query, dependsOnID, contentID).Scan(&cycle); err != nil {
+		return err
+	}
+	if cycle {
+		return ErrDependencyCycle
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO content_dependencies (content_id, depends_on_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, contentID, dependsOnID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListDependencies returns the content contentID directly depends on.
+// Dependencies that are disabled or deleted are returned with Enabled and
+// DeletedAt set, since without them contentID cannot be installed.
+func (s *ContentStore) ListDependencies(ctx context.Context, contentID uuid.UUID) (_ []Content, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT c.id, c.name, c.version, COALESCE(c.app_type, ''), c.size, c.enabled, c.deleted_at
+		FROM content_dependencies d
+		JOIN content c ON c.id = d.depends_on_id
+		WHERE d.content_id = $1
+		ORDER BY c.name`
+
+	return s.queryDependencies(ctx, query, contentID)
+}
+
+// ResolveDependencies returns the transitive closure of contentID's
+// dependencies in install order: anything a record depends on comes before
+// it. As with ListDependencies, disabled and deleted dependencies are
+// included with Enabled and DeletedAt set.
+func (s *ContentStore) ResolveDependencies(ctx context.Context, contentID uuid.UUID) (_ []Content, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		WITH RECURSIVE deps(id, depth) AS (
+			SELECT depends_on_id, 1
+			FROM content_dependencies
+			WHERE content_id = $1
+			UNION ALL
+			SELECT d.depends_on_id, deps.depth + 1
+			FROM content_dependencies d
+			JOIN deps ON d.content_id = deps.id
+			WHERE deps.depth < $2
+		)
+		SELECT c.id, c.name, c.version, COALESCE(c.app_type, ''), c.size, c.enabled, c.deleted_at
+		FROM deps
+		JOIN content c ON c.id = deps.id
+		GROUP BY c.id, c.name, c.version, c.app_type, c.size, c.enabled, c.deleted_at
+		ORDER BY MAX(deps.depth) DESC, c.name`
+
+	return s.queryDependencies(ctx, query, contentID, maxDependencyDepth)
+}
+
+func (s *ContentStore) queryDependencies(ctx context.Context, query string, args ...interface{}) ([]Content, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contents []Content
+	for rows.Next() {
+		var c Content
+		if err := rows.Scan(&c.ID, &c.Name, &c.Version, &c.AppType, &c.Size, &c.Enabled, &c.DeletedAt); err != nil {
+			return nil, err
+		}
+		contents = append(contents, c)
+	}
+	return contents, rows.Err()
+}
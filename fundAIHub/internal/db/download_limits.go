@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// SlotDownloadStatuses are the statuses of downloads holding one of a
+// device's or user's slots: queued, in flight or paused. The limits are
+// enforced and the plan's parallelism counted against this one set. Stale
+// downloads have been given up on and do not count.
+var SlotDownloadStatuses = []string{
+	DownloadStatusQueued, DownloadStatusDownloading, DownloadStatusStarted,
+	DownloadStatusPaused, DownloadStatusResuming,
+}
+
+// holdsSlot reports whether a download in status counts against the limits
+func holdsSlot(status string) bool {
+	for _, s := range SlotDownloadStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// DownloadLimits caps the active downloads a device, and a user across all
+// of their devices, may hold. Zero is not enforced.
+type DownloadLimits struct {
+	PerDevice int
+	PerUser   int
+}
+
+// DownloadLimitError is returned by CreateDownloadWithinLimits when a new
+// download would take a device or user past its limit
+type DownloadLimitError struct {
+	// Scope is "device" or "user"
+	Scope  string
+	Active int
+}
+
+func (e *DownloadLimitError) Error() string {
+	if e.Scope == "user" {
+		return fmt.Sprintf("This account already has %d active downloads across its devices", e.Active)
+	}
+	return fmt.Sprintf("This device already has %d active downloads", e.Active)
+}
+
+// CreateDownloadWithinLimits is CreateDownload, refused with a
+// *DownloadLimitError when the device or user already holds as many active
+// downloads as limits allow. The count and insert share a transaction under
+// per-device and per-user advisory locks, so concurrent starts cannot all
+// slip under the limit.
+func (s *ContentStore) CreateDownloadWithinLimits(ctx context.Context, download *Download, limits DownloadLimits) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Always device before user, so two starts never wait on each other
+	checks := []struct {
+		scope  string
+		limit  int
+		column string
+		key    string
+		arg    interface{}
+	}{
+		{"device", limits.PerDevice, "device_id", download.DeviceID.String(), download.DeviceID},
+		{"user", limits.PerUser, "user_id", download.UserID, download.UserID},
+	}
+	for _, c := range checks {
+		if c.limit <= 0 || c.key == "" {
+			continue
+		}
+		if err := checkActiveLimit(ctx, tx, c.scope, c.column, c.key, c.arg, c.limit, uuid.Nil); err != nil {
+			return err
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO downloads (device_id, user_id, content_id, status, bytes_downloaded, total_bytes)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, created_at, version`,
+		download.DeviceID,
+		download.UserID,
+		download.ContentID,
+		download.Status,
+		download.BytesDownloaded,
+		download.TotalBytes,
+	).Scan(&download.ID, &download.StartedAt, &download.Version)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkActiveLimit takes the advisory lock for scope's key and refuses with
+// a *DownloadLimitError once the rows whose column equals arg already hold
+// limit slots. The download except, if any, is not counted.
+func checkActiveLimit(ctx context.Context, tx *sql.Tx, scope, column, key string, arg interface{}, limit int, except uuid.UUID) error {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1), hashtext($2))`,
+		"fundaihub.active_downloads."+scope, key); err != nil {
+		return err
+	}
+	var active int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM downloads WHERE `+column+` = $1 AND status = ANY($2) AND id <> $3`,
+		arg, pq.Array(SlotDownloadStatuses), except).Scan(&active); err != nil {
+		return err
+	}
+	if active >= limit {
+		return &DownloadLimitError{Scope: scope, Active: active}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrDownloadFinished is returned when handing off a download that has
+// already completed, failed or been cancelled
+var ErrDownloadFinished = errors.New("download has already finished")
+
+// HandoffDownload moves an unfinished download to deviceID. The new device
+// resumes from the bytes already received, and a transfer that was in
+// flight on the old device is paused until the new one picks it up. A
+// download that holds a slot is refused with a *DownloadLimitError when
+// deviceID already holds maxPerDevice, counted under the same lock as
+// CreateDownloadWithinLimits; zero is not enforced. Returns sql.ErrNoRows
+// when the download does not exist.
+func (s *ContentStore) HandoffDownload(ctx context.Context, id, deviceID uuid.UUID, maxPerDevice int) (_ *Download, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	if err := tx.QueryRowContext(ctx, `SELECT status FROM downloads WHERE id = $1 FOR UPDATE`, id).Scan(&status); err != nil {
+		return nil, err
+	}
+	switch status {
+	case DownloadStatusCompleted, DownloadStatusFailed, DownloadStatusCancelled:
+		return nil, ErrDownloadFinished
+	}
+	// A stale download holds no slot, before or after the move
+	if maxPerDevice > 0 && holdsSlot(status) {
+		if err := checkActiveLimit(ctx, tx, "device", "device_id", deviceID.String(), deviceID, maxPerDevice, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE downloads
+		SET device_id = $2,
+		    resume_position = bytes_downloaded,
+		    status = CASE WHEN status IN ('downloading', 'started', 'resuming') THEN 'paused' ELSE status END,
+		    last_updated_at = NOW(),
+		    version = version + 1
+		WHERE id = $1`, id, deviceID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetDownloadByID(ctx, id)
+}
@@ -0,0 +1,3 @@
+-- Supports keyset pagination of a device's download history
+CREATE INDEX IF NOT EXISTS idx_downloads_device_created
+    ON downloads (device_id, created_at DESC, id DESC);
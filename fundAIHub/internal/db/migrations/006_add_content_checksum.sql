@@ -0,0 +1,3 @@
+-- SHA-256 of the stored object, hex encoded
+ALTER TABLE content
+ADD COLUMN checksum VARCHAR(64);
@@ -0,0 +1,7 @@
+-- Each storage object may back at most one content record. Resolve any
+-- existing duplicates before applying:
+--   SELECT storage_key, COUNT(*) FROM content
+--   WHERE storage_key IS NOT NULL GROUP BY storage_key HAVING COUNT(*) > 1;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_content_storage_key
+    ON content (storage_key)
+    WHERE storage_key IS NOT NULL;
@@ -0,0 +1,9 @@
+CREATE TABLE content_dependencies (
+    content_id UUID NOT NULL REFERENCES content(id) ON DELETE CASCADE,
+    depends_on_id UUID NOT NULL REFERENCES content(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (content_id, depends_on_id),
+    CONSTRAINT no_self_dependency CHECK (content_id <> depends_on_id)
+);
+
+CREATE INDEX idx_content_dependencies_depends_on ON content_dependencies (depends_on_id);
@@ -0,0 +1,5 @@
+-- Split "record created" (queued) from "bytes flowing" (downloading).
+-- 'started' is kept so existing rows stay valid.
+ALTER TABLE downloads
+    DROP CONSTRAINT IF EXISTS valid_status,
+    ADD CONSTRAINT valid_status CHECK (status IN ('queued', 'downloading', 'started', 'paused', 'resuming', 'completed', 'failed'));
@@ -0,0 +1,24 @@
+-- Chunked uploads: a session declares the final file, chunks are stored as
+-- separate objects and finalize assembles and verifies them.
+CREATE TABLE upload_sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    filename VARCHAR NOT NULL,
+    version VARCHAR NOT NULL DEFAULT '',
+    description TEXT,
+    app_version VARCHAR,
+    app_type VARCHAR,
+    content_type VARCHAR,
+    expected_size BIGINT NOT NULL,
+    expected_sha256 VARCHAR(64) NOT NULL,
+    chunk_count INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE upload_chunks (
+    session_id UUID NOT NULL REFERENCES upload_sessions(id) ON DELETE CASCADE,
+    chunk_index INTEGER NOT NULL,
+    storage_key VARCHAR NOT NULL,
+    size BIGINT NOT NULL,
+    uploaded_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (session_id, chunk_index)
+);
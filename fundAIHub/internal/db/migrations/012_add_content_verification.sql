@@ -0,0 +1,3 @@
+ALTER TABLE content
+ADD COLUMN last_verified_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN verification_status VARCHAR(16);
@@ -0,0 +1,5 @@
+ALTER TABLE content
+ADD COLUMN license VARCHAR,
+ADD COLUMN license_url VARCHAR;
+
+CREATE INDEX idx_content_license ON content(license);
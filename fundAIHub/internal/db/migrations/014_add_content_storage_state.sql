@@ -0,0 +1,5 @@
+-- NULL means the object was present the last time it was served
+ALTER TABLE content
+ADD COLUMN storage_state VARCHAR(16);
+
+CREATE INDEX idx_content_storage_state ON content(storage_state) WHERE storage_state IS NOT NULL;
@@ -0,0 +1,3 @@
+-- 'gzip' when the stored object is compressed; NULL when stored as uploaded
+ALTER TABLE content
+ADD COLUMN content_encoding VARCHAR(16);
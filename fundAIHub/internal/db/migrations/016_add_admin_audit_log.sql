@@ -0,0 +1,11 @@
+-- Admin actions taken on behalf of someone else, e.g. viewing a device's plan
+CREATE TABLE admin_audit_log (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    admin_user_id VARCHAR NOT NULL,
+    admin_email VARCHAR,
+    action VARCHAR NOT NULL,
+    target VARCHAR NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_admin_audit_log_created_at ON admin_audit_log(created_at DESC);
@@ -0,0 +1,3 @@
+-- Sizes above 2 GiB overflowed INTEGER
+ALTER TABLE content
+ALTER COLUMN size TYPE BIGINT;
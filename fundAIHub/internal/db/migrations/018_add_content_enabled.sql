@@ -0,0 +1,3 @@
+-- Lets admins pull content temporarily without deleting the record or object
+ALTER TABLE content
+ADD COLUMN enabled BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,3 @@
+-- Row version for optimistic locking of concurrent status updates
+ALTER TABLE downloads
+ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
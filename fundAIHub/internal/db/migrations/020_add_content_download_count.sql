@@ -0,0 +1,23 @@
+-- Completed downloads per content, kept up to date by a trigger so the
+-- catalog can be ordered by popularity without aggregating downloads
+ALTER TABLE content
+ADD COLUMN download_count BIGINT NOT NULL DEFAULT 0;
+
+UPDATE content c
+SET download_count = (
+    SELECT COUNT(*) FROM downloads d
+    WHERE d.content_id = c.id AND d.status = 'completed'
+);
+
+CREATE OR REPLACE FUNCTION count_completed_download() RETURNS trigger AS $$
+BEGIN
+    IF NEW.status = 'completed' AND (TG_OP = 'INSERT' OR OLD.status IS DISTINCT FROM 'completed') THEN
+        UPDATE content SET download_count = download_count + 1 WHERE id = NEW.content_id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER downloads_count_completed
+AFTER INSERT OR UPDATE OF status ON downloads
+FOR EACH ROW EXECUTE FUNCTION count_completed_download();
@@ -0,0 +1,6 @@
+-- Archived content is restored on demand; these track the latest restore.
+-- storage_state is 'archived' or 'rehydrating' while the object is in cold
+-- storage.
+ALTER TABLE content
+ADD COLUMN rehydration_requested_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN rehydration_error TEXT;
@@ -0,0 +1,5 @@
+-- Records which storage backend holds each content's object so backends can
+-- be changed without breaking downloads of existing content. Everything
+-- stored so far is in Supabase.
+ALTER TABLE content
+ADD COLUMN storage_backend TEXT NOT NULL DEFAULT 'supabase';
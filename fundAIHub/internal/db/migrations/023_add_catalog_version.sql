@@ -0,0 +1,19 @@
+-- A counter bumped by every change to content, so clients polling the
+-- catalog can compare an integer instead of re-reading it
+CREATE TABLE catalog_version (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    version BIGINT NOT NULL
+);
+
+INSERT INTO catalog_version (version) VALUES (1);
+
+CREATE OR REPLACE FUNCTION bump_catalog_version() RETURNS trigger AS $$
+BEGIN
+    UPDATE catalog_version SET version = version + 1;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER content_bump_catalog_version
+AFTER INSERT OR UPDATE OR DELETE ON content
+FOR EACH STATEMENT EXECUTE FUNCTION bump_catalog_version();
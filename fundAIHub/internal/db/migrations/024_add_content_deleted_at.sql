@@ -0,0 +1,5 @@
+-- Content is soft-deleted by stamping deleted_at; such records stay in the
+-- table, and their objects in storage, but are hidden from the catalog and
+-- cannot be downloaded.
+ALTER TABLE content
+ADD COLUMN deleted_at TIMESTAMPTZ;
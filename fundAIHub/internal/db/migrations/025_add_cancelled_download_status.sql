@@ -0,0 +1,4 @@
+-- Let a device cancel a download it no longer wants
+ALTER TABLE downloads
+    DROP CONSTRAINT IF EXISTS valid_status,
+    ADD CONSTRAINT valid_status CHECK (status IN ('queued', 'downloading', 'started', 'paused', 'resuming', 'completed', 'failed', 'cancelled'));
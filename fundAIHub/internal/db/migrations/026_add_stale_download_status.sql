@@ -0,0 +1,4 @@
+-- Downloads whose device stopped reporting are marked stale
+ALTER TABLE downloads
+    DROP CONSTRAINT IF EXISTS valid_status,
+    ADD CONSTRAINT valid_status CHECK (status IN ('queued', 'downloading', 'started', 'paused', 'resuming', 'completed', 'failed', 'cancelled', 'stale'));
@@ -0,0 +1,13 @@
+-- Binary patches between two releases of an app type. Versions are stored
+-- in canonical semver form so "v1.2" and "1.2.0" name the same release.
+CREATE TABLE content_deltas (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    app_type VARCHAR NOT NULL,
+    from_version VARCHAR NOT NULL,
+    to_version VARCHAR NOT NULL,
+    storage_key VARCHAR NOT NULL UNIQUE,
+    size BIGINT NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (app_type, from_version, to_version)
+);
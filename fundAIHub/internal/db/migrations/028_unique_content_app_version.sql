@@ -0,0 +1,9 @@
+-- At most one live content record may publish an app_type's version, so
+-- upserts can rely on ON CONFLICT. Uploads without an app_type or version
+-- are not covered. Resolve any existing duplicates before applying:
+--   SELECT app_type, version, COUNT(*) FROM content
+--   WHERE deleted_at IS NULL AND app_type <> '' AND version <> ''
+--   GROUP BY app_type, version HAVING COUNT(*) > 1;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_content_app_type_version
+    ON content (app_type, version)
+    WHERE deleted_at IS NULL AND app_type <> '' AND version <> '';
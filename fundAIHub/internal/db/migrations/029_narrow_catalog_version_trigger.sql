@@ -0,0 +1,20 @@
+-- Only changes clients see in the catalog bump catalog_version. Download
+-- counts, storage state, verification and rehydration bookkeeping change
+-- far more often and would otherwise defeat If-Catalog-Version.
+DROP TRIGGER IF EXISTS content_bump_catalog_version ON content;
+
+CREATE TRIGGER content_bump_catalog_version
+AFTER INSERT OR DELETE ON content
+FOR EACH STATEMENT EXECUTE FUNCTION bump_catalog_version();
+
+CREATE TRIGGER content_update_bump_catalog_version
+AFTER UPDATE ON content
+FOR EACH ROW
+WHEN ((OLD.name, OLD.type, OLD.version, OLD.description, OLD.app_version, OLD.release_date,
+       OLD.app_type, OLD.file_path, OLD.size, OLD.storage_key, OLD.content_type, OLD.checksum,
+       OLD.license, OLD.license_url, OLD.content_encoding, OLD.enabled, OLD.deleted_at)
+      IS DISTINCT FROM
+      (NEW.name, NEW.type, NEW.version, NEW.description, NEW.app_version, NEW.release_date,
+       NEW.app_type, NEW.file_path, NEW.size, NEW.storage_key, NEW.content_type, NEW.checksum,
+       NEW.license, NEW.license_url, NEW.content_encoding, NEW.enabled, NEW.deleted_at))
+EXECUTE FUNCTION bump_catalog_version();
@@ -0,0 +1,4 @@
+-- Pinned content leads every device's download plan, ahead of updates and
+-- new apps. Pinning does not change the catalog, so it does not bump
+-- catalog_version.
+ALTER TABLE content ADD COLUMN IF NOT EXISTS pinned BOOLEAN NOT NULL DEFAULT FALSE;
@@ -2,11 +2,19 @@ package db
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Content is an uploaded file and its catalog metadata. Version is the
+// upload's own version and AppVersion the release it belongs to; releases of
+// an app type are ordered by ReleaseVersion.
 type Content struct {
 	ID          uuid.UUID      `json:"id"`
 	Name        string         `json:"name"`
@@ -17,11 +25,158 @@ type Content struct {
 	ReleaseDate time.Time      `json:"release_date"`
 	AppType     string         `json:"app_type"`
 	FilePath    string         `json:"file_path"`
-	Size        int            `json:"size"`
+	Size        int64          `json:"size"`
 	StorageKey  sql.NullString `json:"storage_key"`
 	ContentType sql.NullString `json:"content_type"`
+	Checksum    sql.NullString `json:"checksum"`
+	License     string         `json:"license"`
+	LicenseURL  string         `json:"license_url"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
+	// LastVerifiedAt and VerificationStatus record the last time the stored
+	// bytes were re-hashed and whether they still matched Checksum
+	LastVerifiedAt     *time.Time     `json:"last_verified_at,omitempty"`
+	VerificationStatus sql.NullString `json:"verification_status"`
+	// StorageState is "missing" once a download found no object behind the
+	// record, "archived" or "rehydrating" while the object is in cold
+	// storage, and null otherwise
+	StorageState sql.NullString `json:"storage_state"`
+	// StorageBackend names the backend holding the object under StorageKey
+	StorageBackend string `json:"storage_backend"`
+	// RehydrationRequestedAt and RehydrationError describe the latest
+	// restore of archived content; the error is cleared by the next attempt
+	RehydrationRequestedAt *time.Time `json:"rehydration_requested_at,omitempty"`
+	RehydrationError       string     `json:"rehydration_error,omitempty"`
+	// ContentEncoding is "gzip" when the stored object is compressed. Size
+	// and Checksum always describe the uncompressed bytes.
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	// Enabled is false while an admin has pulled the content; the record
+	// and object are kept but nothing may be downloaded
+	Enabled bool `json:"enabled"`
+	// DownloadCount is the number of downloads of this content that have
+	// completed, maintained by the database as they do
+	DownloadCount int64 `json:"download_count"`
+	// DeletedAt is set once the content has been soft-deleted. The record
+	// and object are kept for audit and cleanup but hidden from the catalog.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ReleaseVersion is the version content is ordered by among the releases
+// of its app type: AppVersion when set, otherwise Version. GetLatestVersion and
+// ListByVersionRange both compare it and nothing else.
+func (c *Content) ReleaseVersion() string {
+	if c.AppVersion != "" {
+		return c.AppVersion
+	}
+	return c.Version
+}
+
+// DefaultStorageBackend is the backend of content stored before records
+// named one, and of new records that do not
+const DefaultStorageBackend = "supabase"
+
+// Download statuses. StartDownload records a download as queued; it becomes
+// downloading once the client reports its first bytes. DownloadStatusStarted
+// predates that split and is accepted for older clients. A download ends
+// completed, failed or, when its device gives up on it, cancelled. One whose
+// device stops reporting is marked stale until the device picks it up again.
+const (
+	DownloadStatusQueued      = "queued"
+	DownloadStatusDownloading = "downloading"
+	DownloadStatusStarted     = "started"
+	DownloadStatusPaused      = "paused"
+	DownloadStatusResuming    = "resuming"
+	DownloadStatusCompleted   = "completed"
+	DownloadStatusFailed      = "failed"
+	DownloadStatusCancelled   = "cancelled"
+	DownloadStatusStale       = "stale"
+)
+
+// ValidDownloadStatus reports whether status is allowed by the downloads
+// table
+func ValidDownloadStatus(status string) bool {
+	switch status {
+	case DownloadStatusQueued, DownloadStatusDownloading, DownloadStatusStarted,
+		DownloadStatusPaused, DownloadStatusResuming, DownloadStatusCompleted, DownloadStatusFailed,
+		DownloadStatusCancelled, DownloadStatusStale:
+		return true
+	}
+	return false
+}
+
+// TerminalDownloadStatus reports whether status is one a download never
+// leaves
+func TerminalDownloadStatus(status string) bool {
+	switch status {
+	case DownloadStatusCompleted, DownloadStatusFailed, DownloadStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// downloadTransitions lists the statuses each status may move to, besides
+// itself. Started is interchangeable with downloading for older clients;
+// nothing returns to queued, and nothing leaves a terminal status.
+var downloadTransitions = map[string][]string{
+	DownloadStatusQueued: {DownloadStatusDownloading, DownloadStatusStarted, DownloadStatusPaused,
+		DownloadStatusCompleted, DownloadStatusFailed, DownloadStatusCancelled, DownloadStatusStale},
+	DownloadStatusDownloading: {DownloadStatusStarted, DownloadStatusPaused,
+		DownloadStatusCompleted, DownloadStatusFailed, DownloadStatusCancelled, DownloadStatusStale},
+	DownloadStatusStarted: {DownloadStatusDownloading, DownloadStatusPaused,
+		DownloadStatusCompleted, DownloadStatusFailed, DownloadStatusCancelled, DownloadStatusStale},
+	DownloadStatusPaused: {DownloadStatusResuming, DownloadStatusDownloading, DownloadStatusStarted,
+		DownloadStatusFailed, DownloadStatusCancelled, DownloadStatusStale},
+	DownloadStatusResuming: {DownloadStatusDownloading, DownloadStatusStarted, DownloadStatusPaused,
+		DownloadStatusCompleted, DownloadStatusFailed, DownloadStatusCancelled, DownloadStatusStale},
+	// A stale download is picked up where it left off when its device returns
+	DownloadStatusStale: {DownloadStatusResuming, DownloadStatusDownloading, DownloadStatusStarted,
+		DownloadStatusPaused, DownloadStatusFailed, DownloadStatusCancelled},
+}
+
+// ErrInvalidTransition is returned when an update would move a download to
+// a status it cannot take from its current one
+var ErrInvalidTransition = errors.New("invalid download status transition")
+
+// ValidDownloadTransition reports whether a download may move from one
+// status to another. Repeating the current status is always allowed, so a
+// retried update is harmless.
+func ValidDownloadTransition(from, to string) bool {
+	if from == to {
+		return ValidDownloadStatus(to)
+	}
+	for _, next := range downloadTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckDownloadTransition returns an error wrapping ErrInvalidTransition,
+// saying why, if current may not move to status with bytesDownloaded
+// received. Completion also needs every byte of a known total.
+func CheckDownloadTransition(current *Download, status string, bytesDownloaded int64) error {
+	if !ValidDownloadTransition(current.Status, status) {
+		if TerminalDownloadStatus(current.Status) {
+			return fmt.Errorf("%w: download is already %s", ErrInvalidTransition, current.Status)
+		}
+		return fmt.Errorf("%w: a %s download cannot become %s", ErrInvalidTransition, current.Status, status)
+	}
+	if status == DownloadStatusCompleted && current.Status != DownloadStatusCompleted &&
+		current.TotalBytes > 0 && bytesDownloaded < current.TotalBytes {
+		return fmt.Errorf("%w: only %d of %d bytes received", ErrInvalidTransition, bytesDownloaded, current.TotalBytes)
+	}
+	return nil
+}
+
+// ActiveDownloadCounts splits a device's unfinished downloads into those
+// merely queued and those transferring or about to (resuming). Paused
+// downloads are in neither. Holding counts every download in
+// SlotDownloadStatuses, queued and paused included, as the limits do.
+type ActiveDownloadCounts struct {
+	Queued      int
+	Downloading int
+	Holding     int
 }
 
 type Download struct {
@@ -37,4 +192,198 @@ type Download struct {
 	CompletedAt     *time.Time `json:"completed_at,omitempty"`
 	ErrorMessage    *string    `json:"error_message,omitempty"`
 	ResumePosition  int64      `json:"resume_position"`
+	// Version increases on every update; UpdateDownload only writes when
+	// it still matches, so concurrent updates cannot overwrite each other
+	Version int `json:"version"`
+	// BytesPerSecond and ETASeconds are computed by EstimateTransfer for
+	// responses and are not stored. Null when there is nothing to go on.
+	BytesPerSecond *float64 `json:"bytes_per_second"`
+	ETASeconds     *int64   `json:"eta_seconds"`
+}
+
+// EstimateTransfer sets BytesPerSecond from the bytes received between
+// StartedAt and asOf, normally the last progress report, and ETASeconds
+// from the bytes still to come at that rate. A completed download is
+// measured up to CompletedAt and has an ETA of zero.
+func (d *Download) EstimateTransfer(asOf time.Time) {
+	d.BytesPerSecond, d.ETASeconds = nil, nil
+
+	if d.Status == DownloadStatusCompleted {
+		if d.CompletedAt != nil {
+			asOf = *d.CompletedAt
+		}
+		zero := int64(0)
+		d.ETASeconds = &zero
+	}
+
+	elapsed := asOf.Sub(d.StartedAt).Seconds()
+	if elapsed <= 0 || d.BytesDownloaded <= 0 {
+		return
+	}
+	rate := float64(d.BytesDownloaded) / elapsed
+	d.BytesPerSecond = &rate
+
+	if d.Status != DownloadStatusCompleted && d.TotalBytes > d.BytesDownloaded {
+		eta := int64(math.Ceil(float64(d.TotalBytes-d.BytesDownloaded) / rate))
+		d.ETASeconds = &eta
+	}
+}
+
+// DownloadContent is the content metadata shown alongside a download in
+// history
+type DownloadContent struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Size    int64  `json:"size"`
+}
+
+// DownloadWithContent is a download with its content's metadata. Content is
+// nil when the content record no longer exists.
+type DownloadWithContent struct {
+	Download
+	Content *DownloadContent `json:"content"`
+}
+
+// ContentStats summarises how widely a content record has been downloaded.
+// UniqueDevices is its reach; CompletedDownloads also counts re-downloads.
+type ContentStats struct {
+	ContentID          uuid.UUID `json:"content_id"`
+	Name               string    `json:"name"`
+	Version            string    `json:"version"`
+	CompletedDownloads int       `json:"completed_downloads"`
+	UniqueDevices      int       `json:"unique_devices"`
+}
+
+// ContentDownloadStat counts a content record's downloads by outcome.
+// InProgress covers downloads not yet finished or abandoned, and
+// BytesTransferred sums bytes_downloaded over all of them.
+type ContentDownloadStat struct {
+	ContentID        uuid.UUID `json:"content_id"`
+	Name             string    `json:"name"`
+	Version          string    `json:"version"`
+	Completed        int       `json:"completed"`
+	Failed           int       `json:"failed"`
+	InProgress       int       `json:"in_progress"`
+	BytesTransferred int64     `json:"bytes_transferred"`
+}
+
+// UploadSession is a chunked upload in progress. The expected size and
+// checksum are declared up front and checked when the upload is finalized.
+type UploadSession struct {
+	ID             uuid.UUID `json:"id"`
+	Filename       string    `json:"filename"`
+	Version        string    `json:"version"`
+	Description    string    `json:"description"`
+	AppVersion     string    `json:"app_version"`
+	AppType        string    `json:"app_type"`
+	ContentType    string    `json:"content_type"`
+	ExpectedSize   int64     `json:"expected_size"`
+	ExpectedSHA256 string    `json:"expected_sha256"`
+	ChunkCount     int       `json:"chunk_count"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ContentDelta is a binary patch that turns release FromVersion of an app
+// type into ToVersion. Versions are canonical semver strings; see
+// CanonicalVersion.
+type ContentDelta struct {
+	ID          uuid.UUID `json:"id"`
+	AppType     string    `json:"app_type"`
+	FromVersion string    `json:"from_version"`
+	ToVersion   string    `json:"to_version"`
+	StorageKey  string    `json:"storage_key"`
+	Size        int64     `json:"size"`
+	Checksum    string    `json:"checksum"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// UploadChunk is one stored part of an upload session
+type UploadChunk struct {
+	Index      int    `json:"index"`
+	StorageKey string `json:"storage_key"`
+	Size       int64  `json:"size"`
+}
+
+// WebhookSubscription is an endpoint that receives catalog change events
+type WebhookSubscription struct {
+	ID        uuid.UUID `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDeadLetter records a delivery that failed on every attempt
+type WebhookDeadLetter struct {
+	ID             uuid.UUID `json:"id"`
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	URL            string    `json:"url"`
+	Event          string    `json:"event"`
+	Payload        []byte    `json:"payload"`
+	Attempts       int       `json:"attempts"`
+	LastError      string    `json:"last_error"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// PlanCandidate is a content item a device has not downloaded yet
+type PlanCandidate struct {
+	ID          uuid.UUID
+	Name        string
+	Version     string
+	AppType     string
+	Size        int64
+	CreatedAt   time.Time
+	UpdatedAt   time.Time // The revision, to sign URLs without reloading the record
+	Pinned      bool
+	InstalledAt *time.Time
+
+	// StorageState is "" or, for content in cold storage, "archived" or
+	// "rehydrating"
+	StorageState string
+}
+
+// DownloadCursor marks the last row of a download history page.
+type DownloadCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// ErrInvalidCursor is returned when a pagination token cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Encode returns the opaque token handed to clients in X-Next-Cursor.
+func (c DownloadCursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeDownloadCursor parses a token produced by DownloadCursor.Encode.
+func DecodeDownloadCursor(token string) (*DownloadCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &DownloadCursor{CreatedAt: t, ID: u}, nil
+}
+
+// AuditEntry is a row of admin_audit_log
+type AuditEntry struct {
+	ID          uuid.UUID `json:"id"`
+	AdminUserID string    `json:"admin_user_id"`
+	AdminEmail  string    `json:"admin_email,omitempty"`
+	Action      string    `json:"action"`
+	Target      string    `json:"target"`
+	CreatedAt   time.Time `json:"created_at"`
 }
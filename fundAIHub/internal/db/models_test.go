@@ -0,0 +1,136 @@
+package db_test
+
+import (
+	"FundAIHub/internal/db"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEstimateTransfer(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	completedAt := start.Add(20 * time.Second)
+
+	tests := []struct {
+		name     string
+		download db.Download
+		asOf     time.Time
+		wantRate float64 // 0 means null
+		wantETA  int64   // -1 means null
+	}{
+		{
+			"In progress",
+			db.Download{Status: db.DownloadStatusDownloading, BytesDownloaded: 1000, TotalBytes: 3000, StartedAt: start},
+			start.Add(10 * time.Second), 100, 20,
+		},
+		{
+			"ETA rounds up",
+			db.Download{Status: db.DownloadStatusDownloading, BytesDownloaded: 1000, TotalBytes: 1150, StartedAt: start},
+			start.Add(10 * time.Second), 100, 2,
+		},
+		{
+			"Zero elapsed",
+			db.Download{Status: db.DownloadStatusDownloading, BytesDownloaded: 1000, TotalBytes: 3000, StartedAt: start},
+			start, 0, -1,
+		},
+		{
+			"No bytes yet",
+			db.Download{Status: db.DownloadStatusQueued, TotalBytes: 3000, StartedAt: start},
+			start.Add(10 * time.Second), 0, -1,
+		},
+		{
+			"Unknown total",
+			db.Download{Status: db.DownloadStatusDownloading, BytesDownloaded: 1000, StartedAt: start},
+			start.Add(10 * time.Second), 100, -1,
+		},
+		{
+			"Completed measured to completion",
+			db.Download{Status: db.DownloadStatusCompleted, BytesDownloaded: 3000, TotalBytes: 3000, StartedAt: start, CompletedAt: &completedAt},
+			start.Add(time.Hour), 150, 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := tt.download
+			d.EstimateTransfer(tt.asOf)
+
+			switch {
+			case tt.wantRate == 0 && d.BytesPerSecond != nil:
+				t.Errorf("Expected null bytes_per_second, got %v", *d.BytesPerSecond)
+			case tt.wantRate != 0 && (d.BytesPerSecond == nil || *d.BytesPerSecond != tt.wantRate):
+				t.Errorf("Expected bytes_per_second %v, got %v", tt.wantRate, d.BytesPerSecond)
+			}
+			switch {
+			case tt.wantETA == -1 && d.ETASeconds != nil:
+				t.Errorf("Expected null eta_seconds, got %d", *d.ETASeconds)
+			case tt.wantETA != -1 && (d.ETASeconds == nil || *d.ETASeconds != tt.wantETA):
+				t.Errorf("Expected eta_seconds %d, got %v", tt.wantETA, d.ETASeconds)
+			}
+		})
+	}
+}
+
+func TestCheckDownloadTransition(t *testing.T) {
+	all := []string{
+		db.DownloadStatusQueued, db.DownloadStatusDownloading, db.DownloadStatusStarted,
+		db.DownloadStatusPaused, db.DownloadStatusResuming, db.DownloadStatusCompleted,
+		db.DownloadStatusFailed, db.DownloadStatusCancelled, db.DownloadStatusStale,
+	}
+	// allowed lists every permitted move away from each status
+	allowed := map[string][]string{
+		db.DownloadStatusQueued:      {"downloading", "started", "paused", "completed", "failed", "cancelled", "stale"},
+		db.DownloadStatusDownloading: {"started", "paused", "completed", "failed", "cancelled", "stale"},
+		db.DownloadStatusStarted:     {"downloading", "paused", "completed", "failed", "cancelled", "stale"},
+		db.DownloadStatusPaused:      {"resuming", "downloading", "started", "failed", "cancelled", "stale"},
+		db.DownloadStatusResuming:    {"downloading", "started", "paused", "completed", "failed", "cancelled", "stale"},
+		db.DownloadStatusStale:       {"resuming", "downloading", "started", "paused", "failed", "cancelled"},
+		db.DownloadStatusCompleted:   nil,
+		db.DownloadStatusFailed:      nil,
+		db.DownloadStatusCancelled:   nil,
+	}
+
+	for _, from := range all {
+		for _, to := range all {
+			want := from == to
+			for _, next := range allowed[from] {
+				want = want || next == to
+			}
+			t.Run(from+" to "+to, func(t *testing.T) {
+				err := db.CheckDownloadTransition(&db.Download{Status: from}, to, 0)
+				if got := err == nil; got != want {
+					t.Errorf("CheckDownloadTransition(%s, %s) = %v, want allowed %t", from, to, err, want)
+				}
+				if err != nil && !errors.Is(err, db.ErrInvalidTransition) {
+					t.Errorf("Expected ErrInvalidTransition, got %v", err)
+				}
+			})
+		}
+	}
+
+	t.Run("Unknown status", func(t *testing.T) {
+		if err := db.CheckDownloadTransition(&db.Download{Status: db.DownloadStatusQueued}, "bogus", 0); err == nil {
+			t.Error("Expected an unknown status to be refused")
+		}
+	})
+}
+
+func TestCheckDownloadTransitionCompletion(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  db.Download
+		bytes    int64
+		wantFail bool
+	}{
+		{"All bytes received", db.Download{Status: db.DownloadStatusDownloading, TotalBytes: 1024}, 1024, false},
+		{"Bytes short of total", db.Download{Status: db.DownloadStatusDownloading, TotalBytes: 1024}, 512, true},
+		{"Unknown total", db.Download{Status: db.DownloadStatusDownloading}, 512, false},
+		{"Repeated completion", db.Download{Status: db.DownloadStatusCompleted, TotalBytes: 1024}, 512, false},
+	}
+	for _, tt := range tests {
+		err := db.CheckDownloadTransition(&tt.current, db.DownloadStatusCompleted, tt.bytes)
+		if (err != nil) != tt.wantFail {
+			t.Errorf("%s: CheckDownloadTransition = %v, want failure %t", tt.name, err, tt.wantFail)
+		}
+	}
+}
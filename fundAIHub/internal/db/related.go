@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// ListRelated returns up to limit enabled, downloadable content records
+// sharing contentID's app_type, newest first. Content without an app_type
+// has no related records.
+func (s *ContentStore) ListRelated(ctx context.Context, contentID uuid.UUID, limit int) (_ []Content, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT c.id, c.name, c.version, COALESCE(c.app_type, ''), c.size
+		FROM content src
+		JOIN content c ON c.app_type = src.app_type AND c.id <> src.id
+		WHERE src.id = $1
+		  AND COALESCE(src.app_type, '') <> ''
+		  AND c.storage_key IS NOT NULL
+		  AND c.enabled
+		  AND c.deleted_at IS NULL
+		ORDER BY c.created_at DESC, c.id
+		LIMIT $2`
+
+	return s.queryDependencies(ctx, query, contentID, limit)
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TerminalDownloadStatuses are the statuses a download never leaves, and so
+// the only ones PurgeOldDownloads will delete
+var TerminalDownloadStatuses = []string{DownloadStatusCompleted, DownloadStatusFailed, DownloadStatusCancelled}
+
+// PurgeOldDownloads deletes downloads in one of statuses that finished, or
+// were last updated, more than olderThan ago, and returns how many it
+// deleted. Empty statuses means every terminal status; a non-terminal status
+// is rejected so in-flight downloads are never removed.
+func (s *ContentStore) PurgeOldDownloads(ctx context.Context, olderThan time.Duration, statuses []string) (_ int64, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	if olderThan <= 0 {
+		return 0, fmt.Errorf("retention must be positive, got %s", olderThan)
+	}
+	if len(statuses) == 0 {
+		statuses = TerminalDownloadStatuses
+	}
+	for _, status := range statuses {
+		if !TerminalDownloadStatus(status) {
+			return 0, fmt.Errorf("cannot purge downloads with non-terminal status %q", status)
+		}
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM downloads
+		WHERE status = ANY($1)
+		  AND COALESCE(completed_at, last_updated_at, created_at) < $2`,
+		pq.Array(statuses), time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// MarkStaleDownloads marks unfinished downloads that have not been updated
+// for olderThan as stale, so a device that disappeared stops holding
+// transfer slots, and returns how many it marked. last_updated_at is left
+// alone so the download's age still shows when it was last heard from.
+func (s *ContentStore) MarkStaleDownloads(ctx context.Context, olderThan time.Duration) (_ int64, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	if olderThan <= 0 {
+		return 0, fmt.Errorf("stale threshold must be positive, got %s", olderThan)
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE downloads
+		SET status = 'stale',
+		    version = version + 1
+		WHERE status IN ('queued', 'downloading', 'started', 'paused', 'resuming')
+		  AND COALESCE(last_updated_at, created_at) < $1`,
+		time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// WidenSizeColumn makes content.size a BIGINT, as migration 017 does, for
+// databases that predate it. It reports whether the column needed changing.
+func (s *ContentStore) WidenSizeColumn(ctx context.Context) (_ bool, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	var dataType string
+	err = s.db.QueryRowContext(ctx, `
+		SELECT data_type
+		FROM information_schema.columns
+		WHERE table_name = 'content' AND column_name = 'size'`).Scan(&dataType)
+	if err != nil {
+		return false, err
+	}
+	if dataType == "bigint" {
+		return false, nil
+	}
+
+	if _, err := s.db.ExecContext(ctx, `ALTER TABLE content ALTER COLUMN size TYPE BIGINT`); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ListSuspectSizes returns stored content whose recorded size cannot be
+// right: zero, or negative from an INTEGER that overflowed before the column
+// was widened
+func (s *ContentStore) ListSuspectSizes(ctx context.Context) (_ []Content, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT id, name, storage_key, size, COALESCE(content_encoding, ''), storage_backend
+		FROM content
+		WHERE storage_key IS NOT NULL AND size <= 0
+		ORDER BY created_at`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contents []Content
+	for rows.Next() {
+		var c Content
+		if err := rows.Scan(&c.ID, &c.Name, &c.StorageKey, &c.Size, &c.ContentEncoding, &c.StorageBackend); err != nil {
+			return nil, err
+		}
+		contents = append(contents, c)
+	}
+	return contents, rows.Err()
+}
+
+// UpdateSize corrects the size recorded for a content record. Like
+// UpdateContentType it leaves updated_at alone, since the stored bytes are
+// unchanged.
+func (s *ContentStore) UpdateSize(ctx context.Context, id uuid.UUID, size int64) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	result, err := s.db.ExecContext(ctx, `UPDATE content SET size = $1 WHERE id = $2`, size, id)
+	if err != nil {
+		return err
+	}
+	s.invalidate(id)
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
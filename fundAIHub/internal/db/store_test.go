@@ -0,0 +1,1004 @@
+package db_test
+
+import (
+	"FundAIHub/internal/db"
+	"FundAIHub/internal/testdb"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Run(m))
+}
+
+func createContent(t *testing.T, store *db.ContentStore, name string) *db.Content {
+	t.Helper()
+	content := &db.Content{
+		Name:       name,
+		Type:       "test",
+		Version:    "1.0.0",
+		FilePath:   name,
+		Size:       1024,
+		StorageKey: sql.NullString{String: name, Valid: true},
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("Create %s: %v", name, err)
+	}
+	return content
+}
+
+func TestContentCRUD(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	content := createContent(t, store, "crud.zip")
+
+	got, err := store.Get(ctx, content.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Name != "crud.zip" || got.StorageKey.String != "crud.zip" {
+		t.Errorf("Get returned %+v", got)
+	}
+
+	content.Version = "1.1.0"
+	if err := store.Update(ctx, content); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	list, _, err := store.List(ctx, db.ListOptions{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 || list[0].Version != "1.1.0" {
+		t.Errorf("List returned %+v", list)
+	}
+
+	if err := store.Delete(ctx, content.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, content.ID); err != sql.ErrNoRows {
+		t.Errorf("Get after delete: expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestContentSizeAbove2GiB(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	const size = int64(5) << 30
+	content := &db.Content{
+		Name:       "large.img",
+		Type:       "test",
+		Version:    "1.0.0",
+		FilePath:   "large.img",
+		Size:       size,
+		StorageKey: sql.NullString{String: "large.img", Valid: true},
+	}
+	if err := store.Create(ctx, content); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, err := store.Get(ctx, content.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Size != size {
+		t.Errorf("Size = %d, want %d", got.Size, size)
+	}
+
+	list, _, err := store.List(ctx, db.ListOptions{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 || list[0].Size != size {
+		t.Errorf("List returned %+v", list)
+	}
+}
+
+func TestDownloadLifecycle(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	content := createContent(t, store, "download.zip")
+	deviceID := uuid.New()
+
+	download := &db.Download{
+		DeviceID:  deviceID,
+		UserID:    "test-user",
+		ContentID: content.ID,
+		Status:    db.DownloadStatusQueued,
+	}
+	if err := store.CreateDownload(ctx, download); err != nil {
+		t.Fatalf("CreateDownload: %v", err)
+	}
+
+	download.Status = db.DownloadStatusDownloading
+	download.BytesDownloaded = 512
+	if err := store.UpdateDownload(ctx, download); err != nil {
+		t.Fatalf("UpdateDownload: %v", err)
+	}
+
+	got, err := store.GetDownloadByID(ctx, download.ID)
+	if err != nil {
+		t.Fatalf("GetDownloadByID: %v", err)
+	}
+	if got.Status != db.DownloadStatusDownloading || got.BytesDownloaded != 512 {
+		t.Errorf("GetDownloadByID returned %+v", got)
+	}
+
+	counts, err := store.CountActiveDownloads(ctx, deviceID)
+	if err != nil {
+		t.Fatalf("CountActiveDownloads: %v", err)
+	}
+	if counts.Downloading != 1 {
+		t.Errorf("CountActiveDownloads = %+v, want 1 downloading", counts)
+	}
+
+	// A paused download holds no transfer slot
+	download.Status = db.DownloadStatusPaused
+	if err := store.UpdateDownload(ctx, download); err != nil {
+		t.Fatalf("UpdateDownload: %v", err)
+	}
+	if counts, err := store.CountActiveDownloads(ctx, deviceID); err != nil || counts.Downloading != 0 {
+		t.Errorf("CountActiveDownloads = %+v, %v after pausing, want none downloading", counts, err)
+	}
+
+	history, next, err := store.ListDownloadsByDeviceID(ctx, deviceID, nil, 10)
+	if err != nil {
+		t.Fatalf("ListDownloadsByDeviceID: %v", err)
+	}
+	if len(history) != 1 || next != nil {
+		t.Errorf("ListDownloadsByDeviceID returned %d downloads, next %v", len(history), next)
+	}
+
+	joined, _, err := store.ListDownloadsWithContentByDeviceID(ctx, deviceID, nil, 10)
+	if err != nil {
+		t.Fatalf("ListDownloadsWithContentByDeviceID: %v", err)
+	}
+	if len(joined) != 1 || joined[0].Content == nil || joined[0].Content.Name != content.Name {
+		t.Errorf("ListDownloadsWithContentByDeviceID returned %+v", joined)
+	}
+}
+
+func TestUpdateDownloadOptimisticLock(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	content := createContent(t, store, "locked.zip")
+	download := &db.Download{
+		DeviceID:  uuid.New(),
+		UserID:    "test-user",
+		ContentID: content.ID,
+		Status:    db.DownloadStatusDownloading,
+	}
+	if err := store.CreateDownload(ctx, download); err != nil {
+		t.Fatalf("CreateDownload: %v", err)
+	}
+
+	// Every writer read the same version; only one may win
+	const writers = 8
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			d := *download
+			d.BytesDownloaded = int64(i)
+			if i == 0 {
+				d.Status = db.DownloadStatusCompleted
+			}
+			errs <- store.UpdateDownload(ctx, &d)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	won := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			won++
+		case !errors.Is(err, db.ErrVersionConflict):
+			t.Errorf("UpdateDownload: unexpected error %v", err)
+		}
+	}
+	if won != 1 {
+		t.Fatalf("Expected exactly one update to succeed, got %d", won)
+	}
+
+	got, err := store.GetDownloadByID(ctx, download.ID)
+	if err != nil {
+		t.Fatalf("GetDownloadByID: %v", err)
+	}
+	if got.Version != download.Version+1 {
+		t.Errorf("Version = %d, want %d", got.Version, download.Version+1)
+	}
+
+	// A late write from the original read must not clobber the winner,
+	// e.g. a progress update arriving after completion
+	stale := *download
+	stale.Status = db.DownloadStatusPaused
+	if err := store.UpdateDownload(ctx, &stale); !errors.Is(err, db.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict for stale write, got %v", err)
+	}
+	again, err := store.GetDownloadByID(ctx, download.ID)
+	if err != nil {
+		t.Fatalf("GetDownloadByID: %v", err)
+	}
+	if again.Status != got.Status || again.BytesDownloaded != got.BytesDownloaded {
+		t.Errorf("Stale write changed the download: %+v, want %+v", again, got)
+	}
+
+	missing := &db.Download{ID: uuid.New()}
+	if err := store.UpdateDownload(ctx, missing); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for unknown download, got %v", err)
+	}
+}
+
+func TestUpdateDownloadTransitions(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	content := createContent(t, store, "transitions.zip")
+	download := &db.Download{
+		DeviceID:   uuid.New(),
+		UserID:     "test-user",
+		ContentID:  content.ID,
+		Status:     db.DownloadStatusQueued,
+		TotalBytes: 1024,
+	}
+	if err := store.CreateDownload(ctx, download); err != nil {
+		t.Fatalf("CreateDownload: %v", err)
+	}
+
+	download.Status = db.DownloadStatusDownloading
+	download.BytesDownloaded = 512
+	if err := store.UpdateDownload(ctx, download); err != nil {
+		t.Fatalf("UpdateDownload: %v", err)
+	}
+	if download.CompletedAt != nil {
+		t.Errorf("Expected no completed_at while downloading, got %v", download.CompletedAt)
+	}
+
+	download.Status = db.DownloadStatusCompleted
+	if err := store.UpdateDownload(ctx, download); !errors.Is(err, db.ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition completing at 512 of 1024 bytes, got %v", err)
+	}
+
+	download.BytesDownloaded = 1024
+	if err := store.UpdateDownload(ctx, download); err != nil {
+		t.Fatalf("UpdateDownload to completed: %v", err)
+	}
+	if download.CompletedAt == nil {
+		t.Fatal("Expected completed_at to be set by the completing update")
+	}
+	completedAt := *download.CompletedAt
+
+	if err := store.UpdateDownload(ctx, download); err != nil {
+		t.Fatalf("Repeated completion: %v", err)
+	}
+	if download.CompletedAt == nil || !download.CompletedAt.Equal(completedAt) {
+		t.Errorf("Expected completed_at to stay %v, got %v", completedAt, download.CompletedAt)
+	}
+
+	download.Status = db.DownloadStatusDownloading
+	if err := store.UpdateDownload(ctx, download); !errors.Is(err, db.ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition leaving completed, got %v", err)
+	}
+}
+
+func TestCountUniqueDevicesByContent(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	content := createContent(t, store, "reach.zip")
+	device := uuid.New()
+
+	// The same device twice plus one other device
+	for _, d := range []uuid.UUID{device, device, uuid.New()} {
+		download := &db.Download{DeviceID: d, UserID: "u", ContentID: content.ID, Status: db.DownloadStatusCompleted}
+		if err := store.CreateDownload(ctx, download); err != nil {
+			t.Fatalf("CreateDownload: %v", err)
+		}
+	}
+
+	count, err := store.CountUniqueDevicesByContent(ctx, content.ID)
+	if err != nil {
+		t.Fatalf("CountUniqueDevicesByContent: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("unique devices = %d, want 2", count)
+	}
+}
+
+func TestDownloadStats(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	content := createContent(t, store, "popular.zip")
+	for _, d := range []struct {
+		status string
+		bytes  int64
+	}{
+		{db.DownloadStatusCompleted, 100},
+		{db.DownloadStatusCompleted, 100},
+		{db.DownloadStatusFailed, 30},
+		{db.DownloadStatusDownloading, 50},
+		{db.DownloadStatusCancelled, 10},
+	} {
+		download := &db.Download{DeviceID: uuid.New(), UserID: "u", ContentID: content.ID, Status: d.status, BytesDownloaded: d.bytes}
+		if err := store.CreateDownload(ctx, download); err != nil {
+			t.Fatalf("CreateDownload: %v", err)
+		}
+	}
+
+	find := func(stats []db.ContentDownloadStat) *db.ContentDownloadStat {
+		for i := range stats {
+			if stats[i].ContentID == content.ID {
+				return &stats[i]
+			}
+		}
+		t.Fatalf("No stats for content %s", content.ID)
+		return nil
+	}
+
+	stats, err := store.DownloadStats(ctx, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("DownloadStats: %v", err)
+	}
+	got := find(stats)
+	if got.Completed != 2 || got.Failed != 1 || got.InProgress != 1 || got.BytesTransferred != 290 {
+		t.Errorf("DownloadStats = %+v", got)
+	}
+
+	stats, err = store.DownloadStats(ctx, time.Now().Add(time.Hour), time.Time{})
+	if err != nil {
+		t.Fatalf("DownloadStats: %v", err)
+	}
+	if got := find(stats); got.Completed != 0 || got.BytesTransferred != 0 {
+		t.Errorf("Expected no downloads after from, got %+v", got)
+	}
+}
+
+func TestListSorted(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	// Created in this order, so b is newest; sizes and completed downloads
+	// are chosen so every ordering differs
+	c := createContent(t, store, "c.zip")
+	a := createContent(t, store, "a.zip")
+	b := createContent(t, store, "b.zip")
+	for content, size := range map[*db.Content]int64{a: 300, b: 100, c: 200} {
+		content.Size = size
+		if err := store.Update(ctx, content); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+	for id, completed := range map[uuid.UUID]int{a.ID: 1, c.ID: 2} {
+		for i := 0; i < completed; i++ {
+			download := &db.Download{DeviceID: uuid.New(), UserID: "u", ContentID: id, Status: db.DownloadStatusCompleted}
+			if err := store.CreateDownload(ctx, download); err != nil {
+				t.Fatalf("CreateDownload: %v", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{db.SortName, []string{"a.zip", "b.zip", "c.zip"}},
+		{db.SortCreatedAt, []string{"b.zip", "a.zip", "c.zip"}},
+		{db.SortSize, []string{"b.zip", "c.zip", "a.zip"}},
+		{db.SortPopularity, []string{"c.zip", "a.zip", "b.zip"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			list, _, err := store.List(ctx, db.ListOptions{Sort: tt.sort})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var got []string
+			for _, c := range list {
+				got = append(got, c.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("List sorted by %q = %v, want %v", tt.sort, got, tt.want)
+			}
+		})
+	}
+
+	list, _, err := store.List(ctx, db.ListOptions{Sort: db.SortPopularity})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if list[0].DownloadCount != 2 {
+		t.Errorf("DownloadCount = %d, want 2", list[0].DownloadCount)
+	}
+	if _, _, err := store.List(ctx, db.ListOptions{Sort: "downloads"}); err != db.ErrInvalidSort {
+		t.Errorf("Expected ErrInvalidSort, got %v", err)
+	}
+}
+
+func TestListPlanCandidatesPinnedFirst(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	old := createContent(t, store, "old.zip")
+	createContent(t, store, "mid.zip")
+	createContent(t, store, "new.zip")
+	if err := store.SetPinned(ctx, old.ID, true); err != nil {
+		t.Fatalf("SetPinned: %v", err)
+	}
+
+	candidates, err := store.ListPlanCandidates(ctx, uuid.New())
+	if err != nil {
+		t.Fatalf("ListPlanCandidates: %v", err)
+	}
+	var got []string
+	for _, c := range candidates {
+		got = append(got, c.Name)
+	}
+	if want := "old.zip,new.zip,mid.zip"; strings.Join(got, ",") != want {
+		t.Errorf("Candidates = %v, want %s", got, want)
+	}
+	if !candidates[0].Pinned || candidates[1].Pinned {
+		t.Errorf("Expected only the first candidate pinned, got %+v", candidates)
+	}
+
+	if err := store.SetPinned(ctx, uuid.New(), true); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows pinning unknown content, got %v", err)
+	}
+}
+
+func TestListPlanCandidatesStorageState(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	missing := createContent(t, store, "missing.zip")
+	archived := createContent(t, store, "archived.zip")
+	if err := store.SetStorageState(ctx, missing.ID, db.StorageStateMissing); err != nil {
+		t.Fatalf("SetStorageState: %v", err)
+	}
+	if err := store.SetStorageState(ctx, archived.ID, db.StorageStateArchived); err != nil {
+		t.Fatalf("SetStorageState: %v", err)
+	}
+
+	candidates, err := store.ListPlanCandidates(ctx, uuid.New())
+	if err != nil {
+		t.Fatalf("ListPlanCandidates: %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].ID != archived.ID {
+		t.Fatalf("Expected only the archived record, got %+v", candidates)
+	}
+	if candidates[0].StorageState != db.StorageStateArchived {
+		t.Errorf("StorageState = %q, want %q", candidates[0].StorageState, db.StorageStateArchived)
+	}
+}
+
+func TestVersionOrderingAgrees(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	// Version and AppVersion disagree: releases are ordered by AppVersion
+	appType := "ordering-" + uuid.New().String()
+	for _, v := range [][2]string{{"9.0.0", "1.0.0"}, {"1.0.0", "2.0.0"}} {
+		content := &db.Content{
+			Name:       v[1] + ".zip",
+			Type:       "test",
+			Version:    v[0],
+			AppVersion: v[1],
+			AppType:    appType,
+			FilePath:   v[1] + ".zip",
+			Size:       1024,
+			StorageKey: sql.NullString{String: appType + "/" + v[1] + ".zip", Valid: true},
+		}
+		if err := store.Create(ctx, content); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	latest, err := store.GetLatestVersion(ctx, appType)
+	if err != nil {
+		t.Fatalf("GetLatestVersion: %v", err)
+	}
+	listed, err := store.ListByVersionRange(ctx, appType, "", "")
+	if err != nil {
+		t.Fatalf("ListByVersionRange: %v", err)
+	}
+	if latest.ReleaseVersion() != "2.0.0" || len(listed) != 2 || listed[1].ID != latest.ID {
+		t.Errorf("Expected 2.0.0 latest and last in range, got %s and %+v", latest.ReleaseVersion(), listed)
+	}
+
+	listed, err = store.ListByVersionRange(ctx, appType, "1.5.0", "")
+	if err != nil {
+		t.Fatalf("ListByVersionRange: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != latest.ID {
+		t.Errorf("Expected only the 2.0.0 release from 1.5.0, got %+v", listed)
+	}
+}
+
+func TestPurgeOldDownloads(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	content := createContent(t, store, "purge.zip")
+	ids := map[string]uuid.UUID{}
+	for _, status := range []string{db.DownloadStatusCompleted, db.DownloadStatusFailed, db.DownloadStatusDownloading} {
+		download := &db.Download{DeviceID: uuid.New(), UserID: "u", ContentID: content.ID, Status: status}
+		if err := store.CreateDownload(ctx, download); err != nil {
+			t.Fatalf("CreateDownload: %v", err)
+		}
+		ids[status] = download.ID
+	}
+
+	// Nothing is old enough yet
+	if n, err := store.PurgeOldDownloads(ctx, time.Hour, nil); err != nil || n != 0 {
+		t.Fatalf("PurgeOldDownloads(1h) = %d, %v; want 0", n, err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	n, err := store.PurgeOldDownloads(ctx, 10*time.Millisecond, []string{db.DownloadStatusFailed})
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeOldDownloads(failed) = %d, %v; want 1", n, err)
+	}
+	if _, err := store.GetDownloadByID(ctx, ids[db.DownloadStatusFailed]); err != sql.ErrNoRows {
+		t.Errorf("Failed download should be purged, got %v", err)
+	}
+
+	n, err = store.PurgeOldDownloads(ctx, 10*time.Millisecond, nil)
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeOldDownloads = %d, %v; want 1", n, err)
+	}
+	if _, err := store.GetDownloadByID(ctx, ids[db.DownloadStatusDownloading]); err != nil {
+		t.Errorf("In-flight download should be kept: %v", err)
+	}
+
+	if _, err := store.PurgeOldDownloads(ctx, time.Hour, []string{db.DownloadStatusDownloading}); err == nil {
+		t.Error("Expected an error purging a non-terminal status")
+	}
+}
+
+func TestMarkStaleDownloads(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	content := createContent(t, store, "stale.zip")
+	deviceID := uuid.New()
+	ids := map[string]uuid.UUID{}
+	for _, status := range []string{db.DownloadStatusDownloading, db.DownloadStatusPaused, db.DownloadStatusCompleted} {
+		download := &db.Download{DeviceID: deviceID, UserID: "u", ContentID: content.ID, Status: status}
+		if err := store.CreateDownload(ctx, download); err != nil {
+			t.Fatalf("CreateDownload: %v", err)
+		}
+		ids[status] = download.ID
+	}
+
+	if n, err := store.MarkStaleDownloads(ctx, time.Hour); err != nil || n != 0 {
+		t.Fatalf("MarkStaleDownloads(1h) = %d, %v; want 0", n, err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	n, err := store.MarkStaleDownloads(ctx, 10*time.Millisecond)
+	if err != nil || n != 2 {
+		t.Fatalf("MarkStaleDownloads = %d, %v; want 2", n, err)
+	}
+	for status, want := range map[string]string{
+		db.DownloadStatusDownloading: db.DownloadStatusStale,
+		db.DownloadStatusPaused:      db.DownloadStatusStale,
+		db.DownloadStatusCompleted:   db.DownloadStatusCompleted,
+	} {
+		got, err := store.GetDownloadByID(ctx, ids[status])
+		if err != nil {
+			t.Fatalf("GetDownloadByID: %v", err)
+		}
+		if got.Status != want {
+			t.Errorf("%s download is now %s, want %s", status, got.Status, want)
+		}
+	}
+
+	counts, err := store.CountActiveDownloads(ctx, deviceID)
+	if err != nil {
+		t.Fatalf("CountActiveDownloads: %v", err)
+	}
+	if counts.Downloading != 0 || counts.Queued != 0 {
+		t.Errorf("Expected stale downloads not to count as active, got %+v", counts)
+	}
+
+	// The device coming back picks the download up again
+	stale, _ := store.GetDownloadByID(ctx, ids[db.DownloadStatusPaused])
+	stale.Status = db.DownloadStatusResuming
+	if err := store.UpdateDownload(ctx, stale); err != nil {
+		t.Errorf("Resuming a stale download: %v", err)
+	}
+
+	if _, err := store.MarkStaleDownloads(ctx, 0); err == nil {
+		t.Error("Expected an error for a zero threshold")
+	}
+}
+
+func TestRepairSuspectSizes(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	good := createContent(t, store, "good.zip")
+	overflowed := createContent(t, store, "overflowed.img")
+	if err := store.UpdateSize(ctx, overflowed.ID, -1073741824); err != nil {
+		t.Fatalf("UpdateSize: %v", err)
+	}
+
+	widened, err := store.WidenSizeColumn(ctx)
+	if err != nil {
+		t.Fatalf("WidenSizeColumn: %v", err)
+	}
+	if widened {
+		t.Error("Migrations already widen size; expected no change")
+	}
+
+	suspect, err := store.ListSuspectSizes(ctx)
+	if err != nil {
+		t.Fatalf("ListSuspectSizes: %v", err)
+	}
+	if len(suspect) != 1 || suspect[0].ID != overflowed.ID {
+		t.Fatalf("ListSuspectSizes returned %+v, want only %s", suspect, overflowed.ID)
+	}
+	if suspect[0].StorageBackend != db.DefaultStorageBackend {
+		t.Errorf("StorageBackend = %q, want %q", suspect[0].StorageBackend, db.DefaultStorageBackend)
+	}
+
+	const size = int64(3) << 30
+	if err := store.UpdateSize(ctx, overflowed.ID, size); err != nil {
+		t.Fatalf("UpdateSize: %v", err)
+	}
+	got, err := store.Get(ctx, overflowed.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Size != size || !got.UpdatedAt.Equal(overflowed.UpdatedAt) {
+		t.Errorf("After UpdateSize got size %d, updated_at %v; want %d, %v", got.Size, got.UpdatedAt, size, overflowed.UpdatedAt)
+	}
+	if g, _ := store.Get(ctx, good.ID); g.Size != good.Size {
+		t.Errorf("Untouched record size changed to %d", g.Size)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	for i, name := range []string{"a.zip", "b.zip", "c.zip", "d.zip"} {
+		appType := "tool"
+		if i%2 == 1 {
+			appType = "game"
+		}
+		content := &db.Content{
+			Name:       name,
+			Type:       "test",
+			Version:    "1.0.0-" + name,
+			AppType:    appType,
+			FilePath:   name,
+			Size:       1024,
+			StorageKey: sql.NullString{String: name, Valid: true},
+		}
+		if err := store.Create(ctx, content); err != nil {
+			t.Fatalf("Create %s: %v", name, err)
+		}
+	}
+
+	page, total, err := store.List(ctx, db.ListOptions{Limit: 2, Offset: 1, Sort: db.SortName})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 4 || len(page) != 2 || page[0].Name != "b.zip" || page[1].Name != "c.zip" {
+		t.Errorf("Page 2 of 2 per page: total %d, %+v", total, page)
+	}
+
+	games, total, err := store.List(ctx, db.ListOptions{AppType: "game", Sort: db.SortName})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 2 || len(games) != 2 || games[0].Name != "b.zip" || games[1].Name != "d.zip" {
+		t.Errorf("app_type filter: total %d, %+v", total, games)
+	}
+
+	// Past the end the page is empty but the total still counts matches
+	past, total, err := store.List(ctx, db.ListOptions{Type: "test", Offset: 10})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 4 || len(past) != 0 {
+		t.Errorf("Past the end: total %d, %d records", total, len(past))
+	}
+}
+
+func TestCatalogVersion(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	v0, err := store.CatalogVersion(ctx)
+	if err != nil {
+		t.Fatalf("CatalogVersion: %v", err)
+	}
+
+	content := createContent(t, store, "catalog.zip")
+	v1, err := store.CatalogVersion(ctx)
+	if err != nil {
+		t.Fatalf("CatalogVersion: %v", err)
+	}
+	if v1 <= v0 {
+		t.Errorf("Create did not bump the version: %d -> %d", v0, v1)
+	}
+
+	// Reads leave it alone
+	if _, _, err := store.List(ctx, db.ListOptions{}); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if v, _ := store.CatalogVersion(ctx); v != v1 {
+		t.Errorf("List changed the version: %d -> %d", v1, v)
+	}
+
+	// Bookkeeping clients do not see in the catalog leaves it alone
+	if err := store.SetStorageState(ctx, content.ID, db.StorageStateMissing); err != nil {
+		t.Fatalf("SetStorageState: %v", err)
+	}
+	if err := store.SetVerificationStatus(ctx, content.ID, db.VerificationMismatch); err != nil {
+		t.Fatalf("SetVerificationStatus: %v", err)
+	}
+	if v, _ := store.CatalogVersion(ctx); v != v1 {
+		t.Errorf("Storage and verification updates changed the version: %d -> %d", v1, v)
+	}
+
+	content.Version = "1.0.1"
+	if err := store.Update(ctx, content); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	v2, _ := store.CatalogVersion(ctx)
+	if v2 <= v1 {
+		t.Errorf("Update did not bump the version: %d -> %d", v1, v2)
+	}
+
+	if err := store.Delete(ctx, content.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if v3, _ := store.CatalogVersion(ctx); v3 <= v2 {
+		t.Errorf("Delete did not bump the version: %d -> %d", v2, v3)
+	}
+}
+
+func TestListReturnsAllColumns(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	content := &db.Content{
+		Name:        "full.zip",
+		Type:        "test",
+		Version:     "2.0.0",
+		Description: "Every column set",
+		AppVersion:  "2.0",
+		AppType:     "linux-app",
+		FilePath:    "full.zip",
+		Size:        2048,
+		StorageKey:  sql.NullString{String: "full.zip", Valid: true},
+		ContentType: sql.NullString{String: "application/zip", Valid: true},
+		Checksum:    sql.NullString{String: strings.Repeat("ab", 32), Valid: true},
+		License:     "MIT",
+	}
+	if err := store.Create(ctx, content); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	list, _, err := store.List(ctx, db.ListOptions{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("List returned %d records, want 1", len(list))
+	}
+	got := list[0]
+	if got.Description != content.Description || got.AppVersion != content.AppVersion || got.AppType != content.AppType {
+		t.Errorf("Descriptive fields lost: %+v", got)
+	}
+	if got.StorageKey != content.StorageKey || got.ContentType != content.ContentType || got.Checksum != content.Checksum {
+		t.Errorf("Storage fields lost: %+v", got)
+	}
+	if got.StorageBackend != db.DefaultStorageBackend || !got.Enabled {
+		t.Errorf("State fields lost: %+v", got)
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	kept := createContent(t, store, "kept.zip")
+	gone := createContent(t, store, "gone.zip")
+
+	if err := store.SoftDelete(ctx, gone.ID); err != nil {
+		t.Fatalf("SoftDelete: %v", err)
+	}
+	if err := store.SoftDelete(ctx, gone.ID); err != sql.ErrNoRows {
+		t.Errorf("SoftDelete twice: expected sql.ErrNoRows, got %v", err)
+	}
+
+	if _, err := store.Get(ctx, gone.ID); err != sql.ErrNoRows {
+		t.Errorf("Get after soft delete: expected sql.ErrNoRows, got %v", err)
+	}
+	got, err := store.GetIncludingDeleted(ctx, gone.ID)
+	if err != nil {
+		t.Fatalf("GetIncludingDeleted: %v", err)
+	}
+	if got.DeletedAt == nil {
+		t.Error("GetIncludingDeleted: DeletedAt not set")
+	}
+
+	list, total, err := store.List(ctx, db.ListOptions{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 1 || len(list) != 1 || list[0].ID != kept.ID {
+		t.Errorf("List returned %d of %d records, want only %s", len(list), total, kept.ID)
+	}
+
+	_, total, err = store.List(ctx, db.ListOptions{IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("List including deleted: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("List including deleted: total = %d, want 2", total)
+	}
+
+	if err := store.Delete(ctx, gone.ID); err != nil {
+		t.Errorf("Delete of soft-deleted record: %v", err)
+	}
+}
+
+func TestContentDeltas(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+	appType := "delta-" + uuid.New().String()
+
+	create := func(from, to string, size int64) (*db.ContentDelta, error) {
+		d := &db.ContentDelta{AppType: appType, FromVersion: from, ToVersion: to,
+			StorageKey: "deltas/" + uuid.New().String(), Size: size, Checksum: strings.Repeat("a", 64)}
+		return d, store.CreateDelta(ctx, d)
+	}
+
+	first, err := create("v1.0", "1.1.0+build.7", 10)
+	if err != nil {
+		t.Fatalf("CreateDelta: %v", err)
+	}
+	if first.FromVersion != "1.0.0" || first.ToVersion != "1.1.0" {
+		t.Errorf("Expected canonical versions, got %s -> %s", first.FromVersion, first.ToVersion)
+	}
+	if _, err := create("1.1.0", "1.2.0", 10); err != nil {
+		t.Fatalf("CreateDelta: %v", err)
+	}
+	if _, err := create("1.0.0", "1.1.0", 5); !errors.Is(err, db.ErrDuplicateDelta) {
+		t.Errorf("Expected ErrDuplicateDelta, got %v", err)
+	}
+	if _, err := create("1.2.0", "1.0.0", 5); !errors.Is(err, db.ErrInvalidVersion) {
+		t.Errorf("Expected ErrInvalidVersion for a backwards delta, got %v", err)
+	}
+
+	chain, err := store.FindDeltaChain(ctx, appType, "1.0.0", "1.2.0")
+	if err != nil || len(chain) != 2 || chain[0].ID != first.ID {
+		t.Errorf("FindDeltaChain = %+v, %v", chain, err)
+	}
+	if _, err := store.FindDeltaChain(ctx, appType, "1.0.0", "2.0.0"); !errors.Is(err, db.ErrNoDeltaChain) {
+		t.Errorf("Expected ErrNoDeltaChain, got %v", err)
+	}
+
+	got, err := store.GetDelta(ctx, first.ID)
+	if err != nil || got.StorageKey != first.StorageKey {
+		t.Errorf("GetDelta = %+v, %v", got, err)
+	}
+	if _, err := store.GetDelta(ctx, uuid.New()); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for a missing delta, got %v", err)
+	}
+}
+
+func TestRehydrationTakesOverStaleRestore(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+	content := createContent(t, store, "archived.bin")
+	if err := store.SetStorageState(ctx, content.ID, db.StorageStateArchived); err != nil {
+		t.Fatalf("SetStorageState: %v", err)
+	}
+
+	first, started, err := store.BeginRehydration(ctx, content.ID, time.Hour)
+	if err != nil || !started {
+		t.Fatalf("BeginRehydration = %t, %v; want a started restore", started, err)
+	}
+	if _, started, err := store.BeginRehydration(ctx, content.ID, time.Hour); err != nil || started {
+		t.Fatalf("BeginRehydration during a live restore = %t, %v; want false", started, err)
+	}
+
+	// The first restore is now older than the threshold, as if its process
+	// had died mid-copy
+	time.Sleep(10 * time.Millisecond)
+	second, started, err := store.BeginRehydration(ctx, content.ID, time.Millisecond)
+	if err != nil || !started {
+		t.Fatalf("BeginRehydration of a stale restore = %t, %v; want it taken over", started, err)
+	}
+
+	if err := store.FinishRehydration(ctx, content.ID, first, errors.New("lost")); err != sql.ErrNoRows {
+		t.Errorf("Finishing the replaced restore = %v, want sql.ErrNoRows", err)
+	}
+	if err := store.FinishRehydration(ctx, content.ID, second, nil); err != nil {
+		t.Fatalf("FinishRehydration: %v", err)
+	}
+	got, err := store.Get(ctx, content.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.StorageState.Valid {
+		t.Errorf("storage_state = %q, want it cleared after the restore", got.StorageState.String)
+	}
+}
+
+func TestUpsertByVersionConcurrent(t *testing.T) {
+	store := testdb.New(t)
+	ctx := context.Background()
+
+	// Every publish of the same version races; one creates, the rest update
+	const publishers = 8
+	type result struct {
+		created bool
+		err     error
+	}
+	results := make(chan result, publishers)
+	var wg sync.WaitGroup
+	for i := 0; i < publishers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("upsert-%d.zip", i)
+			created, _, err := store.UpsertByVersion(ctx, &db.Content{
+				Name: key, Type: "test", Version: "1.0.0", AppType: "upsert-app",
+				FilePath: key, Size: 1, StorageKey: sql.NullString{String: key, Valid: true},
+			})
+			results <- result{created, err}
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	created := 0
+	for r := range results {
+		if r.err != nil {
+			t.Fatalf("UpsertByVersion: %v", r.err)
+		}
+		if r.created {
+			created++
+		}
+	}
+	if created != 1 {
+		t.Errorf("Expected exactly one publish to create, got %d", created)
+	}
+	matches, err := store.FindByVersion(ctx, "upsert-app", "1.0.0")
+	if err != nil {
+		t.Fatalf("FindByVersion: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Errorf("Expected one record for upsert-app 1.0.0, got %d", len(matches))
+	}
+
+	// A plain create of the same version is refused
+	dup := &db.Content{Name: "dup.zip", Type: "test", Version: "1.0.0", AppType: "upsert-app", FilePath: "dup.zip", Size: 1}
+	if err := store.Create(ctx, dup); !errors.Is(err, db.ErrDuplicateVersion) {
+		t.Errorf("Create of a published version: got %v, want ErrDuplicateVersion", err)
+	}
+}
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrQueryTimeout is returned when a store call runs past the query timeout
+// set with SetQueryTimeout
+var ErrQueryTimeout = errors.New("database query timed out")
+
+// SetQueryTimeout bounds every store call by d, in addition to any deadline
+// the caller's context already carries. Zero leaves calls unbounded.
+func (s *ContentStore) SetQueryTimeout(d time.Duration) {
+	s.queryTimeout = d
+}
+
+// withTimeout derives the context for one store call. The returned func
+// releases it and, when the call failed because the query timeout elapsed
+// rather than the caller's own context ending, wraps *err in ErrQueryTimeout.
+func (s *ContentStore) withTimeout(ctx context.Context) (context.Context, func(*error)) {
+	if s.queryTimeout <= 0 {
+		return ctx, func(*error) {}
+	}
+	qctx, cancel := context.WithTimeout(ctx, s.queryTimeout)
+	return qctx, func(err *error) {
+		if *err != nil && errors.Is(qctx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			*err = fmt.Errorf("%w after %s: %v", ErrQueryTimeout, s.queryTimeout, *err)
+		}
+		cancel()
+	}
+}
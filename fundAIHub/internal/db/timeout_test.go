@@ -0,0 +1,70 @@
+package db_test
+
+import (
+	"FundAIHub/internal/db"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// slowDriver is a database/sql driver whose queries block until their
+// context ends, standing in for a database that never answers
+type slowDriver struct{}
+
+func (slowDriver) Open(string) (driver.Conn, error) { return slowConn{}, nil }
+
+type slowConn struct{}
+
+func (slowConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (slowConn) Close() error                        { return nil }
+func (slowConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (slowConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (slowConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func init() {
+	sql.Register("fundaihub-slow", slowDriver{})
+}
+
+func TestQueryTimeout(t *testing.T) {
+	conn, err := sql.Open("fundaihub-slow", "")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer conn.Close()
+
+	store := db.NewContentStore(conn)
+	store.SetQueryTimeout(50 * time.Millisecond)
+
+	start := time.Now()
+	_, err = store.Get(context.Background(), uuid.New())
+	if !errors.Is(err, db.ErrQueryTimeout) {
+		t.Fatalf("Get: expected ErrQueryTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Get took %s, expected it to stop near the 50ms timeout", elapsed)
+	}
+
+	if err := store.SetEnabled(context.Background(), uuid.New(), false); !errors.Is(err, db.ErrQueryTimeout) {
+		t.Errorf("SetEnabled: expected ErrQueryTimeout, got %v", err)
+	}
+
+	// The caller's own deadline is not reported as a query timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := store.Get(ctx, uuid.New()); errors.Is(err, db.ErrQueryTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Get with caller deadline: expected context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CreateUploadSession starts a chunked upload
+func (s *ContentStore) CreateUploadSession(ctx context.Context, u *UploadSession) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		INSERT INTO upload_sessions (filename, version, description, app_version, app_type,
+		                             content_type, expected_size, expected_sha256, chunk_count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at`
+
+	return s.db.QueryRowContext(ctx, query,
+		u.Filename, u.Version, u.Description, u.AppVersion, u.AppType,
+		u.ContentType, u.ExpectedSize, u.ExpectedSHA256, u.ChunkCount,
+	).Scan(&u.ID, &u.CreatedAt)
+}
+
+// GetUploadSession returns sql.ErrNoRows when the session does not exist
+func (s *ContentStore) GetUploadSession(ctx context.Context, id uuid.UUID) (_ *UploadSession, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT id, filename, version, COALESCE(description, ''), COALESCE(app_version, ''),
+		       COALESCE(app_type, ''), COALESCE(content_type, ''), expected_size,
+		       expected_sha256, chunk_count, created_at
+		FROM upload_sessions
+		WHERE id = $1`
+
+	var u UploadSession
+	err = s.db.QueryRowContext(ctx, query, id).Scan(
+		&u.ID, &u.Filename, &u.Version, &u.Description, &u.AppVersion,
+		&u.AppType, &u.ContentType, &u.ExpectedSize,
+		&u.ExpectedSHA256, &u.ChunkCount, &u.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// RecordUploadChunk records a stored chunk, replacing any earlier upload of
+// the same index so a client can retry a chunk.
+func (s *ContentStore) RecordUploadChunk(ctx context.Context, sessionID uuid.UUID, chunk UploadChunk) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		INSERT INTO upload_chunks (session_id, chunk_index, storage_key, size)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (session_id, chunk_index)
+		DO UPDATE SET storage_key = EXCLUDED.storage_key, size = EXCLUDED.size, uploaded_at = NOW()`
+
+	_, err = s.db.ExecContext(ctx, query, sessionID, chunk.Index, chunk.StorageKey, chunk.Size)
+	return err
+}
+
+// ListUploadChunks returns a session's chunks ordered by index
+func (s *ContentStore) ListUploadChunks(ctx context.Context, sessionID uuid.UUID) (_ []UploadChunk, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT chunk_index, storage_key, size
+		FROM upload_chunks
+		WHERE session_id = $1
+		ORDER BY chunk_index`
+
+	rows, err := s.db.QueryContext(ctx, query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []UploadChunk
+	for rows.Next() {
+		var c UploadChunk
+		if err := rows.Scan(&c.Index, &c.StorageKey, &c.Size); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, rows.Err()
+}
+
+// DeleteUploadSession removes a session and its chunk records
+func (s *ContentStore) DeleteUploadSession(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM upload_sessions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListUploadSessionsBefore returns the IDs of sessions started before
+// cutoff, oldest first
+func (s *ContentStore) ListUploadSessionsBefore(ctx context.Context, cutoff time.Time) (_ []uuid.UUID, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id FROM upload_sessions WHERE created_at < $1 ORDER BY created_at`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// StoredObject locates a content's bytes
+type StoredObject struct {
+	Backend string
+	Key     string
+}
+
+// upsertInsertQuery is insertContentQuery, giving way to a live record that
+// already has the app_type and version
+const upsertInsertQuery = insertContentStatement + `
+	ON CONFLICT (app_type, version) WHERE deleted_at IS NULL AND app_type <> '' AND version <> ''
+	DO NOTHING` + insertContentReturning
+
+// UpsertByVersion creates content, or updates the record with the same
+// app_type and version in place. It reports whether a record was created and,
+// for an update, the object the record pointed at before, so the caller can
+// remove a replaced object. On return content holds the stored record's
+// id and timestamps.
+//
+// The unique index on live (app_type, version) decides races: an insert that
+// loses to a concurrent publish does nothing, and the winner's record is then
+// locked and updated instead.
+func (s *ContentStore) UpsertByVersion(ctx context.Context, content *Content) (_ bool, previous StoredObject, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, StoredObject{}, err
+	}
+	defer tx.Rollback()
+
+	// The first pass creates unless the record exists; the second finds the
+	// record a concurrent publish created while the insert waited on it
+	created, stored := false, false
+	for attempt := 0; attempt < 2 && !stored; attempt++ {
+		var id uuid.UUID
+		err = tx.QueryRowContext(ctx, `
+			SELECT id, COALESCE(storage_key, ''), storage_backend
+			FROM content
+			WHERE app_type = $1 AND version = $2 AND deleted_at IS NULL
+			FOR UPDATE`, content.AppType, content.Version).Scan(&id, &previous.Key, &previous.Backend)
+		switch {
+		case err == nil:
+			// The object is new, so earlier verification and storage
+			// findings no longer apply
+			err = tx.QueryRowContext(ctx, `
+				UPDATE content
+				SET name = $1, type = $2, description = $3, app_version = $4, file_path = $5, size = $6,
+				    storage_key = $7, content_type = $8, checksum = $9, license = NULLIF($10, ''),
+				    license_url = NULLIF($11, ''), content_encoding = NULLIF($12, ''), storage_backend = $13,
+				    storage_state = NULL, verification_status = NULL, last_verified_at = NULL, updated_at = NOW()
+				WHERE id = $14
+				RETURNING id, created_at, updated_at, enabled, storage_backend`,
+				content.Name, content.Type, content.Description, content.AppVersion, content.FilePath, content.Size,
+				content.StorageKey, content.ContentType, content.Checksum, content.License,
+				content.LicenseURL, content.ContentEncoding, storageBackendOrDefault(content.StorageBackend), id,
+			).Scan(&content.ID, &content.CreatedAt, &content.UpdatedAt, &content.Enabled, &content.StorageBackend)
+		case errors.Is(err, sql.ErrNoRows):
+			err = tx.QueryRowContext(ctx, upsertInsertQuery, insertContentArgs(content)...).
+				Scan(&content.ID, &content.CreatedAt, &content.UpdatedAt, &content.Enabled, &content.StorageBackend)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			created = true
+		}
+		if err != nil {
+			return false, StoredObject{}, contentUniqueError(err)
+		}
+		stored = true
+	}
+	if !stored {
+		return false, StoredObject{}, fmt.Errorf("content %s %s changed during upsert", content.AppType, content.Version)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, StoredObject{}, err
+	}
+	s.invalidate(content.ID)
+	return created, previous, nil
+}
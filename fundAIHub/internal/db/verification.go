@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// Checksum verification outcomes recorded on a content record
+const (
+	VerificationOK       = "ok"
+	VerificationMismatch = "mismatch"
+)
+
+// ListChecksummed returns the ID, name, storage key and checksum of every
+// stored content record that has a checksum to verify against, least
+// recently verified first.
+func (s *ContentStore) ListChecksummed(ctx context.Context) (_ []Content, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT id, name, storage_key, COALESCE(content_encoding, ''), checksum, last_verified_at, verification_status, storage_backend
+		FROM content
+		WHERE storage_key IS NOT NULL AND checksum IS NOT NULL
+		  AND COALESCE(storage_state, '') NOT IN ('archived', 'rehydrating')
+		ORDER BY last_verified_at NULLS FIRST, created_at`
+
+	return s.queryVerification(ctx, query)
+}
+
+// ListVerificationMismatches returns records whose stored bytes no longer
+// match their checksum
+func (s *ContentStore) ListVerificationMismatches(ctx context.Context) (_ []Content, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT id, name, storage_key, COALESCE(content_encoding, ''), checksum, last_verified_at, verification_status, storage_backend
+		FROM content
+		WHERE verification_status = 'mismatch'
+		ORDER BY last_verified_at DESC`
+
+	return s.queryVerification(ctx, query)
+}
+
+// SetVerificationStatus records the outcome of re-hashing a record's stored
+// object. updated_at is left alone since the content itself is unchanged.
+func (s *ContentStore) SetVerificationStatus(ctx context.Context, id uuid.UUID, status string) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE content
+		SET last_verified_at = NOW(), verification_status = $1
+		WHERE id = $2`, status, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	s.invalidate(id)
+	return nil
+}
+
+func (s *ContentStore) queryVerification(ctx context.Context, query string) ([]Content, error) {
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contents []Content
+	for rows.Next() {
+		var c Content
+		if err := rows.Scan(&c.ID, &c.Name, &c.StorageKey, &c.ContentEncoding, &c.Checksum, &c.LastVerifiedAt, &c.VerificationStatus, &c.StorageBackend); err != nil {
+			return nil, err
+		}
+		contents = append(contents, c)
+	}
+	return contents, rows.Err()
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// CreateWebhookSubscription registers a new webhook endpoint
+func (s *ContentStore) CreateWebhookSubscription(ctx context.Context, sub *WebhookSubscription) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		INSERT INTO webhook_subscriptions (url, secret, events)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	return s.db.QueryRowContext(ctx, query, sub.URL, sub.Secret, pq.Array(sub.Events)).
+		Scan(&sub.ID, &sub.CreatedAt)
+}
+
+// ListWebhookSubscriptions returns subscriptions for the given event, or all
+// subscriptions when event is empty
+func (s *ContentStore) ListWebhookSubscriptions(ctx context.Context, event string) (_ []WebhookSubscription, err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		SELECT id, url, secret, events, created_at
+		FROM webhook_subscriptions
+		WHERE $1 = '' OR $1 = ANY(events)
+		ORDER BY created_at`
+
+	rows, err := s.db.QueryContext(ctx, query, event)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []WebhookSubscription
+	for rows.Next() {
+		var sub WebhookSubscription
+		if err := rows.Scan(&sub.ID, &sub.URL, &sub.Secret, pq.Array(&sub.Events), &sub.CreatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// DeleteWebhookSubscription removes a webhook endpoint
+func (s *ContentStore) DeleteWebhookSubscription(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreateWebhookDeadLetter records a delivery that exhausted its retries
+func (s *ContentStore) CreateWebhookDeadLetter(ctx context.Context, d *WebhookDeadLetter) (err error) {
+	ctx, done := s.withTimeout(ctx)
+	defer done(&err)
+
+	query := `
+		INSERT INTO webhook_dead_letters (subscription_id, url, event, payload, attempts, last_error)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	return s.db.QueryRowContext(ctx, query, d.SubscriptionID, d.URL, d.Event, d.Payload, d.Attempts, d.LastError).
+		Scan(&d.ID, &d.CreatedAt)
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	httpRequests = NewCounterVec("fundaihub_http_requests_total",
+		"HTTP requests by the route that handled them and response status code.", "handler", "code")
+	httpDuration = NewHistogramVec("fundaihub_http_request_duration_seconds",
+		"Time to serve HTTP requests, by route.", DefBuckets, "handler")
+)
+
+// InstrumentMux counts and times every request mux serves. Requests are
+// labelled with the pattern that matched rather than the path, so IDs in
+// paths do not create a series each.
+func InstrumentMux(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		start := time.Now()
+		mux.ServeHTTP(rec, r)
+		httpRequests.Inc(pattern, strconv.Itoa(rec.code))
+		httpDuration.Observe(time.Since(start).Seconds(), pattern)
+	})
+}
+
+// statusRecorder remembers the status code a handler sent
+type statusRecorder struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.code, s.wroteHeader = code, true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
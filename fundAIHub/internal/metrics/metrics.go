@@ -0,0 +1,332 @@
+// Package metrics is a minimal registry of counters and gauges exposed in the
+// Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	mu       sync.RWMutex
+	registry = make(map[string]metric)
+)
+
+func register(m metric) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, exists := registry[m.name()]; exists {
+		panic("metrics: duplicate registration of " + m.name())
+	}
+	registry[m.name()] = m
+}
+
+func formatFloat(v float64) string {
+	if math.IsNaN(v) {
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	n, help string
+	v       atomic.Int64
+}
+
+// NewCounter creates and registers a counter
+func NewCounter(name, help string) *Counter {
+	c := &Counter{n: name, help: help}
+	register(c)
+	return c
+}
+
+func (c *Counter) Inc()         { c.v.Add(1) }
+func (c *Counter) Add(n int64)  { c.v.Add(n) }
+func (c *Counter) Value() int64 { return c.v.Load() }
+func (c *Counter) name() string { return c.n }
+func (c *Counter) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.n, c.help, c.n, c.n, c.Value())
+}
+
+// CounterVec is a family of counters partitioned by one or more labels
+type CounterVec struct {
+	n, help string
+	labels  []string
+	mu      sync.Mutex
+	values  map[string]*atomic.Int64
+}
+
+// NewCounterVec creates and registers a counter family keyed by labels
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{n: name, help: help, labels: labels, values: make(map[string]*atomic.Int64)}
+	register(c)
+	return c
+}
+
+// Inc increments the counter for the given label values
+func (c *CounterVec) Inc(values ...string) { c.Add(1, values...) }
+
+// Add adds n to the counter for the given label values
+func (c *CounterVec) Add(n int64, values ...string) {
+	key := seriesKey(values)
+	c.mu.Lock()
+	v, ok := c.values[key]
+	if !ok {
+		v = new(atomic.Int64)
+		c.values[key] = v
+	}
+	c.mu.Unlock()
+	v.Add(n)
+}
+
+// Value returns the count for the given label values
+func (c *CounterVec) Value(values ...string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.values[seriesKey(values)]; ok {
+		return v.Load()
+	}
+	return 0
+}
+
+func (c *CounterVec) name() string { return c.n }
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.n, c.help, c.n)
+	for _, k := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s{%s} %d\n", c.n, labelPairs(c.labels, k), c.values[k].Load())
+	}
+}
+
+// seriesKey joins label values into a map key. The separator cannot occur
+// in valid UTF-8, so distinct value lists never collide.
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs formats the label values stored under key as name="value"
+// pairs
+func labelPairs(labels []string, key string) string {
+	values := strings.Split(key, "\xff")
+	pairs := make([]string, len(labels))
+	for i, l := range labels {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		pairs[i] = l + "=" + strconv.Quote(v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	n, help string
+	v       atomic.Int64
+}
+
+// NewGauge creates and registers a gauge
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{n: name, help: help}
+	register(g)
+	return g
+}
+
+func (g *Gauge) Inc()         { g.v.Add(1) }
+func (g *Gauge) Dec()         { g.v.Add(-1) }
+func (g *Gauge) Set(n int64)  { g.v.Store(n) }
+func (g *Gauge) Value() int64 { return g.v.Load() }
+func (g *Gauge) name() string { return g.n }
+func (g *Gauge) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", g.n, g.help, g.n, g.n, g.Value())
+}
+
+// GaugeVec is a family of gauges partitioned by a single label. A label
+// value is dropped once its gauge returns to zero, so short-lived values do
+// not accumulate.
+type GaugeVec struct {
+	n, help, label string
+	mu             sync.Mutex
+	values         map[string]int64
+}
+
+// NewGaugeVec creates and registers a gauge family keyed by label
+func NewGaugeVec(name, help, label string) *GaugeVec {
+	g := &GaugeVec{n: name, help: help, label: label, values: make(map[string]int64)}
+	register(g)
+	return g
+}
+
+// Add adjusts the gauge for the given label value by n
+func (g *GaugeVec) Add(value string, n int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if v := g.values[value] + n; v != 0 {
+		g.values[value] = v
+	} else {
+		delete(g.values, value)
+	}
+}
+
+func (g *GaugeVec) Inc(value string) { g.Add(value, 1) }
+func (g *GaugeVec) Dec(value string) { g.Add(value, -1) }
+
+// Value returns the gauge for the given label value
+func (g *GaugeVec) Value(value string) int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.values[value]
+}
+
+func (g *GaugeVec) name() string { return g.n }
+func (g *GaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.n, g.help, g.n)
+	for _, k := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%s{%s=%s} %d\n", g.n, g.label, strconv.Quote(k), g.values[k])
+	}
+}
+
+// GaugeFunc is a gauge whose value is computed at scrape time
+type GaugeFunc struct {
+	n, help string
+	fn      func() float64
+}
+
+// NewGaugeFunc creates and registers a gauge backed by fn
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{n: name, help: help, fn: fn}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) name() string { return g.n }
+func (g *GaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.n, g.help, g.n, g.n, formatFloat(g.fn()))
+}
+
+// DefBuckets are upper bounds in seconds suited to timing requests and
+// calls to other services
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// HistogramVec counts observations into cumulative buckets, partitioned by
+// zero or more labels
+type HistogramVec struct {
+	n, help string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // Per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates and registers a histogram family with the given
+// bucket upper bounds, which must be sorted, keyed by labels
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{n: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+	register(h)
+	return h
+}
+
+// Observe records v for the given label values
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := seriesKey(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+// Count returns how many values were observed for the given label values
+func (h *HistogramVec) Count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[seriesKey(values)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) name() string { return h.n }
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.n, h.help, h.n)
+	for _, k := range sortedKeys(h.series) {
+		s := h.series[k]
+		labels := ""
+		if len(h.labels) > 0 {
+			labels = labelPairs(h.labels, k) + ","
+		}
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%sle=%q} %d\n", h.n, labels, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", h.n, labels, s.count)
+		suffix := ""
+		if len(h.labels) > 0 {
+			suffix = "{" + labelPairs(h.labels, k) + "}"
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", h.n, suffix, formatFloat(s.sum), h.n, suffix, s.count)
+	}
+}
+
+// Handler serves every registered metric in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.RLock()
+		names := make([]string, 0, len(registry))
+		for n := range registry {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		metrics := make([]metric, len(names))
+		for i, n := range names {
+			metrics[i] = registry[n]
+		}
+		mu.RUnlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, m := range metrics {
+			m.write(w)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return rr.Body.String()
+}
+
+func TestCounterVecLabels(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "Test requests.", "handler", "code")
+	c.Inc("/a", "200")
+	c.Add(2, "/a", "200")
+	c.Inc("/a", "500")
+
+	if got := c.Value("/a", "200"); got != 3 {
+		t.Errorf("Value(/a, 200) = %d, want 3", got)
+	}
+	out := scrape(t)
+	for _, want := range []string{
+		`test_requests_total{handler="/a",code="200"} 3`,
+		`test_requests_total{handler="/a",code="500"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "Test durations.", []float64{0.1, 1}, "op")
+	h.Observe(0.05, "read")
+	h.Observe(0.1, "read")
+	h.Observe(5, "read")
+
+	out := scrape(t)
+	for _, want := range []string{
+		`test_duration_seconds_bucket{op="read",le="0.1"} 2`,
+		`test_duration_seconds_bucket{op="read",le="1"} 2`,
+		`test_duration_seconds_bucket{op="read",le="+Inf"} 3`,
+		`test_duration_seconds_sum{op="read"} 5.15`,
+		`test_duration_seconds_count{op="read"} 3`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestInstrumentMux(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.WriteHeader(http.StatusOK) // Ignored, as by net/http
+	})
+	handler := InstrumentMux(mux)
+
+	for _, path := range []string{"/items/1", "/items/2", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if got := httpRequests.Value("/items/", "418"); got != 2 {
+		t.Errorf("Requests for /items/ = %d, want 2", got)
+	}
+	if got := httpRequests.Value("unmatched", "404"); got != 1 {
+		t.Errorf("Unmatched requests = %d, want 1", got)
+	}
+	if got := httpDuration.Count("/items/"); got != 2 {
+		t.Errorf("Timed requests for /items/ = %d, want 2", got)
+	}
+}
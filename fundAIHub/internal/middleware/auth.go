@@ -2,16 +2,27 @@ package middleware
 
 import (
 	"FundAIHub/internal/auth"
+	"FundAIHub/internal/metrics"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
+// fundaVaultLatency times device verifications that reach FundaVault;
+// cached verifications are not counted
+var fundaVaultLatency = metrics.NewHistogramVec("fundaihub_fundavault_verify_duration_seconds",
+	"Time taken by FundaVault device verifications, by result.", metrics.DefBuckets, "result")
+
 type AuthMiddleware struct {
-	fundaVault *auth.FundaVaultClient
+	fundaVault  *auth.FundaVaultClient
+	embedSecret []byte       // nil disables embed tokens; see AllowEmbedToken
+	verified    *verifyCache // nil verifies every request; see EnableVerificationCache
+	limiter     *RateLimiter // nil leaves devices unlimited; see SetRateLimiter
 }
 
 type ErrorResponse struct {
@@ -35,7 +46,33 @@ func (m *AuthMiddleware) respondWithError(w http.ResponseWriter, code int, messa
 	})
 }
 
+// deviceIDLength is the length of a Device-ID: the hex SHA-256 of the
+// device's hardware identifier
+const deviceIDLength = 64
+
+// NormalizeDeviceID validates a Device-ID header value and returns it
+// trimmed and lower-cased. A Device-ID is the 64-character hex SHA-256 of
+// the device's hardware identifier, as produced by the device client.
+func NormalizeDeviceID(v string) (string, bool) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if len(v) != deviceIDLength {
+		return "", false
+	}
+	for _, c := range v {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return "", false
+		}
+	}
+	return v, true
+}
+
 func (m *AuthMiddleware) AuthenticateDevice(next http.HandlerFunc) http.HandlerFunc {
+	return m.authenticate(next, false)
+}
+
+// authenticate is AuthenticateDevice; fresh skips the verification cache,
+// so a device revoked in FundaVault is refused at once
+func (m *AuthMiddleware) authenticate(next http.HandlerFunc, fresh bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[AuthMiddleware] Authenticating device for request: %s %s", r.Method, r.URL.Path)
 
@@ -46,13 +83,23 @@ func (m *AuthMiddleware) AuthenticateDevice(next http.HandlerFunc) http.HandlerF
 			m.respondWithError(w, http.StatusUnauthorized, "Missing Device-ID header")
 			return
 		}
+		hardwareID, ok := NormalizeDeviceID(hardwareID)
+		if !ok {
+			log.Printf("[AuthMiddleware] Error: Malformed Device-ID header (%d bytes).", len(r.Header.Get("Device-ID")))
+			m.respondWithError(w, http.StatusBadRequest, "Invalid Device-ID header: expected 64 hex characters")
+			return
+		}
 
 		// 2. Verify device with FundaVault
 		log.Printf("[AuthMiddleware] Attempting to verify Device-ID '%s' with FundaVault...", hardwareID)
-		result, statusCode, err := m.fundaVault.VerifyDevice(hardwareID)
+		result, statusCode, err := m.verifyDevice(r.Context(), hardwareID, fresh)
 
 		if err != nil {
 			log.Printf("[AuthMiddleware] FundaVault verification returned error: %v (StatusCode: %d)", err, statusCode)
+			if errors.Is(err, auth.ErrTimeout) {
+				m.respondWithError(w, http.StatusServiceUnavailable, "Authentication service timed out")
+				return
+			}
 
 			switch statusCode {
 			case http.StatusNotFound:
@@ -61,6 +108,13 @@ func (m *AuthMiddleware) AuthenticateDevice(next http.HandlerFunc) http.HandlerF
 				m.respondWithError(w, http.StatusForbidden, "Device or user inactive, or subscription expired")
 			case http.StatusConflict:
 				m.respondWithError(w, http.StatusForbidden, "Verification conflict")
+			case http.StatusTooManyRequests:
+				// Pass FundaVault's back-off on so clients wait rather than retry at once
+				var limited *auth.RateLimitedError
+				if errors.As(err, &limited) && limited.RetryAfter != "" {
+					w.Header().Set("Retry-After", limited.RetryAfter)
+				}
+				m.respondWithError(w, http.StatusTooManyRequests, "Authentication service busy, retry later")
 			case http.StatusInternalServerError:
 				m.respondWithError(w, http.StatusServiceUnavailable, "Authentication service error")
 			case 0:
@@ -77,6 +131,12 @@ func (m *AuthMiddleware) AuthenticateDevice(next http.HandlerFunc) http.HandlerF
 			return
 		}
 
+		if result.DeviceDisabled() {
+			log.Printf("[AuthMiddleware] Access denied for Device-ID '%s': device status is %s", hardwareID, result.DeviceStatus)
+			m.respondWithError(w, http.StatusForbidden, "Device "+result.DeviceStatus)
+			return
+		}
+
 		userIDStr := fmt.Sprintf("%d", result.UserID)
 		log.Printf("[AuthMiddleware] Device '%s' validated successfully for UserID: %s (Email: %s)", hardwareID, userIDStr, result.Email)
 
@@ -91,22 +151,62 @@ func (m *AuthMiddleware) AuthenticateDevice(next http.HandlerFunc) http.HandlerF
 			}
 		}
 
-		ctx := context.WithValue(r.Context(), "device_id", hardwareID)
-		ctx = context.WithValue(ctx, "user_id", userIDStr)
-		ctx = context.WithValue(ctx, "is_admin", result.IsAdmin)
-		ctx = context.WithValue(ctx, "subscription_end", result.SubscriptionEnd)
-		ctx = context.WithValue(ctx, "email", result.Email)
+		ctx := WithDeviceID(r.Context(), hardwareID)
+		ctx = WithDeviceUUID(ctx, result.DeviceUUID)
+		ctx = WithUserID(ctx, userIDStr)
+		ctx = WithIsAdmin(ctx, result.IsAdmin)
+		ctx = WithSubscriptionEnd(ctx, result.SubscriptionEnd)
+		ctx = WithEmail(ctx, result.Email)
 
 		log.Printf("[AuthMiddleware] Proceeding to next handler for UserID: %s", userIDStr)
 
+		if m.limiter != nil {
+			m.limiter.Limit(next).ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
 
+// verifyDevice verifies a device with FundaVault unless fresh is false and a
+// recent successful verification is cached. Expiry and device status are
+// re-checked by the caller, so a cached subscription that has since ended is
+// still refused. A device FundaVault refuses loses its cached verification.
+func (m *AuthMiddleware) verifyDevice(ctx context.Context, hardwareID string, fresh bool) (*auth.DeviceVerifyResponse, int, error) {
+	if m.verified != nil && !fresh {
+		if result, ok := m.verified.get(hardwareID); ok {
+			log.Printf("[AuthMiddleware] Using cached verification for Device-ID '%s'", hardwareID)
+			return result, http.StatusOK, nil
+		}
+	}
+	start := time.Now()
+	result, statusCode, err := m.fundaVault.VerifyDevice(ctx, hardwareID)
+	outcome := "ok"
+	switch {
+	case errors.Is(err, auth.ErrTimeout):
+		outcome = "timeout"
+	case err != nil:
+		outcome = "error"
+	}
+	fundaVaultLatency.Observe(time.Since(start).Seconds(), outcome)
+	if m.verified != nil {
+		switch {
+		case err == nil && statusCode == http.StatusOK && result != nil && result.Authenticated && !result.DeviceDisabled():
+			m.verified.put(hardwareID, result)
+		case statusCode == http.StatusNotFound, statusCode == http.StatusForbidden,
+			err == nil && result != nil && result.DeviceDisabled():
+			m.verified.forget(hardwareID)
+		}
+	}
+	return result, statusCode, err
+}
+
+// AdminOnly is AuthenticateDevice for admins only. Admin requests are always
+// verified with FundaVault rather than from the cache, so a revoked admin
+// device loses access at once.
 func (m *AuthMiddleware) AdminOnly(next http.HandlerFunc) http.HandlerFunc {
-	return m.AuthenticateDevice(func(w http.ResponseWriter, r *http.Request) {
-		isAdminVal := r.Context().Value("is_admin")
-		isAdmin, ok := isAdminVal.(bool)
+	return m.authenticate(func(w http.ResponseWriter, r *http.Request) {
+		isAdmin, ok := IsAdminFromContext(r.Context())
 		if !ok {
 			log.Printf("[AuthMiddleware] Error: 'is_admin' value not found or not a boolean in context for AdminOnly check.")
 			m.respondWithError(w, http.StatusInternalServerError, "Internal context error")
@@ -114,11 +214,11 @@ func (m *AuthMiddleware) AdminOnly(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		if !isAdmin {
-			userIDVal := r.Context().Value("user_id")
+			userIDVal, _ := UserIDFromContext(r.Context())
 			log.Printf("[AuthMiddleware] Access denied for UserID %v: Admin access required for %s %s", userIDVal, r.Method, r.URL.Path)
 			m.respondWithError(w, http.StatusForbidden, "Admin access required")
 			return
 		}
 		next.ServeHTTP(w, r)
-	})
+	}, true)
 }
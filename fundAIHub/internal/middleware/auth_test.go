@@ -0,0 +1,242 @@
+package middleware
+
+import (
+	"FundAIHub/internal/auth"
+	"FundAIHub/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNormalizeDeviceID(t *testing.T) {
+	hash := strings.Repeat("0123456789abcdef", 4)
+	tests := []struct {
+		name   string
+		value  string
+		want   string
+		wantOK bool
+	}{
+		{"Lower-case hash", hash, hash, true},
+		{"Upper-case hash", strings.ToUpper(hash), hash, true},
+		{"Surrounding space", " " + hash + " ", hash, true},
+		{"UUID", "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "", false},
+		{"Too short", hash[:63], "", false},
+		{"Too long", hash + "0", "", false},
+		{"Non-hex", strings.Repeat("g", 64), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NormalizeDeviceID(tt.value)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("NormalizeDeviceID(%q) = %q, %t; want %q, %t", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestAuthenticateDeviceRejectsMalformedDeviceID(t *testing.T) {
+	var calls int32
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer vault.Close()
+
+	m := NewAuthMiddleware(auth.NewFundaVaultClient(&config.Config{FundaVaultURL: vault.URL}))
+	handler := m.AuthenticateDevice(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Next handler should not run")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/downloads/history", nil)
+	req.Header.Set("Device-ID", "not-a-device-id")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("Expected no FundaVault calls, got %d", n)
+	}
+}
+
+func TestAuthenticateDeviceSetsDeviceUUID(t *testing.T) {
+	hardwareID := strings.Repeat("0123456789abcdef", 4)
+	// Same value as fundaVault/tests/test_device_auth.py
+	const derived = "7d22d75b-2a64-59d5-b1e9-fd38023c3a76"
+	const reported = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"Derived When Omitted", `{"authenticated": true, "user_id": 7, "email": "student@example.com"}`, derived},
+		{"Reported By FundaVault", `{"authenticated": true, "user_id": 7, "email": "student@example.com", "device_uuid": "` + reported + `"}`, reported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.body))
+			}))
+			defer vault.Close()
+
+			m := NewAuthMiddleware(auth.NewFundaVaultClient(&config.Config{FundaVaultURL: vault.URL}))
+			var got string
+			handler := m.AuthenticateDevice(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = DeviceUUIDFromContext(r.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/downloads/history", nil)
+			req.Header.Set("Device-ID", strings.ToUpper(hardwareID))
+			handler(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("device UUID = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateDevicePassesOnRateLimit(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer vault.Close()
+
+	m := NewAuthMiddleware(auth.NewFundaVaultClient(&config.Config{FundaVaultURL: vault.URL}))
+	handler := m.AuthenticateDevice(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Next handler should not run")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/downloads/history", nil)
+	req.Header.Set("Device-ID", strings.Repeat("ab", 32))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Expected Retry-After 30, got %q", got)
+	}
+}
+
+func TestAuthenticateDeviceTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer vault.Close()
+	defer close(release)
+
+	cfg := &config.Config{FundaVaultURL: vault.URL, FundaVaultTimeout: 50 * time.Millisecond}
+	m := NewAuthMiddleware(auth.NewFundaVaultClient(cfg))
+	handler := m.AuthenticateDevice(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Next handler should not run")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/downloads/history", nil)
+	req.Header.Set("Device-ID", strings.Repeat("ab", 32))
+	rr := httptest.NewRecorder()
+	started := time.Now()
+	handler(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "timed out") {
+		t.Errorf("Expected a timeout error, got %s", rr.Body.String())
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("Verification took %v despite the timeout", elapsed)
+	}
+}
+
+func TestAllowEmbedToken(t *testing.T) {
+	var vaultCalls int32
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&vaultCalls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer vault.Close()
+
+	secret := []byte("embed-secret")
+	const path, contentID = "/api/downloads/url", "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	valid := SignEmbedToken(secret, path, contentID, time.Now().Add(time.Hour))
+	expired := SignEmbedToken(secret, path, contentID, time.Now().Add(-time.Minute))
+	otherContent := SignEmbedToken(secret, path, "00000000-0000-0000-0000-000000000000", time.Now().Add(time.Hour))
+	otherSecret := SignEmbedToken([]byte("wrong"), path, contentID, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name     string
+		secret   string
+		token    string
+		wantCode int
+		wantNext bool
+	}{
+		{"Valid token", string(secret), valid, http.StatusOK, true},
+		{"Expired token", string(secret), expired, http.StatusUnauthorized, false},
+		{"Token for other content", string(secret), otherContent, http.StatusUnauthorized, false},
+		{"Token signed with other secret", string(secret), otherSecret, http.StatusUnauthorized, false},
+		{"Malformed token", string(secret), "not-a-token", http.StatusUnauthorized, false},
+		// Without a token the route needs a Device-ID like any other
+		{"Missing token", string(secret), "", http.StatusUnauthorized, false},
+		{"Disabled by default", "", valid, http.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewAuthMiddleware(auth.NewFundaVaultClient(&config.Config{FundaVaultURL: vault.URL}))
+			m.SetEmbedTokenSecret(tt.secret)
+
+			ran := false
+			handler := m.AllowEmbedToken(func(w http.ResponseWriter, r *http.Request) {
+				ran = true
+				if !EmbedTokenFromContext(r.Context()) {
+					t.Error("Expected embed_token in context")
+				}
+			})
+
+			target := path + "?content_id=" + contentID
+			if tt.token != "" {
+				target += "&" + EmbedTokenParam + "=" + tt.token
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest(http.MethodGet, target, nil))
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("Expected status %d, got %d", tt.wantCode, rr.Code)
+			}
+			if ran != tt.wantNext {
+				t.Errorf("Next handler ran = %t, want %t", ran, tt.wantNext)
+			}
+		})
+	}
+
+	if n := atomic.LoadInt32(&vaultCalls); n != 0 {
+		t.Errorf("Expected no FundaVault calls, got %d", n)
+	}
+}
+
+func TestVerifyEmbedTokenExpiry(t *testing.T) {
+	secret := []byte("embed-secret")
+	expiresAt := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	token := SignEmbedToken(secret, "/p", "c", expiresAt)
+
+	if err := VerifyEmbedToken(secret, token, "/p", "c", expiresAt); err != nil {
+		t.Errorf("Token at its expiry: %v", err)
+	}
+	if err := VerifyEmbedToken(secret, token, "/p", "c", expiresAt.Add(time.Second)); err != ErrEmbedTokenExpired {
+		t.Errorf("Expected ErrEmbedTokenExpired, got %v", err)
+	}
+	if err := VerifyEmbedToken(secret, token, "/other", "c", expiresAt); err != ErrEmbedTokenInvalid {
+		t.Errorf("Expected ErrEmbedTokenInvalid for another path, got %v", err)
+	}
+}
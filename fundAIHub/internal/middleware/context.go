@@ -0,0 +1,96 @@
+package middleware
+
+import "context"
+
+// contextKey types the request context values set by this package, so they
+// cannot collide with keys from other packages
+type contextKey string
+
+const (
+	deviceIDKey        contextKey = "device_id"
+	deviceUUIDKey      contextKey = "device_uuid"
+	userIDKey          contextKey = "user_id"
+	isAdminKey         contextKey = "is_admin"
+	subscriptionEndKey contextKey = "subscription_end"
+	emailKey           contextKey = "email"
+	embedTokenKey      contextKey = "embed_token"
+)
+
+// WithDeviceID returns ctx carrying the device's normalized Device-ID hash
+func WithDeviceID(ctx context.Context, deviceID string) context.Context {
+	return context.WithValue(ctx, deviceIDKey, deviceID)
+}
+
+// DeviceIDFromContext returns the Device-ID hash of the authenticated device
+func DeviceIDFromContext(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(deviceIDKey).(string)
+	return v, ok
+}
+
+// WithDeviceUUID returns ctx carrying FundaVault's ID for the device
+func WithDeviceUUID(ctx context.Context, deviceUUID string) context.Context {
+	return context.WithValue(ctx, deviceUUIDKey, deviceUUID)
+}
+
+// DeviceUUIDFromContext returns FundaVault's ID for the authenticated
+// device, which download records are keyed on. It may be empty for devices
+// verified by older FundaVault releases.
+func DeviceUUIDFromContext(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(deviceUUIDKey).(string)
+	return v, ok
+}
+
+// WithUserID returns ctx carrying the authenticated user's ID
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext returns the ID of the user owning the authenticated
+// device
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(userIDKey).(string)
+	return v, ok
+}
+
+// WithIsAdmin returns ctx recording whether the user is an admin
+func WithIsAdmin(ctx context.Context, isAdmin bool) context.Context {
+	return context.WithValue(ctx, isAdminKey, isAdmin)
+}
+
+// IsAdminFromContext returns whether the authenticated user is an admin.
+// ok is false when no device was authenticated.
+func IsAdminFromContext(ctx context.Context) (isAdmin, ok bool) {
+	isAdmin, ok = ctx.Value(isAdminKey).(bool)
+	return isAdmin, ok
+}
+
+// WithSubscriptionEnd returns ctx carrying the user's subscription end, as
+// reported by FundaVault
+func WithSubscriptionEnd(ctx context.Context, end string) context.Context {
+	return context.WithValue(ctx, subscriptionEndKey, end)
+}
+
+// SubscriptionEndFromContext returns the user's subscription end, an
+// RFC 3339 time or empty
+func SubscriptionEndFromContext(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(subscriptionEndKey).(string)
+	return v, ok
+}
+
+// WithEmail returns ctx carrying the authenticated user's email
+func WithEmail(ctx context.Context, email string) context.Context {
+	return context.WithValue(ctx, emailKey, email)
+}
+
+// EmailFromContext returns the authenticated user's email
+func EmailFromContext(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(emailKey).(string)
+	return v, ok
+}
+
+// EmbedTokenFromContext reports whether the request was admitted by an
+// embed token rather than a Device-ID
+func EmbedTokenFromContext(ctx context.Context) bool {
+	v, _ := ctx.Value(embedTokenKey).(bool)
+	return v
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults used when a CORSConfig leaves a list empty
+var (
+	DefaultCORSMethods = []string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+	}
+	DefaultCORSHeaders = []string{
+		"Authorization", "Content-Type", "Device-ID", "Range", "If-Catalog-Version",
+	}
+)
+
+// corsExposedHeaders are response headers a browser client may read
+var corsExposedHeaders = strings.Join([]string{
+	"Content-Disposition", "Content-Range", "Retry-After",
+	"X-Catalog-Version", "X-Content-SHA256", "X-Next-Cursor", "X-Progress-Persisted", "X-Total-Count",
+}, ", ")
+
+// CORSConfig says which browser origins may call the API and how
+type CORSConfig struct {
+	// AllowedOrigins are exact origins such as "https://admin.example.com",
+	// or "*" for any. Empty allows none, leaving the browser's same-origin
+	// policy in force.
+	AllowedOrigins []string
+	// AllowedMethods and AllowedHeaders are answered to preflights; empty
+	// uses DefaultCORSMethods and DefaultCORSHeaders
+	AllowedMethods []string
+	AllowedHeaders []string
+	// AllowCredentials lets browsers send cookies and Authorization
+	AllowCredentials bool
+	// MaxAge is how long a browser may cache a preflight answer
+	MaxAge time.Duration
+}
+
+// CORS answers preflight requests and adds CORS headers for allowed
+// origins before passing requests to next. Requests without an Origin, and
+// those from origins not allowed, get no CORS headers, so browsers refuse
+// to hand the response to the page.
+func CORS(cfg CORSConfig, next http.Handler) http.Handler {
+	origins := make(map[string]bool, len(cfg.AllowedOrigins))
+	anyOrigin := false
+	for _, o := range cfg.AllowedOrigins {
+		if o == "*" {
+			anyOrigin = true
+		}
+		origins[strings.TrimSuffix(o, "/")] = true
+	}
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = DefaultCORSMethods
+	}
+	headers := cfg.AllowedHeaders
+	if len(headers) == 0 {
+		headers = DefaultCORSHeaders
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(headers, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		if !anyOrigin && !origins[origin] {
+			if preflight {
+				log.Printf("[CORS] Refused preflight from origin %q for %s", origin, r.URL.Path)
+				h.Add("Vary", "Access-Control-Request-Method")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Browsers reject "*" on credentialed requests, so name the origin
+		if anyOrigin && !cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		h.Set("Access-Control-Allow-Methods", allowMethods)
+		h.Set("Access-Control-Allow-Headers", allowHeaders)
+		if cfg.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge/time.Second)))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
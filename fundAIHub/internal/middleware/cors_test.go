@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	tests := []struct {
+		name        string
+		cfg         CORSConfig
+		method      string
+		origin      string
+		preflight   bool
+		wantStatus  int
+		wantOrigin  string
+		wantHeaders string
+	}{
+		{"No Origin", CORSConfig{AllowedOrigins: []string{"https://admin.example.com"}}, http.MethodGet, "", false, http.StatusTeapot, "", ""},
+		{"Allowed Origin", CORSConfig{AllowedOrigins: []string{"https://admin.example.com"}}, http.MethodGet, "https://admin.example.com", false, http.StatusTeapot, "https://admin.example.com", ""},
+		{"Unlisted Origin", CORSConfig{AllowedOrigins: []string{"https://admin.example.com"}}, http.MethodGet, "https://evil.example.com", false, http.StatusTeapot, "", ""},
+		{"Unconfigured", CORSConfig{}, http.MethodGet, "https://admin.example.com", false, http.StatusTeapot, "", ""},
+		{"Preflight", CORSConfig{AllowedOrigins: []string{"https://admin.example.com"}, MaxAge: time.Minute}, http.MethodOptions, "https://admin.example.com", true, http.StatusNoContent, "https://admin.example.com", "Authorization, Content-Type, Device-ID, Range, If-Catalog-Version"},
+		{"Preflight Refused", CORSConfig{}, http.MethodOptions, "https://admin.example.com", true, http.StatusForbidden, "", ""},
+		{"Wildcard", CORSConfig{AllowedOrigins: []string{"*"}}, http.MethodGet, "https://any.example.com", false, http.StatusTeapot, "*", ""},
+		{"Wildcard With Credentials", CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}, http.MethodGet, "https://any.example.com", false, http.StatusTeapot, "https://any.example.com", ""},
+		{"Custom Headers", CORSConfig{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"Device-ID"}}, http.MethodOptions, "https://any.example.com", true, http.StatusNoContent, "*", "Device-ID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/content", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			rr := httptest.NewRecorder()
+			CORS(tt.cfg, next).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Headers"); got != tt.wantHeaders {
+				t.Errorf("Access-Control-Allow-Headers = %q, want %q", got, tt.wantHeaders)
+			}
+			wantCredentials := ""
+			if tt.cfg.AllowCredentials && tt.wantOrigin != "" {
+				wantCredentials = "true"
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, wantCredentials)
+			}
+		})
+	}
+
+	t.Run("Preflight Max Age", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/api/uploads", nil)
+		req.Header.Set("Origin", "https://admin.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		rr := httptest.NewRecorder()
+		CORS(CORSConfig{AllowedOrigins: []string{"https://admin.example.com"}, MaxAge: 10 * time.Minute}, next).ServeHTTP(rr, req)
+		if got := rr.Header().Get("Access-Control-Max-Age"); got != "600" {
+			t.Errorf("Access-Control-Max-Age = %q, want 600", got)
+		}
+	})
+}
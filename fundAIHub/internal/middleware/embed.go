@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmbedTokenParam is the query parameter carrying an embed token
+const EmbedTokenParam = "embed_token"
+
+var (
+	// ErrEmbedTokenInvalid is returned for an embed token that is malformed
+	// or whose signature does not match the request
+	ErrEmbedTokenInvalid = errors.New("invalid embed token")
+	// ErrEmbedTokenExpired is returned for a correctly signed embed token
+	// past its expiry
+	ErrEmbedTokenExpired = errors.New("embed token expired")
+)
+
+// SetEmbedTokenSecret enables embed tokens on routes wrapped in
+// AllowEmbedToken. An empty secret disables them.
+func (m *AuthMiddleware) SetEmbedTokenSecret(secret string) {
+	if secret == "" {
+		m.embedSecret = nil
+		return
+	}
+	m.embedSecret = []byte(secret)
+}
+
+// SignEmbedToken returns a token granting access to path for a single
+// content_id until expiresAt. The token has the form <unix-expiry>.<signature>.
+func SignEmbedToken(secret []byte, path, contentID string, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expires + "." + embedSignature(secret, path, contentID, expires)
+}
+
+func embedSignature(secret []byte, path, contentID, expires string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("embed\n" + path + "\n" + contentID + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyEmbedToken checks a token issued by SignEmbedToken against the
+// request's path and content_id
+func VerifyEmbedToken(secret []byte, token, path, contentID string, now time.Time) error {
+	expires, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrEmbedTokenInvalid
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrEmbedTokenInvalid
+	}
+	expected := embedSignature(secret, path, contentID, expires)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrEmbedTokenInvalid
+	}
+	if now.After(time.Unix(unix, 0)) {
+		return ErrEmbedTokenExpired
+	}
+	return nil
+}
+
+// AllowEmbedToken lets a route be reached with an embed token in place of a
+// Device-ID, so a link can be embedded in pages that cannot send headers.
+// Requests without a token, or any request while no secret is configured,
+// fall through to AuthenticateDevice. A token that is present but invalid is
+// rejected rather than falling back.
+//
+// Only wrap routes that identify their content by a content_id query
+// parameter and do not depend on the device, since a token-authenticated
+// request carries no device or user in its context.
+func (m *AuthMiddleware) AllowEmbedToken(next http.HandlerFunc) http.HandlerFunc {
+	authenticated := m.AuthenticateDevice(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get(EmbedTokenParam)
+		if token == "" || m.embedSecret == nil {
+			authenticated(w, r)
+			return
+		}
+
+		contentID := r.URL.Query().Get("content_id")
+		if err := VerifyEmbedToken(m.embedSecret, token, r.URL.Path, contentID, time.Now()); err != nil {
+			log.Printf("[AuthMiddleware] Rejected embed token for %s (content_id %s): %v", r.URL.Path, contentID, err)
+			if errors.Is(err, ErrEmbedTokenExpired) {
+				m.respondWithError(w, http.StatusUnauthorized, "Embed token expired")
+			} else {
+				m.respondWithError(w, http.StatusUnauthorized, "Invalid embed token")
+			}
+			return
+		}
+
+		// The token, not a cookie or header, is the credential, so the
+		// response may be read from any origin
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		log.Printf("[AuthMiddleware] Embed token accepted for %s (content_id %s)", r.URL.Path, contentID)
+		ctx := context.WithValue(r.Context(), embedTokenKey, true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"FundAIHub/internal/metrics"
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var rateLimited = metrics.NewCounter("fundaihub_rate_limited_total", "Requests refused by the per-device rate limit.")
+
+// tokenBucket holds a key's tokens as of last
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is an in-memory token-bucket limiter. Each key may make burst
+// requests at once, refilled at a steady rate per minute. Buckets left idle
+// long enough to refill are dropped by Cleanup, since a new bucket would be
+// the same.
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+// NewRateLimiter allows perMinute requests a minute per key, with bursts of
+// up to burst. A burst below one is raised to one.
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from key's bucket. When none is left it reports how
+// long until one is.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.rate <= 0 {
+		return false, time.Minute
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// Cleanup drops buckets that have refilled since their last request and
+// returns how many it dropped
+func (l *RateLimiter) Cleanup() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	dropped := 0
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// RunCleanup calls Cleanup on each tick until ctx is done
+func (l *RateLimiter) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if dropped := l.Cleanup(); dropped > 0 {
+			log.Printf("[RateLimiter] Dropped %d idle buckets", dropped)
+		}
+	}
+}
+
+// Limit refuses requests over the limit with 429 and a Retry-After header.
+// Requests are keyed by the authenticated Device-ID, so Limit belongs
+// inside AuthenticateDevice; without one they are keyed by remote IP.
+func (l *RateLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := DeviceIDFromContext(r.Context())
+		if !ok || key == "" {
+			key = "ip:" + remoteIP(r)
+		}
+		allowed, wait := l.Allow(key)
+		if !allowed {
+			rateLimited.Inc()
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			log.Printf("[RateLimiter] Refused %s %s for %s; retry after %ds", r.Method, r.URL.Path, key, retryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(ErrorResponse{
+				Error: "Too many requests, retry later",
+				Code:  http.StatusTooManyRequests,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// remoteIP is the host part of the request's remote address
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// SetRateLimiter limits every request AuthenticateDevice lets through,
+// per device; nil removes the limit
+func (m *AuthMiddleware) SetRateLimiter(l *RateLimiter) {
+	m.limiter = l
+}
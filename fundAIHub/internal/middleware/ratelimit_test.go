@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewRateLimiter(60, 2)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("device"); !ok {
+			t.Fatalf("request %d within burst was refused", i+1)
+		}
+	}
+	ok, wait := l.Allow("device")
+	if ok {
+		t.Fatal("request over burst was allowed")
+	}
+	if wait != time.Second {
+		t.Errorf("wait = %s, want 1s at 60 a minute", wait)
+	}
+	if ok, _ := l.Allow("other"); !ok {
+		t.Error("another key shared the exhausted bucket")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := l.Allow("device"); !ok {
+		t.Error("request after refill was refused")
+	}
+
+	// "other" refills fully after 2s idle; "device" has just been used
+	now = now.Add(time.Second)
+	if dropped := l.Cleanup(); dropped != 1 {
+		t.Errorf("Cleanup dropped %d buckets, want 1", dropped)
+	}
+	if _, ok := l.buckets["device"]; !ok {
+		t.Error("Cleanup dropped a bucket that had not refilled")
+	}
+}
+
+func TestRateLimiterLimit(t *testing.T) {
+	l := NewRateLimiter(1, 1)
+	handler := l.Limit(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	deviceA := WithDeviceID(httptest.NewRequest(http.MethodPost, "/api/downloads/start", nil).Context(), "device-a")
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+	}{
+		{"First Request", httptest.NewRequest(http.MethodPost, "/api/downloads/start", nil).WithContext(deviceA), http.StatusOK},
+		{"Same Device", httptest.NewRequest(http.MethodPost, "/api/downloads/start", nil).WithContext(deviceA), http.StatusTooManyRequests},
+		{"No Device Uses IP", httptest.NewRequest(http.MethodPost, "/api/downloads/start", nil), http.StatusOK},
+		{"Same IP", httptest.NewRequest(http.MethodPost, "/api/downloads/start", nil), http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler(rr, tt.req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+			if tt.wantStatus == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "60" {
+				t.Errorf("Retry-After = %q, want 60", rr.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"FundAIHub/internal/auth"
+	"FundAIHub/internal/metrics"
+	"container/list"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	verifyCacheHits   = metrics.NewCounter("fundaihub_device_verify_cache_hits_total", "Device verifications served from the cache.")
+	verifyCacheMisses = metrics.NewCounter("fundaihub_device_verify_cache_misses_total", "Device verifications sent to FundaVault.")
+)
+
+type verifyEntry struct {
+	deviceID  string
+	result    auth.DeviceVerifyResponse
+	expiresAt time.Time
+}
+
+// verifyCache is a size-bounded LRU of successful FundaVault verifications,
+// keyed by Device-ID, whose entries expire after a fixed TTL. Callers still
+// check the cached subscription end and device status on every hit.
+type verifyCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+func newVerifyCache(size int, ttl time.Duration) *verifyCache {
+	return &verifyCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// get returns a copy of the cached verification of deviceID
+func (c *verifyCache) get(deviceID string) (*auth.DeviceVerifyResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[deviceID]
+	if !ok {
+		verifyCacheMisses.Inc()
+		return nil, false
+	}
+	entry := el.Value.(*verifyEntry)
+	if c.now().After(entry.expiresAt) {
+		c.order.Remove(el)
+		delete(c.entries, deviceID)
+		verifyCacheMisses.Inc()
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	verifyCacheHits.Inc()
+	result := entry.result
+	return &result, true
+}
+
+func (c *verifyCache) put(deviceID string, result *auth.DeviceVerifyResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(c.ttl)
+	if el, ok := c.entries[deviceID]; ok {
+		entry := el.Value.(*verifyEntry)
+		entry.result = *result
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[deviceID] = c.order.PushFront(&verifyEntry{
+		deviceID:  deviceID,
+		result:    *result,
+		expiresAt: expiresAt,
+	})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*verifyEntry).deviceID)
+	}
+}
+
+// forget drops deviceID's cached verification, reporting whether there was one
+func (c *verifyCache) forget(deviceID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[deviceID]
+	if !ok {
+		return false
+	}
+	c.order.Remove(el)
+	delete(c.entries, deviceID)
+	return true
+}
+
+// EnableVerificationCache keeps successful device verifications for ttl,
+// holding at most size devices, so repeat requests skip FundaVault. A size
+// or ttl of zero leaves every request verified. Admin routes always verify
+// afresh; see AdminOnly.
+func (m *AuthMiddleware) EnableVerificationCache(size int, ttl time.Duration) {
+	if size <= 0 || ttl <= 0 {
+		m.verified = nil
+		return
+	}
+	m.verified = newVerifyCache(size, ttl)
+}
+
+// ForgetDevice drops the cached verification of a Device-ID, so the device's
+// next request is verified with FundaVault. Call it when a device is revoked.
+func (m *AuthMiddleware) ForgetDevice(deviceID string) bool {
+	if m.verified == nil {
+		return false
+	}
+	return m.verified.forget(deviceID)
+}
+
+// EvictDevice serves DELETE /api/admin/device-cache?device_id=<Device-ID>,
+// dropping the device's cached verification so a revocation in FundaVault
+// takes effect on its next request. Belongs behind AdminOnly.
+func (m *AuthMiddleware) EvictDevice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		m.respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	deviceID, ok := NormalizeDeviceID(r.URL.Query().Get("device_id"))
+	if !ok {
+		m.respondWithError(w, http.StatusBadRequest, "device_id must be a Device-ID: 64 hex characters")
+		return
+	}
+	if m.ForgetDevice(deviceID) {
+		log.Printf("[AuthMiddleware] Evicted cached verification for Device-ID '%s'", deviceID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
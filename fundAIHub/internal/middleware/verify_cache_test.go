@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"FundAIHub/internal/auth"
+	"FundAIHub/internal/config"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVerifyCache(t *testing.T) {
+	now := time.Now()
+	cache := newVerifyCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.put("a", &auth.DeviceVerifyResponse{UserID: 1})
+	cache.put("b", &auth.DeviceVerifyResponse{UserID: 2})
+	cache.get("a") // a is now more recent than b
+	cache.put("c", &auth.DeviceVerifyResponse{UserID: 3})
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	if got, ok := cache.get("a"); !ok || got.UserID != 1 {
+		t.Errorf("Expected a to remain cached, got %+v, %t", got, ok)
+	}
+
+	now = now.Add(time.Minute + time.Second)
+	if _, ok := cache.get("a"); ok {
+		t.Error("Expected a to expire")
+	}
+}
+
+func TestAuthenticateDeviceCachesVerification(t *testing.T) {
+	var calls int32
+	subscriptionEnd := time.Now().Add(time.Hour)
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		json.NewEncoder(w).Encode(auth.DeviceVerifyResponse{
+			Authenticated:   true,
+			UserID:          7,
+			SubscriptionEnd: subscriptionEnd.Format(time.RFC3339),
+		})
+	}))
+	defer vault.Close()
+
+	m := NewAuthMiddleware(auth.NewFundaVaultClient(&config.Config{FundaVaultURL: vault.URL}))
+	m.EnableVerificationCache(16, time.Minute)
+	now := time.Now()
+	m.verified.now = func() time.Time { return now }
+	handler := m.AuthenticateDevice(func(w http.ResponseWriter, r *http.Request) {})
+
+	serve := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/api/downloads/history", nil)
+		req.Header.Set("Device-ID", strings.Repeat("ab", 32))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := serve(); code != http.StatusOK {
+			t.Fatalf("Request %d: expected status %d, got %d", i, http.StatusOK, code)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Expected 1 FundaVault call, got %d", n)
+	}
+
+	now = now.Add(2 * time.Minute)
+	serve()
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected FundaVault to be asked again after expiry, got %d calls", n)
+	}
+
+	// A cached verification whose subscription has since ended is refused
+	m.verified.put(strings.Repeat("ab", 32), &auth.DeviceVerifyResponse{
+		Authenticated:   true,
+		UserID:          7,
+		SubscriptionEnd: time.Now().Add(-time.Minute).Format(time.RFC3339),
+	})
+	if code := serve(); code != http.StatusForbidden {
+		t.Errorf("Expected status %d for an ended subscription, got %d", http.StatusForbidden, code)
+	}
+}
+
+func TestRevokedDeviceLosesCachedAccess(t *testing.T) {
+	var revoked atomic.Bool
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if revoked.Load() {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(auth.DeviceVerifyResponse{Authenticated: true, UserID: 7, IsAdmin: true})
+	}))
+	defer vault.Close()
+
+	m := NewAuthMiddleware(auth.NewFundaVaultClient(&config.Config{FundaVaultURL: vault.URL}))
+	m.EnableVerificationCache(16, time.Hour)
+	device := strings.Repeat("cd", 32)
+	serve := func(handler http.HandlerFunc) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/downloads/history", nil)
+		req.Header.Set("Device-ID", device)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr.Code
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	user, admin := m.AuthenticateDevice(ok), m.AdminOnly(ok)
+
+	if code := serve(user); code != http.StatusOK {
+		t.Fatalf("Expected status %d before revocation, got %d", http.StatusOK, code)
+	}
+	revoked.Store(true)
+
+	// The cache still vouches for the device on ordinary routes, but admin
+	// routes ask FundaVault, and its refusal drops the cached entry
+	if code := serve(admin); code != http.StatusForbidden {
+		t.Errorf("Admin route: expected status %d after revocation, got %d", http.StatusForbidden, code)
+	}
+	if code := serve(user); code != http.StatusForbidden {
+		t.Errorf("Expected status %d once FundaVault refused the device, got %d", http.StatusForbidden, code)
+	}
+
+	// Eviction through the admin endpoint
+	revoked.Store(false)
+	serve(user)
+	revoked.Store(true)
+	req := httptest.NewRequest(http.MethodDelete, "/api/admin/device-cache?device_id="+strings.ToUpper(device), nil)
+	rr := httptest.NewRecorder()
+	m.EvictDevice(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("EvictDevice: expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if code := serve(user); code != http.StatusForbidden {
+		t.Errorf("Expected status %d after eviction, got %d", http.StatusForbidden, code)
+	}
+}
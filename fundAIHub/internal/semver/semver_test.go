@@ -0,0 +1,70 @@
+package semver
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	// Each version is lower than the next, following the precedence example
+	// in the semver spec
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.2",
+		"v1.10.0",
+		"2.0.0",
+	}
+	for i := 0; i < len(ordered)-1; i++ {
+		a, err := Parse(ordered[i])
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", ordered[i], err)
+		}
+		b, err := Parse(ordered[i+1])
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", ordered[i+1], err)
+		}
+		if Compare(a, b) != -1 || Compare(b, a) != 1 {
+			t.Errorf("expected %s < %s", ordered[i], ordered[i+1])
+		}
+	}
+}
+
+func TestBuildMetadataIgnored(t *testing.T) {
+	a, _ := Parse("1.0.0+build.1")
+	b, _ := Parse("1.0.0+build.2")
+	if Compare(a, b) != 0 {
+		t.Error("build metadata should not affect precedence")
+	}
+	if a.Build != "build.1" {
+		t.Errorf("Build = %q, want build.1", a.Build)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{"", "abc", "1.2.3.4", "1.0.0-", "1.0.0-alpha..1", "1.x"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) should fail", s)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	for in, want := range map[string]string{
+		"v1.2":             "1.2.0",
+		"1.0.0-rc.1+build": "1.0.0-rc.1+build",
+		"3":                "3.0.0",
+	} {
+		v, err := Parse(in)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", in, err)
+		}
+		if got := v.String(); got != want {
+			t.Errorf("Parse(%q).String() = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package storage
+
+import "errors"
+
+var (
+	// ErrNotFound means the backend has no object under the requested key
+	ErrNotFound = errors.New("object not found in storage")
+	// ErrUpstream means the backend could not be reached or failed the request
+	ErrUpstream = errors.New("storage backend unavailable")
+	// ErrRangeNotSupported means the backend answered a ranged request with
+	// the whole object
+	ErrRangeNotSupported = errors.New("range not supported")
+)
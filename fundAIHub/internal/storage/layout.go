@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KeyLayout decides where newly uploaded objects are placed in the bucket.
+// Every new key is unique, so an upload can never land on another record's
+// object however uploads race. Existing objects keep whatever key is recorded
+// on their content record, so changing the layout only affects new uploads.
+type KeyLayout string
+
+const (
+	// LayoutFlat stores every object at the bucket root as <uuid>-<filename>
+	LayoutFlat KeyLayout = "flat"
+	// LayoutHierarchical groups objects as <app_type>/<yyyy>/<mm>/<uuid>-<filename>
+	LayoutHierarchical KeyLayout = "hierarchical"
+)
+
+// ParseKeyLayout validates a layout name, treating an empty value as flat
+func ParseKeyLayout(s string) (KeyLayout, error) {
+	switch KeyLayout(strings.ToLower(strings.TrimSpace(s))) {
+	case "", LayoutFlat:
+		return LayoutFlat, nil
+	case LayoutHierarchical:
+		return LayoutHierarchical, nil
+	default:
+		return "", fmt.Errorf("unknown storage key layout %q", s)
+	}
+}
+
+// ObjectKey returns the storage key for a new upload
+func (l KeyLayout) ObjectKey(appType, filename string, now time.Time) string {
+	name := fmt.Sprintf("%s-%s", uuid.New(), path.Base(strings.ReplaceAll(filename, "\\", "/")))
+	if l != LayoutHierarchical {
+		return name
+	}
+
+	prefix := strings.Trim(strings.ReplaceAll(appType, "/", "-"), ". ")
+	if prefix == "" {
+		prefix = "uncategorized"
+	}
+	return fmt.Sprintf("%s/%04d/%02d/%s", prefix, now.Year(), int(now.Month()), name)
+}
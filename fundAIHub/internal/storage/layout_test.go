@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyLayout(t *testing.T) {
+	now := time.Date(2024, time.June, 3, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Flat uses the base filename", func(t *testing.T) {
+		got := LayoutFlat.ObjectKey("linux-app", "../builds/editor.AppImage", now)
+		if strings.Contains(got, "/") || !strings.HasSuffix(got, "-editor.AppImage") {
+			t.Errorf("Expected <uuid>-editor.AppImage, got %q", got)
+		}
+	})
+
+	t.Run("Keys are unique", func(t *testing.T) {
+		for _, layout := range []KeyLayout{LayoutFlat, LayoutHierarchical} {
+			if a, b := layout.ObjectKey("linux-app", "editor.AppImage", now), layout.ObjectKey("linux-app", "editor.AppImage", now); a == b {
+				t.Errorf("%s layout gave %q twice", layout, a)
+			}
+		}
+	})
+
+	t.Run("Hierarchical prefixes by app type and date", func(t *testing.T) {
+		got := LayoutHierarchical.ObjectKey("linux-app", "editor.AppImage", now)
+		if !strings.HasPrefix(got, "linux-app/2024/06/") || !strings.HasSuffix(got, "-editor.AppImage") {
+			t.Errorf("Unexpected hierarchical key %q", got)
+		}
+	})
+
+	t.Run("Hierarchical without app type", func(t *testing.T) {
+		got := LayoutHierarchical.ObjectKey("", "notes.pdf", now)
+		if !strings.HasPrefix(got, "uncategorized/2024/06/") {
+			t.Errorf("Unexpected hierarchical key %q", got)
+		}
+	})
+
+	t.Run("Unknown layout is rejected", func(t *testing.T) {
+		if _, err := ParseKeyLayout("nested"); err == nil {
+			t.Error("Expected error for unknown layout")
+		}
+	})
+}
@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// localTempPrefix marks files still being written by Upload; they are
+// renamed into place once complete and never listed
+const localTempPrefix = ".upload-"
+
+// LocalStorage keeps objects as files under a root directory, for
+// deployments that cannot reach a hosted bucket. Keys map to paths below
+// the root and cannot escape it.
+type LocalStorage struct {
+	root string
+}
+
+// NewLocalStorage returns a backend storing objects under root, which is
+// created on first upload if missing
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{root: root}
+}
+
+// path returns the file holding key. Cleaning the key as an absolute path
+// drops any ".." that would lead outside the root.
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if clean == "" {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+// Upload writes file to root/key, creating parent directories. The file is
+// written under a temporary name and renamed when complete, so readers
+// never see a partial object.
+func (s *LocalStorage) Upload(ctx context.Context, file io.Reader, key string, contentType string) (*FileInfo, error) {
+	dest, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return nil, fmt.Errorf("creating directory for %s: %w", key, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), localTempPrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("creating file for %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, contextReader{ctx, file})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("writing %s: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return nil, fmt.Errorf("storing %s: %w", key, err)
+	}
+
+	stat, err := os.Stat(dest)
+	if err != nil {
+		return nil, fmt.Errorf("stat %s: %w", key, err)
+	}
+	return &FileInfo{
+		Key:         strings.TrimPrefix(path.Clean("/"+key), "/"),
+		Size:        size,
+		ContentType: contentType,
+		UpdatedAt:   stat.ModTime(),
+	}, nil
+}
+
+// Download opens the file holding key
+func (s *LocalStorage) Download(ctx context.Context, key string) (io.ReadCloser, *FileInfo, error) {
+	f, info, err := s.open(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+// DownloadFrom opens the file holding key at offset
+func (s *LocalStorage) DownloadFrom(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	return s.DownloadRange(ctx, key, offset, -1)
+}
+
+// DownloadRange reads bytes start through end of the file holding key,
+// inclusive. A negative end reads to the end of the file.
+func (s *LocalStorage) DownloadRange(ctx context.Context, key string, start, end int64) (io.ReadCloser, error) {
+	f, _, err := s.open(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("seeking to byte %d of %s: %w", start, key, err)
+	}
+	if end < 0 {
+		return f, nil
+	}
+	return readCloser{io.LimitReader(f, end-start+1), f}, nil
+}
+
+func (s *LocalStorage) open(key string) (*os.File, *FileInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, localError("open", key, err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, localError("stat", key, err)
+	}
+	if stat.IsDir() {
+		f.Close()
+		return nil, nil, fmt.Errorf("%w: %s is a directory", ErrNotFound, key)
+	}
+	return f, localFileInfo(key, stat), nil
+}
+
+// Delete removes the file holding key. Deleting a missing object succeeds,
+// as it does on hosted backends.
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return localError("delete", key, err)
+	}
+	return nil
+}
+
+// GetInfo describes the file holding key
+func (s *LocalStorage) GetInfo(ctx context.Context, key string) (*FileInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(p)
+	if err != nil {
+		return nil, localError("stat", key, err)
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("%w: %s is a directory", ErrNotFound, key)
+	}
+	return localFileInfo(key, stat), nil
+}
+
+// ListFiles walks the root and returns every file whose key starts with
+// prefix
+func (s *LocalStorage) ListFiles(ctx context.Context, prefix string) ([]FileInfo, error) {
+	var files []FileInfo
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == s.root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir // Nothing uploaded yet
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), localTempPrefix) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, *localFileInfo(key, stat))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", s.root, err)
+	}
+	return files, nil
+}
+
+// localFileInfo describes a stored file. The content type is not kept on
+// disk, so it is guessed from the key's extension.
+func localFileInfo(key string, stat fs.FileInfo) *FileInfo {
+	return &FileInfo{
+		Key:         key,
+		Size:        stat.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		UpdatedAt:   stat.ModTime(),
+	}
+}
+
+// localError maps a missing file to ErrNotFound
+func localError(op, key string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return fmt.Errorf("%s %s: %w", op, key, err)
+}
+
+// contextReader stops a copy once ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
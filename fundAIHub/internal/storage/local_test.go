@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorage(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "objects")
+	s := NewLocalStorage(root)
+	ctx := context.Background()
+
+	files, err := s.ListFiles(ctx, "")
+	if err != nil || len(files) != 0 {
+		t.Fatalf("ListFiles before any upload = %v, %v", files, err)
+	}
+
+	info, err := s.Upload(ctx, strings.NewReader("hello world"), "apps/linux/app.zip", "application/zip")
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if info.Key != "apps/linux/app.zip" || info.Size != 11 {
+		t.Errorf("Upload returned %+v", info)
+	}
+	if _, err := s.Upload(ctx, strings.NewReader("notes"), "docs/readme.txt", "text/plain"); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	body, info, err := s.Download(ctx, "apps/linux/app.zip")
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "hello world" || info.Size != 11 || info.ContentType != "application/zip" {
+		t.Errorf("Download returned %q, %+v", data, info)
+	}
+
+	ranged, err := OpenRange(ctx, s, "apps/linux/app.zip", 6, 9)
+	if err != nil {
+		t.Fatalf("OpenRange: %v", err)
+	}
+	data, _ = io.ReadAll(ranged)
+	ranged.Close()
+	if string(data) != "worl" {
+		t.Errorf("OpenRange returned %q, want %q", data, "worl")
+	}
+
+	files, err = s.ListFiles(ctx, "apps/")
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	if len(files) != 1 || files[0].Key != "apps/linux/app.zip" {
+		t.Errorf("ListFiles(apps/) = %+v", files)
+	}
+	files, _ = s.ListFiles(ctx, "")
+	var keys []string
+	for _, f := range files {
+		keys = append(keys, f.Key)
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "apps/linux/app.zip,docs/readme.txt" {
+		t.Errorf("ListFiles() keys = %v", keys)
+	}
+
+	if err := s.Delete(ctx, "apps/linux/app.zip"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.GetInfo(ctx, "apps/linux/app.zip"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetInfo after Delete error = %v, want ErrNotFound", err)
+	}
+	if _, _, err := s.Download(ctx, "apps/linux/app.zip"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Download after Delete error = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "apps/linux/app.zip"); err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+}
+
+func TestLocalStorageStaysUnderRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "objects")
+	s := NewLocalStorage(root)
+
+	info, err := s.Upload(context.Background(), strings.NewReader("x"), "../../escape.txt", "text/plain")
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if info.Key != "escape.txt" {
+		t.Errorf("Key = %q, want escape.txt", info.Key)
+	}
+	if _, err := os.Stat(filepath.Join(root, "escape.txt")); err != nil {
+		t.Errorf("Expected the file under the root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); err == nil {
+		t.Error("Upload wrote outside the root")
+	}
+}
@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"FundAIHub/internal/metrics"
+	"time"
+)
+
+// operationDuration times calls to hosted storage. For downloads it covers
+// opening the object, not streaming it.
+var operationDuration = metrics.NewHistogramVec("fundaihub_storage_operation_duration_seconds",
+	"Time taken by storage operations, by bucket and operation.", metrics.DefBuckets, "bucket", "operation")
+
+// ObserveOperation records an operation on bucket that began at start.
+// Backends defer it at the top of each method:
+//
+//	defer storage.ObserveOperation(s.bucketName, "upload", time.Now())
+func ObserveOperation(bucket, operation string, start time.Time) {
+	operationDuration.Observe(time.Since(start).Seconds(), bucket, operation)
+}
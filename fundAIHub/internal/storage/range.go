@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// RangeReader is implemented by backends that can read part of an object
+// without transferring the rest
+type RangeReader interface {
+	// DownloadRange reads bytes start through end, inclusive. A negative end
+	// reads to the end of the object.
+	DownloadRange(ctx context.Context, key string, start, end int64) (io.ReadCloser, error)
+}
+
+// RangeHeader formats an HTTP Range header value for DownloadRange's bounds
+func RangeHeader(start, end int64) string {
+	if end < 0 {
+		return fmt.Sprintf("bytes=%d-", start)
+	}
+	return fmt.Sprintf("bytes=%d-%d", start, end)
+}
+
+// OpenRange reads bytes start through end of an object from any backend. It
+// uses a ranged request when svc is a RangeReader that honours it, and
+// otherwise downloads the object and skips to start.
+func OpenRange(ctx context.Context, svc StorageService, key string, start, end int64) (io.ReadCloser, error) {
+	if ranged, ok := svc.(RangeReader); ok {
+		body, err := ranged.DownloadRange(ctx, key, start, end)
+		if !errors.Is(err, ErrRangeNotSupported) {
+			return body, err
+		}
+	}
+
+	body, _, err := svc.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, body, start); err != nil {
+		body.Close()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s is shorter than %d bytes", key, start)
+		}
+		return nil, fmt.Errorf("%w: skipping to byte %d of %s: %v", ErrUpstream, start, key, err)
+	}
+	if end < 0 {
+		return body, nil
+	}
+	return readCloser{io.LimitReader(body, end-start+1), body}, nil
+}
+
+// readCloser pairs a reader with the Close of the stream beneath it
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
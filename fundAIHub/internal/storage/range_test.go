@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenRange(t *testing.T) {
+	t.Run("Backends without ranged reads skip to the start", func(t *testing.T) {
+		mem := newMemStorage()
+		mem.objects["a.zip"] = []byte("0123456789")
+
+		body, err := OpenRange(context.Background(), mem, "a.zip", 3, 6)
+		if err != nil {
+			t.Fatalf("OpenRange: %v", err)
+		}
+		defer body.Close()
+		if got, _ := io.ReadAll(body); string(got) != "3456" {
+			t.Errorf("Expected %q, got %q", "3456", got)
+		}
+	})
+
+	t.Run("Supabase forwards the range", func(t *testing.T) {
+		var gotRange string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotRange = r.Header.Get("Range")
+			w.WriteHeader(http.StatusPartialContent)
+			io.WriteString(w, "3456")
+		}))
+		defer server.Close()
+
+		body, err := OpenRange(context.Background(), NewSupabaseStorage(server.URL, "key", "content"), "a.zip", 3, 6)
+		if err != nil {
+			t.Fatalf("OpenRange: %v", err)
+		}
+		defer body.Close()
+		if gotRange != "bytes=3-6" {
+			t.Errorf("Expected Range %q, got %q", "bytes=3-6", gotRange)
+		}
+	})
+
+	t.Run("Ignored ranges fall back to skipping", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "0123456789")
+		}))
+		defer server.Close()
+
+		body, err := OpenRange(context.Background(), NewSupabaseStorage(server.URL, "key", "content"), "a.zip", 7, -1)
+		if err != nil {
+			t.Fatalf("OpenRange: %v", err)
+		}
+		defer body.Close()
+		if got, _ := io.ReadAll(body); string(got) != "789" {
+			t.Errorf("Expected %q, got %q", "789", got)
+		}
+	})
+}
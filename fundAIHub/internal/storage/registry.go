@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrUnknownBackend is returned when a content record names a storage
+// backend that is not registered
+var ErrUnknownBackend = errors.New("unknown storage backend")
+
+// Registry maps backend names, as stored on content records, to the services
+// holding their objects. One of them is active and receives new uploads.
+type Registry struct {
+	backends map[string]StorageService
+	active   string
+}
+
+// NewRegistry returns a registry whose active backend is svc under name
+func NewRegistry(name string, svc StorageService) *Registry {
+	r := &Registry{backends: map[string]StorageService{}}
+	r.Register(name, svc)
+	r.active = name
+	return r
+}
+
+// Register adds or replaces a backend. Objects already stored in it stay
+// reachable while it is registered, even once another backend is active.
+func (r *Registry) Register(name string, svc StorageService) {
+	r.backends[name] = svc
+}
+
+// SetActive makes a registered backend receive new uploads
+func (r *Registry) SetActive(name string) error {
+	if _, ok := r.backends[name]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownBackend, name)
+	}
+	r.active = name
+	return nil
+}
+
+// Active returns the backend new uploads go to and its name
+func (r *Registry) Active() (string, StorageService) {
+	return r.active, r.backends[r.active]
+}
+
+// Get returns the backend registered under name
+func (r *Registry) Get(name string) (StorageService, error) {
+	svc, ok := r.backends[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, name)
+	}
+	return svc, nil
+}
+
+// Names lists the registered backends in name order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.backends))
+	for name := range r.backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Pinger is implemented by backends with a cheap check that they are
+// reachable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// pingKey is looked up to check backends without a Ping; it is never stored
+const pingKey = ".readiness-probe"
+
+// Ping reports whether svc can be reached. Backends without a Ping are asked
+// about an object that does not exist, for which not found is the healthy
+// answer.
+func Ping(ctx context.Context, svc StorageService) error {
+	if p, ok := svc.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	if _, err := svc.GetInfo(ctx, pingKey); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Wrap returns a registry with the same backends, each wrapped by fn, and the
+// same active backend
+func (r *Registry) Wrap(fn func(StorageService) StorageService) *Registry {
+	wrapped := &Registry{backends: make(map[string]StorageService, len(r.backends)), active: r.active}
+	for name, svc := range r.backends {
+		wrapped.backends[name] = fn(svc)
+	}
+	return wrapped
+}
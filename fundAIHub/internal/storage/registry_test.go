@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	supabase, local := newMemStorage(), newMemStorage()
+	r := NewRegistry("supabase", supabase)
+	r.Register("local", local)
+
+	if name, svc := r.Active(); name != "supabase" || svc != supabase {
+		t.Errorf("Active = %q, want the backend the registry was created with", name)
+	}
+	if err := r.SetActive("local"); err != nil {
+		t.Fatalf("SetActive: %v", err)
+	}
+	if name, svc := r.Active(); name != "local" || svc != local {
+		t.Errorf("Active = %q after SetActive(local)", name)
+	}
+
+	// Switching the active backend leaves the old one reachable
+	if svc, err := r.Get("supabase"); err != nil || svc != supabase {
+		t.Errorf("Get(supabase) = %v, %v", svc, err)
+	}
+
+	if _, err := r.Get("s3"); !errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("Get(s3) error = %v, want ErrUnknownBackend", err)
+	}
+	if err := r.SetActive("s3"); !errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("SetActive(s3) error = %v, want ErrUnknownBackend", err)
+	}
+}
+
+// failingInfo is a backend whose metadata requests fail
+type failingInfo struct{ *memStorage }
+
+func (f failingInfo) GetInfo(ctx context.Context, key string) (*FileInfo, error) {
+	return nil, ErrUpstream
+}
+
+func TestRegistryPing(t *testing.T) {
+	r := NewRegistry("supabase", newMemStorage())
+	r.Register("local", failingInfo{newMemStorage()})
+
+	if got, want := r.Names(), []string{"local", "supabase"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names = %v, want %v", got, want)
+	}
+
+	supabase, _ := r.Get("supabase")
+	if err := Ping(context.Background(), supabase); err != nil {
+		t.Errorf("Ping(supabase) = %v, want nil for a reachable backend", err)
+	}
+	local, _ := r.Get("local")
+	if err := Ping(context.Background(), local); !errors.Is(err, ErrUpstream) {
+		t.Errorf("Ping(local) = %v, want ErrUpstream", err)
+	}
+}
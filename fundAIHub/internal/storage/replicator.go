@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// Replicator copies objects from a primary backend to a mirror so the mirror
+// can serve downloads when the primary fails.
+type Replicator struct {
+	primary StorageService
+	mirror  StorageService
+}
+
+func NewReplicator(primary, mirror StorageService) *Replicator {
+	return &Replicator{primary: primary, mirror: mirror}
+}
+
+// Sync copies each key the mirror does not have yet and returns how many
+// objects were copied. Failures are logged and skipped so one bad object
+// does not stall the rest.
+func (r *Replicator) Sync(ctx context.Context, keys []string) int {
+	copied := 0
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			break
+		}
+
+		_, err := r.mirror.GetInfo(ctx, key)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("[Replicator] Could not check mirror for %s: %v", key, err)
+			continue
+		}
+
+		if err := r.copy(ctx, key); err != nil {
+			log.Printf("[Replicator] Failed to copy %s to mirror: %v", key, err)
+			continue
+		}
+		copied++
+	}
+	return copied
+}
+
+func (r *Replicator) copy(ctx context.Context, key string) error {
+	return Copy(ctx, r.primary, r.mirror, key)
+}
+
+// Copy streams the object under key from one backend to another, keeping
+// its content type
+func Copy(ctx context.Context, from, to StorageService, key string) error {
+	reader, info, err := from.Download(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	contentType := ""
+	if info != nil {
+		contentType = info.ContentType
+	}
+	_, err = to.Upload(ctx, reader, key, contentType)
+	return err
+}
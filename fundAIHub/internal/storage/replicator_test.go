@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// memStorage is an in-memory StorageService for tests
+type memStorage struct {
+	objects map[string][]byte
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{objects: make(map[string][]byte)}
+}
+
+func (m *memStorage) Upload(ctx context.Context, file io.Reader, key string, contentType string) (*FileInfo, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	m.objects[key] = data
+	return &FileInfo{Key: key, Size: int64(len(data)), ContentType: contentType}, nil
+}
+
+func (m *memStorage) Download(ctx context.Context, key string) (io.ReadCloser, *FileInfo, error) {
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return io.NopCloser(bytes.NewReader(data)), &FileInfo{Key: key, Size: int64(len(data))}, nil
+}
+
+func (m *memStorage) Delete(ctx context.Context, key string) error {
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memStorage) GetInfo(ctx context.Context, key string) (*FileInfo, error) {
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return &FileInfo{Key: key, Size: int64(len(data))}, nil
+}
+
+func (m *memStorage) ListFiles(ctx context.Context, prefix string) ([]FileInfo, error) {
+	var files []FileInfo
+	for key, data := range m.objects {
+		files = append(files, FileInfo{Key: key, Size: int64(len(data))})
+	}
+	return files, nil
+}
+
+func TestReplicatorSync(t *testing.T) {
+	primary, mirror := newMemStorage(), newMemStorage()
+	primary.objects["a.zip"] = []byte("aaa")
+	primary.objects["b.zip"] = []byte("bbb")
+	mirror.objects["a.zip"] = []byte("aaa")
+
+	copied := NewReplicator(primary, mirror).Sync(context.Background(), []string{"a.zip", "b.zip", "missing.zip"})
+
+	if copied != 1 {
+		t.Errorf("copied = %d, want 1", copied)
+	}
+	if string(mirror.objects["b.zip"]) != "bbb" {
+		t.Errorf("mirror b.zip = %q, want bbb", mirror.objects["b.zip"])
+	}
+	if _, ok := mirror.objects["missing.zip"]; ok {
+		t.Error("object missing from primary should not appear in mirror")
+	}
+}
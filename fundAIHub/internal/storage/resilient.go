@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// RangeDownloader is implemented by backends that can open an object part
+// way through, which lets an interrupted download be continued
+type RangeDownloader interface {
+	DownloadFrom(ctx context.Context, key string, offset int64) (io.ReadCloser, error)
+}
+
+// Retry calls fn up to attempts times while it fails with ErrUpstream,
+// waiting about delay before the first retry and doubling it after each.
+// Waits are jittered to between half and all of their length so clients
+// that failed together do not retry together. Other errors, such as
+// ErrNotFound, are returned at once.
+func Retry(ctx context.Context, attempts int, delay time.Duration, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !errors.Is(err, ErrUpstream) || attempt >= attempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(jitter(delay)):
+		}
+		delay *= 2
+	}
+}
+
+// Resilient wraps a StorageService so transient backend failures do not fail
+// a download outright. Opening a download is retried on ErrUpstream, and if
+// the stream breaks part way and the backend is a RangeDownloader, the rest
+// is fetched with a ranged request and spliced in. Other operations pass
+// straight through. A backend that is a Retrier with retries enabled already
+// retries each request, so its opens are tried once here.
+type Resilient struct {
+	StorageService
+	attempts int
+	delay    time.Duration
+}
+
+// NewResilient wraps svc, allowing up to attempts tries per open, and up to
+// attempts resumes per stream, with the given initial delay between tries
+func NewResilient(svc StorageService, attempts int, delay time.Duration) *Resilient {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &Resilient{StorageService: svc, attempts: attempts, delay: delay}
+}
+
+// openAttempts is how many times to try opening an object
+func (r *Resilient) openAttempts() int {
+	if rt, ok := r.StorageService.(Retrier); ok && rt.Retries() {
+		return 1
+	}
+	return r.attempts
+}
+
+func (r *Resilient) Download(ctx context.Context, key string) (io.ReadCloser, *FileInfo, error) {
+	var body io.ReadCloser
+	var info *FileInfo
+	attempts := r.openAttempts()
+	attempt := 0
+	err := Retry(ctx, attempts, r.delay, func() error {
+		attempt++
+		var err error
+		body, info, err = r.StorageService.Download(ctx, key)
+		if err != nil && errors.Is(err, ErrUpstream) && attempt < attempts {
+			log.Printf("[Storage] Opening %s failed (attempt %d/%d), retrying: %v", key, attempt, attempts, err)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ranged, ok := r.StorageService.(RangeDownloader)
+	if !ok {
+		return body, info, nil
+	}
+	var size int64
+	if info != nil {
+		size = info.Size
+	}
+	return &resumingReader{ctx: ctx, key: key, size: size, body: body, ranged: ranged, r: r}, info, nil
+}
+
+// DownloadRange opens part of an object, retrying on ErrUpstream like
+// Download. Backends without ranged reads are served by skipping.
+func (r *Resilient) DownloadRange(ctx context.Context, key string, start, end int64) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	err := Retry(ctx, r.openAttempts(), r.delay, func() error {
+		var err error
+		body, err = OpenRange(ctx, r.StorageService, key, start, end)
+		return err
+	})
+	return body, err
+}
+
+// resumingReader reads an object and, when a read fails before the end,
+// reopens it from the current offset
+type resumingReader struct {
+	ctx     context.Context
+	key     string
+	size    int64 // Zero when unknown
+	offset  int64
+	resumes int
+	body    io.ReadCloser
+	ranged  RangeDownloader
+	r       *Resilient
+}
+
+func (rr *resumingReader) Read(p []byte) (int, error) {
+	n, err := rr.body.Read(p)
+	rr.offset += int64(n)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	if rr.size > 0 && rr.offset >= rr.size {
+		return n, io.EOF
+	}
+	if rr.resumes >= rr.r.attempts || rr.ctx.Err() != nil {
+		return n, err
+	}
+	if resumeErr := rr.resume(err); resumeErr != nil {
+		return n, fmt.Errorf("%v; resuming at byte %d: %w", err, rr.offset, resumeErr)
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return rr.Read(p)
+}
+
+// resume replaces the broken body with one starting at the current offset
+func (rr *resumingReader) resume(cause error) error {
+	rr.resumes++
+	log.Printf("[Storage] Stream of %s broke at byte %d, re-requesting from there (resume %d/%d): %v",
+		rr.key, rr.offset, rr.resumes, rr.r.attempts, cause)
+	rr.body.Close()
+
+	var body io.ReadCloser
+	err := Retry(rr.ctx, rr.r.openAttempts(), rr.r.delay, func() error {
+		var err error
+		body, err = rr.ranged.DownloadFrom(rr.ctx, rr.key, rr.offset)
+		return err
+	})
+	if err != nil {
+		rr.body = io.NopCloser(errReader{err})
+		return err
+	}
+	rr.body = body
+	return nil
+}
+
+func (rr *resumingReader) Close() error {
+	return rr.body.Close()
+}
+
+// errReader fails every read with err
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyStorage fails the first opens with ErrUpstream, then serves data
+// through a body that breaks after breakAfter bytes. Ranged opens serve the
+// rest intact.
+type flakyStorage struct {
+	*memStorage
+	failOpens  int
+	breakAfter int
+	opens      int
+	rangedAt   []int64
+}
+
+func (f *flakyStorage) Download(ctx context.Context, key string) (io.ReadCloser, *FileInfo, error) {
+	f.opens++
+	if f.opens <= f.failOpens {
+		return nil, nil, fmt.Errorf("%w: 503", ErrUpstream)
+	}
+	data := f.objects[key]
+	var body io.Reader = bytes.NewReader(data)
+	if f.breakAfter > 0 {
+		body = io.MultiReader(bytes.NewReader(data[:f.breakAfter]), errReader{errors.New("connection reset")})
+	}
+	return io.NopCloser(body), &FileInfo{Key: key, Size: int64(len(data))}, nil
+}
+
+func (f *flakyStorage) DownloadFrom(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	f.rangedAt = append(f.rangedAt, offset)
+	return io.NopCloser(bytes.NewReader(f.objects[key][offset:])), nil
+}
+
+func TestResilientRetriesOpen(t *testing.T) {
+	backend := &flakyStorage{memStorage: newMemStorage(), failOpens: 2}
+	backend.objects["a.zip"] = []byte("hello")
+
+	body, _, err := NewResilient(backend, 3, time.Millisecond).Download(context.Background(), "a.zip")
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	defer body.Close()
+	if got, _ := io.ReadAll(body); string(got) != "hello" {
+		t.Errorf("Read %q, want %q", got, "hello")
+	}
+	if backend.opens != 3 {
+		t.Errorf("Expected 3 opens, got %d", backend.opens)
+	}
+
+	backend.opens, backend.failOpens = 0, 5
+	if _, _, err := NewResilient(backend, 3, time.Millisecond).Download(context.Background(), "a.zip"); !errors.Is(err, ErrUpstream) {
+		t.Errorf("Expected ErrUpstream after retries run out, got %v", err)
+	}
+	if backend.opens != 3 {
+		t.Errorf("Expected 3 opens, got %d", backend.opens)
+	}
+}
+
+func TestResilientDoesNotRetryNotFound(t *testing.T) {
+	backend := newMemStorage()
+	if _, _, err := NewResilient(backend, 3, time.Millisecond).Download(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestResilientResumesBrokenStream(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 100))
+	backend := &flakyStorage{memStorage: newMemStorage(), breakAfter: 337}
+	backend.objects["a.zip"] = data
+
+	body, _, err := NewResilient(backend, 3, time.Millisecond).Download(context.Background(), "a.zip")
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	defer body.Close()
+
+	got, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Resumed stream differs: got %d bytes, want %d", len(got), len(data))
+	}
+	if len(backend.rangedAt) != 1 || backend.rangedAt[0] != 337 {
+		t.Errorf("Expected one ranged request at 337, got %v", backend.rangedAt)
+	}
+}
+
+func TestSupabaseDownloadFrom(t *testing.T) {
+	data := "0123456789"
+	var gotRange string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRange = r.Header.Get("Range")
+		offset, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(gotRange, "bytes="), "-"))
+		w.WriteHeader(http.StatusPartialContent)
+		io.WriteString(w, data[offset:])
+	}))
+	defer server.Close()
+
+	body, err := NewSupabaseStorage(server.URL, "key", "content").DownloadFrom(context.Background(), "a.zip", 4)
+	if err != nil {
+		t.Fatalf("DownloadFrom: %v", err)
+	}
+	defer body.Close()
+	got, _ := io.ReadAll(body)
+	if gotRange != "bytes=4-" || string(got) != "456789" {
+		t.Errorf("Range %q returned %q", gotRange, got)
+	}
+}
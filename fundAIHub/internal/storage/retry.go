@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy governs how an HTTP backend retries a request that fails in
+// transit or is answered with a 5xx. The zero value sends each request once.
+type RetryPolicy struct {
+	// Attempts is the most tries per request; one or less disables retries
+	Attempts int
+	// BaseDelay is the wait before the first retry. It doubles after each
+	// try, and every wait is jittered to between half and all of its length
+	// so clients that failed together do not retry together.
+	BaseDelay time.Duration
+	// Writes allows uploads and deletes to be retried as well as reads.
+	// A request whose body cannot be replayed is still sent only once.
+	Writes bool
+}
+
+// Do sends req with client under the policy. A request is retried only if
+// idempotent or the policy allows writes, and only while its context is
+// live; cancelling it abandons any pending wait at once. The last response
+// is returned whatever its status, so callers handle it as before.
+func (p RetryPolicy) Do(client *http.Client, req *http.Request, idempotent bool) (*http.Response, error) {
+	attempts := p.Attempts
+	if attempts < 1 || (!idempotent && !p.Writes) || (req.Body != nil && req.GetBody == nil) {
+		attempts = 1
+	}
+	ctx := req.Context()
+	var resp *http.Response
+	var sendErr error
+	attempt := 0
+	err := Retry(ctx, attempts, p.BaseDelay, func() error {
+		attempt++
+		if attempt > 1 {
+			next := req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return fmt.Errorf("replaying request body: %w", err)
+				}
+				next.Body = body
+			}
+			req = next
+		}
+
+		resp, sendErr = client.Do(req)
+		if attempt >= attempts || (sendErr == nil && resp.StatusCode < 500) {
+			return nil
+		}
+		failure := sendErr
+		if sendErr == nil {
+			failure = fmt.Errorf("status %s", resp.Status)
+			resp.Body.Close()
+			resp = nil
+		}
+		log.Printf("[Storage] %s %s failed (attempt %d/%d), retrying: %v",
+			req.Method, req.URL.Path, attempt, attempts, failure)
+		return fmt.Errorf("%w: %v", ErrUpstream, failure)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%v; retry abandoned: %w", err, ctx.Err())
+		}
+		return nil, err
+	}
+	return resp, sendErr
+}
+
+// Retrier is implemented by backends that retry failed requests themselves,
+// so wrappers such as Resilient do not retry them a second time
+type Retrier interface {
+	// Retries reports whether failed requests are currently retried
+	Retries() bool
+}
+
+// jitter returns a random duration between half of d and d
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond}
+
+	t.Run("Reads are retried after a 5xx", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			io.WriteString(w, `{"size":42}`)
+		}))
+		defer server.Close()
+
+		s := NewSupabaseStorage(server.URL, "key", "content")
+		s.SetRetryPolicy(policy)
+		info, err := s.GetInfo(context.Background(), "a.zip")
+		if err != nil {
+			t.Fatalf("GetInfo: %v", err)
+		}
+		if info.Size != 42 || calls != 3 {
+			t.Errorf("Got size %d after %d calls, want 42 after 3", info.Size, calls)
+		}
+	})
+
+	t.Run("Retries give up after the last attempt", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			http.Error(w, "unavailable", http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		s := NewSupabaseStorage(server.URL, "key", "content")
+		s.SetRetryPolicy(policy)
+		if _, _, err := s.Download(context.Background(), "a.zip"); !errors.Is(err, ErrUpstream) {
+			t.Errorf("Expected ErrUpstream, got %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("Server called %d times, want 3", calls)
+		}
+	})
+
+	t.Run("Writes are sent once unless allowed", func(t *testing.T) {
+		var calls int32
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			if atomic.AddInt32(&calls, 1) == 1 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			io.WriteString(w, `{"Key":"content/a.txt"}`)
+		}))
+		defer server.Close()
+
+		s := NewSupabaseStorage(server.URL, "key", "content")
+		s.SetRetryPolicy(policy)
+		if _, err := s.Upload(context.Background(), strings.NewReader("hello"), "a.txt", "text/plain"); err == nil {
+			t.Fatal("Expected the upload to fail without write retries")
+		}
+
+		calls, bodies = 0, nil
+		s.SetRetryPolicy(RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, Writes: true})
+		if _, err := s.Upload(context.Background(), strings.NewReader("hello"), "a.txt", "text/plain"); err != nil {
+			t.Fatalf("Upload: %v", err)
+		}
+		if len(bodies) != 2 || bodies[1] != "hello" {
+			t.Errorf("Server received %q, want the body replayed", bodies)
+		}
+	})
+
+	t.Run("Cancelling abandons the wait", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		s := NewSupabaseStorage(server.URL, "key", "content")
+		s.SetRetryPolicy(RetryPolicy{Attempts: 5, BaseDelay: time.Hour})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := s.GetInfo(ctx, "a.zip")
+		if !errors.Is(err, ErrUpstream) || !strings.Contains(err.Error(), "retry abandoned") {
+			t.Errorf("Expected an abandoned retry, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("GetInfo took %s after cancellation", elapsed)
+		}
+	})
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := jitter(100 * time.Millisecond); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("jitter(100ms) = %s, want between 50ms and 100ms", d)
+		}
+	}
+}
+
+func TestResilientDoesNotCompoundRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "unavailable", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	s := NewSupabaseStorage(server.URL, "key", "content")
+	s.SetRetryPolicy(RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond})
+	if _, _, err := NewResilient(s, 3, time.Millisecond).Download(context.Background(), "a.zip"); !errors.Is(err, ErrUpstream) {
+		t.Errorf("Expected ErrUpstream, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Server called %d times, want 3 from the backend's policy alone", calls)
+	}
+}
@@ -0,0 +1,383 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3-compatible backend such as AWS S3 or MinIO
+type S3Config struct {
+	// Endpoint is the service's base URL, e.g. https://minio.local:9000.
+	// Empty uses AWS S3 in Region.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3Storage stores objects in an S3-compatible bucket. Requests are signed
+// with AWS Signature Version 4 and address the bucket in the path, which
+// MinIO and AWS both accept.
+type S3Storage struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	now       func() time.Time
+}
+
+// NewS3Storage returns a backend for cfg's bucket
+func NewS3Storage(cfg S3Config) *S3Storage {
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := strings.TrimSuffix(cfg.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	return &S3Storage{
+		endpoint:  endpoint,
+		region:    region,
+		bucket:    cfg.Bucket,
+		accessKey: cfg.AccessKeyID,
+		secretKey: cfg.SecretAccessKey,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		now:       time.Now,
+	}
+}
+
+// objectURL returns the URL of key, or of the bucket when key is empty
+func (s *S3Storage) objectURL(key string, query url.Values) string {
+	u := s.endpoint + "/" + s3Escape(s.bucket)
+	if key != "" {
+		u += "/" + s3Escape(strings.TrimPrefix(path.Clean("/"+key), "/"))
+	}
+	if len(query) > 0 {
+		u += "?" + s3Query(query)
+	}
+	return u
+}
+
+// do signs and sends a request. The payload is not hashed, which S3 allows
+// for requests over TLS and MinIO allows everywhere.
+func (s *S3Storage) do(ctx context.Context, method, target string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	// Send the path encoded exactly as it is signed
+	req.URL.RawPath = s3Escape(req.URL.Path)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	signS3Request(req, s.accessKey, s.secretKey, s.region, "UNSIGNED-PAYLOAD", s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s %s: %v", ErrUpstream, method, req.URL.Path, err)
+	}
+	return resp, nil
+}
+
+// Upload puts file under key. S3 needs the length up front, so a reader of
+// unknown length is spooled to a temporary file first.
+func (s *S3Storage) Upload(ctx context.Context, file io.Reader, key string, contentType string) (*FileInfo, error) {
+	body, size, cleanup, err := sizedBody(file)
+	if err != nil {
+		return nil, fmt.Errorf("buffering %s: %w", key, err)
+	}
+	defer cleanup()
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(ctx, http.MethodPut, s.objectURL(key, nil), body, size, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3StatusError("upload", key, resp)
+	}
+	return &FileInfo{
+		Key:         strings.TrimPrefix(path.Clean("/"+key), "/"),
+		Size:        size,
+		ContentType: contentType,
+		UpdatedAt:   time.Now(),
+	}, nil
+}
+
+// sizedBody returns r with its length, copying it to a temporary file when
+// the length cannot be told without reading it
+func sizedBody(r io.Reader) (io.Reader, int64, func(), error) {
+	if v, ok := r.(interface {
+		io.Reader
+		Len() int
+	}); ok {
+		return v, int64(v.Len()), func() {}, nil
+	}
+
+	tmp, err := os.CreateTemp("", "fundaihub-s3-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	size, err := io.Copy(tmp, r)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+	return tmp, size, cleanup, nil
+}
+
+// Download retrieves the object under key
+func (s *S3Storage) Download(ctx context.Context, key string) (io.ReadCloser, *FileInfo, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.objectURL(key, nil), nil, 0, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, nil, s3StatusError("download", key, resp)
+	}
+	return resp.Body, s3FileInfo(key, resp), nil
+}
+
+// DownloadFrom retrieves the object under key starting at offset
+func (s *S3Storage) DownloadFrom(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	return s.DownloadRange(ctx, key, offset, -1)
+}
+
+// DownloadRange retrieves bytes start through end of the object under key,
+// inclusive. A negative end reads to the end of the object.
+func (s *S3Storage) DownloadRange(ctx context.Context, key string, start, end int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	header.Set("Range", RangeHeader(start, end))
+	resp, err := s.do(ctx, http.MethodGet, s.objectURL(key, nil), nil, 0, header)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return nil, fmt.Errorf("download %s: %w", key, ErrRangeNotSupported)
+		}
+		return nil, s3StatusError("download", key, resp)
+	}
+	return resp.Body, nil
+}
+
+// Delete removes the object under key. S3 reports success for missing
+// objects too.
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.objectURL(key, nil), nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3StatusError("delete", key, resp)
+	}
+	return nil
+}
+
+// GetInfo describes the object under key from a HEAD request
+func (s *S3Storage) GetInfo(ctx context.Context, key string) (*FileInfo, error) {
+	resp, err := s.do(ctx, http.MethodHead, s.objectURL(key, nil), nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3StatusError("getting info", key, resp)
+	}
+	return s3FileInfo(key, resp), nil
+}
+
+// listBucketResult is the part of a ListObjectsV2 response that is used
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+// ListFiles lists every object whose key starts with prefix, following
+// continuation tokens across pages. S3 does not report content types in
+// listings, so they are left empty.
+func (s *S3Storage) ListFiles(ctx context.Context, prefix string) ([]FileInfo, error) {
+	var files []FileInfo
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, s.objectURL("", query), nil, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, s3StatusError("list", prefix, resp)
+		}
+		var page listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: parsing list response: %v", ErrUpstream, err)
+		}
+		for _, o := range page.Contents {
+			files = append(files, FileInfo{Key: o.Key, Size: o.Size, UpdatedAt: o.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return files, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+func s3FileInfo(key string, resp *http.Response) *FileInfo {
+	info := &FileInfo{
+		Key:          key,
+		ContentType:  resp.Header.Get("Content-Type"),
+		CacheControl: resp.Header.Get("Cache-Control"),
+	}
+	info.Size, _ = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.UpdatedAt = t
+	}
+	return info
+}
+
+// s3StatusError maps a failed response to ErrNotFound or ErrUpstream
+func s3StatusError(op, key string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s %s: %s", ErrNotFound, op, key, resp.Status)
+	}
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("%w: %s %s: %s", ErrUpstream, op, key, resp.Status)
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s %s failed: %s: %s", op, key, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// signS3Request adds AWS Signature Version 4 headers to req. The host,
+// Content-Type, Range and x-amz-* headers are signed.
+func signS3Request(req *http.Request, accessKey, secretKey, region, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path),
+		s3Query(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes everything but unreserved characters and "/",
+// as SigV4 requires of paths
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// s3Query encodes a query string with sorted keys, as SigV4 requires
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, strings.ReplaceAll(s3Escape(k), "/", "%2F")+"="+strings.ReplaceAll(s3Escape(v), "/", "%2F"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
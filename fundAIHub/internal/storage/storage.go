@@ -12,6 +12,8 @@ type FileInfo struct {
 	Size        int64
 	ContentType string
 	UpdatedAt   time.Time
+	// CacheControl is set by backends that report it, empty otherwise
+	CacheControl string
 }
 
 // StorageService defines operations for file storage
@@ -20,5 +22,7 @@ type StorageService interface {
 	Download(ctx context.Context, key string) (io.ReadCloser, *FileInfo, error)
 	Delete(ctx context.Context, key string) error
 	GetInfo(ctx context.Context, key string) (*FileInfo, error)
-	ListFiles(ctx context.Context) ([]FileInfo, error)
+	// ListFiles returns the objects whose keys start with prefix; an empty
+	// prefix lists the whole bucket
+	ListFiles(ctx context.Context, prefix string) ([]FileInfo, error)
 }
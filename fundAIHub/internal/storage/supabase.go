@@ -9,139 +9,190 @@ import (
 	"log"
 	"net/http"
 	"path"
-	"strings"
 	"time"
 )
 
+// defaultListPageSize is the number of objects requested per list call
+const defaultListPageSize = 1000
+
 type SupabaseStorage struct {
-	projectURL string
-	apiKey     string
-	bucketName string
-	client     *http.Client
+	projectURL   string
+	apiKey       string
+	bucketName   string
+	client       *http.Client
+	listPageSize int
+	retry        RetryPolicy
 }
 
 func NewSupabaseStorage(projectURL, apiKey, bucketName string) *SupabaseStorage {
 	return &SupabaseStorage{
-		projectURL: projectURL,
-		apiKey:     apiKey,
-		bucketName: bucketName,
-		client:     &http.Client{Timeout: 30 * time.Second},
+		projectURL:   projectURL,
+		apiKey:       apiKey,
+		bucketName:   bucketName,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		listPageSize: defaultListPageSize,
 	}
 }
 
-func (s *SupabaseStorage) Upload(ctx context.Context, file io.Reader, filename string, contentType string) (*FileInfo, error) {
-	url := fmt.Sprintf("%s/storage/v1/object/%s/%s",
-		s.projectURL,
-		s.bucketName,
-		path.Clean(filename))
+// SetListPageSize sets how many objects ListFiles requests per call
+func (s *SupabaseStorage) SetListPageSize(n int) {
+	if n > 0 {
+		s.listPageSize = n
+	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, file)
+// SetRetryPolicy sets how failed requests are retried. Reads are retried
+// under any policy with more than one attempt; uploads and deletes only if
+// it allows writes.
+func (s *SupabaseStorage) SetRetryPolicy(p RetryPolicy) {
+	s.retry = p
+}
+
+// Retries reports whether a retry policy with more than one attempt is set
+func (s *SupabaseStorage) Retries() bool {
+	return s.retry.Attempts > 1
+}
+
+func (s *SupabaseStorage) Upload(ctx context.Context, file io.Reader, filename string, contentType string) (*FileInfo, error) {
+	defer ObserveOperation(s.bucketName, "upload", time.Now())
+	uploadURL := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.projectURL, s.bucketName, filename)
+	req, err := http.NewRequestWithContext(ctx, "POST", uploadURL, file)
 	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+		return nil, fmt.Errorf("failed to create upload request: %w", err)
 	}
-
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.apiKey))
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
 	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("x-upsert", "true") // Overwrite if exists
 
-	log.Printf("[Storage] Uploading to URL: %s", url)
-	log.Printf("[Storage] Content-Type: %s", contentType)
-
-	resp, err := s.client.Do(req)
+	resp, err := s.retry.Do(s.client, req, false)
 	if err != nil {
-		return nil, fmt.Errorf("uploading file: %w", err)
+		return nil, fmt.Errorf("failed to execute upload request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-	log.Printf("[Storage] Response Status: %s, Body: %s", resp.Status, string(body))
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("upload failed with status %s: %s", resp.Status, string(body))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
-	var response struct {
-		Key string `json:"Key"`
-		Id  string `json:"Id"`
-	}
-	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&response); err != nil {
-		return nil, fmt.Errorf("parsing response: %w", err)
-	}
+	log.Printf("[SupabaseStorage] Upload successful for %s. Status: %d", filename, resp.StatusCode)
 
 	return &FileInfo{
-		Key:         response.Key,
+		Key:         filename,
 		ContentType: contentType,
-		UpdatedAt:   time.Now(),
 	}, nil
 }
 
-// Download retrieves a file from storage
 func (s *SupabaseStorage) Download(ctx context.Context, key string) (io.ReadCloser, *FileInfo, error) {
-	// Remove any bucket name prefix from the key if it exists
-	key = strings.TrimPrefix(key, s.bucketName+"/")
-
-	url := fmt.Sprintf("%s/storage/v1/object/%s/%s",
-		s.projectURL,
-		s.bucketName,
-		path.Clean(key))
-
-	log.Printf("[Debug] Downloading from: %s", url)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	defer ObserveOperation(s.bucketName, "download", time.Now())
+	downloadURL := fmt.Sprintf("%s/storage/v1/object/authenticated/%s/%s", s.projectURL, s.bucketName, key)
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
 	if err != nil {
-		return nil, nil, fmt.Errorf("creating request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create download request: %w", err)
 	}
-
 	req.Header.Set("Authorization", "Bearer "+s.apiKey)
 
-	resp, err := s.client.Do(req)
+	resp, err := s.retry.Do(s.client, req, true)
 	if err != nil {
-		return nil, nil, fmt.Errorf("downloading file: %w", err)
+		return nil, nil, fmt.Errorf("%w: failed to execute download request: %v", ErrUpstream, err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode == http.StatusNotFound {
 		resp.Body.Close()
-		return nil, nil, fmt.Errorf("download failed: %s", resp.Status)
+		return nil, nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("%w: download failed with status %d: %s", ErrUpstream, resp.StatusCode, string(bodyBytes))
 	}
 
-	info := &FileInfo{
+	fileInfo := &FileInfo{
 		Key:         key,
 		Size:        resp.ContentLength,
 		ContentType: resp.Header.Get("Content-Type"),
-		UpdatedAt:   time.Now(),
+	}
+	lastModified := resp.Header.Get("Last-Modified")
+	if lastModified != "" {
+		tm, err := time.Parse(http.TimeFormat, lastModified)
+		if err == nil {
+			fileInfo.UpdatedAt = tm
+		}
 	}
 
-	return resp.Body, info, nil
+	return resp.Body, fileInfo, nil
 }
 
-// Delete removes a file from storage
-func (s *SupabaseStorage) Delete(ctx context.Context, key string) error {
-	url := fmt.Sprintf("%s/storage/v1/object/%s/%s",
-		s.projectURL,
-		s.bucketName,
-		path.Clean(key))
+// DownloadFrom retrieves a file starting at offset, letting an interrupted
+// stream be continued
+func (s *SupabaseStorage) DownloadFrom(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	return s.DownloadRange(ctx, key, offset, -1)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+// DownloadRange retrieves bytes start through end of a file, inclusive, by
+// forwarding a Range header. A negative end reads to the end of the file.
+func (s *SupabaseStorage) DownloadRange(ctx context.Context, key string, start, end int64) (io.ReadCloser, error) {
+	defer ObserveOperation(s.bucketName, "download_range", time.Now())
+	downloadURL := fmt.Sprintf("%s/storage/v1/object/authenticated/%s/%s", s.projectURL, s.bucketName, key)
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
 	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+		return nil, fmt.Errorf("failed to create download request: %w", err)
 	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	req.Header.Set("Range", RangeHeader(start, end))
 
+	resp, err := s.retry.Do(s.client, req, true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to execute download request: %v", ErrUpstream, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		return resp.Body, nil
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	case resp.StatusCode == http.StatusOK:
+		// The range was ignored; the body would repeat what was already sent
+		resp.Body.Close()
+		return nil, fmt.Errorf("download of %s from byte %d: %w", key, start, ErrRangeNotSupported)
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: ranged download failed with status %d", ErrUpstream, resp.StatusCode)
+	}
+}
+
+func (s *SupabaseStorage) Delete(ctx context.Context, key string) error {
+	defer ObserveOperation(s.bucketName, "delete", time.Now())
+	deleteURL := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.projectURL, s.bucketName, key)
+	payload := map[string][]string{"prefixes": {key}}
+	payloadBytes, _ := json.Marshal(payload)
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", deleteURL, bytes.NewReader(payloadBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create delete request: %w", err)
+	}
 	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := s.client.Do(req)
+	resp, err := s.retry.Do(s.client, req, false)
 	if err != nil {
-		return fmt.Errorf("deleting file: %w", err)
+		return fmt.Errorf("failed to execute delete request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("delete failed: %s", resp.Status)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("delete failed with status %d: %s", resp.StatusCode, string(bodyBytes))
 	}
-
+	log.Printf("[SupabaseStorage] Delete successful for key: %s", key)
 	return nil
 }
 
-// GetInfo retrieves file information from storage
+// GetInfo returns an object's metadata without downloading it. A missing
+// object is reported as ErrNotFound and a failed request as ErrUpstream, so
+// callers can tell the two apart.
 func (s *SupabaseStorage) GetInfo(ctx context.Context, key string) (*FileInfo, error) {
+	defer ObserveOperation(s.bucketName, "get_info", time.Now())
 	url := fmt.Sprintf("%s/storage/v1/object/info/%s/%s",
 		s.projectURL,
 		s.bucketName,
@@ -154,20 +205,183 @@ func (s *SupabaseStorage) GetInfo(ctx context.Context, key string) (*FileInfo, e
 
 	req.Header.Set("Authorization", "Bearer "+s.apiKey)
 
-	resp, err := s.client.Do(req)
+	resp, err := s.retry.Do(s.client, req, true)
 	if err != nil {
-		return nil, fmt.Errorf("getting file info: %w", err)
+		return nil, fmt.Errorf("%w: getting file info: %v", ErrUpstream, err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("getting info failed: %s", resp.Status)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading info for %s: %v", ErrUpstream, key, err)
+	}
+	// Supabase reports a missing object as 400 with a not_found body as well as 404
+	if resp.StatusCode == http.StatusNotFound ||
+		(resp.StatusCode == http.StatusBadRequest && bytes.Contains(bytes.ToLower(body), []byte("not_found"))) {
+		return nil, fmt.Errorf("%w: getting info %s: %s", ErrNotFound, key, resp.Status)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%w: getting info %s: %s: %s", ErrUpstream, key, resp.Status, string(body))
 	}
 
-	return &FileInfo{
-		Key:         key,
-		Size:        resp.ContentLength,
-		ContentType: resp.Header.Get("Content-Type"),
-		UpdatedAt:   time.Now(),
-	}, nil
+	// The size is in the JSON body; the response's own length says nothing
+	// about the object
+	var info objectInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("%w: decoding info for %s: %v", ErrUpstream, key, err)
+	}
+	fileInfo := &FileInfo{
+		Key:          key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		UpdatedAt:    info.LastModified,
+		CacheControl: info.CacheControl,
+	}
+	if m := info.Metadata; m != nil {
+		if fileInfo.Size == 0 {
+			fileInfo.Size = m.Size
+		}
+		if fileInfo.ContentType == "" {
+			fileInfo.ContentType = m.Mimetype
+		}
+		if fileInfo.UpdatedAt.IsZero() {
+			fileInfo.UpdatedAt = m.LastModified
+		}
+		if fileInfo.CacheControl == "" {
+			fileInfo.CacheControl = m.CacheControl
+		}
+	}
+	return fileInfo, nil
+}
+
+// objectInfo is Supabase's object info response. Older deployments only
+// report size and type inside metadata.
+type objectInfo struct {
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"contentType"`
+	LastModified time.Time `json:"lastModified"`
+	CacheControl string    `json:"cacheControl"`
+	Metadata     *struct {
+		Size         int64     `json:"size"`
+		Mimetype     string    `json:"mimetype"`
+		LastModified time.Time `json:"lastModified"`
+		CacheControl string    `json:"cacheControl"`
+	} `json:"metadata"`
+}
+
+// listedObject is an entry in Supabase's list response. Folders are listed
+// with a null id and no metadata.
+type listedObject struct {
+	ID        *string   `json:"id"`
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Metadata  *struct {
+		Size     int64  `json:"size"`
+		Mimetype string `json:"mimetype"`
+	} `json:"metadata"`
+}
+
+// ListFiles lists every object under prefix, descending into folders so
+// nested objects are returned under their full key. Each folder is read a
+// page at a time until a short page marks its end.
+func (s *SupabaseStorage) ListFiles(ctx context.Context, prefix string) ([]FileInfo, error) {
+	defer ObserveOperation(s.bucketName, "list", time.Now())
+	var files []FileInfo
+	folders := []string{prefix}
+	for len(folders) > 0 {
+		folder := folders[0]
+		folders = folders[1:]
+
+		for offset := 0; ; offset += s.listPageSize {
+			page, err := s.listPage(ctx, folder, s.listPageSize, offset)
+			if err != nil {
+				return nil, err
+			}
+			for _, o := range page {
+				key := path.Join(folder, o.Name)
+				if o.ID == nil {
+					folders = append(folders, key)
+					continue
+				}
+				info := FileInfo{Key: key, UpdatedAt: o.UpdatedAt}
+				if o.Metadata != nil {
+					info.Size = o.Metadata.Size
+					info.ContentType = o.Metadata.Mimetype
+				}
+				files = append(files, info)
+			}
+			if len(page) < s.listPageSize {
+				break
+			}
+		}
+	}
+	log.Printf("[SupabaseStorage] Listed %d objects under prefix %q", len(files), prefix)
+	return files, nil
+}
+
+// listPage returns up to limit entries directly under prefix, starting at offset
+func (s *SupabaseStorage) listPage(ctx context.Context, prefix string, limit, offset int) ([]listedObject, error) {
+	listURL := fmt.Sprintf("%s/storage/v1/object/list/%s", s.projectURL, s.bucketName)
+	payloadBytes, err := json.Marshal(map[string]interface{}{
+		"prefix": prefix,
+		"limit":  limit,
+		"offset": offset,
+		"sortBy": map[string]string{"column": "name", "order": "asc"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode list request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", listURL, bytes.NewReader(payloadBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create list request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.retry.Do(s.client, req, true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to execute list request: %v", ErrUpstream, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%w: list of %q failed with status %d: %s", ErrUpstream, prefix, resp.StatusCode, string(bodyBytes))
+	}
+
+	var page []listedObject
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("failed to decode list response: %w", err)
+	}
+	return page, nil
 }
+
+// Ping checks the bucket is reachable by reading its details, which is
+// cheaper than listing it
+func (s *SupabaseStorage) Ping(ctx context.Context) error {
+	bucketURL := fmt.Sprintf("%s/storage/v1/bucket/%s", s.projectURL, s.bucketName)
+	req, err := http.NewRequestWithContext(ctx, "GET", bucketURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create bucket request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: failed to execute bucket request: %v", ErrUpstream, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%w: bucket %s answered with status %d", ErrUpstream, s.bucketName, resp.StatusCode)
+	}
+	return nil
+}
+
+var (
+	_ StorageService  = (*SupabaseStorage)(nil)
+	_ Pinger          = (*SupabaseStorage)(nil)
+	_ Retrier         = (*SupabaseStorage)(nil)
+	_ RangeDownloader = (*SupabaseStorage)(nil)
+	_ RangeReader     = (*SupabaseStorage)(nil)
+)
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSupabaseGetInfo(t *testing.T) {
+	t.Run("Size comes from the info body", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"name":"big.img","metadata":{"size":5368709120,"mimetype":"application/x-iso9660-image"}}`)
+		}))
+		defer server.Close()
+
+		info, err := NewSupabaseStorage(server.URL, "key", "content").GetInfo(context.Background(), "big.img")
+		if err != nil {
+			t.Fatalf("GetInfo: %v", err)
+		}
+		if info.Size != 5368709120 || info.ContentType != "application/x-iso9660-image" {
+			t.Errorf("GetInfo returned %+v", info)
+		}
+	})
+
+	t.Run("Top-level fields win over metadata", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/storage/v1/object/info/content/apps/editor.zip" {
+				t.Errorf("Requested %s", r.URL.Path)
+			}
+			io.WriteString(w, `{"size":42,"contentType":"application/zip","cacheControl":"max-age=60",`+
+				`"metadata":{"size":1,"mimetype":"text/plain","cacheControl":"no-cache"}}`)
+		}))
+		defer server.Close()
+
+		info, err := NewSupabaseStorage(server.URL, "key", "content").GetInfo(context.Background(), "apps/editor.zip")
+		if err != nil {
+			t.Fatalf("GetInfo: %v", err)
+		}
+		if info.Size != 42 || info.ContentType != "application/zip" || info.CacheControl != "max-age=60" {
+			t.Errorf("GetInfo returned %+v", info)
+		}
+	})
+
+	t.Run("Missing object answered with 404", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		}))
+		defer server.Close()
+
+		_, err := NewSupabaseStorage(server.URL, "key", "content").GetInfo(context.Background(), "gone.img")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Other bad requests are not a missing object", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error":"invalid_jwt"}`, http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		_, err := NewSupabaseStorage(server.URL, "key", "content").GetInfo(context.Background(), "a.img")
+		if err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected an error other than ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Missing object", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error":"not_found"}`, http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		_, err := NewSupabaseStorage(server.URL, "key", "content").GetInfo(context.Background(), "gone.img")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestSupabaseListFiles(t *testing.T) {
+	// A bucket with three objects at the top level, more than a page, and a
+	// folder holding one more
+	listings := map[string][]string{
+		"":     {`{"id":"1","name":"a.zip","metadata":{"size":1,"mimetype":"application/zip"}}`, `{"id":"2","name":"b.zip","metadata":{"size":2}}`, `{"id":null,"name":"apps","metadata":null}`, `{"id":"3","name":"c.zip","metadata":{"size":3}}`},
+		"apps": {`{"id":"4","name":"editor.zip","metadata":{"size":4}}`},
+	}
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Method != http.MethodPost || r.URL.Path != "/storage/v1/object/list/content" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var req struct {
+			Prefix string `json:"prefix"`
+			Limit  int    `json:"limit"`
+			Offset int    `json:"offset"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Decoding list request: %v", err)
+		}
+		entries := listings[req.Prefix]
+		end := req.Offset + req.Limit
+		if end > len(entries) {
+			end = len(entries)
+		}
+		page := []string{}
+		if req.Offset < end {
+			page = entries[req.Offset:end]
+		}
+		io.WriteString(w, "["+strings.Join(page, ",")+"]")
+	}))
+	defer server.Close()
+
+	s := NewSupabaseStorage(server.URL, "key", "content")
+	s.SetListPageSize(2)
+	files, err := s.ListFiles(context.Background(), "")
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+
+	var keys []string
+	for _, f := range files {
+		keys = append(keys, f.Key)
+		if f.Key == "a.zip" && (f.Size != 1 || f.ContentType != "application/zip") {
+			t.Errorf("a.zip listed as %+v", f)
+		}
+	}
+	sort.Strings(keys)
+	if want := []string{"a.zip", "apps/editor.zip", "b.zip", "c.zip"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListFiles keys = %v, want %v", keys, want)
+	}
+	// Two full pages and an empty one for the root, one short page for apps
+	if requests != 4 {
+		t.Errorf("Made %d list requests, want 4", requests)
+	}
+}
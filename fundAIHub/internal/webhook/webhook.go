@@ -0,0 +1,305 @@
+// Package webhook delivers signed catalog change notifications to subscribed
+// endpoints.
+package webhook
+
+import (
+	"FundAIHub/internal/db"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Catalog events a subscription can listen for
+const (
+	EventContentCreated = "content.created"
+	EventContentUpdated = "content.updated"
+	EventContentDeleted = "content.deleted"
+)
+
+// Events lists every event a subscription may name
+var Events = []string{EventContentCreated, EventContentUpdated, EventContentDeleted}
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body, keyed
+// with the subscription secret and prefixed with "sha256="
+const SignatureHeader = "X-FundAIHub-Signature"
+
+// EventHeader names the event a delivery is for
+const EventHeader = "X-FundAIHub-Event"
+
+// Store is the persistence the dispatcher needs; *db.ContentStore satisfies it
+type Store interface {
+	ListWebhookSubscriptions(ctx context.Context, event string) ([]db.WebhookSubscription, error)
+	CreateWebhookDeadLetter(ctx context.Context, d *db.WebhookDeadLetter) error
+}
+
+// ContentSummary is the part of a content record sent to subscribers
+type ContentSummary struct {
+	ID         uuid.UUID `json:"id"`
+	Name       string    `json:"name"`
+	Version    string    `json:"version"`
+	AppType    string    `json:"app_type,omitempty"`
+	AppVersion string    `json:"app_version,omitempty"`
+	Size       int64     `json:"size"`
+	// Enabled is false once an admin has pulled the content from download
+	Enabled bool `json:"enabled"`
+}
+
+// Payload is the JSON body of every delivery
+type Payload struct {
+	Event      string         `json:"event"`
+	OccurredAt time.Time      `json:"occurred_at"`
+	Content    ContentSummary `json:"content"`
+}
+
+// queueSize is how many published events may wait for a worker; events
+// published while it is full are dropped
+const queueSize = 256
+
+// ErrForbiddenTarget is returned for webhook targets on loopback, private,
+// link-local or otherwise internal addresses, which include cloud metadata
+// endpoints
+var ErrForbiddenTarget = errors.New("webhook target is not a public address")
+
+// forbiddenIP reports whether ip is an address a webhook may not be sent to
+func forbiddenIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || sharedAddressSpace.Contains(ip)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, internal like the
+// private ranges
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// CheckTarget resolves host and returns ErrForbiddenTarget when any of its
+// addresses is internal, so a subscription can be refused when it is
+// registered. Deliveries are checked again when they connect, as DNS may
+// change in between.
+func CheckTarget(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if forbiddenIP(addr.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrForbiddenTarget, host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// delivery is a published event waiting for a worker
+type delivery struct {
+	event string
+	body  []byte
+}
+
+// Dispatcher fans events out to subscribers on a fixed number of workers,
+// retrying failed deliveries with exponential backoff. Nothing is delivered
+// until Run is called. A nil *Dispatcher is valid and drops every event.
+type Dispatcher struct {
+	store        Store
+	client       *http.Client
+	maxAttempts  int
+	baseDelay    time.Duration
+	workers      int
+	queue        chan delivery
+	allowPrivate bool
+}
+
+// NewDispatcher delivers events on workers goroutines, at least one
+func NewDispatcher(store Store, maxAttempts int, baseDelay time.Duration, workers int) *Dispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	d := &Dispatcher{
+		store:       store,
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+		workers:     workers,
+		queue:       make(chan delivery, queueSize),
+	}
+	// Every connection is checked, including those of redirects, and no
+	// proxy is used, so the address checked is the one dialled
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: d.checkDial}
+	d.client = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}
+	return d
+}
+
+// SetAllowPrivateTargets lets webhooks reach internal addresses, for
+// deployments whose subscribers are on the same private network
+func (d *Dispatcher) SetAllowPrivateTargets(allow bool) {
+	d.allowPrivate = allow
+}
+
+// checkDial refuses connections to internal addresses
+func (d *Dispatcher) checkDial(network, address string, _ syscall.RawConn) error {
+	if d.allowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || forbiddenIP(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, host)
+	}
+	return nil
+}
+
+// Run delivers published events until ctx is done. A delivery cut short by
+// ctx is recorded as a dead letter; events still queued are dropped.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < d.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-d.queue:
+					d.fanOut(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if dropped := len(d.queue); dropped > 0 {
+		log.Printf("[Webhook] Stopped with %d events undelivered", dropped)
+	}
+}
+
+// Sign returns the signature header value for body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Publish queues event for content and returns immediately; Run's workers
+// deliver it to subscribers.
+func (d *Dispatcher) Publish(event string, content *db.Content) {
+	if d == nil || content == nil {
+		return
+	}
+
+	payload := Payload{
+		Event:      event,
+		OccurredAt: time.Now().UTC(),
+		Content: ContentSummary{
+			ID:         content.ID,
+			Name:       content.Name,
+			Version:    content.Version,
+			AppType:    content.AppType,
+			AppVersion: content.AppVersion,
+			Size:       content.Size,
+			Enabled:    content.Enabled,
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("[Webhook] Failed to encode %s payload: %v", event, err)
+		return
+	}
+
+	select {
+	case d.queue <- delivery{event: event, body: body}:
+	default:
+		log.Printf("[Webhook] Queue full, dropping %s for %s", event, content.ID)
+	}
+}
+
+// fanOut delivers job to every subscriber of its event in turn
+func (d *Dispatcher) fanOut(ctx context.Context, job delivery) {
+	subs, err := d.store.ListWebhookSubscriptions(ctx, job.event)
+	if err != nil {
+		log.Printf("[Webhook] Failed to list subscriptions for %s: %v", job.event, err)
+		return
+	}
+	for _, sub := range subs {
+		d.deliver(ctx, sub, job.event, job.body)
+	}
+}
+
+// deliver posts body to sub until it succeeds or attempts run out, then
+// records a dead letter. A forbidden target is not retried.
+func (d *Dispatcher) deliver(ctx context.Context, sub db.WebhookSubscription, event string, body []byte) {
+	var lastErr error
+	attempts := 0
+	delay := d.baseDelay
+	for attempts < d.maxAttempts {
+		attempts++
+		if lastErr = d.post(ctx, sub, event, body); lastErr == nil {
+			return
+		}
+		log.Printf("[Webhook] Delivery of %s to %s failed (attempt %d/%d): %v",
+			event, sub.URL, attempts, d.maxAttempts, lastErr)
+		if errors.Is(lastErr, ErrForbiddenTarget) || ctx.Err() != nil || attempts == d.maxAttempts {
+			break
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+
+	dead := &db.WebhookDeadLetter{
+		SubscriptionID: sub.ID,
+		URL:            sub.URL,
+		Event:          event,
+		Payload:        body,
+		Attempts:       attempts,
+		LastError:      lastErr.Error(),
+	}
+	// Recorded even when shutting down, so the event can be redelivered
+	if err := d.store.CreateWebhookDeadLetter(context.WithoutCancel(ctx), dead); err != nil {
+		log.Printf("[Webhook] Failed to record dead letter for %s to %s: %v", event, sub.URL, err)
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, sub db.WebhookSubscription, event string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package webhook
+
+import (
+	"FundAIHub/internal/db"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type fakeStore struct {
+	subs []db.WebhookSubscription
+
+	mu   sync.Mutex
+	dead []*db.WebhookDeadLetter
+	done chan struct{}
+}
+
+func (s *fakeStore) ListWebhookSubscriptions(ctx context.Context, event string) ([]db.WebhookSubscription, error) {
+	return s.subs, nil
+}
+
+func (s *fakeStore) CreateWebhookDeadLetter(ctx context.Context, d *db.WebhookDeadLetter) error {
+	s.mu.Lock()
+	s.dead = append(s.dead, d)
+	s.mu.Unlock()
+	close(s.done)
+	return nil
+}
+
+// startDispatcher runs a dispatcher for the test, allowed to reach the
+// loopback test servers
+func startDispatcher(t *testing.T, store Store, maxAttempts int) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	d := NewDispatcher(store, maxAttempts, time.Millisecond, 2)
+	d.SetAllowPrivateTargets(true)
+	go d.Run(ctx)
+	return d
+}
+
+func TestPublishSignsPayload(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	store := &fakeStore{
+		subs: []db.WebhookSubscription{{ID: uuid.New(), URL: server.URL, Secret: "s3cret"}},
+		done: make(chan struct{}),
+	}
+	startDispatcher(t, store, 1).Publish(EventContentCreated, &db.Content{ID: uuid.New(), Name: "app"})
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		if got := r.Header.Get(EventHeader); got != EventContentCreated {
+			t.Errorf("event header = %q, want %q", got, EventContentCreated)
+		}
+		if got, want := r.Header.Get(SignatureHeader), Sign("s3cret", body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+}
+
+func TestPublishRetriesThenDeadLetters(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	store := &fakeStore{
+		subs: []db.WebhookSubscription{{ID: uuid.New(), URL: server.URL, Secret: "s"}},
+		done: make(chan struct{}),
+	}
+	startDispatcher(t, store, 3).Publish(EventContentDeleted, &db.Content{ID: uuid.New()})
+
+	select {
+	case <-store.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no dead letter recorded")
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("attempts = %d, want 3", got)
+	}
+	if store.dead[0].Attempts != 3 || store.dead[0].Event != EventContentDeleted {
+		t.Errorf("unexpected dead letter: %+v", store.dead[0])
+	}
+}
+
+func TestNilDispatcherIsNoop(t *testing.T) {
+	var d *Dispatcher
+	d.Publish(EventContentCreated, &db.Content{})
+}
+
+func TestPublishRefusesInternalTargets(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer server.Close()
+
+	store := &fakeStore{
+		subs: []db.WebhookSubscription{{ID: uuid.New(), URL: server.URL, Secret: "s"}},
+		done: make(chan struct{}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewDispatcher(store, 3, time.Millisecond, 1)
+	go d.Run(ctx)
+	d.Publish(EventContentCreated, &db.Content{ID: uuid.New()})
+
+	select {
+	case <-store.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no dead letter recorded")
+	}
+	if got := calls.Load(); got != 0 {
+		t.Errorf("Expected the loopback target not to be reached, got %d requests", got)
+	}
+	// Refused targets are not retried
+	if store.dead[0].Attempts != 1 || !strings.Contains(store.dead[0].LastError, ErrForbiddenTarget.Error()) {
+		t.Errorf("unexpected dead letter: %+v", store.dead[0])
+	}
+}
+
+func TestForbiddenIP(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":       true,
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"192.168.1.1":     true,
+		"169.254.169.254": true,
+		"100.64.0.1":      true,
+		"0.0.0.0":         true,
+		"::1":             true,
+		"fd00::1":         true,
+		"fe80::1":         true,
+		"::ffff:10.0.0.1": true,
+		"8.8.8.8":         false,
+		"2606:4700::1111": false,
+	}
+	for addr, want := range tests {
+		if got := forbiddenIP(net.ParseIP(addr)); got != want {
+			t.Errorf("forbiddenIP(%s) = %t, want %t", addr, got, want)
+		}
+	}
+}
+
+func TestRunStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := NewDispatcher(&fakeStore{}, 1, time.Millisecond, 3)
+	stopped := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(stopped)
+	}()
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after its context was cancelled")
+	}
+}
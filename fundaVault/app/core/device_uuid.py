@@ -0,0 +1,14 @@
+"""
+device_uuid.py
+
+Purpose: Derive the stable UUID other services key a device's records on.
+"""
+import uuid
+
+# Devices are stored by hardware hash, so the UUID is derived from it rather
+# than kept in a column. FundAIHub derives it the same way.
+DEVICE_UUID_NAMESPACE = uuid.uuid5(uuid.NAMESPACE_DNS, "devices.fundai")
+
+def device_uuid(hardware_id: str) -> str:
+    """Return the device UUID for a hardware hash, ignoring case and surrounding space."""
+    return str(uuid.uuid5(DEVICE_UUID_NAMESPACE, hardware_id.strip().lower()))
@@ -9,6 +9,7 @@ import logging
 from supabase import Client as SupabaseClient
 
 from app.db.database import get_db
+from app.core.device_uuid import device_uuid
 from app.schemas.auth import DeviceAuthRequest, DeviceAuthResponse # Import new schemas
 
 router = APIRouter()
@@ -93,7 +94,12 @@ async def authenticate_device(
         user_email = user_response.data[0]['email']
 
         logger.info(f"Device authentication successful: HardwareID=[{hardware_id}] UserID=[{user_id}]")
-        return DeviceAuthResponse(authenticated=True, user_id=user_id, email=user_email)
+        return DeviceAuthResponse(
+            authenticated=True,
+            user_id=user_id,
+            email=user_email,
+            device_uuid=device_uuid(hardware_id),
+        )
 
     except HTTPException as http_exc:
         # No db.rollback() needed here
@@ -12,3 +12,5 @@ class DeviceAuthResponse(BaseModel):
     authenticated: bool
     user_id: int
     email: str
+    # Stable ID FundAIHub keys download records on; see app.core.device_uuid
+    device_uuid: str
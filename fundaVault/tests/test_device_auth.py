@@ -0,0 +1,79 @@
+"""
+test_device_auth.py
+
+Purpose: Check the device UUID returned by /api/v1/auth/device.
+Run with: python -m unittest tests.test_device_auth
+"""
+import asyncio
+import importlib.util
+import unittest
+import uuid
+
+from app.core.device_uuid import device_uuid
+
+HARDWARE_ID = "0123456789abcdef" * 4
+# FundAIHub's middleware tests assert the same value
+EXPECTED_UUID = "7d22d75b-2a64-59d5-b1e9-fd38023c3a76"
+
+
+class DeviceUUIDTest(unittest.TestCase):
+    def test_stable(self):
+        self.assertEqual(device_uuid(HARDWARE_ID), EXPECTED_UUID)
+
+    def test_ignores_case_and_space(self):
+        self.assertEqual(device_uuid(" " + HARDWARE_ID.upper() + " "), EXPECTED_UUID)
+
+    def test_distinct_devices(self):
+        self.assertNotEqual(device_uuid(HARDWARE_ID), device_uuid("f" * 64))
+
+    def test_is_uuid(self):
+        self.assertEqual(uuid.UUID(device_uuid(HARDWARE_ID)).version, 5)
+
+
+class _Result:
+    def __init__(self, data):
+        self.data = data
+        self.error = None
+
+
+class _Query:
+    """Stands in for a supabase-py query, answering by table name."""
+    def __init__(self, rows):
+        self._rows = rows
+
+    def __getattr__(self, name):
+        return lambda *args, **kwargs: self
+
+    def execute(self):
+        return _Result(self._rows)
+
+
+class _FakeDB:
+    def __init__(self, tables):
+        self._tables = tables
+
+    def table(self, name):
+        return _Query(self._tables[name])
+
+
+@unittest.skipUnless(importlib.util.find_spec("fastapi") and importlib.util.find_spec("supabase"),
+                     "fastapi and supabase are not installed")
+class AuthenticateDeviceTest(unittest.TestCase):
+    def test_response_includes_device_uuid(self):
+        from app.endpoints.auth import authenticate_device
+        from app.schemas.auth import DeviceAuthRequest
+
+        db = _FakeDB({
+            "devices": [{"user_id": 7, "is_active": True}],
+            "subscriptions": [{"id": 1}],
+            "users": [{"email": "student@example.com"}],
+        })
+        resp = asyncio.run(authenticate_device(DeviceAuthRequest(hardware_id=HARDWARE_ID), db=db))
+
+        self.assertTrue(resp.authenticated)
+        self.assertEqual(resp.user_id, 7)
+        self.assertEqual(resp.device_uuid, EXPECTED_UUID)
+
+
+if __name__ == "__main__":
+    unittest.main()